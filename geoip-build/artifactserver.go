@@ -0,0 +1,211 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// artifactServer serves the files in a directory over HTTP,
+// along with a JSON index of them.
+type artifactServer struct {
+	dir string
+
+	mu    sync.RWMutex
+	index []*artifactIndexEntry
+	etags map[string]string
+}
+
+type artifactIndexEntry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	SHA256  string    `json:"sha256"`
+}
+
+func newArtifactServer(dir string) *artifactServer {
+	return &artifactServer{
+		dir:   dir,
+		index: []*artifactIndexEntry{},
+		etags: make(map[string]string),
+	}
+}
+
+// refresh rebuilds the index and the ETags of all files in the directory.
+// Hidden files and directories are skipped, e.g. the temporary files of the
+// outputs being written.
+func (s *artifactServer) refresh() error {
+	index := make([]*artifactIndexEntry, 0, 16)
+	etags := make(map[string]string)
+
+	err := filepath.WalkDir(s.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != s.dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		sum, err := sha256File(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.dir, p)
+		if err != nil {
+			return err
+		}
+		rel = "/" + filepath.ToSlash(rel)
+
+		index = append(index, &artifactIndexEntry{
+			Path:    rel,
+			Size:    info.Size(),
+			ModTime: info.ModTime().UTC(),
+			SHA256:  sum,
+		})
+		etags[rel] = `"` + sum + `"`
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(index, func(i, j int) bool {
+		return index[i].Path < index[j].Path
+	})
+
+	s.mu.Lock()
+	s.index = index
+	s.etags = etags
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *artifactServer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.index)
+}
+
+func (s *artifactServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := path.Clean("/" + r.URL.Path)
+	if isHiddenPath(name) {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := http.Dir(s.dir).Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.RLock()
+	etag := s.etags[name]
+	s.mu.RUnlock()
+	w.Header().Set("Vary", "Accept-Encoding")
+
+	gzipped := r.Header.Get("Range") == "" && strings.Contains(r.Header.Get("Accept-Encoding"), "gzip")
+	if etag != "" {
+		// The gzip body differs from the file, so is its ETag
+		if gzipped {
+			etag = strings.TrimSuffix(etag, `"`) + `-gz"`
+		}
+		w.Header().Set("ETag", etag)
+	}
+
+	if gzipped {
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.Close()
+		w = gw
+	}
+
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// isHiddenPath reports whether any element of the slash-separated path name
+// is hidden, i.e. starts with a dot.
+func isHiddenPath(name string) bool {
+	for _, elem := range strings.Split(name, "/") {
+		if strings.HasPrefix(elem, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter compresses the response body with gzip lazily,
+// so that responses without body (e.g. 304 Not Modified) are left untouched.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gw *gzip.Writer
+}
+
+func (g *gzipResponseWriter) WriteHeader(code int) {
+	if code == http.StatusOK {
+		g.Header().Del("Content-Length")
+		g.Header().Set("Content-Encoding", "gzip")
+		g.gw = gzip.NewWriter(g.ResponseWriter)
+	}
+	g.ResponseWriter.WriteHeader(code)
+}
+
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	if g.gw == nil {
+		return g.ResponseWriter.Write(b)
+	}
+	return g.gw.Write(b)
+}
+
+func (g *gzipResponseWriter) Close() error {
+	if g.gw == nil {
+		return nil
+	}
+	return g.gw.Close()
+}
+
+func sha256File(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
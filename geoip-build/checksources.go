@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Loyalsoldier/geoip/lib"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(checkSourcesCmd)
+	checkSourcesCmd.Flags().StringP("config", "c", "config.json", "URI of the JSON, YAML or TOML format config file, support both local file path and remote HTTP(S) URL")
+	checkSourcesCmd.MarkFlagFilename("config", "json", "yaml", "yml", "toml")
+	checkSourcesCmd.Flags().DurationP("timeout", "t", 30*time.Second, "Timeout of checking each source")
+}
+
+var checkSourcesCmd = &cobra.Command{
+	Use:     "check-sources",
+	Aliases: []string{"check"},
+	Short:   "Check whether all remote sources referenced by the inputs of config file are reachable",
+	Run: func(cmd *cobra.Command, args []string) {
+		configFile, _ := cmd.Flags().GetString("config")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		log.Println("Use config:", configFile)
+
+		content, err := lib.ReadConfig(configFile)
+		if err != nil {
+			fatal(err)
+		}
+
+		sources, err := lib.ConfigSources(content)
+		if err != nil {
+			fatal(err)
+		}
+		if len(sources) == 0 {
+			log.Println("No remote source found in config")
+			return
+		}
+
+		client := &http.Client{Timeout: timeout, Transport: lib.SourceTransport()}
+		results := make([]*sourceResult, 0, len(sources))
+		failed := 0
+		for _, source := range sources {
+			result := checkSource(client, source)
+			if (!result.OK || result.Stale && source.Freshness.OnStale == lib.StaleActionFail) && !result.Optional {
+				failed++
+			}
+			results = append(results, result)
+		}
+
+		if isJSONOutput(cmd) {
+			printJSON(results)
+		} else {
+			printSourceResults(results)
+		}
+
+		if failed > 0 {
+			fatalf("❌ %d of %d required sources are unreachable or stale", failed, len(sources))
+		}
+		log.Printf("✅ all required sources of %d sources are reachable", len(sources))
+	},
+}
+
+type sourceResult struct {
+	Type         string `json:"type"`
+	URL          string `json:"url"`
+	Optional     bool   `json:"optional"`
+	OK           bool   `json:"ok"`
+	Status       string `json:"status"`
+	Size         int64  `json:"size"`
+	LastModified string `json:"lastModified,omitempty"`
+	Stale        bool   `json:"stale"`
+}
+
+// checkSource sends a HEAD request to the URL of source, and falls back to GET
+// for servers that do not support HEAD requests.
+func checkSource(client *http.Client, source *lib.Source) *sourceResult {
+	result := &sourceResult{
+		Type:     source.Type,
+		URL:      source.URL,
+		Optional: source.Optional,
+		Size:     -1,
+	}
+
+	resp, err := client.Head(source.URL)
+	if err == nil && resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		resp, err = client.Get(source.URL)
+	}
+	if err != nil {
+		result.Status = err.Error()
+		return result
+	}
+	resp.Body.Close()
+
+	result.OK = resp.StatusCode == http.StatusOK
+	result.Status = resp.Status
+	result.Size = resp.ContentLength
+	result.LastModified = resp.Header.Get("Last-Modified")
+	if lastModified, err := http.ParseTime(result.LastModified); err == nil && source.Freshness != nil {
+		result.Stale = source.Freshness.Stale(lastModified, time.Now())
+	}
+
+	return result
+}
+
+func printSourceResults(results []*sourceResult) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tURL\tSTATUS\tSIZE\tLAST-MODIFIED\t")
+	for _, r := range results {
+		status, size, lastModified := r.Status, "-", "-"
+		if !r.OK {
+			status = "❌ " + status
+			if r.Optional {
+				status = "⚠️ " + r.Status + " (optional)"
+			}
+		}
+		if r.OK && r.Stale {
+			status = "⚠️ " + status + " (stale)"
+		}
+		if r.OK && r.Size >= 0 {
+			size = strconv.FormatInt(r.Size, 10)
+		}
+		if r.LastModified != "" {
+			lastModified = r.LastModified
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t\n", r.Type, r.URL, status, size, lastModified)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/Loyalsoldier/geoip/lib"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configSchemaCmd)
+	configCmd.AddCommand(configMigrateCmd)
+	configMigrateCmd.Flags().StringP("write", "w", "", "Path to write the migrated config to instead of stdout")
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Tools for config file",
+}
+
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of config file generated from all available input and output formats",
+	Run: func(cmd *cobra.Command, args []string) {
+		printJSON(lib.ConfigSchema())
+	},
+}
+
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate <upstream-config>",
+	Short: "Convert a config file of the upstream Loyalsoldier/geoip project to the format of this project, reporting the unsupported options",
+	Long: "Convert a config file of the upstream Loyalsoldier/geoip project, given as a local file path or remote HTTP(S) URL, to the format of this project.\n" +
+		"The input and output types and args that are not supported are dropped and reported, so that they can be replaced by hand.\n" +
+		"The upstream geosite projects are configured by flags instead of config files, which are accepted by geosite-build as is.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		r, err := lib.OpenURI(context.Background(), args[0])
+		if err != nil {
+			fatal(err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			fatal(err)
+		}
+
+		migrated, issues, err := lib.MigrateConfig(content)
+		if err != nil {
+			fatal(err)
+		}
+
+		writePath, _ := cmd.Flags().GetString("write")
+		if writePath != "" {
+			if err := os.WriteFile(writePath, migrated, lib.FileMode()); err != nil {
+				fatal(err)
+			}
+		}
+
+		if isJSONOutput(cmd) {
+			result := struct {
+				Config any                 `json:"config,omitempty"`
+				Issues []*lib.MigrateIssue `json:"issues"`
+			}{Issues: issues}
+			if writePath == "" {
+				result.Config = json.RawMessage(migrated)
+			}
+			printJSON(result)
+			return
+		}
+
+		for _, issue := range issues {
+			slog.Warn(fmt.Sprintf("⚠️ %s", issue), "path", issue.Path)
+		}
+		if writePath == "" {
+			os.Stdout.Write(migrated)
+		} else {
+			slog.Info(fmt.Sprintf("✅ migrated config is written to %s with %d issues", writePath, len(issues)), "path", writePath, "issues", len(issues))
+		}
+	},
+}
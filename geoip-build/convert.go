@@ -1,7 +1,15 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"log/slog"
+	"net/netip"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
 
 	"github.com/Loyalsoldier/geoip/lib"
 	"github.com/spf13/cobra"
@@ -9,7 +17,35 @@ import (
 
 func init() {
 	rootCmd.AddCommand(convertCmd)
-	convertCmd.PersistentFlags().StringP("config", "c", "config.json", "URI of the JSON format config file, support both local file path and remote HTTP(S) URL")
+	convertCmd.PersistentFlags().StringArrayP("config", "c", []string{"config.json"}, "URI of the JSON, YAML or TOML format config file, support both local file path and remote HTTP(S) URL. Can be used multiple times or be a directory of config files, which are built one by one downloading their shared remote sources only once, and the paths of the files written for each of them must contain \""+configPlaceholder+"\" replaced with the name of the config file")
+	convertCmd.MarkPersistentFlagFilename("config", "json", "yaml", "yml", "toml")
+	convertCmd.PersistentFlags().Bool("verify", false, "Re-read every written output and check it against the lists in memory after converting")
+	convertCmd.PersistentFlags().Bool("dry-run", false, "Process all inputs and outputs, and print what would be written without writing any file")
+	convertCmd.PersistentFlags().StringArray("set", []string{}, "Override a value in config file in the form of path=value, e.g. \"output.0.outputDir=./dist\", can be used multiple times")
+	convertCmd.PersistentFlags().StringSlice("only-output", []string{}, "Only run the outputs of the specified types in config file, separated by comma")
+	convertCmd.PersistentFlags().String("attributions", "", "Path to the file of the licenses and attributions declared by the inputs in config file, e.g. \"./output/ATTRIBUTIONS\"")
+	convertCmd.PersistentFlags().String("manifest", "", "Path to the JSON manifest of all written outputs and the versions of remote sources, e.g. \"./output/version.json\"")
+	convertCmd.PersistentFlags().String("checksums", "", "Path to the sha256sum compatible checksum file of all written outputs, e.g. \"./output/SHA256SUMS\"")
+	convertCmd.PersistentFlags().Bool("checksum-files", false, "Write a \".sha256\" checksum file next to each written output")
+	convertCmd.PersistentFlags().String("sign", "", "Sign every written output with a detached signature by the tool, available options: \"minisign\", \"gpg\"")
+	convertCmd.PersistentFlags().String("sign-key", "", "Path to the secret key file for minisign, or the key ID for gpg, passphrase of which is read from the "+lib.SignPassphraseEnv+" environment variable")
+	convertCmd.PersistentFlags().StringArray("notify-webhook", []string{}, "URL to POST the JSON report of the build to when converting completes, can be used multiple times")
+	convertCmd.PersistentFlags().String("notify-telegram-chat", "", "ID of the Telegram chat to send the report of the build to when converting completes, token of the bot is read from the "+lib.TelegramBotTokenEnv+" environment variable")
+	convertCmd.PersistentFlags().String("notify-on", lib.NotifyAlways, "When to send notifications, available options: \"always\", \"success\", \"failure\"")
+	convertCmd.PersistentFlags().String("metrics-file", "", "Path to the Prometheus textfile of the metrics of the build, e.g. for the textfile collector of node_exporter")
+	convertCmd.PersistentFlags().String("metrics-push", "", "URL of the Prometheus Pushgateway to push the metrics of the build to, e.g. \"http://localhost:9091\"")
+	convertCmd.PersistentFlags().String("metrics-job", "geoip", "Job label of the metrics pushed to the Pushgateway")
+	convertCmd.PersistentFlags().Int("max-failures", 0, "Number of failed inputs not marked as optional to be skipped before converting fails")
+	convertCmd.PersistentFlags().IntP("jobs", "j", runtime.NumCPU(), "Number of inputs to parse concurrently, 1 to parse them one by one")
+	convertCmd.PersistentFlags().Int("output-jobs", runtime.NumCPU(), "Number of outputs to write concurrently, 1 to write them one by one")
+	convertCmd.PersistentFlags().String("max-memory", "", "Memory the conversion should fit in, e.g. \"512MB\", lists are spilled to a temporary file and inputs and outputs run one by one")
+	convertCmd.PersistentFlags().String("incremental", "", "Path to the state file of incremental builds, outputs whose config and inputs are unchanged since the last build are skipped")
+	convertCmd.PersistentFlags().String("state", "", "Path to the state file of the checksums of all artifacts, the build exits with code 7 without sending notifications if no artifact is changed since the last build")
+	convertCmd.PersistentFlags().String("changelog", "", "Path to the markdown changelog of the lists changed since the last build of the state file, e.g. for release notes, requires state")
+	convertCmd.PersistentFlags().String("as-of", "", "Date to build the outputs as of in the format of \"2006-01-02\", with the remote sources of the inputs substituted with their archived versions by the \"archive\" URL templates of the inputs, which the inputs with remote sources must have, and the date embedded in the manifest")
+	convertCmd.PersistentFlags().String("invalid-lines-report", "", "Path to the JSON report of the invalid lines of the sources of the inputs with their line numbers, contents and reasons, written whether converting fails or not")
+	convertCmd.PersistentFlags().String("parse-cache", "", "Directory to cache the parsed inputs in, keyed by the content hash of their sources, so that unchanged sources are not parsed again")
+	convertCmd.MarkFlagsMutuallyExclusive("verify", "dry-run")
 }
 
 var convertCmd = &cobra.Command{
@@ -17,20 +53,288 @@ var convertCmd = &cobra.Command{
 	Aliases: []string{"conv"},
 	Short:   "Convert geoip data from one format to another by using config file",
 	Run: func(cmd *cobra.Command, args []string) {
-		configFile, _ := cmd.Flags().GetString("config")
-		log.Println("Use config:", configFile)
+		configValues, _ := cmd.Flags().GetStringArray("config")
+		configFiles, err := lib.ConfigFiles(configValues)
+		if err != nil {
+			fatal(err)
+		}
+		if len(configFiles) > 1 {
+			for _, flag := range configPathFlags {
+				if value, _ := cmd.Flags().GetString(flag); value != "" && !strings.Contains(value, configPlaceholder) {
+					fatalf("invalid argument %s: must contain %s to be written for each of the %d config files", flag, configPlaceholder, len(configFiles))
+				}
+			}
+		}
+
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			lib.SetDryRun(true)
+		}
+		if date, _ := cmd.Flags().GetString("as-of"); date != "" {
+			if err := lib.SetAsOf(date); err != nil {
+				fatal(fmt.Errorf("invalid argument as-of: %v", err))
+			}
+			slog.Info("🕰️ build as of "+lib.AsOf(), "asOf", lib.AsOf())
+		}
+
+		signer, err := newSigner(cmd)
+		if err != nil {
+			fatal(err)
+		}
 
-		instance, err := lib.NewInstance()
+		notifier, err = newNotifier(cmd)
 		if err != nil {
-			log.Fatal(err)
+			fatal(err)
+		}
+
+		// The remote sources shared by the configs are downloaded only once
+		if len(configFiles) > 1 {
+			lib.EnableDownloadCache()
+			defer lib.RemoveDownloadCache()
+		}
+
+		changed := false
+		summaries := make([]*lib.Summary, 0, len(configFiles))
+		for _, configFile := range configFiles {
+			summary, configChanged := runConvert(cmd, configFile, signer)
+			summaries = append(summaries, summary)
+			changed = changed || configChanged
 		}
 
-		if err := instance.Init(configFile); err != nil {
-			log.Fatal(err)
+		if isJSONOutput(cmd) {
+			if len(summaries) == 1 {
+				printJSON(summaries[0])
+			} else {
+				printJSON(summaries)
+			}
 		}
 
-		if err := instance.Run(); err != nil {
-			log.Fatal(err)
+		if !changed {
+			lib.RemoveDownloadCache()
+			stopProfiling()
+			os.Exit(lib.ExitCodeUnchanged)
 		}
 	},
 }
+
+// configPlaceholder is replaced with the name of each config file in the
+// paths of configPathFlags, e.g. "./output/{config}/version.json".
+const configPlaceholder = "{config}"
+
+// configPathFlags are the flags of the files written for each config file,
+// which must contain configPlaceholder if there are more than one.
+var configPathFlags = []string{"attributions", "manifest", "checksums", "metrics-file", "incremental", "state", "changelog", "invalid-lines-report"}
+
+// configPath returns the value of flag of cmd for configFile.
+func configPath(cmd *cobra.Command, flag, configFile string) string {
+	value, _ := cmd.Flags().GetString(flag)
+	return strings.ReplaceAll(value, configPlaceholder, lib.ConfigName(configFile))
+}
+
+// runConvert converts geoip data by using configFile with the flags of cmd,
+// and returns the summary of the build and whether any artifact is changed
+// since the last build of the state file.
+func runConvert(cmd *cobra.Command, configFile string, signer *lib.Signer) (*lib.Summary, bool) {
+	log.Println("Use config:", configFile)
+
+	var err error
+	pushURL, _ := cmd.Flags().GetString("metrics-push")
+	job, _ := cmd.Flags().GetString("metrics-job")
+	metricsExporter, err = lib.NewMetricsExporter(configPath(cmd, "metrics-file", configFile), pushURL, job)
+	if err != nil {
+		fatal(err)
+	}
+	runConfig, runStart = configFile, time.Now()
+	invalidLinesFile = configPath(cmd, "invalid-lines-report", configFile)
+
+	instance, err := lib.NewInstance()
+	if err != nil {
+		fatal(err)
+	}
+	runInstance = instance
+
+	content, err := lib.ReadConfig(configFile)
+	if err != nil {
+		fatal(err)
+	}
+
+	overrides, _ := cmd.Flags().GetStringArray("set")
+	onlyOutputs, _ := cmd.Flags().GetStringSlice("only-output")
+	content, err = lib.OverrideConfig(content, overrides, onlyOutputs)
+	if err != nil {
+		fatal(err)
+	}
+
+	if err := instance.InitFromBytes(content); err != nil {
+		fatal(err)
+	}
+
+	maxFailures, _ := cmd.Flags().GetInt("max-failures")
+	instance.SetMaxFailures(maxFailures)
+	jobs, _ := cmd.Flags().GetInt("jobs")
+	instance.SetConcurrency(jobs)
+	outputJobs, _ := cmd.Flags().GetInt("output-jobs")
+	instance.SetOutputConcurrency(outputJobs)
+	maxMemory, err := maxMemoryFlag(cmd)
+	if err != nil {
+		fatal(err)
+	}
+	instance.SetMaxMemory(maxMemory)
+	if cacheDir, _ := cmd.Flags().GetString("parse-cache"); cacheDir != "" {
+		cache, err := lib.NewParseCache(cacheDir)
+		if err != nil {
+			fatal(err)
+		}
+		instance.SetParseCache(cache)
+	}
+	if stateFile := configPath(cmd, "incremental", configFile); stateFile != "" {
+		incremental, err := lib.NewIncremental(stateFile)
+		if err != nil {
+			fatal(err)
+		}
+		instance.SetIncremental(incremental)
+	}
+
+	var buildState *lib.BuildState
+	if stateFile := configPath(cmd, "state", configFile); stateFile != "" {
+		if buildState, err = lib.NewBuildState(stateFile); err != nil {
+			fatal(err)
+		}
+	}
+	changelogFile := configPath(cmd, "changelog", configFile)
+	if changelogFile != "" && buildState == nil {
+		fatal(fmt.Errorf("invalid argument changelog: must be used with state"))
+	}
+
+	if err := instance.Run(cmd.Context()); err != nil {
+		fatal(err)
+	}
+	if invalidLinesFile != "" {
+		if err := instance.WriteInvalidLines(invalidLinesFile); err != nil {
+			fatal(err)
+		}
+	}
+
+	// Only the artifacts of output converters are compared, as the
+	// manifest and the like embed the build time
+	changed := true
+	if buildState != nil {
+		artifacts := lib.Artifacts()
+		changed = buildState.Changed(artifacts)
+
+		var lists map[string][]netip.Prefix
+		if changelogFile != "" {
+			if lists, err = instance.ListPrefixes(); err != nil {
+				fatal(err)
+			}
+			if err := lib.WriteChangelog(changelogFile, buildState.Changelog(lists)); err != nil {
+				fatal(err)
+			}
+		}
+
+		if changed || lists != nil && !buildState.HasLists() {
+			if err := buildState.Save(artifacts, lists); err != nil {
+				fatal(err)
+			}
+		}
+	}
+
+	if attributions := configPath(cmd, "attributions", configFile); attributions != "" {
+		if err := instance.WriteAttributions(attributions); err != nil {
+			fatal(err)
+		}
+	}
+
+	if manifest := configPath(cmd, "manifest", configFile); manifest != "" {
+		if err := instance.WriteManifest(manifest); err != nil {
+			fatal(err)
+		}
+	}
+
+	checksums := configPath(cmd, "checksums", configFile)
+	checksumFiles, _ := cmd.Flags().GetBool("checksum-files")
+	if err := lib.WriteChecksums(checksums, checksumFiles); err != nil {
+		fatal(err)
+	}
+
+	if signer != nil {
+		if err := signer.SignArtifacts(); err != nil {
+			fatal(err)
+		}
+	}
+
+	if verify, _ := cmd.Flags().GetBool("verify"); verify {
+		if err := instance.Verify(cmd.Context()); err != nil {
+			fatal(err)
+		}
+	}
+
+	summary, err := instance.Summary()
+	if err != nil {
+		fatal(err)
+	}
+	if changed {
+		if err := notifier.Notify(lib.NewBuildReport(configFile, runStart, summary, nil, nil)); err != nil {
+			slog.Error("❌ failed to send notifications: "+err.Error(), "config", configFile)
+		}
+	} else {
+		slog.Info("⏭️ no artifact is changed since the last build, notifications are skipped", "state", buildState.File)
+	}
+	if err := metricsExporter.Export(instance, runStart, nil); err != nil {
+		slog.Error("❌ failed to export metrics: "+err.Error(), "config", configFile)
+	}
+
+	if !isJSONOutput(cmd) {
+		if err := instance.PrintSummary(os.Stderr); err != nil {
+			fatal(err)
+		}
+	}
+
+	return summary, changed
+}
+
+// newSigner returns the signer specified by the flags of cmd, or nil if signing is not enabled.
+func newSigner(cmd *cobra.Command) (*lib.Signer, error) {
+	tool, _ := cmd.Flags().GetString("sign")
+	key, _ := cmd.Flags().GetString("sign-key")
+	if tool == "" {
+		if key != "" {
+			return nil, fmt.Errorf("invalid argument sign-key: must be used with sign")
+		}
+		return nil, nil
+	}
+	return lib.NewSigner(tool, key)
+}
+
+// newNotifier returns the notifier specified by the flags of cmd, or nil if notifications are not enabled.
+func newNotifier(cmd *cobra.Command) (*lib.Notifier, error) {
+	webhooks, _ := cmd.Flags().GetStringArray("notify-webhook")
+	chatID, _ := cmd.Flags().GetString("notify-telegram-chat")
+	on, _ := cmd.Flags().GetString("notify-on")
+	return lib.NewNotifier(webhooks, os.Getenv(lib.TelegramBotTokenEnv), chatID, on)
+}
+
+// newMetricsExporter returns the metrics exporter specified by the flags of cmd, or nil if metrics are not enabled.
+func newMetricsExporter(cmd *cobra.Command) (*lib.MetricsExporter, error) {
+	file, _ := cmd.Flags().GetString("metrics-file")
+	pushURL, _ := cmd.Flags().GetString("metrics-push")
+	job, _ := cmd.Flags().GetString("metrics-job")
+	return lib.NewMetricsExporter(file, pushURL, job)
+}
+
+// maxMemoryFlag returns the memory limit in bytes specified by the flags of
+// cmd, or 0 if there is no limit, and sets it as the soft memory limit of the
+// Go runtime.
+func maxMemoryFlag(cmd *cobra.Command) (int64, error) {
+	value, _ := cmd.Flags().GetString("max-memory")
+	if value == "" {
+		return 0, nil
+	}
+	n, err := lib.ParseSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid argument max-memory: %v", err)
+	}
+	if n > 0 {
+		debug.SetMemoryLimit(n)
+	}
+	return n, nil
+}
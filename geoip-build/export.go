@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/Loyalsoldier/geoip/lib"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().StringP("uri", "u", "", "(Required) URI of the V2Ray GeoIP dat file, support both local file path and remote HTTP(S) URL")
+	exportCmd.Flags().StringP("outputdir", "o", "./export", "Path to the output directory")
+	exportCmd.Flags().StringSliceP("wantedlist", "l", []string{}, "The lists to export, separated by comma")
+	exportCmd.Flags().StringP("onlyiptype", "t", "", "The only IP type to output, available options: \"ipv4\", \"ipv6\"")
+
+	exportCmd.MarkFlagRequired("uri")
+	exportCmd.MarkFlagDirname("outputdir")
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export each list of V2Ray GeoIP dat file to plaintext CIDR file",
+	Run: func(cmd *cobra.Command, args []string) {
+		uri, _ := cmd.Flags().GetString("uri")
+		outputDir, _ := cmd.Flags().GetString("outputdir")
+		wantedList, _ := cmd.Flags().GetStringSlice("wantedlist")
+		otype, _ := cmd.Flags().GetString("onlyiptype")
+
+		config, err := generateConfigForExport(uri, outputDir, wantedList, lib.IPType(otype))
+		if err != nil {
+			fatal(err)
+		}
+
+		instance, err := lib.NewInstance()
+		if err != nil {
+			fatal(err)
+		}
+
+		if err := instance.InitFromBytes(config); err != nil {
+			fatal(err)
+		}
+
+		if err := instance.Run(cmd.Context()); err != nil {
+			fatal(err)
+		}
+	},
+}
+
+func generateConfigForExport(uri, outputDir string, wantedList []string, otype lib.IPType) ([]byte, error) {
+	type convConfig struct {
+		Type   string         `json:"type"`
+		Action lib.Action     `json:"action"`
+		Args   map[string]any `json:"args"`
+	}
+
+	config := struct {
+		Input  []convConfig `json:"input"`
+		Output []convConfig `json:"output"`
+	}{
+		Input: []convConfig{
+			{
+				Type:   "v2rayGeoIPDat",
+				Action: lib.ActionAdd,
+				Args: map[string]any{
+					"uri":        uri,
+					"wantedList": wantedList,
+				},
+			},
+		},
+		Output: []convConfig{
+			{
+				Type:   "text",
+				Action: lib.ActionOutput,
+				Args: map[string]any{
+					"outputDir":  outputDir,
+					"onlyIPType": otype,
+				},
+			},
+		},
+	}
+
+	return json.Marshal(config)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/Loyalsoldier/geoip/lib"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(graphCmd)
+	graphCmd.PersistentFlags().StringP("config", "c", "config.json", "URI of the JSON, YAML or TOML format config file, support both local file path and remote HTTP(S) URL")
+	graphCmd.MarkPersistentFlagFilename("config", "json", "yaml", "yml", "toml")
+}
+
+var graphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Print how the lists are composed by the inputs of config file, in Graphviz DOT format or JSON format with --output json",
+	Run: func(cmd *cobra.Command, args []string) {
+		configFile, _ := cmd.Flags().GetString("config")
+		log.Println("Use config:", configFile)
+
+		instance, err := lib.NewInstance()
+		if err != nil {
+			fatal(err)
+		}
+
+		if err := instance.Init(configFile); err != nil {
+			fatal(err)
+		}
+
+		instance.EnableProvenance()
+		if _, err := instance.RunInput(cmd.Context()); err != nil {
+			fatal(err)
+		}
+
+		graph := instance.Provenance().Graph()
+		if isJSONOutput(cmd) {
+			err = graph.WriteJSON(os.Stdout)
+		} else {
+			err = graph.WriteDOT(os.Stdout)
+		}
+		if err != nil {
+			fatal(err)
+		}
+	},
+}
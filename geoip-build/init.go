@@ -1,6 +1,7 @@
 package main
 
 import (
+	_ "github.com/Loyalsoldier/geoip/plugin/firewall"
 	_ "github.com/Loyalsoldier/geoip/plugin/maxmind"
 	_ "github.com/Loyalsoldier/geoip/plugin/plaintext"
 	_ "github.com/Loyalsoldier/geoip/plugin/special"
@@ -0,0 +1,119 @@
+package lib
+
+import "sort"
+
+const (
+	ArgTypeString        ArgType = "string"
+	ArgTypeBool          ArgType = "bool"
+	ArgTypeInt           ArgType = "int"
+	ArgTypeStringList    ArgType = "[]string"
+	ArgTypeStringListMap ArgType = "map[string][]string"
+)
+
+// ArgType is the type of the value of an argument in config.
+type ArgType string
+
+// Arg describes an argument accepted in the `args` of a converter in config.
+type Arg struct {
+	Name        string   `json:"name"`
+	Type        ArgType  `json:"type"`
+	Description string   `json:"description"`
+	Required    bool     `json:"required,omitempty"`
+	Default     string   `json:"default,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+}
+
+// Argumenter is implemented by converters that describe their arguments.
+type Argumenter interface {
+	GetArgs() []Arg
+}
+
+// Common arguments shared by many converters.
+var (
+	ArgOnlyIPType = Arg{
+		Name:        "onlyIPType",
+		Type:        ArgTypeString,
+		Description: "The only IP type to be processed",
+		Enum:        []string{string(IPv4), string(IPv6)},
+	}
+	ArgWantedList = Arg{
+		Name:        "wantedList",
+		Type:        ArgTypeStringList,
+		Description: "The lists to be processed, others are ignored. Supports glob patterns like \"category-*\" and regular expressions enclosed in slashes like \"/^(cn|hk|mo)$/\" and presets like \"preset:cn-full\"",
+	}
+	ArgExcludedList = Arg{
+		Name:        "excludedList",
+		Type:        ArgTypeStringList,
+		Description: "The lists to be ignored. Supports glob patterns like \"category-*\" and regular expressions enclosed in slashes like \"/^(cn|hk|mo)$/\" and presets like \"preset:cn-full\"",
+	}
+	ArgOutputDir = Arg{
+		Name:        "outputDir",
+		Type:        ArgTypeString,
+		Description: "The directory of the output files",
+	}
+	ArgOutputName = Arg{
+		Name:        "outputName",
+		Type:        ArgTypeString,
+		Description: "The name of the output file",
+	}
+	ArgURI = Arg{
+		Name:        "uri",
+		Type:        ArgTypeString,
+		Description: "Local file path or remote HTTP(S) URL of the input file",
+	}
+)
+
+// WithDefault returns a copy of the argument with the default value set.
+func (a Arg) WithDefault(value string) Arg {
+	a.Default = value
+	return a
+}
+
+// WithRequired returns a copy of the argument marked as required.
+func (a Arg) WithRequired() Arg {
+	a.Required = true
+	return a
+}
+
+// ConverterInfo describes a registered converter.
+type ConverterInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Args        []Arg  `json:"args"`
+}
+
+// InputConverterInfos returns the information of all registered input converters sorted by name.
+func InputConverterInfos() []*ConverterInfo {
+	list := make([]*ConverterInfo, 0, len(inputConverterMap))
+	for name, c := range inputConverterMap {
+		list = append(list, newConverterInfo(name, c))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// OutputConverterInfos returns the information of all registered output converters sorted by name.
+func OutputConverterInfos() []*ConverterInfo {
+	list := make([]*ConverterInfo, 0, len(outputConverterMap))
+	for name, c := range outputConverterMap {
+		list = append(list, newConverterInfo(name, c))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+func newConverterInfo(name string, c Descriptioner) *ConverterInfo {
+	info := &ConverterInfo{
+		Name:        name,
+		Description: c.GetDescription(),
+		Args:        []Arg{},
+	}
+	if argumenter, ok := c.(Argumenter); ok {
+		info.Args = argumenter.GetArgs()
+	}
+	return info
+}
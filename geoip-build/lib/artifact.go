@@ -0,0 +1,243 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+var (
+	artifactMu   sync.Mutex
+	artifactList = make([]*Artifact, 0, 16)
+
+	dryRun bool
+)
+
+// Artifact describes a file written by an output converter.
+type Artifact struct {
+	Type      string   `json:"type"`
+	Path      string   `json:"path"`
+	Size      int64    `json:"size"`
+	SHA256    string   `json:"sha256"`
+	Lists     []string `json:"lists"`
+	Unchanged bool     `json:"unchanged"`
+}
+
+// SetDryRun enables or disables dry-run mode. In dry-run mode,
+// output converters do not write any file, but artifacts are still recorded.
+func SetDryRun(enabled bool) {
+	dryRun = enabled
+}
+
+// IsDryRun reports whether dry-run mode is enabled.
+func IsDryRun() bool {
+	return dryRun
+}
+
+// WriteFile writes data to the file of path for the output converter of type iType,
+// creating the parent directory if necessary, and records the file as an artifact
+// containing the lists. No file is written in dry-run mode, and existing files
+// with identical content are left untouched. Files are written to the OutputFS
+// set by SetOutputFS, which is the local disk by default.
+func WriteFile(iType, path string, data []byte, lists ...string) error {
+	dir, filename := filepath.Split(path)
+	dir = filepath.Clean(dir)
+
+	unchanged := false
+	if existing, err := fs.ReadFile(outputFS, path); err == nil && bytes.Equal(existing, data) {
+		unchanged = true
+	}
+
+	switch {
+	case dryRun:
+		slog.Info(fmt.Sprintf("📝 [%s] %s --> %s (dry run, %d bytes)", iType, filename, dir, len(data)), "type", iType, "path", path, "bytes", len(data), "dryRun", true)
+	case unchanged:
+		slog.Info(fmt.Sprintf("✅ [%s] %s --> %s (unchanged)", iType, filename, dir), "type", iType, "path", path, "bytes", len(data), "unchanged", true)
+	default:
+		f, err := outputFSOf(iType).Create(path)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			f.Discard()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		slog.Info(fmt.Sprintf("✅ [%s] %s --> %s", iType, filename, dir), "type", iType, "path", path, "bytes", len(data))
+	}
+
+	recordArtifact(&Artifact{
+		Type:      iType,
+		Path:      path,
+		Size:      int64(len(data)),
+		SHA256:    fmt.Sprintf("%x", sha256.Sum256(data)),
+		Lists:     lists,
+		Unchanged: unchanged,
+	})
+
+	return nil
+}
+
+// WriteFileFrom is like WriteFile, but the content of the file is written
+// incrementally by write, so that it is never held in memory as a whole.
+// The content replaces the file of path only if it is changed.
+func WriteFileFrom(iType, path string, write func(w io.Writer) error, lists ...string) error {
+	dir, filename := filepath.Split(path)
+	dir = filepath.Clean(dir)
+
+	hash := sha256.New()
+	counter := new(countingWriter)
+	w := io.MultiWriter(hash, counter)
+
+	var f OutputFile
+	if !dryRun {
+		var err error
+		if f, err = outputFSOf(iType).Create(path); err != nil {
+			return err
+		}
+		defer f.Discard()
+		w = io.MultiWriter(f, hash, counter)
+	}
+
+	if err := write(w); err != nil {
+		return err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	unchanged := false
+	if existing, err := outputSHA256(path); err == nil && existing == sum {
+		unchanged = true
+	}
+
+	switch {
+	case dryRun:
+		slog.Info(fmt.Sprintf("📝 [%s] %s --> %s (dry run, %d bytes)", iType, filename, dir, counter.n), "type", iType, "path", path, "bytes", counter.n, "dryRun", true)
+	case unchanged:
+		slog.Info(fmt.Sprintf("✅ [%s] %s --> %s (unchanged)", iType, filename, dir), "type", iType, "path", path, "bytes", counter.n, "unchanged", true)
+	default:
+		if err := f.Close(); err != nil {
+			return err
+		}
+		slog.Info(fmt.Sprintf("✅ [%s] %s --> %s", iType, filename, dir), "type", iType, "path", path, "bytes", counter.n)
+	}
+
+	recordArtifact(&Artifact{
+		Type:      iType,
+		Path:      path,
+		Size:      counter.n,
+		SHA256:    sum,
+		Lists:     lists,
+		Unchanged: unchanged,
+	})
+
+	return nil
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// outputSHA256 returns the SHA256 of the file of path in the OutputFS.
+func outputSHA256(path string) (string, error) {
+	f, err := outputFS.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func recordArtifact(artifact *Artifact) {
+	artifactMu.Lock()
+	defer artifactMu.Unlock()
+	artifactList = append(artifactList, artifact)
+}
+
+// artifactsSince returns the artifacts of type iType recorded after the first n ones.
+func artifactsSince(n int, iType string) []*Artifact {
+	artifactMu.Lock()
+	defer artifactMu.Unlock()
+	list := make([]*Artifact, 0, 4)
+	for _, artifact := range artifactList[min(n, len(artifactList)):] {
+		if artifact.Type == iType {
+			list = append(list, artifact)
+		}
+	}
+	return list
+}
+
+// removeArtifactsSince removes the artifacts of type iType recorded after
+// the first n ones, whose files are not written.
+func removeArtifactsSince(n int, iType string) {
+	artifactMu.Lock()
+	defer artifactMu.Unlock()
+	list := artifactList[:min(n, len(artifactList))]
+	for _, artifact := range artifactList[len(list):] {
+		if artifact.Type != iType {
+			list = append(list, artifact)
+		}
+	}
+	artifactList = list
+}
+
+func artifactCount() int {
+	artifactMu.Lock()
+	defer artifactMu.Unlock()
+	return len(artifactList)
+}
+
+// ResetArtifacts removes all recorded artifacts.
+func ResetArtifacts() {
+	artifactMu.Lock()
+	defer artifactMu.Unlock()
+	artifactList = artifactList[:0]
+}
+
+// Artifacts returns all recorded artifacts sorted by path.
+func Artifacts() []*Artifact {
+	artifactMu.Lock()
+	defer artifactMu.Unlock()
+
+	list := make([]*Artifact, len(artifactList))
+	copy(list, artifactList)
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Path < list[j].Path
+	})
+
+	return list
+}
@@ -0,0 +1,139 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// configKeyArchive is the key of the URL template of the archived versions
+// of the remote sources of an input.
+const configKeyArchive = "archive"
+
+// asOfLayout is the layout of the date of a build "as of" a date.
+const asOfLayout = "2006-01-02"
+
+var asOf time.Time
+
+// SetAsOf sets the date to build the outputs as of in the format of
+// "2006-01-02", or clears it if date is empty. It must be set before the
+// config is loaded, for the remote URLs in the args of the inputs to be
+// substituted with the archived ones of their archive.
+func SetAsOf(date string) error {
+	date = strings.TrimSpace(date)
+	if date == "" {
+		asOf = time.Time{}
+		return nil
+	}
+	t, err := time.Parse(asOfLayout, date)
+	if err != nil {
+		return fmt.Errorf("invalid date %q: must be in the format of %s", date, asOfLayout)
+	}
+	if t.After(time.Now()) {
+		return fmt.Errorf("invalid date %q: must not be in the future", date)
+	}
+	asOf = t
+	return nil
+}
+
+// AsOf returns the date outputs are built as of in the format of
+// "2006-01-02", or empty if they are built from the current sources.
+func AsOf() string {
+	if asOf.IsZero() {
+		return ""
+	}
+	return asOf.Format(asOfLayout)
+}
+
+// archiveData is the data of the archive template of an input.
+type archiveData struct {
+	// Date is the date in the format of "2006-01-02".
+	Date string
+	// Time is the date as time.Time, e.g. {{.Time.Format "20060102"}}.
+	Time time.Time
+	// URL is the current URL of the source.
+	URL string
+}
+
+// newArchive parses the archive template of an input, which is checked
+// with an example date and URL.
+func newArchive(archive string) (*template.Template, error) {
+	archive = strings.TrimSpace(archive)
+	if archive == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New(configKeyArchive).Option("missingkey=error").Parse(archive)
+	if err == nil {
+		err = tmpl.Execute(io.Discard, archiveData{Date: "2024-01-01", Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), URL: "https://example.com/"})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(archive, ".Date") && !strings.Contains(archive, ".Time") {
+		return nil, fmt.Errorf("must contain {{.Date}} or {{.Time}}")
+	}
+	return tmpl, nil
+}
+
+// archiveArgs returns args with every remote URL in it substituted with the
+// URL of its version archived at the date of AsOf by archive.
+func archiveArgs(args json.RawMessage, archive *template.Template) (json.RawMessage, error) {
+	if len(args) == 0 || asOf.IsZero() || archive == nil {
+		return args, nil
+	}
+
+	var decoded any
+	if err := json.Unmarshal(args, &decoded); err != nil {
+		return nil, err
+	}
+
+	var walk func(v any) (any, error)
+	walk = func(v any) (any, error) {
+		switch v := v.(type) {
+		case string:
+			if !IsRemoteURI(strings.TrimSpace(v)) {
+				return v, nil
+			}
+			var b strings.Builder
+			if err := archive.Execute(&b, archiveData{Date: AsOf(), Time: asOf, URL: strings.TrimSpace(v)}); err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", configKeyArchive, err)
+			}
+			return b.String(), nil
+		case []any:
+			for idx, item := range v {
+				item, err := walk(item)
+				if err != nil {
+					return nil, err
+				}
+				v[idx] = item
+			}
+		case map[string]any:
+			for key, item := range v {
+				item, err := walk(item)
+				if err != nil {
+					return nil, err
+				}
+				v[key] = item
+			}
+		}
+		return v, nil
+	}
+
+	decoded, err := walk(decoded)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(decoded)
+}
+
+// hasRemoteURLs reports whether there is any remote URL in args.
+func hasRemoteURLs(args json.RawMessage) bool {
+	var decoded any
+	if len(args) == 0 || json.Unmarshal(args, &decoded) != nil {
+		return false
+	}
+	return len(findURLs(decoded)) > 0
+}
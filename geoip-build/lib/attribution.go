@@ -0,0 +1,82 @@
+package lib
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// typeAttributions is the type of the attributions file recorded as an artifact.
+const typeAttributions = "attributions"
+
+// attributionNotice is the license and attribution declared by an input converter in config.
+type attributionNotice struct {
+	License     string
+	Attribution string
+}
+
+// Attribution is a license and attribution shared by one or more inputs.
+type Attribution struct {
+	License     string   `json:"license,omitempty"`
+	Attribution string   `json:"attribution,omitempty"`
+	Sources     []string `json:"sources"`
+}
+
+// Attributions returns the licenses and attributions declared by the input
+// converters that succeeded in the last run, merging the inputs with the same
+// license and attribution, in the order they appear in config.
+func (i *Instance) Attributions() []*Attribution {
+	list := make([]*Attribution, 0, len(i.inputNotices))
+	index := make(map[attributionNotice]*Attribution)
+	for idx, notice := range i.inputNotices {
+		if notice == nil || idx >= len(i.inputDone) || !i.inputDone[idx] {
+			continue
+		}
+
+		source := i.input[idx].GetType()
+		if i.inputSources[idx] != "" {
+			source += " " + i.inputSources[idx]
+		}
+
+		attribution, found := index[*notice]
+		if !found {
+			attribution = &Attribution{License: notice.License, Attribution: notice.Attribution}
+			index[*notice] = attribution
+			list = append(list, attribution)
+		}
+		if !slices.Contains(attribution.Sources, source) {
+			attribution.Sources = append(attribution.Sources, source)
+		}
+	}
+	return list
+}
+
+// WriteAttributions writes the licenses and attributions of the last run
+// in plain text to file, which is recorded as an artifact. No file is
+// written if no input declares a license or an attribution.
+func (i *Instance) WriteAttributions(file string) error {
+	attributions := i.Attributions()
+	if len(attributions) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("This data is generated from the following sources.\n")
+	for _, attribution := range attributions {
+		b.WriteString("\n")
+		for _, source := range attribution.Sources {
+			fmt.Fprintf(&b, "Source: %s\n", source)
+		}
+		if attribution.License != "" {
+			fmt.Fprintf(&b, "License: %s\n", attribution.License)
+		}
+		if attribution.Attribution != "" {
+			fmt.Fprintf(&b, "%s\n", attribution.Attribution)
+		}
+	}
+
+	if err := WriteFile(typeAttributions, file, []byte(b.String())); err != nil {
+		return &RunError{Kind: ErrorKindOutput, Type: typeAttributions, Action: ActionOutput, Err: err}
+	}
+	return nil
+}
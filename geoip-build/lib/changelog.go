@@ -0,0 +1,151 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// typeChangelog is the type of the changelog file recorded as an artifact.
+const typeChangelog = "changelog"
+
+// Changelog is how the lists of a build changed since the last build of
+// a build state file, summarized for release notes.
+type Changelog struct {
+	// Previous reports whether the lists of the last build are known.
+	Previous bool          `json:"previous"`
+	Lists    []*ListChange `json:"lists"`
+	// Total is the number of lists of the build.
+	Total int `json:"total"`
+}
+
+// ListChange is the change of a list since the last build, in the numbers
+// of CIDRs added and removed, as a diff of the list in plaintext would show.
+type ListChange struct {
+	Name    string `json:"name"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+	// New and Deleted report whether the list is added or removed as a whole.
+	New     bool `json:"new,omitempty"`
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// ListPrefixes returns the CIDRs of each list generated by the last run.
+func (i *Instance) ListPrefixes() (map[string][]netip.Prefix, error) {
+	if i.container == nil {
+		return nil, errors.New("instance has not been run yet")
+	}
+
+	lists := make(map[string][]netip.Prefix, 300)
+	for entry := range i.container.Loop() {
+		prefixes, err := entry.MarshalPrefix()
+		if err != nil {
+			continue
+		}
+		lists[entry.GetName()] = prefixes
+	}
+	return lists, nil
+}
+
+// Changelog returns the changes of lists since the lists of the last build
+// of the state file, sorted by name with unchanged lists omitted.
+func (s *BuildState) Changelog(lists map[string][]netip.Prefix) *Changelog {
+	changelog := &Changelog{Previous: s.lists != nil, Lists: make([]*ListChange, 0), Total: len(lists)}
+	if !changelog.Previous {
+		return changelog
+	}
+
+	names := make(map[string]bool, len(lists))
+	for name := range lists {
+		names[name] = true
+	}
+	for name := range s.lists {
+		names[name] = true
+	}
+
+	for _, name := range sortedKeys(names) {
+		previous, found := s.lists[name]
+		current, exists := lists[name]
+		change := &ListChange{Name: name, New: !found, Deleted: !exists}
+
+		change.Added = countPrefixDifference(current, previous)
+		change.Removed = countPrefixDifference(previous, current)
+		if change.Added > 0 || change.Removed > 0 || change.New || change.Deleted {
+			changelog.Lists = append(changelog.Lists, change)
+		}
+	}
+	return changelog
+}
+
+// countPrefixDifference returns the number of CIDRs in a but not in b.
+func countPrefixDifference(a, b []netip.Prefix) int {
+	inB := make(map[netip.Prefix]bool, len(b))
+	for _, prefix := range b {
+		inB[prefix] = true
+	}
+	count := 0
+	for _, prefix := range a {
+		if !inB[prefix] {
+			count++
+		}
+	}
+	return count
+}
+
+// Markdown returns the changelog in markdown format, suitable for release
+// notes.
+func (c *Changelog) Markdown() string {
+	var b strings.Builder
+	b.WriteString("## Changes\n\n")
+
+	switch {
+	case !c.Previous:
+		fmt.Fprintf(&b, "No previous build to compare with, lists generated: %d\n", c.Total)
+		return b.String()
+	case len(c.Lists) == 0:
+		b.WriteString("No list is changed since the last build.\n")
+		return b.String()
+	}
+
+	added, removed := 0, 0
+	var newLists, deletedLists []string
+	for _, change := range c.Lists {
+		added += change.Added
+		removed += change.Removed
+		if change.New {
+			newLists = append(newLists, strings.ToLower(change.Name))
+		}
+		if change.Deleted {
+			deletedLists = append(deletedLists, strings.ToLower(change.Name))
+		}
+	}
+	fmt.Fprintf(&b, "- Lists changed since the last build: %d of %d\n", len(c.Lists), c.Total)
+	fmt.Fprintf(&b, "- CIDRs added: %d, removed: %d\n", added, removed)
+	if len(newLists) > 0 {
+		sort.Strings(newLists)
+		fmt.Fprintf(&b, "- New lists: %s\n", strings.Join(newLists, ", "))
+	}
+	if len(deletedLists) > 0 {
+		sort.Strings(deletedLists)
+		fmt.Fprintf(&b, "- Removed lists: %s\n", strings.Join(deletedLists, ", "))
+	}
+	b.WriteString("\n")
+
+	b.WriteString("| List | Added | Removed |\n")
+	b.WriteString("| --- | ---: | ---: |\n")
+	for _, change := range c.Lists {
+		fmt.Fprintf(&b, "| %s | +%d | -%d |\n", strings.ToLower(change.Name), change.Added, change.Removed)
+	}
+	return b.String()
+}
+
+// WriteChangelog writes the changelog in markdown format to file, which is
+// recorded as an artifact.
+func WriteChangelog(file string, changelog *Changelog) error {
+	if err := WriteFile(typeChangelog, file, []byte(changelog.Markdown())); err != nil {
+		return &RunError{Kind: ErrorKindOutput, Type: typeChangelog, Action: ActionOutput, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package lib
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// typeChecksum is the type of the checksum files recorded as artifacts.
+const typeChecksum = "sha256sum"
+
+// WriteChecksums writes the SHA256 checksums of all recorded artifacts to
+// sumsFile in the format of sha256sum, with paths relative to the directory
+// of sumsFile, so that they can be checked by "sha256sum -c". If siblings
+// is true, a ".sha256" file is also written next to each artifact.
+// Either is skipped if sumsFile is empty or siblings is false.
+func WriteChecksums(sumsFile string, siblings bool) error {
+	if err := writeChecksums(sumsFile, siblings); err != nil {
+		return &RunError{Kind: ErrorKindOutput, Type: typeChecksum, Action: ActionOutput, Err: err}
+	}
+	return nil
+}
+
+func writeChecksums(sumsFile string, siblings bool) error {
+	artifacts := Artifacts()
+	if len(artifacts) == 0 || (sumsFile == "" && !siblings) {
+		return nil
+	}
+
+	var sums strings.Builder
+	sumsDir := filepath.Dir(sumsFile)
+	for _, artifact := range artifacts {
+		if artifact.Type == typeChecksum {
+			continue
+		}
+
+		if sumsFile != "" {
+			path, err := filepath.Rel(sumsDir, artifact.Path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&sums, "%s  %s\n", artifact.SHA256, filepath.ToSlash(path))
+		}
+
+		if siblings {
+			line := fmt.Sprintf("%s  %s\n", artifact.SHA256, filepath.Base(artifact.Path))
+			if err := WriteFile(typeChecksum, artifact.Path+".sha256", []byte(line)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if sumsFile != "" {
+		return WriteFile(typeChecksum, sumsFile, []byte(sums.String()))
+	}
+
+	return nil
+}
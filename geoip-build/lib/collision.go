@@ -0,0 +1,131 @@
+package lib
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Policies of an input adding a list that already exists, e.g. when two
+// inputs both generate the list cn.
+const (
+	// CollisionUnion merges the CIDRs of the input into the list.
+	CollisionUnion = "union"
+	// CollisionReplace removes the list, or only its IPv4 or IPv6 CIDRs if
+	// the input adds only one of them, before the input adds it.
+	CollisionReplace = "replace"
+	// CollisionError fails the input.
+	CollisionError = "error"
+)
+
+// configKeyOnCollision is the key of the collision policy of all inputs at
+// the top level of config, and of a single input in the input.
+const configKeyOnCollision = "onCollision"
+
+var collisionPolicies = []string{CollisionUnion, CollisionReplace, CollisionError}
+
+func checkCollisionPolicy(policy string) error {
+	switch policy {
+	case "", CollisionUnion, CollisionReplace, CollisionError:
+		return nil
+	}
+	return fmt.Errorf("invalid %s %q, available options: %s", configKeyOnCollision, policy, strings.Join(collisionPolicies, ", "))
+}
+
+// inputContainer applies the collision policy of an input converter to
+// the lists it adds that were generated by the previous input converters,
+// attaches the metadata of the input converter to them, and converts the
+// IPv4-mapped IPv6 CIDRs it adds or removes by its mappedIPv4.
+type inputContainer struct {
+	Container
+	// policy is empty if the input converter removes lists, which never
+	// collide.
+	policy    string
+	metadata  *inputMetadata
+	unmapIPv4 bool
+	iType     string
+	action    Action
+	// added is the lists added by the input converter so far, which are
+	// not collisions when added again
+	added map[string]bool
+}
+
+// inputContainer wraps container to apply the collision policy, which is
+// union by default, the metadata and the mappedIPv4 of the input converter
+// ic at idx.
+func (i *Instance) inputContainer(container Container, idx int, ic InputConverter) Container {
+	unmapIPv4 := idx >= len(i.inputMappedIPv4) || i.inputMappedIPv4[idx] != MappedIPv4AsIPv6
+	if ic.GetAction() != ActionAdd {
+		if !unmapIPv4 {
+			return container
+		}
+		return &inputContainer{Container: container, unmapIPv4: true, iType: ic.GetType(), action: ic.GetAction()}
+	}
+	policy := CollisionUnion
+	if idx < len(i.inputCollisions) && i.inputCollisions[idx] != "" {
+		policy = i.inputCollisions[idx]
+	}
+	var metadata *inputMetadata
+	if idx < len(i.inputMetadata) {
+		metadata = i.inputMetadata[idx]
+	}
+	return &inputContainer{
+		Container: container,
+		policy:    policy,
+		metadata:  metadata,
+		unmapIPv4: unmapIPv4,
+		iType:     ic.GetType(),
+		action:    ic.GetAction(),
+		added:     make(map[string]bool),
+	}
+}
+
+// unwrapInputContainer returns the container wrapped by container if it
+// is an inputContainer.
+func unwrapInputContainer(container Container) Container {
+	if c, ok := container.(*inputContainer); ok {
+		return c.Container
+	}
+	return container
+}
+
+func (c *inputContainer) Add(entry *Entry, opts ...IgnoreIPOption) error {
+	name := entry.GetName()
+	if c.unmapIPv4 {
+		entry.unmapIPv4()
+	}
+	if c.metadata != nil {
+		entry.addMetadata(c.metadata.list(name))
+	}
+	if c.policy != "" && !c.added[name] {
+		c.added[name] = true
+		if _, found := c.Container.GetEntry(name); found {
+			if err := c.collide(name, opts...); err != nil {
+				return err
+			}
+		}
+	}
+	return c.Container.Add(entry, opts...)
+}
+
+func (c *inputContainer) Remove(entry *Entry, rCase CaseRemove, opts ...IgnoreIPOption) error {
+	if c.unmapIPv4 {
+		entry.unmapIPv4()
+	}
+	return c.Container.Remove(entry, rCase, opts...)
+}
+
+func (c *inputContainer) collide(name string, opts ...IgnoreIPOption) error {
+	switch c.policy {
+	case CollisionError:
+		return fmt.Errorf("❌ [type %s | action %s] list %s already exists, which is not allowed by %s %s", c.iType, c.action, name, configKeyOnCollision, c.policy)
+	case CollisionReplace:
+		if err := c.Container.Remove(NewEntry(name), CaseRemoveEntry, opts...); err != nil {
+			return err
+		}
+		slog.Info(fmt.Sprintf("🔀 [%s] list %s already exists, replaced by %s %s", c.iType, name, configKeyOnCollision, c.policy), "type", c.iType, "action", c.action, "list", name, "policy", c.policy)
+	default:
+		slog.Info(fmt.Sprintf("🔀 [%s] list %s already exists, merged by %s %s", c.iType, name, configKeyOnCollision, c.policy), "type", c.iType, "action", c.action, "list", name, "policy", c.policy)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package lib
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testInput is an input converter of action, which reads nothing.
+type testInput struct {
+	action Action
+}
+
+func (i *testInput) GetType() string        { return "testInput" }
+func (i *testInput) GetAction() Action      { return i.action }
+func (i *testInput) GetDescription() string { return "" }
+func (i *testInput) Input(ctx context.Context, container Container) (Container, error) {
+	return container, nil
+}
+
+func TestInputContainerCollision(t *testing.T) {
+	existing := map[string][]string{"cn": {"1.0.0.0/24", "2001:db8::/32"}}
+	added := []string{"2.0.0.0/24", "2001:dba::/32"}
+
+	tests := []struct {
+		name   string
+		policy string
+		opts   []IgnoreIPOption
+		// want is the CIDRs of list CN after the input adds it, or err the
+		// error of adding it.
+		want []string
+		err  string
+	}{
+		{name: "union by default", want: []string{"1.0.0.0/24", "2.0.0.0/24", "2001:db8::/32", "2001:dba::/32"}},
+		{name: "union", policy: CollisionUnion, want: []string{"1.0.0.0/24", "2.0.0.0/24", "2001:db8::/32", "2001:dba::/32"}},
+		{name: "union of ipv4-only input", policy: CollisionUnion, opts: []IgnoreIPOption{IgnoreIPv6}, want: []string{"1.0.0.0/24", "2.0.0.0/24", "2001:db8::/32"}},
+		{name: "replace", policy: CollisionReplace, want: []string{"2.0.0.0/24", "2001:dba::/32"}},
+		{name: "replace of ipv4-only input", policy: CollisionReplace, opts: []IgnoreIPOption{IgnoreIPv6}, want: []string{"2.0.0.0/24", "2001:db8::/32"}},
+		{name: "replace of ipv6-only input", policy: CollisionReplace, opts: []IgnoreIPOption{IgnoreIPv4}, want: []string{"1.0.0.0/24", "2001:dba::/32"}},
+		{name: "error", policy: CollisionError, err: "list CN already exists, which is not allowed by onCollision error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := &Instance{inputCollisions: []string{tt.policy}}
+			container := instance.inputContainer(testContainer(t, existing), 0, &testInput{action: ActionAdd})
+
+			err := container.Add(testEntry(t, "cn", added...), tt.opts...)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Add error = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Add error = %v", err)
+			}
+			if got := entryCIDRs(t, container, "cn"); !slices.Equal(got, tt.want) {
+				t.Errorf("list CN = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInputContainerCollisionSameInput(t *testing.T) {
+	// Lists added again by the same input or added by it first never collide
+	for _, policy := range collisionPolicies {
+		t.Run(policy, func(t *testing.T) {
+			instance := &Instance{inputCollisions: []string{policy}}
+			container := instance.inputContainer(testContainer(t, map[string][]string{"cn": {"1.0.0.0/24"}}), 0, &testInput{action: ActionAdd})
+
+			if err := container.Add(testEntry(t, "us", "3.0.0.0/24")); err != nil {
+				t.Fatalf("Add error of a new list = %v", err)
+			}
+			if err := container.Add(testEntry(t, "us", "4.0.0.0/24")); err != nil {
+				t.Fatalf("Add error of a list added again = %v", err)
+			}
+			if got, want := entryCIDRs(t, container, "us"), []string{"3.0.0.0/24", "4.0.0.0/24"}; !slices.Equal(got, want) {
+				t.Errorf("list US = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestInputContainerCollisionRemove(t *testing.T) {
+	// Inputs removing lists never collide, whatever their policy is
+	instance := &Instance{inputCollisions: []string{CollisionError}}
+	container := instance.inputContainer(testContainer(t, map[string][]string{"cn": {"1.0.0.0/16"}}), 0, &testInput{action: ActionRemove})
+
+	if err := container.Remove(testEntry(t, "cn", "1.0.0.0/17"), CaseRemovePrefix); err != nil {
+		t.Fatalf("Remove error = %v", err)
+	}
+	if got, want := entryCIDRs(t, container, "cn"), []string{"1.0.128.0/17"}; !slices.Equal(got, want) {
+		t.Errorf("list CN = %v, want %v", got, want)
+	}
+}
+
+func TestCheckCollisionPolicy(t *testing.T) {
+	for _, policy := range append([]string{""}, collisionPolicies...) {
+		if err := checkCollisionPolicy(policy); err != nil {
+			t.Errorf("checkCollisionPolicy(%q) error = %v", policy, err)
+		}
+	}
+	if err := checkCollisionPolicy("merge"); err == nil || !strings.Contains(err.Error(), "available options: union, replace, error") {
+		t.Errorf("checkCollisionPolicy(\"merge\") error = %v, want the available options", err)
+	}
+}
+
+// testEntry returns a list name of cidrs.
+func testEntry(t *testing.T, name string, cidrs ...string) *Entry {
+	t.Helper()
+	entry := NewEntry(name)
+	for _, cidr := range cidrs {
+		if err := entry.AddPrefix(cidr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return entry
+}
+
+// entryCIDRs returns the CIDRs of the list name in container.
+func entryCIDRs(t *testing.T, container Container, name string) []string {
+	t.Helper()
+	entry, found := container.GetEntry(name)
+	if !found {
+		t.Fatalf("list %s is not found", name)
+	}
+	cidrs, err := entry.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cidrs
+}
@@ -1,34 +1,148 @@
 package lib
 
 import (
+	"bufio"
+	"context"
+	"encoding/csv"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 )
 
+// csvBufferSize is the size of the read buffer of CSV readers, large enough
+// to read multi-hundred-MB CSV files in few system calls.
+const csvBufferSize = 1 << 20
+
 func GetRemoteURLContent(url string) ([]byte, error) {
-	resp, err := http.Get(url)
+	if f, found, err := openShared(context.Background(), url); found {
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return io.ReadAll(f)
+	}
+	if f, found := openDownloaded(url); found {
+		defer f.Close()
+		return io.ReadAll(f)
+	}
+
+	start := time.Now()
+	resp, err := sourceClient.Get(url)
 	if err != nil {
-		return nil, err
+		return nil, WrapDownloadError(url, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get remote content -> %s: %s", url, resp.Status)
+		return nil, WrapDownloadError(url, fmt.Errorf("failed to get remote content -> %s: %s", url, resp.Status))
 	}
 
-	return io.ReadAll(resp.Body)
+	body := TrackRemoteReader(url, start, resp)
+	defer body.Close()
+
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return nil, WrapDownloadError(url, err)
+	}
+
+	return content, nil
 }
 
-func GetRemoteURLReader(url string) (io.ReadCloser, error) {
-	resp, err := http.Get(url)
+// GetRemoteURLReader returns the body of the remote content of url, the
+// download of which is aborted once ctx is done.
+func GetRemoteURLReader(ctx context.Context, url string) (io.ReadCloser, error) {
+	if f, found, err := openShared(ctx, url); found {
+		return f, err
+	}
+	if f, found := openDownloaded(url); found {
+		return f, nil
+	}
+
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return nil, err
+		return nil, WrapDownloadError(url, err)
+	}
+	resp, err := sourceClient.Do(req)
+	if err != nil {
+		return nil, WrapDownloadError(url, err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get remote content -> %s: %s", url, resp.Status)
+		resp.Body.Close()
+		return nil, WrapDownloadError(url, fmt.Errorf("failed to get remote content -> %s: %s", url, resp.Status))
+	}
+
+	return TrackRemoteReader(url, start, resp), nil
+}
+
+// GetRemoteURLFile downloads the remote content of url into a temporary file
+// without holding it in memory, and returns the path to the file, which
+// should be removed by the caller.
+func GetRemoteURLFile(ctx context.Context, url string) (string, error) {
+	body, err := GetRemoteURLReader(ctx, url)
+	if err != nil {
+		return "", err
 	}
+	defer body.Close()
+
+	f, err := os.CreateTemp("", "geoip-download-")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", WrapDownloadError(url, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+// IsRemoteURI reports whether uri is a remote HTTP(S) URL.
+func IsRemoteURI(uri string) bool {
+	uri = strings.ToLower(uri)
+	return strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://")
+}
+
+// OpenURI opens the local file path or remote HTTP(S) URL of uri for reading.
+func OpenURI(ctx context.Context, uri string) (io.ReadCloser, error) {
+	if IsRemoteURI(uri) {
+		return GetRemoteURLReader(ctx, uri)
+	}
+	f, err := os.Open(uri)
+	if err != nil {
+		return nil, err
+	}
+	return &contextReadCloser{ctx: ctx, ReadCloser: f}, nil
+}
+
+// contextReadCloser fails to read once ctx is done, so that local files
+// stop being parsed as well.
+type contextReadCloser struct {
+	ctx context.Context
+	io.ReadCloser
+}
+
+func (r *contextReadCloser) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.ReadCloser.Read(p)
+}
 
-	return resp.Body, nil
+// NewCSVReader returns a CSV reader of r with a large read buffer, which reuses
+// the slice of each record between reads to avoid an allocation per record,
+// so that records must not be retained after the next read.
+func NewCSVReader(r io.Reader) *csv.Reader {
+	reader := csv.NewReader(bufio.NewReaderSize(r, csvBufferSize))
+	reader.ReuseRecord = true
+	return reader
 }
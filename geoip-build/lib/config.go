@@ -8,15 +8,21 @@ import (
 )
 
 var (
-	inputConfigCreatorCache  = make(map[string]inputConfigCreator)
-	outputConfigCreatorCache = make(map[string]outputConfigCreator)
+	inputConfigCreatorCache  = make(map[string]InputConfigCreator)
+	outputConfigCreatorCache = make(map[string]OutputConfigCreator)
 )
 
-type inputConfigCreator func(Action, json.RawMessage) (InputConverter, error)
+// InputConfigCreator creates an input converter with the action and the
+// args of an input in config file.
+type InputConfigCreator func(Action, json.RawMessage) (InputConverter, error)
 
-type outputConfigCreator func(Action, json.RawMessage) (OutputConverter, error)
+// OutputConfigCreator creates an output converter with the action and the
+// args of an output in config file.
+type OutputConfigCreator func(Action, json.RawMessage) (OutputConverter, error)
 
-func RegisterInputConfigCreator(id string, fn inputConfigCreator) error {
+// RegisterInputConfigCreator registers fn to create the input converters of
+// type id in config file, and the type is case-insensitive.
+func RegisterInputConfigCreator(id string, fn InputConfigCreator) error {
 	id = strings.ToLower(id)
 	if _, found := inputConfigCreatorCache[id]; found {
 		return errors.New("config creator has already been registered")
@@ -34,7 +40,9 @@ func createInputConfig(id string, action Action, data json.RawMessage) (InputCon
 	return fn(action, data)
 }
 
-func RegisterOutputConfigCreator(id string, fn outputConfigCreator) error {
+// RegisterOutputConfigCreator registers fn to create the output converters
+// of type id in config file, and the type is case-insensitive.
+func RegisterOutputConfigCreator(id string, fn OutputConfigCreator) error {
 	id = strings.ToLower(id)
 	if _, found := outputConfigCreatorCache[id]; found {
 		return errors.New("config creator has already been registered")
@@ -53,21 +61,47 @@ func createOutputConfig(id string, action Action, data json.RawMessage) (OutputC
 }
 
 type config struct {
-	Input  []*inputConvConfig  `json:"input"`
-	Output []*outputConvConfig `json:"output"`
+	Input       []*inputConvConfig  `json:"input"`
+	Output      []*outputConvConfig `json:"output"`
+	OnCollision string              `json:"onCollision"`
+	// MaxInvalidRatio is the maxInvalidRatio of the inputs not specifying
+	// one of their own.
+	MaxInvalidRatio *float64 `json:"maxInvalidRatio"`
+	// MappedIPv4 is the mappedIPv4 of the inputs not specifying one of
+	// their own, which is the one set by SetMappedIPv4 if empty.
+	MappedIPv4 string `json:"mappedIPv4"`
 }
 
 type inputConvConfig struct {
-	iType     string
-	action    Action
-	converter InputConverter
+	iType       string
+	action      Action
+	optional    bool
+	freshness   *Freshness
+	onCollision string
+	maxInvalid  *float64
+	mappedIPv4  string
+	metadata    *inputMetadata
+	source      string
+	args        json.RawMessage
+	notice      *attributionNotice
+	converter   InputConverter
 }
 
 func (i *inputConvConfig) UnmarshalJSON(data []byte) error {
 	var temp struct {
-		Type   string          `json:"type"`
-		Action Action          `json:"action"`
-		Args   json.RawMessage `json:"args"`
+		Type        string          `json:"type"`
+		Action      Action          `json:"action"`
+		Args        json.RawMessage `json:"args"`
+		Optional    bool            `json:"optional"`
+		MaxAge      string          `json:"maxAge"`
+		OnStale     string          `json:"onStale"`
+		OnCollision string          `json:"onCollision"`
+		MaxInvalid  *float64        `json:"maxInvalidRatio"`
+		MappedIPv4  string          `json:"mappedIPv4"`
+		Archive     string          `json:"archive"`
+		Metadata    json.RawMessage `json:"metadata"`
+		License     string          `json:"license"`
+		Attribution string          `json:"attribution"`
 	}
 
 	if err := json.Unmarshal(data, &temp); err != nil {
@@ -78,13 +112,67 @@ func (i *inputConvConfig) UnmarshalJSON(data []byte) error {
 		return fmt.Errorf("invalid action %s in type %s", temp.Action, temp.Type)
 	}
 
+	archive, err := newArchive(temp.Archive)
+	if err != nil {
+		return fmt.Errorf("❌ [type %s | action %s] invalid %s: %w", temp.Type, temp.Action, configKeyArchive, err)
+	}
+	if temp.Args, err = archiveArgs(temp.Args, archive); err != nil {
+		return fmt.Errorf("❌ [type %s | action %s] %w", temp.Type, temp.Action, err)
+	}
+
 	config, err := createInputConfig(temp.Type, temp.Action, temp.Args)
 	if err != nil {
 		return err
 	}
 
+	freshness, err := newFreshness(temp.MaxAge, temp.OnStale, temp.Args)
+	if err != nil {
+		return fmt.Errorf("❌ [type %s | action %s] %w", config.GetType(), config.GetAction(), err)
+	}
+	if AsOf() != "" {
+		// Sources of builds as of a date are old on purpose
+		freshness = nil
+		// The current versions of remote sources would make the build
+		// differ from the one as of the date the manifest claims
+		if archive == nil && hasRemoteURLs(temp.Args) {
+			return fmt.Errorf("❌ [type %s | action %s] has remote sources but no %s to build as of %s", config.GetType(), config.GetAction(), configKeyArchive, AsOf())
+		}
+	}
+
+	if err := checkCollisionPolicy(temp.OnCollision); err != nil {
+		return fmt.Errorf("❌ [type %s | action %s] %w", config.GetType(), config.GetAction(), err)
+	}
+
+	if temp.MaxInvalid != nil {
+		if err := checkMaxInvalidRatio(*temp.MaxInvalid); err != nil {
+			return fmt.Errorf("❌ [type %s | action %s] invalid %s: %w", config.GetType(), config.GetAction(), configKeyMaxInvalidRatio, err)
+		}
+	}
+
+	if temp.MappedIPv4 != "" {
+		if _, err := checkMappedIPv4(temp.MappedIPv4); err != nil {
+			return fmt.Errorf("❌ [type %s | action %s] %w", config.GetType(), config.GetAction(), err)
+		}
+	}
+
 	i.iType = config.GetType()
 	i.action = config.GetAction()
+	i.optional = temp.Optional
+	i.freshness = freshness
+	i.onCollision = temp.OnCollision
+	i.maxInvalid = temp.MaxInvalid
+	i.mappedIPv4 = strings.ToLower(strings.TrimSpace(temp.MappedIPv4))
+	if i.metadata, err = newInputMetadata(temp.Metadata, temp.Args); err != nil {
+		return fmt.Errorf("❌ [type %s | action %s] %w", config.GetType(), config.GetAction(), err)
+	}
+	i.source = describeSource(temp.Args)
+	i.args = temp.Args
+	if temp.License != "" || temp.Attribution != "" {
+		i.notice = &attributionNotice{
+			License:     strings.TrimSpace(temp.License),
+			Attribution: strings.TrimSpace(temp.Attribution),
+		}
+	}
 	i.converter = config
 
 	return nil
@@ -93,14 +181,24 @@ func (i *inputConvConfig) UnmarshalJSON(data []byte) error {
 type outputConvConfig struct {
 	iType     string
 	action    Action
+	args      json.RawMessage
+	limit     *entryLimit
+	hooks     []*outputHook
+	policy    *outputPolicy
 	converter OutputConverter
 }
 
 func (i *outputConvConfig) UnmarshalJSON(data []byte) error {
 	var temp struct {
-		Type   string          `json:"type"`
-		Action Action          `json:"action"`
-		Args   json.RawMessage `json:"args"`
+		Type              string          `json:"type"`
+		Action            Action          `json:"action"`
+		Args              json.RawMessage `json:"args"`
+		MaxEntries        int             `json:"maxEntries"`
+		MaxEntriesPerList map[string]int  `json:"maxEntriesPerList"`
+		OnExceed          string          `json:"onExceed"`
+		RankFile          string          `json:"rankFile"`
+		Hooks             json.RawMessage `json:"hooks"`
+		Policy            json.RawMessage `json:"policy"`
 	}
 
 	if err := json.Unmarshal(data, &temp); err != nil {
@@ -120,8 +218,27 @@ func (i *outputConvConfig) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
+	limit, err := newEntryLimit(temp.MaxEntries, temp.MaxEntriesPerList, temp.OnExceed, temp.RankFile)
+	if err != nil {
+		return fmt.Errorf("❌ [type %s | action %s] %w", config.GetType(), config.GetAction(), err)
+	}
+
+	hooks, err := newOutputHooks(temp.Hooks)
+	if err != nil {
+		return fmt.Errorf("❌ [type %s | action %s] invalid %w", config.GetType(), config.GetAction(), err)
+	}
+
+	policy, err := newOutputPolicy(temp.Policy)
+	if err != nil {
+		return fmt.Errorf("❌ [type %s | action %s] invalid %w", config.GetType(), config.GetAction(), err)
+	}
+
 	i.iType = config.GetType()
 	i.action = config.GetAction()
+	i.args = temp.Args
+	i.limit = limit
+	i.hooks = hooks
+	i.policy = policy
 	i.converter = config
 
 	return nil
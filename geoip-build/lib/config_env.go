@@ -0,0 +1,77 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// envPattern matches placeholders like ${NAME} and ${NAME:-default}.
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces the environment variable placeholders in all string values
+// of the JSON config content. Placeholders of unset variables without
+// a default value are reported as error.
+func expandEnv(content []byte) ([]byte, error) {
+	if !bytes.Contains(content, []byte("${")) {
+		return content, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	var data any
+	if err := decoder.Decode(&data); err != nil {
+		return nil, err
+	}
+
+	missing := make(map[string]bool)
+	var walk func(v any) any
+	walk = func(v any) any {
+		switch v := v.(type) {
+		case string:
+			return expandEnvString(v, missing)
+		case []any:
+			for idx, item := range v {
+				v[idx] = walk(item)
+			}
+		case map[string]any:
+			for key, item := range v {
+				v[key] = walk(item)
+			}
+		}
+		return v
+	}
+	data = walk(data)
+
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("environment variables used in config are not set: %s", strings.Join(names, ", "))
+	}
+
+	return json.Marshal(data)
+}
+
+// expandEnvString replaces the environment variable placeholders in s,
+// adding the names of unset variables without a default value to missing.
+func expandEnvString(s string, missing map[string]bool) string {
+	return envPattern.ReplaceAllStringFunc(s, func(placeholder string) string {
+		match := envPattern.FindStringSubmatch(placeholder)
+		if value, found := os.LookupEnv(match[1]); found {
+			return value
+		}
+		if match[2] != "" {
+			return match[3]
+		}
+		missing[match[1]] = true
+		return placeholder
+	})
+}
@@ -0,0 +1,125 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v2"
+)
+
+// convertConfig converts the content of config file in YAML or TOML format
+// to JSON format according to the extension of configFile.
+// Content of other extensions is returned as is.
+func convertConfig(configFile string, content []byte) ([]byte, error) {
+	if u, err := url.Parse(configFile); err == nil && u.Scheme != "" && u.Path != "" {
+		configFile = u.Path
+	}
+
+	var data any
+	switch strings.ToLower(filepath.Ext(configFile)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(content, &data); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML config %s: %w", configFile, err)
+		}
+		data = normalizeYAML(data)
+
+	case ".toml":
+		var table map[string]any
+		if err := toml.Unmarshal(content, &table); err != nil {
+			return nil, fmt.Errorf("failed to parse TOML config %s: %w", configFile, err)
+		}
+		data = table
+
+	default:
+		return content, nil
+	}
+
+	return json.Marshal(data)
+}
+
+// configExts are the extensions of the config files in a directory of
+// config files.
+var configExts = []string{".json", ".jsonc", ".yaml", ".yml", ".toml"}
+
+// ConfigFiles returns the config files of uris in order, with each local
+// directory replaced by the JSON, YAML and TOML files directly in it sorted
+// by name, e.g. "full.json", "lite.yaml" and "router.toml". As the files
+// written for each of them are named after them, it is an error if any two
+// of them have the same name, see ConfigName.
+func ConfigFiles(uris []string) ([]string, error) {
+	files := make([]string, 0, len(uris))
+	for _, uri := range uris {
+		uri = strings.TrimSpace(uri)
+		info, err := os.Stat(uri)
+		if IsRemoteURI(uri) || err != nil || !info.IsDir() {
+			files = append(files, uri)
+			continue
+		}
+
+		entries, err := os.ReadDir(uri)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, entry := range entries {
+			if !entry.IsDir() && slices.Contains(configExts, strings.ToLower(filepath.Ext(entry.Name()))) {
+				files = append(files, filepath.Join(uri, entry.Name()))
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no config file is found in directory %s", uri)
+		}
+	}
+
+	if len(files) > 1 {
+		// Names are compared case-insensitively, as file names are on some
+		// file systems
+		names := make(map[string]string, len(files))
+		for _, file := range files {
+			name := strings.ToLower(ConfigName(file))
+			if other, found := names[name]; found {
+				return nil, fmt.Errorf("config files %s and %s have the same name %s", other, file, ConfigName(file))
+			}
+			names[name] = file
+		}
+	}
+	return files, nil
+}
+
+// ConfigName returns the name of configFile without the directory and the
+// extension, e.g. "lite" of "./configs/lite.yaml" or of a URL of it.
+func ConfigName(configFile string) string {
+	if u, err := url.Parse(configFile); err == nil && u.Scheme != "" && u.Path != "" {
+		configFile = u.Path
+	}
+	name := path.Base(filepath.ToSlash(configFile))
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// normalizeYAML converts the maps with interface{} keys decoded by yaml.v2
+// to maps with string keys, which can be marshaled to JSON.
+func normalizeYAML(value any) any {
+	switch v := value.(type) {
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = normalizeYAML(item)
+		}
+		return m
+	case []any:
+		for idx, item := range v {
+			v[idx] = normalizeYAML(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,180 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/tailscale/hujson"
+)
+
+const configKeyInclude = "include"
+
+func isRemoteConfig(configFile string) bool {
+	lower := strings.ToLower(configFile)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// readConfig reads configFile and merges the config files included by it.
+// chain is the list of config files including configFile, used to detect
+// circular includes.
+func readConfig(configFile string, chain []string) ([]byte, error) {
+	if !isRemoteConfig(configFile) {
+		configFile = filepath.Clean(configFile)
+	}
+	if slices.Contains(chain, configFile) {
+		return nil, fmt.Errorf("circular include of config file %s: %s", configFile, strings.Join(append(chain, configFile), " -> "))
+	}
+	chain = append(chain, configFile)
+
+	var content []byte
+	var err error
+	if isRemoteConfig(configFile) {
+		content, err = GetRemoteURLContent(configFile)
+	} else {
+		content, err = os.ReadFile(configFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	content, err = convertConfig(configFile, content)
+	if err != nil {
+		return nil, err
+	}
+
+	// Support JSON with comments and trailing commas
+	content, _ = hujson.Standardize(content)
+
+	content, err = expandEnv(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand config %s: %w", configFile, err)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(content, &fields); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", configFile, err)
+	}
+	if _, found := fields[configKeyInclude]; !found {
+		return content, nil
+	}
+
+	var patterns []string
+	if err := json.Unmarshal(fields[configKeyInclude], &patterns); err != nil {
+		return nil, fmt.Errorf("invalid include in config %s: %w", configFile, err)
+	}
+	delete(fields, configKeyInclude)
+
+	included, err := resolveIncludes(configFile, patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	// Inputs and outputs of the included config files are placed in the order
+	// they are included and before those of the including config file.
+	// Other fields of the including config file take precedence.
+	merged := make(map[string]json.RawMessage)
+	var input, output []json.RawMessage
+	for _, file := range included {
+		data, err := readConfig(file, chain)
+		if err != nil {
+			return nil, err
+		}
+
+		var includedFields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &includedFields); err != nil {
+			return nil, fmt.Errorf("failed to parse config %s: %w", file, err)
+		}
+		for key, value := range includedFields {
+			merged[key] = value
+		}
+		if input, err = appendConfigList(input, includedFields["input"]); err != nil {
+			return nil, fmt.Errorf("invalid input in config %s: %w", file, err)
+		}
+		if output, err = appendConfigList(output, includedFields["output"]); err != nil {
+			return nil, fmt.Errorf("invalid output in config %s: %w", file, err)
+		}
+	}
+
+	for key, value := range fields {
+		merged[key] = value
+	}
+	if input, err = appendConfigList(input, fields["input"]); err != nil {
+		return nil, fmt.Errorf("invalid input in config %s: %w", configFile, err)
+	}
+	if output, err = appendConfigList(output, fields["output"]); err != nil {
+		return nil, fmt.Errorf("invalid output in config %s: %w", configFile, err)
+	}
+
+	if merged["input"], err = json.Marshal(input); err != nil {
+		return nil, err
+	}
+	if merged["output"], err = json.Marshal(output); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(merged)
+}
+
+func appendConfigList(list []json.RawMessage, data json.RawMessage) ([]json.RawMessage, error) {
+	if len(data) == 0 {
+		return list, nil
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+
+	return append(list, items...), nil
+}
+
+// resolveIncludes returns the config files matched by patterns, which are
+// relative to the directory of configFile. Glob patterns are supported for
+// local files only, and matched files are sorted by name.
+func resolveIncludes(configFile string, patterns []string) ([]string, error) {
+	files := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+
+		switch {
+		case isRemoteConfig(pattern):
+			files = append(files, pattern)
+
+		case isRemoteConfig(configFile):
+			base, err := url.Parse(configFile)
+			if err != nil {
+				return nil, err
+			}
+			ref, err := url.Parse(pattern)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, base.ResolveReference(ref).String())
+
+		default:
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(filepath.Dir(configFile), pattern)
+			}
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid include pattern %s in config %s: %w", pattern, configFile, err)
+			}
+			if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+				return nil, fmt.Errorf("included config file %s in config %s does not exist", pattern, configFile)
+			}
+			sort.Strings(matches)
+			files = append(files, matches...)
+		}
+	}
+
+	return files, nil
+}
@@ -0,0 +1,176 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/tailscale/hujson"
+)
+
+// upstreamTypeHints are the hints of the types of the upstream
+// Loyalsoldier/geoip project that are not supported.
+var upstreamTypeHints = map[string]string{
+	"mihomoMRS":         "use clashRuleSet, which is read by mihomo as well",
+	"singboxSRS":        "use text or clashRuleSet and compile them with \"sing-box rule-set compile\"",
+	"dbipCountryMMDB":   "only the MaxMind layout is supported by maxmindMMDB",
+	"ipinfoCountryMMDB": "only the MaxMind layout is supported by maxmindMMDB",
+}
+
+// MigrateIssue is an option of an upstream config that is dropped or has to
+// be checked after migrating.
+type MigrateIssue struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (i *MigrateIssue) String() string {
+	return i.Path + ": " + i.Message
+}
+
+// migratedConverter is a converter of a migrated config, of which the keys
+// are marshaled in the order of configs written by hand.
+type migratedConverter struct {
+	Type   string                     `json:"type"`
+	Action Action                     `json:"action,omitempty"`
+	Args   map[string]json.RawMessage `json:"args,omitempty"`
+}
+
+type migratedConfig struct {
+	Input  []*migratedConverter `json:"input"`
+	Output []*migratedConverter `json:"output"`
+}
+
+// MigrateConfig converts the content of a config file of the upstream
+// Loyalsoldier/geoip project to the format of this project. The types and
+// args unknown to this project are dropped, and reported with the options
+// to be checked by hand in the returned issues.
+//
+// The upstream geosite projects v2fly/domain-list-community and
+// Loyalsoldier/domain-list-custom are configured by flags instead of config
+// files, which are accepted by geosite-build as is.
+func MigrateConfig(content []byte) ([]byte, []*MigrateIssue, error) {
+	// Support JSON with comments and trailing commas, as InitFromBytes does
+	content, _ = hujson.Standardize(content)
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(content, &fields); err != nil {
+		return nil, nil, fmt.Errorf("invalid upstream config: %w", err)
+	}
+	if _, found := fields["input"]; !found {
+		if _, found := fields["output"]; !found {
+			return nil, nil, fmt.Errorf("invalid upstream config: neither input nor output is found, upstream geosite builds are configured by flags, which are accepted by geosite-build as is")
+		}
+	}
+
+	issues := make([]*MigrateIssue, 0)
+	for _, key := range sortedKeys(fields) {
+		if !slices.Contains(configKeys, key) {
+			issues = append(issues, &MigrateIssue{Path: key, Message: "unknown key, dropped"})
+		}
+	}
+
+	var config migratedConfig
+	for _, key := range configKeys {
+		var list []map[string]json.RawMessage
+		if data, found := fields[key]; found && !bytes.Equal(data, []byte("null")) {
+			if err := json.Unmarshal(data, &list); err != nil {
+				return nil, nil, fmt.Errorf("invalid upstream config: %s: must be a list of objects", key)
+			}
+		}
+
+		infos, actions := InputConverterInfos(), inputActions
+		if key == "output" {
+			infos, actions = OutputConverterInfos(), outputActions
+		}
+		converters := make([]*migratedConverter, 0, len(list))
+		for idx, item := range list {
+			c, itemIssues := migrateConverter(fmt.Sprintf("%s[%d]", key, idx), item, infos, actions)
+			issues = append(issues, itemIssues...)
+			if c != nil {
+				converters = append(converters, c)
+			}
+		}
+		if key == "input" {
+			config.Input = converters
+		} else {
+			config.Output = converters
+		}
+	}
+
+	migrated, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ValidateConfig(migrated); err != nil {
+		issues = append(issues, &MigrateIssue{Path: "config", Message: err.Error()})
+	}
+	return append(migrated, '\n'), issues, nil
+}
+
+// migrateConverter converts the upstream converter item at path, or returns
+// nil if its type is not supported.
+func migrateConverter(path string, item map[string]json.RawMessage, infos []*ConverterInfo, actions []Action) (*migratedConverter, []*MigrateIssue) {
+	issues := make([]*MigrateIssue, 0)
+	for _, key := range sortedKeys(item) {
+		if key != "type" && key != "action" && key != "args" {
+			issues = append(issues, &MigrateIssue{Path: path + "." + key, Message: "unknown key, dropped"})
+		}
+	}
+
+	var iType string
+	if err := json.Unmarshal(item["type"], &iType); err != nil || iType == "" {
+		return nil, append(issues, &MigrateIssue{Path: path + ".type", Message: "must be a non-empty string, converter dropped"})
+	}
+	idx := slices.IndexFunc(infos, func(info *ConverterInfo) bool {
+		return strings.EqualFold(info.Name, iType)
+	})
+	if idx < 0 {
+		message := fmt.Sprintf("type %s is not supported, converter dropped", iType)
+		if hint, found := upstreamTypeHints[iType]; found {
+			message += ", " + hint
+		}
+		return nil, append(issues, &MigrateIssue{Path: path + ".type", Message: message})
+	}
+	info := infos[idx]
+	c := &migratedConverter{Type: info.Name}
+
+	if data, found := item["action"]; found {
+		if err := json.Unmarshal(data, &c.Action); err != nil || !slices.Contains(actions, c.Action) {
+			return nil, append(issues, &MigrateIssue{Path: path + ".action", Message: fmt.Sprintf("must be one of %v, converter dropped", actions)})
+		}
+	}
+
+	var args map[string]json.RawMessage
+	if data, found := item["args"]; found && !bytes.Equal(data, []byte("null")) {
+		if err := json.Unmarshal(data, &args); err != nil {
+			return nil, append(issues, &MigrateIssue{Path: path + ".args", Message: "must be an object, converter dropped"})
+		}
+	}
+
+	for _, name := range sortedKeys(args) {
+		argIdx := slices.IndexFunc(info.Args, func(arg Arg) bool {
+			return strings.EqualFold(arg.Name, name)
+		})
+		if argIdx < 0 {
+			issues = append(issues, &MigrateIssue{Path: path + ".args." + name, Message: fmt.Sprintf("arg is not supported by type %s, dropped", info.Name)})
+			continue
+		}
+		arg := info.Args[argIdx]
+		if err := checkArgValue(arg, args[name]); err != nil {
+			issues = append(issues, &MigrateIssue{Path: path + ".args." + name, Message: fmt.Sprintf("%v, dropped", err)})
+			continue
+		}
+		if arg.Name != name {
+			issues = append(issues, &MigrateIssue{Path: path + ".args." + name, Message: fmt.Sprintf("renamed to %s", arg.Name)})
+		}
+		if c.Args == nil {
+			c.Args = make(map[string]json.RawMessage, len(args))
+		}
+		c.Args[arg.Name] = args[name]
+	}
+
+	return c, issues
+}
@@ -0,0 +1,138 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// OverrideConfig applies overrides to the JSON config content, and keeps only
+// the outputs of the types in onlyOutputs if it is not empty.
+//
+// Each override is in the form of "path=value", in which path is a list of
+// keys and indexes separated by dots, e.g. "output.0.outputDir=./dist".
+// Keys of input and output items other than the ones of the items themselves,
+// e.g. type, action, args, optional and maxEntries, refer to the args of the
+// item. Value is parsed as JSON if possible, e.g. true or
+// ["cn"], and used as string otherwise.
+func OverrideConfig(content []byte, overrides []string, onlyOutputs []string) ([]byte, error) {
+	if len(overrides) == 0 && len(onlyOutputs) == 0 {
+		return content, nil
+	}
+
+	content, err := overrideConfig(content, overrides, onlyOutputs)
+	return content, newConfigError(err)
+}
+
+func overrideConfig(content []byte, overrides []string, onlyOutputs []string) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	var data map[string]any
+	if err := decoder.Decode(&data); err != nil {
+		return nil, err
+	}
+
+	for _, override := range overrides {
+		path, value, found := strings.Cut(override, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid override %q: must be in the form of path=value", override)
+		}
+
+		var parsed any
+		valueDecoder := json.NewDecoder(strings.NewReader(value))
+		valueDecoder.UseNumber()
+		if err := valueDecoder.Decode(&parsed); err != nil || valueDecoder.More() {
+			parsed = value
+		}
+
+		keys := strings.Split(strings.TrimSpace(path), ".")
+		if err := setConfigValue(data, keys, parsed); err != nil {
+			return nil, fmt.Errorf("invalid override %q: %w", override, err)
+		}
+	}
+
+	if len(onlyOutputs) > 0 {
+		list, _ := data["output"].([]any)
+		kept := make([]any, 0, len(list))
+		for _, item := range list {
+			m, _ := item.(map[string]any)
+			iType, _ := m["type"].(string)
+			if slices.ContainsFunc(onlyOutputs, func(t string) bool { return strings.EqualFold(strings.TrimSpace(t), iType) }) {
+				kept = append(kept, item)
+			}
+		}
+		if len(kept) == 0 {
+			return nil, fmt.Errorf("no output in config matches types: %s", strings.Join(onlyOutputs, ", "))
+		}
+		data["output"] = kept
+	}
+
+	return json.Marshal(data)
+}
+
+func setConfigValue(data map[string]any, keys []string, value any) error {
+	if len(keys) == 0 || keys[0] == "" {
+		return fmt.Errorf("empty path")
+	}
+
+	var current any = data
+	for idx, key := range keys {
+		last := idx == len(keys)-1
+
+		// Keys of converter items other than the ones of the items refer to args
+		if m, ok := current.(map[string]any); ok && idx == 2 && isArgKey(keys[0], key) {
+			args, ok := m["args"].(map[string]any)
+			if !ok {
+				args = make(map[string]any)
+				m["args"] = args
+			}
+			current = args
+		}
+
+		switch node := current.(type) {
+		case map[string]any:
+			if last {
+				node[key] = value
+				return nil
+			}
+			next, found := node[key]
+			if !found || next == nil {
+				next = make(map[string]any)
+				node[key] = next
+			}
+			current = next
+
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return fmt.Errorf("index %s out of range in %s", key, strings.Join(keys[:idx], "."))
+			}
+			if last {
+				node[i] = value
+				return nil
+			}
+			current = node[i]
+
+		default:
+			return fmt.Errorf("%s is not an object or a list", strings.Join(keys[:idx], "."))
+		}
+	}
+
+	return nil
+}
+
+// isArgKey reports whether key of an item of section, which is input or
+// output, refers to its args.
+func isArgKey(section, key string) bool {
+	switch section {
+	case "input":
+		return !slices.Contains(inputConverterKeys, key)
+	case "output":
+		return !slices.Contains(outputConverterKeys, key)
+	}
+	return false
+}
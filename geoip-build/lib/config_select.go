@@ -0,0 +1,86 @@
+package lib
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+// Top-level keys of config for the lists selected by all outputs.
+var selectionKeys = []string{ArgWantedList.Name, ArgExcludedList.Name}
+
+// applyOutputSelection copies the top-level wantedList and excludedList of
+// the JSON config content into the args of each output supporting them.
+// Outputs specifying wantedList or excludedList of their own are left
+// unchanged, so that their selection is independent of the top-level one.
+func applyOutputSelection(content []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(content, &fields); err != nil {
+		return nil, err
+	}
+
+	selection := make(map[string]json.RawMessage, len(selectionKeys))
+	for _, key := range selectionKeys {
+		if data, found := fields[key]; found {
+			selection[key] = data
+		}
+	}
+	if len(selection) == 0 || len(fields["output"]) == 0 {
+		return content, nil
+	}
+
+	var outputs []map[string]json.RawMessage
+	if err := json.Unmarshal(fields["output"], &outputs); err != nil {
+		return nil, err
+	}
+
+	infos := OutputConverterInfos()
+	for _, output := range outputs {
+		var oType string
+		json.Unmarshal(output["type"], &oType)
+		idx := slices.IndexFunc(infos, func(info *ConverterInfo) bool {
+			return strings.EqualFold(info.Name, oType)
+		})
+		if idx < 0 {
+			continue
+		}
+
+		var args map[string]json.RawMessage
+		if len(output["args"]) > 0 {
+			if err := json.Unmarshal(output["args"], &args); err != nil {
+				return nil, err
+			}
+		}
+		if args == nil {
+			args = make(map[string]json.RawMessage)
+		}
+		if slices.ContainsFunc(selectionKeys, func(key string) bool { _, found := args[key]; return found }) {
+			continue
+		}
+
+		updated := false
+		for key, data := range selection {
+			if slices.ContainsFunc(infos[idx].Args, func(arg Arg) bool { return arg.Name == key }) {
+				args[key] = data
+				updated = true
+			}
+		}
+		if !updated {
+			continue
+		}
+
+		data, err := json.Marshal(args)
+		if err != nil {
+			return nil, err
+		}
+		output["args"] = data
+	}
+
+	data, err := json.Marshal(outputs)
+	if err != nil {
+		return nil, err
+	}
+	fields["output"] = data
+
+	return json.Marshal(fields)
+}
@@ -65,40 +65,30 @@ func (c *container) Add(entry *Entry, opts ...IgnoreIPOption) error {
 
 	switch found {
 	case true:
-		var ipv4set, ipv6set *netipx.IPSet
-		var err4, err6 error
-		if entry.hasIPv4Builder() {
-			ipv4set, err4 = entry.ipv4Builder.IPSet()
-			if err4 != nil {
-				return err4
-			}
-		}
-		if entry.hasIPv6Builder() {
-			ipv6set, err6 = entry.ipv6Builder.IPSet()
-			if err6 != nil {
-				return err6
-			}
+		if err := entry.builderErr(); err != nil {
+			return err
 		}
+		val.addMetadata(entry.metadata)
 		switch ignoreIPType {
 		case IPv4:
 			if !val.hasIPv6Builder() {
-				val.ipv6Builder = new(netipx.IPSetBuilder)
+				val.ipv6Builder = new(prefixTrie)
 			}
-			val.ipv6Builder.AddSet(ipv6set)
+			val.ipv6Builder.AddTrie(entry.ipv6Builder)
 		case IPv6:
 			if !val.hasIPv4Builder() {
-				val.ipv4Builder = new(netipx.IPSetBuilder)
+				val.ipv4Builder = new(prefixTrie)
 			}
-			val.ipv4Builder.AddSet(ipv4set)
+			val.ipv4Builder.AddTrie(entry.ipv4Builder)
 		default:
 			if !val.hasIPv4Builder() {
-				val.ipv4Builder = new(netipx.IPSetBuilder)
+				val.ipv4Builder = new(prefixTrie)
 			}
 			if !val.hasIPv6Builder() {
-				val.ipv6Builder = new(netipx.IPSetBuilder)
+				val.ipv6Builder = new(prefixTrie)
 			}
-			val.ipv4Builder.AddSet(ipv4set)
-			val.ipv6Builder.AddSet(ipv6set)
+			val.ipv4Builder.AddTrie(entry.ipv4Builder)
+			val.ipv6Builder.AddTrie(entry.ipv6Builder)
 		}
 
 	case false:
@@ -130,41 +120,30 @@ func (c *container) Remove(entry *Entry, rCase CaseRemove, opts ...IgnoreIPOptio
 
 	switch rCase {
 	case CaseRemovePrefix:
-		var ipv4set, ipv6set *netipx.IPSet
-		var err4, err6 error
-		if entry.hasIPv4Builder() {
-			ipv4set, err4 = entry.ipv4Builder.IPSet()
-			if err4 != nil {
-				return err4
-			}
-		}
-		if entry.hasIPv6Builder() {
-			ipv6set, err6 = entry.ipv6Builder.IPSet()
-			if err6 != nil {
-				return err6
-			}
+		if err := entry.builderErr(); err != nil {
+			return err
 		}
 
 		switch ignoreIPType {
 		case IPv4:
 			if !val.hasIPv6Builder() {
-				val.ipv6Builder = new(netipx.IPSetBuilder)
+				val.ipv6Builder = new(prefixTrie)
 			}
-			val.ipv6Builder.RemoveSet(ipv6set)
+			val.ipv6Builder.RemoveTrie(entry.ipv6Builder)
 		case IPv6:
 			if !val.hasIPv4Builder() {
-				val.ipv4Builder = new(netipx.IPSetBuilder)
+				val.ipv4Builder = new(prefixTrie)
 			}
-			val.ipv4Builder.RemoveSet(ipv4set)
+			val.ipv4Builder.RemoveTrie(entry.ipv4Builder)
 		default:
 			if !val.hasIPv4Builder() {
-				val.ipv4Builder = new(netipx.IPSetBuilder)
+				val.ipv4Builder = new(prefixTrie)
 			}
 			if !val.hasIPv6Builder() {
-				val.ipv6Builder = new(netipx.IPSetBuilder)
+				val.ipv6Builder = new(prefixTrie)
 			}
-			val.ipv4Builder.RemoveSet(ipv4set)
-			val.ipv6Builder.RemoveSet(ipv6set)
+			val.ipv4Builder.RemoveTrie(entry.ipv4Builder)
+			val.ipv6Builder.RemoveTrie(entry.ipv6Builder)
 		}
 
 	case CaseRemoveEntry:
@@ -185,38 +164,22 @@ func (c *container) Remove(entry *Entry, rCase CaseRemove, opts ...IgnoreIPOptio
 }
 
 func (c *container) Lookup(ipOrCidr string, searchList ...string) ([]string, bool, error) {
-	switch strings.Contains(ipOrCidr, "/") {
-	case true: // CIDR
-		prefix, err := netip.ParsePrefix(ipOrCidr)
-		if err != nil {
-			return nil, false, err
-		}
-		addr := prefix.Addr().Unmap()
-		switch {
-		case addr.Is4():
-			return c.lookup(prefix, IPv4, searchList...)
-		case addr.Is6():
-			return c.lookup(prefix, IPv6, searchList...)
-		}
+	return lookup(c, ipOrCidr, searchList...)
+}
 
-	case false: // IP
-		addr, err := netip.ParseAddr(ipOrCidr)
-		if err != nil {
-			return nil, false, err
-		}
-		addr = addr.Unmap()
-		switch {
-		case addr.Is4():
-			return c.lookup(addr, IPv4, searchList...)
-		case addr.Is6():
-			return c.lookup(addr, IPv6, searchList...)
-		}
+// lookup returns the names of the entries of c containing the IP or CIDR.
+func lookup(c Container, ipOrCidr string, searchList ...string) ([]string, bool, error) {
+	prefix, iptype, err := ParsePrefix(ipOrCidr)
+	if err != nil {
+		return nil, false, err
 	}
-
-	return nil, false, nil
+	if prefix.IsSingleIP() {
+		return lookupEntries(c, prefix.Addr(), iptype, searchList...)
+	}
+	return lookupEntries(c, prefix, iptype, searchList...)
 }
 
-func (c *container) lookup(addrOrPrefix any, iptype IPType, searchList ...string) ([]string, bool, error) {
+func lookupEntries(c Container, addrOrPrefix any, iptype IPType, searchList ...string) ([]string, bool, error) {
 	searchMap := make(map[string]bool)
 	for _, name := range searchList {
 		if name = strings.ToUpper(strings.TrimSpace(name)); name != "" {
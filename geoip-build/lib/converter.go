@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"errors"
 	"fmt"
 	"sort"
 	"strings"
@@ -23,6 +24,8 @@ func ListInputConverter() {
 	}
 }
 
+// RegisterInputConverter registers c to describe the input converters of
+// type name, e.g. in the list of formats.
 func RegisterInputConverter(name string, c InputConverter) error {
 	name = strings.TrimSpace(name)
 	if _, ok := inputConverterMap[name]; ok {
@@ -44,6 +47,8 @@ func ListOutputConverter() {
 	}
 }
 
+// RegisterOutputConverter registers c to describe the output converters of
+// type name, e.g. in the list of formats.
 func RegisterOutputConverter(name string, c OutputConverter) error {
 	name = strings.TrimSpace(name)
 	if _, ok := outputConverterMap[name]; ok {
@@ -52,3 +57,47 @@ func RegisterOutputConverter(name string, c OutputConverter) error {
 	outputConverterMap[name] = c
 	return nil
 }
+
+// RegisterInput registers an input format of type iType, which is described
+// by info and whose input converters in config file are created by create.
+// Nothing is registered if the type has been registered. Formats must be
+// registered before any config file is loaded, typically in an init
+// function, since the registry is not safe for concurrent use.
+func RegisterInput(iType string, info InputConverter, create InputConfigCreator) error {
+	iType = strings.TrimSpace(iType)
+	if iType == "" || info == nil || create == nil {
+		return errors.New("type, converter and config creator must be specified")
+	}
+	if _, found := inputConverterMap[iType]; found {
+		return fmt.Errorf("input type %s: %w", iType, ErrDuplicatedConverter)
+	}
+	if _, found := inputConfigCreatorCache[strings.ToLower(iType)]; found {
+		return fmt.Errorf("input type %s: %w", iType, ErrDuplicatedConverter)
+	}
+
+	if err := RegisterInputConfigCreator(iType, create); err != nil {
+		return err
+	}
+	return RegisterInputConverter(iType, info)
+}
+
+// RegisterOutput registers an output format of type oType, which is
+// described by info and whose output converters in config file are created
+// by create, like RegisterInput.
+func RegisterOutput(oType string, info OutputConverter, create OutputConfigCreator) error {
+	oType = strings.TrimSpace(oType)
+	if oType == "" || info == nil || create == nil {
+		return errors.New("type, converter and config creator must be specified")
+	}
+	if _, found := outputConverterMap[oType]; found {
+		return fmt.Errorf("output type %s: %w", oType, ErrDuplicatedConverter)
+	}
+	if _, found := outputConfigCreatorCache[strings.ToLower(oType)]; found {
+		return fmt.Errorf("output type %s: %w", oType, ErrDuplicatedConverter)
+	}
+
+	if err := RegisterOutputConfigCreator(oType, create); err != nil {
+		return err
+	}
+	return RegisterOutputConverter(oType, info)
+}
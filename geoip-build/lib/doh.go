@@ -0,0 +1,316 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sourceClient is the HTTP client fetching remote sources and config files.
+var sourceClient = &http.Client{Transport: newSourceTransport(http.DefaultTransport)}
+
+// newSourceTransport returns the transport of sourceClient sending requests
+// by base.
+func newSourceTransport(base http.RoundTripper) http.RoundTripper {
+	return &headerTransport{base: &limitTransport{base: base}}
+}
+
+// SourceTransport returns the transport of the HTTP client fetching remote
+// sources, for other clients checking the same sources.
+func SourceTransport() http.RoundTripper {
+	return sourceClient.Transport
+}
+
+// SetDoH makes the hostnames of remote sources resolved by the DNS-over-HTTPS
+// endpoint, e.g. "https://dns.google/dns-query", instead of the system
+// resolver, for networks in which DNS is poisoned. The endpoint is connected
+// to at the IP bootstrap, which may be empty if the host of endpoint is an IP.
+// An empty endpoint restores the system resolver.
+func SetDoH(endpoint, bootstrap string) error {
+	endpoint, bootstrap = strings.TrimSpace(endpoint), strings.TrimSpace(bootstrap)
+	if endpoint == "" {
+		if bootstrap != "" {
+			return fmt.Errorf("DoH bootstrap IP requires a DoH endpoint")
+		}
+		sourceClient = &http.Client{Transport: newSourceTransport(http.DefaultTransport)}
+		return nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+		return fmt.Errorf("invalid DoH endpoint %q, must be an HTTPS URL", endpoint)
+	}
+
+	var bootstrapAddr netip.Addr
+	if bootstrap != "" {
+		if bootstrapAddr, err = netip.ParseAddr(bootstrap); err != nil {
+			return fmt.Errorf("invalid DoH bootstrap IP %q", bootstrap)
+		}
+	} else if bootstrapAddr, err = netip.ParseAddr(u.Hostname()); err != nil {
+		return fmt.Errorf("DoH bootstrap IP is required to connect to the DoH endpoint %s", u.Host)
+	}
+
+	// The endpoint is dialed at the bootstrap IP, keeping its hostname
+	// in the URL for the TLS handshake
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	dohTransport := http.DefaultTransport.(*http.Transport).Clone()
+	dohTransport.Proxy = nil
+	dohTransport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		return dialer.DialContext(ctx, network, net.JoinHostPort(bootstrapAddr.String(), port))
+	}
+
+	resolver := &dohResolver{
+		endpoint: u.String(),
+		client:   &http.Client{Transport: dohTransport, Timeout: 30 * time.Second},
+		dialer:   dialer,
+		cache:    make(map[string]*dohCacheEntry),
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = resolver.dialContext
+	sourceClient = &http.Client{Transport: newSourceTransport(transport)}
+	return nil
+}
+
+// DNS record types looked up by dohResolver.
+const (
+	dnsTypeA    = 1
+	dnsTypeAAAA = 28
+)
+
+// dohResolver resolves hostnames by the DoH endpoint in the wire format of
+// RFC 8484, caching the addresses for their TTL.
+type dohResolver struct {
+	endpoint string
+	client   *http.Client
+	dialer   *net.Dialer
+
+	mu    sync.Mutex
+	cache map[string]*dohCacheEntry
+}
+
+type dohCacheEntry struct {
+	addrs   []netip.Addr
+	expires time.Time
+}
+
+func (r *dohResolver) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		return r.dialer.DialContext(ctx, network, addr)
+	}
+
+	addrs, err := r.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, ip := range addrs {
+		if network == "tcp4" && !ip.Is4() || network == "tcp6" && !ip.Is6() {
+			continue
+		}
+		conn, err := r.dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("no %s address of %s is resolved by DoH", network, host)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// lookup returns the IPv4 addresses of host followed by the IPv6 ones.
+func (r *dohResolver) lookup(ctx context.Context, host string) ([]netip.Addr, error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	r.mu.Lock()
+	if entry, found := r.cache[host]; found && time.Now().Before(entry.expires) {
+		r.mu.Unlock()
+		return entry.addrs, nil
+	}
+	r.mu.Unlock()
+
+	var addrs []netip.Addr
+	var minTTL uint32
+	for _, qtype := range []uint16{dnsTypeA, dnsTypeAAAA} {
+		answers, ttl, err := r.query(ctx, host, qtype)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s by DoH: %w", host, err)
+		}
+		if len(answers) > 0 && (minTTL == 0 || ttl < minTTL) {
+			minTTL = ttl
+		}
+		addrs = append(addrs, answers...)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("failed to resolve %s by DoH: no address found", host)
+	}
+
+	r.mu.Lock()
+	r.cache[host] = &dohCacheEntry{addrs: addrs, expires: time.Now().Add(time.Duration(minTTL) * time.Second)}
+	r.mu.Unlock()
+
+	return addrs, nil
+}
+
+// query returns the addresses of the records of qtype of host, and the
+// minimum TTL of them in seconds.
+func (r *dohResolver) query(ctx context.Context, host string, qtype uint16) ([]netip.Addr, uint32, error) {
+	msg, err := newDNSQuery(host, qtype)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(msg))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("DoH endpoint %s: %s", r.endpoint, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return parseDNSAnswers(body, qtype)
+}
+
+// newDNSQuery returns the DNS message querying the records of qtype of
+// host, with ID 0 as recommended by RFC 8484 for HTTP caching.
+func newDNSQuery(host string, qtype uint16) ([]byte, error) {
+	if host == "" || len(host) > 253 {
+		return nil, fmt.Errorf("invalid hostname %q", host)
+	}
+
+	msg := []byte{
+		0, 0, // ID
+		1, 0, // flags with recursion desired
+		0, 1, // QDCOUNT
+		0, 0, // ANCOUNT
+		0, 0, // NSCOUNT
+		0, 0, // ARCOUNT
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 {
+			return nil, fmt.Errorf("invalid hostname %q", host)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, 1) // class IN
+
+	return msg, nil
+}
+
+var errInvalidDNSMessage = errors.New("invalid DNS message")
+
+// parseDNSAnswers returns the addresses of the answers of qtype in the DNS
+// message msg, skipping the other records like CNAME, and the minimum TTL
+// of them in seconds.
+func parseDNSAnswers(msg []byte, qtype uint16) ([]netip.Addr, uint32, error) {
+	if len(msg) < 12 {
+		return nil, 0, errInvalidDNSMessage
+	}
+	if rcode := msg[3] & 0x0f; rcode != 0 {
+		// NXDOMAIN is no address rather than a failure
+		if rcode == 3 {
+			return nil, 0, nil
+		}
+		return nil, 0, fmt.Errorf("DNS response code %d", rcode)
+	}
+	qdcount := binary.BigEndian.Uint16(msg[4:6])
+	ancount := binary.BigEndian.Uint16(msg[6:8])
+
+	off := 12
+	var err error
+	for i := 0; i < int(qdcount); i++ {
+		if off, err = skipDNSName(msg, off); err != nil {
+			return nil, 0, err
+		}
+		off += 4 // QTYPE and QCLASS
+	}
+
+	var addrs []netip.Addr
+	var minTTL uint32
+	for i := 0; i < int(ancount); i++ {
+		if off, err = skipDNSName(msg, off); err != nil {
+			return nil, 0, err
+		}
+		if off+10 > len(msg) {
+			return nil, 0, errInvalidDNSMessage
+		}
+		rtype := binary.BigEndian.Uint16(msg[off:])
+		ttl := binary.BigEndian.Uint32(msg[off+4:])
+		rdlength := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+rdlength > len(msg) {
+			return nil, 0, errInvalidDNSMessage
+		}
+		rdata := msg[off : off+rdlength]
+		off += rdlength
+
+		if rtype != qtype {
+			continue
+		}
+		addr, ok := netip.AddrFromSlice(rdata)
+		if !ok || qtype == dnsTypeA && !addr.Is4() || qtype == dnsTypeAAAA && !addr.Is6() {
+			return nil, 0, errInvalidDNSMessage
+		}
+		addrs = append(addrs, addr)
+		if minTTL == 0 || ttl < minTTL {
+			minTTL = ttl
+		}
+	}
+
+	return addrs, minTTL, nil
+}
+
+// skipDNSName returns the offset after the possibly compressed name at off
+// of msg.
+func skipDNSName(msg []byte, off int) (int, error) {
+	for {
+		if off >= len(msg) {
+			return 0, errInvalidDNSMessage
+		}
+		switch length := int(msg[off]); {
+		case length == 0:
+			return off + 1, nil
+		case length&0xc0 == 0xc0:
+			return off + 2, nil
+		default:
+			off += 1 + length
+		}
+	}
+}
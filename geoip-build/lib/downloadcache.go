@@ -0,0 +1,172 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// sharedDownload is a remote file downloaded once for all runs while the
+// download cache is enabled.
+type sharedDownload struct {
+	done   chan struct{}
+	file   string
+	source *SourceVersion
+	err    error
+}
+
+// sharedDownloads are the remote files of the download cache by URL, which
+// is disabled if nil.
+var (
+	sharedMu        sync.Mutex
+	sharedDownloads map[string]*sharedDownload
+)
+
+// EnableDownloadCache keeps the remote files downloaded by input converters
+// in temporary files until RemoveDownloadCache is called, so that the runs
+// of several configs in one invocation download each of them only once. The
+// versions of the remote files read by a run are recorded as if they were
+// downloaded by it, to be written into its manifest.
+func EnableDownloadCache() {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	if sharedDownloads == nil {
+		sharedDownloads = make(map[string]*sharedDownload)
+	}
+}
+
+// RemoveDownloadCache removes the files of the download cache and disables it.
+// The files still being downloaded are removed once downloaded.
+func RemoveDownloadCache() {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	for _, d := range sharedDownloads {
+		select {
+		case <-d.done:
+			if d.err == nil {
+				os.Remove(d.file)
+			}
+		default:
+		}
+	}
+	sharedDownloads = nil
+}
+
+// openShared opens the file of url in the download cache, downloading it
+// if it is not there yet, or returns false if the cache is disabled.
+func openShared(ctx context.Context, url string) (io.ReadCloser, bool, error) {
+	file, found, err := sharedFile(ctx, url)
+	if !found || err != nil {
+		return nil, found, err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, true, err
+	}
+	return f, true, nil
+}
+
+// sharedFile returns the path to the file of url in the download cache,
+// downloading it if it is not there yet, or false if the cache is disabled.
+// Failed downloads are not cached, so that the next run tries them again.
+func sharedFile(ctx context.Context, url string) (string, bool, error) {
+	sharedMu.Lock()
+	if sharedDownloads == nil {
+		sharedMu.Unlock()
+		return "", false, nil
+	}
+	d, found := sharedDownloads[url]
+	if !found {
+		d = &sharedDownload{done: make(chan struct{})}
+		sharedDownloads[url] = d
+	}
+	sharedMu.Unlock()
+
+	if !found {
+		d.file, d.source, d.err = downloadShared(ctx, url)
+		sharedMu.Lock()
+		removed := sharedDownloads[url] != d
+		switch {
+		case removed && d.err == nil:
+			// The cache is removed while downloading, so the file is left
+			// to be removed here
+			os.Remove(d.file)
+			d.file, d.err = "", fmt.Errorf("download cache is removed while downloading %s", url)
+		case d.err != nil && !removed:
+			delete(sharedDownloads, url)
+		}
+		sharedMu.Unlock()
+		close(d.done)
+		return d.file, true, d.err
+	}
+
+	select {
+	case <-d.done:
+	case <-ctx.Done():
+		return "", true, ctx.Err()
+	}
+	if d.err != nil {
+		return "", true, d.err
+	}
+	recordSharedSource(d.source)
+	slog.Debug("♻️ reused download of "+url, "url", url, "bytes", d.source.Size)
+	return d.file, true, nil
+}
+
+// recordSharedSource records the version of a file of the download cache
+// unless it is already recorded since the last reset, as a run may read a
+// remote file more than once, e.g. to hash it for the parse cache.
+func recordSharedSource(source *SourceVersion) {
+	sourceMu.Lock()
+	defer sourceMu.Unlock()
+	for _, recorded := range sourceList {
+		if recorded.URL == source.URL {
+			return
+		}
+	}
+	copied := *source
+	sourceList = append(sourceList, &copied)
+}
+
+// downloadShared downloads the remote content of url into a temporary file,
+// and returns the path to it and the version of the content.
+func downloadShared(ctx context.Context, url string) (string, *SourceVersion, error) {
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", nil, WrapDownloadError(url, err)
+	}
+	resp, err := sourceClient.Do(req)
+	if err != nil {
+		return "", nil, WrapDownloadError(url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return "", nil, WrapDownloadError(url, fmt.Errorf("failed to get remote content -> %s: %s", url, resp.Status))
+	}
+
+	body := TrackRemoteReader(url, start, resp).(*remoteReader)
+	f, err := os.CreateTemp("", "geoip-download-")
+	if err != nil {
+		body.ReadCloser.Close()
+		return "", nil, err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		body.ReadCloser.Close()
+		f.Close()
+		os.Remove(f.Name())
+		return "", nil, WrapDownloadError(url, err)
+	}
+	body.Close()
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", nil, err
+	}
+
+	return f.Name(), body.source, nil
+}
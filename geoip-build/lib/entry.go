@@ -11,10 +11,11 @@ import (
 
 type Entry struct {
 	name        string
-	ipv4Builder *netipx.IPSetBuilder
-	ipv6Builder *netipx.IPSetBuilder
+	ipv4Builder *prefixTrie
+	ipv6Builder *prefixTrie
 	ipv4Set     *netipx.IPSet
 	ipv6Set     *netipx.IPSet
+	metadata    *ListMetadata
 }
 
 func NewEntry(name string) *Entry {
@@ -43,6 +44,17 @@ func (e *Entry) hasIPv6Set() bool {
 	return e.ipv6Set != nil
 }
 
+// builderErr returns the error of invalid CIDRs added to or removed from the entry.
+func (e *Entry) builderErr() error {
+	if e.hasIPv4Builder() && e.ipv4Builder.err != nil {
+		return e.ipv4Builder.err
+	}
+	if e.hasIPv6Builder() && e.ipv6Builder.err != nil {
+		return e.ipv6Builder.err
+	}
+	return nil
+}
+
 func (e *Entry) GetIPv4Set() (*netipx.IPSet, error) {
 	if err := e.buildIPSet(); err != nil {
 		return nil, err
@@ -67,125 +79,35 @@ func (e *Entry) GetIPv6Set() (*netipx.IPSet, error) {
 	return nil, fmt.Errorf("entry %s has no ipv6 set", e.GetName())
 }
 
-func (e *Entry) processPrefix(src any) (*netip.Prefix, IPType, error) {
+// processPrefix normalizes the IP or CIDR, keeping IPv4-mapped ones as IPv6
+// until the entry is added to the lists, see unmapIPv4.
+func (e *Entry) processPrefix(src any) (netip.Prefix, IPType, error) {
 	switch src := src.(type) {
 	case net.IP:
 		ip, ok := netipx.FromStdIP(src)
 		if !ok {
-			return nil, "", ErrInvalidIP
-		}
-		ip = ip.Unmap()
-		switch {
-		case ip.Is4():
-			prefix := netip.PrefixFrom(ip, 32)
-			return &prefix, IPv4, nil
-		case ip.Is6():
-			prefix := netip.PrefixFrom(ip, 128)
-			return &prefix, IPv6, nil
-		default:
-			return nil, "", ErrInvalidIPLength
+			return netip.Prefix{}, "", ErrInvalidIP
 		}
+		return normalizePrefix(netip.PrefixFrom(ip, ip.BitLen()), true)
 
 	case *net.IPNet:
 		prefix, ok := netipx.FromStdIPNet(src)
 		if !ok {
-			return nil, "", ErrInvalidIPNet
-		}
-		ip := prefix.Addr().Unmap()
-		switch {
-		case ip.Is4():
-			return &prefix, IPv4, nil
-		case ip.Is6():
-			return &prefix, IPv6, nil
-		default:
-			return nil, "", ErrInvalidIPLength
+			return netip.Prefix{}, "", ErrInvalidIPNet
 		}
+		return normalizePrefix(prefix, true)
 
 	case netip.Addr:
-		src = src.Unmap()
-		switch {
-		case src.Is4():
-			prefix := netip.PrefixFrom(src, 32)
-			return &prefix, IPv4, nil
-		case src.Is6():
-			prefix := netip.PrefixFrom(src, 128)
-			return &prefix, IPv6, nil
-		default:
-			return nil, "", ErrInvalidIPLength
-		}
+		return normalizePrefix(netip.PrefixFrom(src, src.BitLen()), true)
 
 	case *netip.Addr:
-		*src = (*src).Unmap()
-		switch {
-		case src.Is4():
-			prefix := netip.PrefixFrom(*src, 32)
-			return &prefix, IPv4, nil
-		case src.Is6():
-			prefix := netip.PrefixFrom(*src, 128)
-			return &prefix, IPv6, nil
-		default:
-			return nil, "", ErrInvalidIPLength
-		}
+		return normalizePrefix(netip.PrefixFrom(*src, src.BitLen()), true)
 
 	case netip.Prefix:
-		ip := src.Addr()
-		switch {
-		case ip.Is4():
-			prefix, err := ip.Prefix(src.Bits())
-			if err != nil {
-				return nil, "", ErrInvalidPrefix
-			}
-			return &prefix, IPv4, nil
-		case ip.Is4In6():
-			ip = ip.Unmap()
-			bits := src.Bits()
-			if bits < 96 {
-				return nil, "", ErrInvalidPrefix
-			}
-			prefix, err := ip.Prefix(bits - 96)
-			if err != nil {
-				return nil, "", ErrInvalidPrefix
-			}
-			return &prefix, IPv4, nil
-		case ip.Is6():
-			prefix, err := ip.Prefix(src.Bits())
-			if err != nil {
-				return nil, "", ErrInvalidPrefix
-			}
-			return &prefix, IPv6, nil
-		default:
-			return nil, "", ErrInvalidIPLength
-		}
+		return normalizePrefix(src, true)
 
 	case *netip.Prefix:
-		ip := src.Addr()
-		switch {
-		case ip.Is4():
-			prefix, err := ip.Prefix(src.Bits())
-			if err != nil {
-				return nil, "", ErrInvalidPrefix
-			}
-			return &prefix, IPv4, nil
-		case ip.Is4In6():
-			ip = ip.Unmap()
-			bits := src.Bits()
-			if bits < 96 {
-				return nil, "", ErrInvalidPrefix
-			}
-			prefix, err := ip.Prefix(bits - 96)
-			if err != nil {
-				return nil, "", ErrInvalidPrefix
-			}
-			return &prefix, IPv4, nil
-		case ip.Is6():
-			prefix, err := ip.Prefix(src.Bits())
-			if err != nil {
-				return nil, "", ErrInvalidPrefix
-			}
-			return &prefix, IPv6, nil
-		default:
-			return nil, "", ErrInvalidIPLength
-		}
+		return normalizePrefix(*src, true)
 
 	case string:
 		src, _, _ = strings.Cut(src, "#")
@@ -193,71 +115,26 @@ func (e *Entry) processPrefix(src any) (*netip.Prefix, IPType, error) {
 		src, _, _ = strings.Cut(src, "/*")
 		src = strings.TrimSpace(src)
 		if src == "" {
-			return nil, "", ErrCommentLine
-		}
-
-		switch strings.Contains(src, "/") {
-		case true: // src is CIDR notation
-			ip, network, err := net.ParseCIDR(src)
-			if err != nil {
-				return nil, "", ErrInvalidCIDR
-			}
-			addr, ok := netipx.FromStdIP(ip)
-			if !ok {
-				return nil, "", ErrInvalidIP
-			}
-			if addr.Unmap().Is4() && strings.Contains(network.String(), "::") { // src is invalid IPv4-mapped IPv6 address
-				return nil, "", ErrInvalidCIDR
-			}
-			prefix, ok := netipx.FromStdIPNet(network)
-			if !ok {
-				return nil, "", ErrInvalidIPNet
-			}
-
-			addr = prefix.Addr().Unmap()
-			switch {
-			case addr.Is4():
-				return &prefix, IPv4, nil
-			case addr.Is6():
-				return &prefix, IPv6, nil
-			default:
-				return nil, "", ErrInvalidIPLength
-			}
-
-		case false: // src is IP address
-			ip, err := netip.ParseAddr(src)
-			if err != nil {
-				return nil, "", ErrInvalidIP
-			}
-			ip = ip.Unmap()
-			switch {
-			case ip.Is4():
-				prefix := netip.PrefixFrom(ip, 32)
-				return &prefix, IPv4, nil
-			case ip.Is6():
-				prefix := netip.PrefixFrom(ip, 128)
-				return &prefix, IPv6, nil
-			default:
-				return nil, "", ErrInvalidIPLength
-			}
+			return netip.Prefix{}, "", ErrCommentLine
 		}
+		return parsePrefix(src, true)
 	}
 
-	return nil, "", ErrInvalidPrefixType
+	return netip.Prefix{}, "", ErrInvalidPrefixType
 }
 
-func (e *Entry) add(prefix *netip.Prefix, ipType IPType) error {
+func (e *Entry) add(prefix netip.Prefix, ipType IPType) error {
 	switch ipType {
 	case IPv4:
 		if !e.hasIPv4Builder() {
-			e.ipv4Builder = new(netipx.IPSetBuilder)
+			e.ipv4Builder = new(prefixTrie)
 		}
-		e.ipv4Builder.AddPrefix(*prefix)
+		e.ipv4Builder.AddPrefix(prefix)
 	case IPv6:
 		if !e.hasIPv6Builder() {
-			e.ipv6Builder = new(netipx.IPSetBuilder)
+			e.ipv6Builder = new(prefixTrie)
 		}
-		e.ipv6Builder.AddPrefix(*prefix)
+		e.ipv6Builder.AddPrefix(prefix)
 	default:
 		return ErrInvalidIPType
 	}
@@ -265,15 +142,15 @@ func (e *Entry) add(prefix *netip.Prefix, ipType IPType) error {
 	return nil
 }
 
-func (e *Entry) remove(prefix *netip.Prefix, ipType IPType) error {
+func (e *Entry) remove(prefix netip.Prefix, ipType IPType) error {
 	switch ipType {
 	case IPv4:
 		if e.hasIPv4Builder() {
-			e.ipv4Builder.RemovePrefix(*prefix)
+			e.ipv4Builder.RemovePrefix(prefix)
 		}
 	case IPv6:
 		if e.hasIPv6Builder() {
-			e.ipv6Builder.RemovePrefix(*prefix)
+			e.ipv6Builder.RemovePrefix(prefix)
 		}
 	default:
 		return ErrInvalidIPType
@@ -282,6 +159,9 @@ func (e *Entry) remove(prefix *netip.Prefix, ipType IPType) error {
 	return nil
 }
 
+// AddPrefix adds the IP or CIDR to the entry. IPv4-mapped IPv6 ones are
+// kept as IPv6 until the entry is added to the lists by an input, which
+// converts them by its mappedIPv4.
 func (e *Entry) AddPrefix(cidr any) error {
 	prefix, ipType, err := e.processPrefix(cidr)
 	if err != nil && err != ErrCommentLine {
@@ -343,14 +223,14 @@ func (e *Entry) MarshalPrefix(opts ...IgnoreIPOption) ([]netip.Prefix, error) {
 		return nil, err
 	}
 
-	prefixes := make([]netip.Prefix, 0, 1024)
+	var prefixes []netip.Prefix
 
 	if !disableIPv4 && e.hasIPv4Set() {
-		prefixes = append(prefixes, e.ipv4Set.Prefixes()...)
+		prefixes = appendSetPrefixes(prefixes, e.ipv4Set)
 	}
 
 	if !disableIPv6 && e.hasIPv6Set() {
-		prefixes = append(prefixes, e.ipv6Set.Prefixes()...)
+		prefixes = appendSetPrefixes(prefixes, e.ipv6Set)
 	}
 
 	if len(prefixes) > 0 {
@@ -379,10 +259,10 @@ func (e *Entry) MarshalIPRange(opts ...IgnoreIPOption) ([]netipx.IPRange, error)
 		return nil, err
 	}
 
-	ipranges := make([]netipx.IPRange, 0, 1024)
+	var ipranges []netipx.IPRange
 
 	if !disableIPv4 && e.hasIPv4Set() {
-		ipranges = append(ipranges, e.ipv4Set.Ranges()...)
+		ipranges = e.ipv4Set.Ranges()
 	}
 
 	if !disableIPv6 && e.hasIPv6Set() {
@@ -415,19 +295,29 @@ func (e *Entry) MarshalText(opts ...IgnoreIPOption) ([]string, error) {
 		return nil, err
 	}
 
-	cidrList := make([]string, 0, 1024)
-
+	var ipv4Prefixes, ipv6Prefixes []netip.Prefix
 	if !disableIPv4 && e.hasIPv4Set() {
-		for _, prefix := range e.ipv4Set.Prefixes() {
-			cidrList = append(cidrList, prefix.String())
-		}
+		ipv4Prefixes = appendSetPrefixes(nil, e.ipv4Set)
 	}
-
 	if !disableIPv6 && e.hasIPv6Set() {
-		for _, prefix := range e.ipv6Set.Prefixes() {
-			cidrList = append(cidrList, prefix.String())
+		ipv6Prefixes = appendSetPrefixes(nil, e.ipv6Set)
+	}
+
+	// all CIDRs are formatted into one buffer to allocate once instead of per CIDR
+	cidrList := make([]string, 0, len(ipv4Prefixes)+len(ipv6Prefixes))
+	buf := make([]byte, 0, len(ipv4Prefixes)*len("255.255.255.255/32")+len(ipv6Prefixes)*len("ffff:ffff:ffff:ffff::/64"))
+	for _, prefixes := range [][]netip.Prefix{ipv4Prefixes, ipv6Prefixes} {
+		for _, prefix := range prefixes {
+			buf = prefix.AppendTo(buf)
+			buf = append(buf, '\n')
 		}
 	}
+	text := string(buf)
+	for len(text) > 0 {
+		cidr, rest, _ := strings.Cut(text, "\n")
+		cidrList = append(cidrList, cidr)
+		text = rest
+	}
 
 	if len(cidrList) > 0 {
 		return cidrList, nil
@@ -435,3 +325,54 @@ func (e *Entry) MarshalText(opts ...IgnoreIPOption) ([]string, error) {
 
 	return nil, fmt.Errorf("entry %s has no prefix", e.GetName())
 }
+
+// appendSetPrefixes appends the CIDRs of set to dst. Unlike set.Prefixes,
+// it does not allocate a slice for each IP range of set.
+func appendSetPrefixes(dst []netip.Prefix, set *netipx.IPSet) []netip.Prefix {
+	ranges := set.Ranges()
+	if dst == nil {
+		dst = make([]netip.Prefix, 0, len(ranges))
+	}
+	for _, r := range ranges {
+		dst = r.AppendPrefixes(dst)
+	}
+	return dst
+}
+
+// CountPrefix returns the number of IPv4 and IPv6 prefixes of the entry.
+func (e *Entry) CountPrefix() (int, int, error) {
+	if err := e.buildIPSet(); err != nil {
+		return 0, 0, err
+	}
+
+	ipv4Count, ipv6Count := 0, 0
+	if e.hasIPv4Set() {
+		ipv4Count = len(appendSetPrefixes(nil, e.ipv4Set))
+	}
+	if e.hasIPv6Set() {
+		ipv6Count = len(appendSetPrefixes(nil, e.ipv6Set))
+	}
+
+	return ipv4Count, ipv6Count, nil
+}
+
+// ContainsPrefix reports whether the prefix is fully contained in the entry.
+func (e *Entry) ContainsPrefix(prefix netip.Prefix) (bool, error) {
+	if err := e.buildIPSet(); err != nil {
+		return false, err
+	}
+
+	switch {
+	case prefix.Addr().Is4():
+		if e.hasIPv4Set() && e.ipv4Set.ContainsPrefix(prefix) {
+			return true, nil
+		}
+		// IPv4-mapped IPv6 CIDRs kept as IPv6 contain the same IPv4 CIDRs
+		mapped := netip.PrefixFrom(netip.AddrFrom16(prefix.Addr().As16()), prefix.Bits()+96)
+		return e.hasIPv6Set() && e.ipv6Set.ContainsPrefix(mapped), nil
+	case prefix.Addr().Is6():
+		return e.hasIPv6Set() && e.ipv6Set.ContainsPrefix(prefix), nil
+	}
+
+	return false, ErrInvalidPrefix
+}
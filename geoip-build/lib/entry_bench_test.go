@@ -0,0 +1,166 @@
+package lib
+
+import (
+	"math/rand/v2"
+	"net/netip"
+	"testing"
+)
+
+// The sizes of the lists of the benchmarks, which are about the ones of the
+// largest countries.
+const (
+	benchIPv4CIDRs = 150000
+	benchIPv6CIDRs = 50000
+)
+
+// benchPrefixes returns n4 IPv4 and n6 IPv6 random CIDRs of seed, which are
+// the same in every run.
+func benchPrefixes(seed uint64, n4, n6 int) []netip.Prefix {
+	r := rand.New(rand.NewPCG(seed, seed))
+	prefixes := make([]netip.Prefix, 0, n4+n6)
+	for range n4 {
+		addr := netip.AddrFrom4([4]byte{byte(r.IntN(224)), byte(r.Uint32()), byte(r.Uint32()), byte(r.Uint32())})
+		prefixes = append(prefixes, netip.PrefixFrom(addr, 16+r.IntN(16)).Masked())
+	}
+	for range n6 {
+		var b [16]byte
+		b[0], b[1] = 0x20, byte(r.Uint32())
+		for i := 2; i < 8; i++ {
+			b[i] = byte(r.Uint32())
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(netip.AddrFrom16(b), 32+r.IntN(32)).Masked())
+	}
+	return prefixes
+}
+
+// benchEntry returns an entry of prefixes with its IP sets not built.
+func benchEntry(b *testing.B, name string, prefixes []netip.Prefix) *Entry {
+	entry := NewEntry(name)
+	for _, prefix := range prefixes {
+		if err := entry.AddPrefix(prefix); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return entry
+}
+
+// BenchmarkContainerMerge merges two entries of the same name, e.g. the
+// lists of a country generated by two inputs, and builds the IP sets.
+func BenchmarkContainerMerge(b *testing.B) {
+	prefixes := benchPrefixes(1, benchIPv4CIDRs, benchIPv6CIDRs)
+	half := len(prefixes) / 2
+	b.ReportAllocs()
+	for range b.N {
+		b.StopTimer()
+		first, second := benchEntry(b, "cn", prefixes[:half]), benchEntry(b, "cn", prefixes[half:])
+		container := NewContainer()
+		b.StartTimer()
+
+		if err := container.Add(first); err != nil {
+			b.Fatal(err)
+		}
+		if err := container.Add(second); err != nil {
+			b.Fatal(err)
+		}
+		entry, _ := container.GetEntry("cn")
+		if err := entry.buildIPSet(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkEntryAggregate adds the halves of the CIDRs one by one, which
+// are aggregated into them, and builds the IP sets.
+func BenchmarkEntryAggregate(b *testing.B) {
+	prefixes := benchPrefixes(1, benchIPv4CIDRs, benchIPv6CIDRs)
+	halves := make([]netip.Prefix, 0, 2*len(prefixes))
+	for _, prefix := range prefixes {
+		lower := netip.PrefixFrom(prefix.Addr(), prefix.Bits()+1)
+		upper := netip.PrefixFrom(setAddrBit(prefix.Addr(), prefix.Bits()), prefix.Bits()+1)
+		halves = append(halves, lower, upper)
+	}
+	b.ReportAllocs()
+	for range b.N {
+		entry := benchEntry(b, "cn", halves)
+		if err := entry.buildIPSet(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkContainerRemove removes the CIDRs of an entry from the list of
+// the same name, e.g. the bogons removed from a country, and builds the IP
+// sets.
+func BenchmarkContainerRemove(b *testing.B) {
+	prefixes := benchPrefixes(1, benchIPv4CIDRs, benchIPv6CIDRs)
+	removed := benchPrefixes(2, benchIPv4CIDRs/10, benchIPv6CIDRs/10)
+	b.ReportAllocs()
+	for range b.N {
+		b.StopTimer()
+		container := NewContainer()
+		if err := container.Add(benchEntry(b, "cn", prefixes)); err != nil {
+			b.Fatal(err)
+		}
+		remove := benchEntry(b, "cn", removed)
+		b.StartTimer()
+
+		if err := container.Remove(remove, CaseRemovePrefix); err != nil {
+			b.Fatal(err)
+		}
+		entry, _ := container.GetEntry("cn")
+		if err := entry.buildIPSet(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkEntryAddPrefixString parses and adds the CIDRs in text form, as
+// the plaintext inputs do.
+func BenchmarkEntryAddPrefixString(b *testing.B) {
+	prefixes := benchPrefixes(1, benchIPv4CIDRs, benchIPv6CIDRs)
+	cidrs := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		cidrs = append(cidrs, prefix.String())
+	}
+	b.ReportAllocs()
+	for range b.N {
+		entry := NewEntry("cn")
+		for _, cidr := range cidrs {
+			if err := entry.AddPrefix(cidr); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkEntryMarshalText formats the CIDRs of an entry with its IP sets
+// built, as the plaintext outputs do.
+func BenchmarkEntryMarshalText(b *testing.B) {
+	entry := benchEntry(b, "cn", benchPrefixes(1, benchIPv4CIDRs, benchIPv6CIDRs))
+	if err := entry.buildIPSet(); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		if _, err := entry.MarshalText(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkEntryMarshalPrefix collects the CIDRs of an entry with its IP
+// sets built, as the binary outputs do.
+func BenchmarkEntryMarshalPrefix(b *testing.B) {
+	entry := benchEntry(b, "cn", benchPrefixes(1, benchIPv4CIDRs, benchIPv6CIDRs))
+	if err := entry.buildIPSet(); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		if _, err := entry.MarshalPrefix(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
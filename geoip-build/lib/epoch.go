@@ -0,0 +1,30 @@
+package lib
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var buildEpoch int64
+
+// SetBuildEpoch sets the build timestamp as Unix epoch value to be embedded
+// in outputs. Zero means the default build timestamp.
+func SetBuildEpoch(epoch int64) {
+	buildEpoch = epoch
+}
+
+// BuildEpoch returns the build timestamp as Unix epoch value to be embedded
+// in outputs, so that outputs are reproducible given identical inputs.
+// It defaults to the value of the SOURCE_DATE_EPOCH environment variable,
+// or the current time if not set.
+func BuildEpoch() int64 {
+	if buildEpoch != 0 {
+		return buildEpoch
+	}
+	if epoch, err := strconv.ParseInt(strings.TrimSpace(os.Getenv("SOURCE_DATE_EPOCH")), 10, 64); err == nil && epoch > 0 {
+		return epoch
+	}
+	return time.Now().Unix()
+}
@@ -0,0 +1,70 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"text/tabwriter"
+)
+
+// SourceFailure is an input converter that failed and was skipped.
+type SourceFailure struct {
+	Type     string `json:"type"`
+	Action   Action `json:"action"`
+	Optional bool   `json:"optional"`
+	Error    string `json:"error"`
+}
+
+// SetMaxFailures sets the number of failed input converters not marked
+// as optional to be skipped before the run fails. Zero means any failure
+// of such input converters fails the run.
+func (i *Instance) SetMaxFailures(n int) {
+	i.maxFailures = n
+}
+
+// Failures returns the input converters that failed and were skipped in the last run.
+func (i *Instance) Failures() []*SourceFailure {
+	return i.failures
+}
+
+// tolerateFailure records the failure of the input converter and returns nil
+// if it is optional or the failure threshold is not reached yet.
+// Otherwise, err is returned.
+func (i *Instance) tolerateFailure(ic InputConverter, optional bool, err error) error {
+	if !optional {
+		required := 0
+		for _, f := range i.failures {
+			if !f.Optional {
+				required++
+			}
+		}
+		if required >= i.maxFailures {
+			return err
+		}
+	}
+
+	i.failures = append(i.failures, &SourceFailure{
+		Type:     ic.GetType(),
+		Action:   ic.GetAction(),
+		Optional: optional,
+		Error:    err.Error(),
+	})
+	slog.Warn(fmt.Sprintf("⚠️ [%s] %s failed and skipped: %s", ic.GetType(), ic.GetAction(), err), "type", ic.GetType(), "action", ic.GetAction(), "optional", optional)
+
+	return nil
+}
+
+// PrintFailures writes the failed input converters in table format.
+func PrintFailures(w io.Writer, failures []*SourceFailure) {
+	if len(failures) == 0 {
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "FAILED SOURCE\tACTION\tOPTIONAL\tERROR\t")
+	for _, f := range failures {
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%s\t\n", f.Type, f.Action, f.Optional, f.Error)
+	}
+	tw.Flush()
+}
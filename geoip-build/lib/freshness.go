@@ -0,0 +1,142 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Actions for the remote files of an input converter older than its maxAge.
+const (
+	StaleActionWarn = "warn"
+	StaleActionFail = "fail"
+)
+
+// Freshness is the maximum age of the remote files of an input converter,
+// checked against their Last-Modified headers before running it.
+type Freshness struct {
+	MaxAge time.Duration
+	// OnStale is either StaleActionWarn or StaleActionFail.
+	OnStale string
+
+	urls []string
+}
+
+// ParseMaxAge parses the maxAge of an input converter, which is a
+// duration like "36h" or a number of days like "7d".
+func ParseMaxAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if days, found := strings.CutSuffix(s, "d"); found {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid maxAge %q", s)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid maxAge %q", s)
+	}
+	return d, nil
+}
+
+// newFreshness returns the freshness of an input converter with args,
+// or nil if maxAge is empty.
+func newFreshness(maxAge, onStale string, args json.RawMessage) (*Freshness, error) {
+	if maxAge == "" {
+		if onStale != "" {
+			return nil, fmt.Errorf("onStale must be used with maxAge")
+		}
+		return nil, nil
+	}
+
+	d, err := ParseMaxAge(maxAge)
+	if err != nil {
+		return nil, err
+	}
+
+	switch onStale {
+	case "":
+		onStale = StaleActionFail
+	case StaleActionWarn, StaleActionFail:
+	default:
+		return nil, fmt.Errorf("invalid onStale %q, available options: %s, %s", onStale, StaleActionWarn, StaleActionFail)
+	}
+
+	var decoded any
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &decoded); err != nil {
+			return nil, err
+		}
+	}
+	urls := findURLs(decoded)
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("maxAge is only supported by inputs with remote HTTP(S) files")
+	}
+
+	return &Freshness{MaxAge: d, OnStale: onStale, urls: urls}, nil
+}
+
+// Stale reports whether lastModified is older than the maxAge at now.
+func (f *Freshness) Stale(lastModified, now time.Time) bool {
+	return now.Sub(lastModified) > f.MaxAge
+}
+
+// check checks the Last-Modified headers of the remote files of the input
+// converter against the freshness, and returns the error of the first
+// stale file if it should fail the run.
+func (f *Freshness) check(ic InputConverter) error {
+	now := time.Now()
+	for _, url := range f.urls {
+		lastModified, err := GetRemoteLastModified(url)
+		if err != nil {
+			return WrapDownloadError(url, err)
+		}
+		if lastModified.IsZero() {
+			slog.Warn(fmt.Sprintf("⚠️ [%s] %s has no Last-Modified header, freshness unknown", ic.GetType(), url), "type", ic.GetType(), "url", url)
+			continue
+		}
+		if !f.Stale(lastModified, now) {
+			continue
+		}
+
+		age := now.Sub(lastModified).Round(time.Minute)
+		if f.OnStale == StaleActionWarn {
+			slog.Warn(fmt.Sprintf("⚠️ [%s] %s was last modified %s ago, older than maxAge %s", ic.GetType(), url, age, f.MaxAge), "type", ic.GetType(), "url", url, "lastModified", lastModified, "maxAge", f.MaxAge)
+			continue
+		}
+		return WrapDownloadError(url, fmt.Errorf("❌ [type %s | action %s] %s was last modified %s ago, older than maxAge %s", ic.GetType(), ic.GetAction(), url, age, f.MaxAge))
+	}
+
+	return nil
+}
+
+// GetRemoteLastModified returns the time in the Last-Modified header of url,
+// which is zero if the header is missing. A HEAD request is sent first,
+// falling back to GET if it is not allowed.
+func GetRemoteLastModified(url string) (time.Time, error) {
+	resp, err := sourceClient.Head(url)
+	if err == nil && resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		resp, err = sourceClient.Get(url)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("failed to get remote content -> %s: %s", url, resp.Status)
+	}
+
+	header := resp.Header.Get("Last-Modified")
+	if header == "" {
+		return time.Time{}, nil
+	}
+	return http.ParseTime(header)
+}
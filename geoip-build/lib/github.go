@@ -0,0 +1,296 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GitHubReleaseConfig is the configuration of a GitHub release to publish artifacts to.
+type GitHubReleaseConfig struct {
+	// APIURL is the base URL of the GitHub REST API, e.g. "https://api.github.com".
+	APIURL string
+	// Repo is the repository in the form of "owner/name".
+	Repo  string
+	Token string
+	// Tag is the tag of the release, in which "{date}", "{datetime}" and "{epoch}"
+	// are replaced with the build time, e.g. "{datetime}" for "202401020304".
+	Tag  string
+	Name string
+	Body string
+	// Checksums is the name of the sha256sum compatible checksum asset generated
+	// from all uploaded files, unless empty or a file of the same name exists.
+	Checksums string
+}
+
+// GitHubPublisher creates or updates a GitHub release and uploads files as its assets.
+type GitHubPublisher struct {
+	config GitHubReleaseConfig
+	client *http.Client
+}
+
+type githubRelease struct {
+	ID        int64          `json:"id"`
+	TagName   string         `json:"tag_name"`
+	HTMLURL   string         `json:"html_url"`
+	UploadURL string         `json:"upload_url"`
+	Assets    []*githubAsset `json:"assets"`
+}
+
+type githubAsset struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	Digest string `json:"digest"`
+}
+
+// NewGitHubPublisher returns the publisher of the release in config.
+func NewGitHubPublisher(config GitHubReleaseConfig) (*GitHubPublisher, error) {
+	if owner, name, found := strings.Cut(config.Repo, "/"); !found || owner == "" || name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("invalid repo %q, must be in the form of owner/name", config.Repo)
+	}
+	if config.Token == "" {
+		return nil, fmt.Errorf("token must be specified")
+	}
+	if config.APIURL == "" {
+		config.APIURL = "https://api.github.com"
+	}
+	config.APIURL = strings.TrimSuffix(config.APIURL, "/")
+
+	config.Tag = ExpandReleaseTag(config.Tag, time.Unix(BuildEpoch(), 0))
+	if config.Tag == "" {
+		return nil, fmt.Errorf("tag must be specified")
+	}
+	if config.Name == "" {
+		config.Name = config.Tag
+	} else {
+		config.Name = ExpandReleaseTag(config.Name, time.Unix(BuildEpoch(), 0))
+	}
+
+	return &GitHubPublisher{
+		config: config,
+		client: &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+// Tag returns the tag of the release.
+func (p *GitHubPublisher) Tag() string {
+	return p.config.Tag
+}
+
+// ExpandReleaseTag replaces the placeholders "{date}", "{datetime}" and
+// "{epoch}" in pattern with t in UTC.
+func ExpandReleaseTag(pattern string, t time.Time) string {
+	t = t.UTC()
+	return strings.NewReplacer(
+		"{date}", t.Format("20060102"),
+		"{datetime}", t.Format("200601021504"),
+		"{epoch}", strconv.FormatInt(t.Unix(), 10),
+	).Replace(strings.TrimSpace(pattern))
+}
+
+// PublishDir creates the release, or updates it if it exists, and uploads
+// all files in dir as its assets, replacing the existing assets of the same
+// names. Assets with the same SHA256 checksum are kept untouched. It returns
+// the URL of the release and the number of uploaded files.
+func (p *GitHubPublisher) PublishDir(dir string) (string, int, error) {
+	assets, err := p.readAssets(dir)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if dryRun {
+		for _, name := range sortedKeys(assets) {
+			slog.Info(fmt.Sprintf("🚀 [github] %s %s (dry run, %d bytes)", p.config.Tag, name, len(assets[name])), "repo", p.config.Repo, "tag", p.config.Tag, "asset", name, "bytes", len(assets[name]), "dryRun", true)
+		}
+		return "", 0, nil
+	}
+
+	release, err := p.ensureRelease()
+	if err != nil {
+		return "", 0, err
+	}
+
+	existing := make(map[string]*githubAsset, len(release.Assets))
+	for _, asset := range release.Assets {
+		existing[asset.Name] = asset
+	}
+
+	uploaded := 0
+	for _, name := range sortedKeys(assets) {
+		data := assets[name]
+		sum := sha256.Sum256(data)
+		if asset, found := existing[name]; found {
+			if asset.Digest == "sha256:"+hex.EncodeToString(sum[:]) {
+				slog.Info(fmt.Sprintf("✅ [github] %s %s (unchanged)", p.config.Tag, name), "repo", p.config.Repo, "tag", p.config.Tag, "asset", name, "unchanged", true)
+				continue
+			}
+			if err := p.request(http.MethodDelete, fmt.Sprintf("%s/repos/%s/releases/assets/%d", p.config.APIURL, p.config.Repo, asset.ID), "", nil, nil); err != nil {
+				return "", uploaded, err
+			}
+		}
+
+		if err := p.uploadAsset(release, name, data); err != nil {
+			return "", uploaded, err
+		}
+		uploaded++
+		slog.Info(fmt.Sprintf("🚀 [github] %s %s", p.config.Tag, name), "repo", p.config.Repo, "tag", p.config.Tag, "asset", name, "bytes", len(data))
+	}
+
+	return release.HTMLURL, uploaded, nil
+}
+
+// readAssets reads all files in dir keyed by their names, which must be unique
+// since assets of a release cannot be in directories, and adds the checksum asset.
+func (p *GitHubPublisher) readAssets(dir string) (map[string][]byte, error) {
+	assets := make(map[string][]byte)
+	paths := make(map[string]string)
+	if err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		name := d.Name()
+		if other, found := paths[name]; found {
+			return fmt.Errorf("duplicated asset name %s of %s and %s", name, other, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		assets[name] = data
+		paths[name] = path
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if name := p.config.Checksums; name != "" && assets[name] == nil && len(assets) > 0 {
+		var sums strings.Builder
+		for _, asset := range sortedKeys(assets) {
+			fmt.Fprintf(&sums, "%x  %s\n", sha256.Sum256(assets[asset]), asset)
+		}
+		assets[name] = []byte(sums.String())
+	}
+
+	return assets, nil
+}
+
+// ensureRelease returns the release of the tag, creating it if not found,
+// or updating its name and body otherwise.
+func (p *GitHubPublisher) ensureRelease() (*githubRelease, error) {
+	release := new(githubRelease)
+	err := p.request(http.MethodGet, fmt.Sprintf("%s/repos/%s/releases/tags/%s", p.config.APIURL, p.config.Repo, url.PathEscape(p.config.Tag)), "", nil, release)
+
+	fields := map[string]any{"tag_name": p.config.Tag, "name": p.config.Name}
+	if p.config.Body != "" {
+		fields["body"] = p.config.Body
+	}
+	body, _ := json.Marshal(fields)
+
+	var statusErr *githubStatusError
+	switch {
+	case err == nil:
+		updated := new(githubRelease)
+		if err := p.request(http.MethodPatch, fmt.Sprintf("%s/repos/%s/releases/%d", p.config.APIURL, p.config.Repo, release.ID), "application/json", body, updated); err != nil {
+			return nil, err
+		}
+		slog.Info(fmt.Sprintf("🚀 [github] release %s updated", p.config.Tag), "repo", p.config.Repo, "tag", p.config.Tag)
+		return updated, nil
+
+	case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound:
+		created := new(githubRelease)
+		if err := p.request(http.MethodPost, fmt.Sprintf("%s/repos/%s/releases", p.config.APIURL, p.config.Repo), "application/json", body, created); err != nil {
+			return nil, err
+		}
+		slog.Info(fmt.Sprintf("🚀 [github] release %s created", p.config.Tag), "repo", p.config.Repo, "tag", p.config.Tag)
+		return created, nil
+
+	default:
+		return nil, err
+	}
+}
+
+func (p *GitHubPublisher) uploadAsset(release *githubRelease, name string, data []byte) error {
+	uploadURL, _, _ := strings.Cut(release.UploadURL, "{")
+	if uploadURL == "" {
+		return fmt.Errorf("release %s has no upload URL", release.TagName)
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	return p.request(http.MethodPost, uploadURL+"?name="+url.QueryEscape(name), contentType, data, nil)
+}
+
+// githubStatusError is the error of an unexpected status code of the GitHub API.
+type githubStatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func (e *githubStatusError) Error() string {
+	return fmt.Sprintf("%s %s: %s %s", e.Method, e.URL, e.Status, e.Message)
+}
+
+// request sends the request of the GitHub API and decodes the JSON response into v if not nil.
+func (p *GitHubPublisher) request(method, reqURL, contentType string, body []byte, v any) error {
+	req, err := http.NewRequest(method, reqURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+p.config.Token)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var message struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		json.Unmarshal(data, &message)
+		return &githubStatusError{Method: method, URL: reqURL, StatusCode: resp.StatusCode, Status: resp.Status, Message: message.Message}
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
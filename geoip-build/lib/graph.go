@@ -0,0 +1,138 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Graph is how the lists are composed by the input converters of config,
+// summarized from the provenance of a run.
+type Graph struct {
+	Inputs []*GraphInput `json:"inputs"`
+	Lists  []string      `json:"lists"`
+	Edges  []*GraphEdge  `json:"edges"`
+}
+
+// GraphInput is an input converter of Graph.
+type GraphInput struct {
+	Input  int    `json:"input"`
+	Type   string `json:"type"`
+	Source string `json:"source,omitempty"`
+}
+
+// GraphEdge is the change of List made by the input converter at Input.
+type GraphEdge struct {
+	Input  int    `json:"input"`
+	List   string `json:"list"`
+	Action Action `json:"action"`
+	// Prefixes is the number of CIDRs added or removed.
+	Prefixes int `json:"prefixes"`
+	// WholeList reports whether the whole list is removed.
+	WholeList bool `json:"wholeList,omitempty"`
+}
+
+// Graph returns the graph of the records, with inputs in the order of
+// config and lists sorted by name.
+func (p *Provenance) Graph() *Graph {
+	inputs := make(map[int]*GraphInput)
+	lists := make(map[string]bool)
+	edges := make(map[GraphEdge]*GraphEdge)
+
+	for _, record := range p.Records() {
+		if _, found := inputs[record.Input]; !found {
+			inputs[record.Input] = &GraphInput{Input: record.Input, Type: record.Type, Source: record.Source}
+		}
+		lists[record.List] = true
+
+		key := GraphEdge{Input: record.Input, List: record.List, Action: record.Action}
+		edge, found := edges[key]
+		if !found {
+			edge = &GraphEdge{Input: record.Input, List: record.List, Action: record.Action}
+			edges[key] = edge
+		}
+		if record.Prefix.IsValid() {
+			edge.Prefixes++
+		} else {
+			edge.WholeList = true
+		}
+	}
+
+	g := &Graph{
+		Inputs: make([]*GraphInput, 0, len(inputs)),
+		Lists:  sortedKeys(lists),
+		Edges:  make([]*GraphEdge, 0, len(edges)),
+	}
+	for _, input := range inputs {
+		g.Inputs = append(g.Inputs, input)
+	}
+	slices.SortFunc(g.Inputs, func(a, b *GraphInput) int {
+		return a.Input - b.Input
+	})
+	for _, edge := range edges {
+		g.Edges = append(g.Edges, edge)
+	}
+	slices.SortFunc(g.Edges, func(a, b *GraphEdge) int {
+		if a.Input != b.Input {
+			return a.Input - b.Input
+		}
+		if c := strings.Compare(a.List, b.List); c != 0 {
+			return c
+		}
+		return strings.Compare(string(a.Action), string(b.Action))
+	})
+
+	return g
+}
+
+// WriteJSON writes the graph to w in indented JSON format.
+func (g *Graph) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(g)
+}
+
+// WriteDOT writes the graph to w in Graphviz DOT format, with an edge from
+// each input converter to every list it changes, dashed for removals.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph geoip {\n")
+	b.WriteString("  rankdir=LR;\n")
+	for _, input := range g.Inputs {
+		label := fmt.Sprintf("input[%d] %s", input.Input, input.Type)
+		if input.Source != "" {
+			label += "\\n" + input.Source
+		}
+		fmt.Fprintf(&b, "  %s [shape=ellipse, label=%s];\n", dotQuote(graphInputID(input.Input)), dotQuote(label))
+	}
+	for _, list := range g.Lists {
+		fmt.Fprintf(&b, "  %s [shape=box, label=%s];\n", dotQuote(list), dotQuote(strings.ToLower(list)))
+	}
+	for _, edge := range g.Edges {
+		label := fmt.Sprintf("%s %d", edge.Action, edge.Prefixes)
+		if edge.WholeList {
+			label = fmt.Sprintf("%s (whole list)", edge.Action)
+		}
+		attrs := "label=" + dotQuote(label)
+		if edge.Action == ActionRemove {
+			attrs += ", style=dashed"
+		}
+		fmt.Fprintf(&b, "  %s -> %s [%s];\n", dotQuote(graphInputID(edge.Input)), dotQuote(edge.List), attrs)
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func graphInputID(input int) string {
+	return fmt.Sprintf("input[%d]", input)
+}
+
+// dotQuote quotes s as a DOT ID, keeping the escape sequences of labels
+// like "\n" written in s.
+func dotQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
@@ -0,0 +1,82 @@
+package lib
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// SourceHeader is a header sent with the requests to the remote sources and
+// config files at Host, or at all hosts if Host is empty.
+type SourceHeader struct {
+	Host  string
+	Name  string
+	Value string
+}
+
+var sourceHeaders []*SourceHeader
+
+// ParseSourceHeader parses a header in the form of "[host=]Name: Value",
+// e.g. "raw.githubusercontent.com=Authorization: Bearer ${GITHUB_TOKEN}",
+// the environment variable placeholders of which are expanded, so that
+// secrets are not written in command lines.
+func ParseSourceHeader(s string) (*SourceHeader, error) {
+	header := &SourceHeader{}
+	field := s
+	if host, rest, found := strings.Cut(s, "="); found && !strings.Contains(host, ":") {
+		header.Host = strings.ToLower(strings.TrimSpace(host))
+		field = rest
+	}
+
+	name, value, found := strings.Cut(field, ":")
+	header.Name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+	if !found || header.Name == "" || strings.ContainsAny(header.Name, " \t") {
+		return nil, fmt.Errorf("invalid header %q, must be in the form of [host=]Name: Value", s)
+	}
+
+	missing := make(map[string]bool)
+	header.Value = expandEnvString(strings.TrimSpace(value), missing)
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("environment variables used in header %s are not set: %s", header.Name, strings.Join(names, ", "))
+	}
+
+	return header, nil
+}
+
+// SetSourceHeaders sets the headers sent with the requests to remote
+// sources and config files.
+func SetSourceHeaders(headers []*SourceHeader) {
+	sourceHeaders = headers
+}
+
+// headerTransport sets sourceHeaders on the requests to remote sources and
+// config files. The headers of a host are set per request, so that they are
+// not sent to other hosts redirected to.
+type headerTransport struct {
+	base http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := strings.ToLower(req.URL.Hostname())
+	var cloned *http.Request
+	for _, header := range sourceHeaders {
+		if header.Host != "" && header.Host != host {
+			continue
+		}
+		// RoundTrip must not change the original request
+		if cloned == nil {
+			cloned = req.Clone(req.Context())
+		}
+		cloned.Header.Set(header.Name, header.Value)
+	}
+	if cloned == nil {
+		return t.base.RoundTrip(req)
+	}
+	return t.base.RoundTrip(cloned)
+}
@@ -0,0 +1,210 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// configKeyHooks is the key of the commands run after an output writes its
+// files.
+const configKeyHooks = "hooks"
+
+// hookPathsArg is the arg of the command of a hook that is expanded into
+// the paths of all files written by the output, one arg each.
+const hookPathsArg = "{{.Paths}}"
+
+// maxHookOutput is the number of bytes of the output of a failed hook
+// included in its error, the ones before which are dropped.
+const maxHookOutput = 2048
+
+// hookData is the data of the args of the command of a hook.
+type hookData struct {
+	// Type is the type of the output.
+	Type string
+	// Path, Dir and Name are the path, directory and file name of the file
+	// of the run of a hook with forEach.
+	Path string
+	Dir  string
+	Name string
+	// Lists are the lists in the file of the run of a hook with forEach.
+	Lists []string
+	// Paths are the paths of all files written by the output.
+	Paths []string
+}
+
+var hookFuncs = template.FuncMap{"join": strings.Join}
+
+// outputHook is an external command run after an output writes its files,
+// e.g. to validate or upload them. The output fails if the command exits
+// with a non-zero status.
+type outputHook struct {
+	command []*template.Template
+	forEach bool
+	timeout time.Duration
+	// raw is the config of the hook, hashed into the digest of the output
+	// so that changing it builds the output again in incremental builds.
+	raw json.RawMessage
+}
+
+// newOutputHooks parses the hooks of an output, of which the args of the
+// commands are checked with an example file.
+func newOutputHooks(data json.RawMessage) ([]*outputHook, error) {
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return nil, nil
+	}
+	var raws []json.RawMessage
+	var list []struct {
+		Command []string `json:"command"`
+		ForEach bool     `json:"forEach"`
+		Timeout string   `json:"timeout"`
+	}
+	if json.Unmarshal(data, &raws) != nil || json.Unmarshal(data, &list) != nil {
+		return nil, fmt.Errorf("%s: must be a list of objects with command, forEach and timeout", configKeyHooks)
+	}
+
+	example := &hookData{Type: "text", Path: "output/text/cn.txt", Dir: "output/text", Name: "cn.txt", Lists: []string{"cn"}, Paths: []string{"output/text/cn.txt"}}
+	hooks := make([]*outputHook, 0, len(list))
+	for idx, item := range list {
+		if len(item.Command) == 0 || strings.TrimSpace(item.Command[0]) == "" {
+			return nil, fmt.Errorf("%s[%d].command: must be a non-empty list of the program and its args", configKeyHooks, idx)
+		}
+		hook := &outputHook{forEach: item.ForEach, command: make([]*template.Template, 0, len(item.Command)), raw: raws[idx]}
+		for argIdx, arg := range item.Command {
+			tmpl, err := template.New(configKeyHooks).Funcs(hookFuncs).Option("missingkey=error").Parse(arg)
+			if err == nil && argIdx == 0 && isHookPathsArg(tmpl) {
+				err = fmt.Errorf("%s must not be the program, as an output may write no files", hookPathsArg)
+			}
+			if err == nil {
+				_, err = hook.expand(tmpl, example)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s[%d].command: %v", configKeyHooks, idx, err)
+			}
+			hook.command = append(hook.command, tmpl)
+		}
+		if item.Timeout != "" {
+			timeout, err := time.ParseDuration(item.Timeout)
+			if err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("%s[%d].timeout: invalid duration %q, must be positive like \"2m\"", configKeyHooks, idx, item.Timeout)
+			}
+			hook.timeout = timeout
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+// expand returns the args of tmpl with data, which are the paths of all
+// files for hookPathsArg.
+func (h *outputHook) expand(tmpl *template.Template, data *hookData) ([]string, error) {
+	if isHookPathsArg(tmpl) {
+		return data.Paths, nil
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return nil, err
+	}
+	return []string{b.String()}, nil
+}
+
+// isHookPathsArg reports whether the arg of tmpl is hookPathsArg.
+func isHookPathsArg(tmpl *template.Template) bool {
+	return strings.TrimSpace(tmpl.Root.String()) == hookPathsArg
+}
+
+// run runs the hook for the artifacts written by the output converter oc,
+// once for each of them with forEach, or once for all of them otherwise.
+func (h *outputHook) run(ctx context.Context, oc OutputConverter, artifacts []*Artifact) error {
+	paths := make([]string, 0, len(artifacts))
+	for _, artifact := range artifacts {
+		paths = append(paths, artifact.Path)
+	}
+
+	if !h.forEach {
+		return h.exec(ctx, oc, &hookData{Type: oc.GetType(), Paths: paths})
+	}
+	for _, artifact := range artifacts {
+		data := &hookData{
+			Type:  oc.GetType(),
+			Path:  artifact.Path,
+			Dir:   filepath.Dir(artifact.Path),
+			Name:  filepath.Base(artifact.Path),
+			Lists: artifact.Lists,
+			Paths: paths,
+		}
+		if err := h.exec(ctx, oc, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *outputHook) exec(ctx context.Context, oc OutputConverter, data *hookData) error {
+	args := make([]string, 0, len(h.command))
+	for _, tmpl := range h.command {
+		expanded, err := h.expand(tmpl, data)
+		if err != nil {
+			return fmt.Errorf("❌ [type %s | action %s] invalid %s: %v", oc.GetType(), oc.GetAction(), configKeyHooks, err)
+		}
+		args = append(args, expanded...)
+	}
+	if len(args) == 0 || args[0] == "" {
+		return fmt.Errorf("❌ [type %s | action %s] invalid %s: the program is empty", oc.GetType(), oc.GetAction(), configKeyHooks)
+	}
+	line := strings.Join(args, " ")
+
+	if IsDryRun() {
+		slog.Info(fmt.Sprintf("📝 [%s] %s hook skipped (dry run): %s", oc.GetType(), oc.GetAction(), line), "type", oc.GetType(), "action", oc.GetAction(), "command", line, "dryRun", true)
+		return nil
+	}
+
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	output, err := cmd.CombinedOutput()
+	output = bytes.TrimSpace(output)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+		if len(output) > maxHookOutput {
+			output = append([]byte("..."), output[len(output)-maxHookOutput:]...)
+		}
+		if len(output) > 0 {
+			return fmt.Errorf("❌ [type %s | action %s] hook %s failed: %w\n%s", oc.GetType(), oc.GetAction(), line, err, output)
+		}
+		return fmt.Errorf("❌ [type %s | action %s] hook %s failed: %w", oc.GetType(), oc.GetAction(), line, err)
+	}
+
+	slog.Info(fmt.Sprintf("🪝 [%s] %s hook done: %s", oc.GetType(), oc.GetAction(), line), "type", oc.GetType(), "action", oc.GetAction(), "command", line, "duration", time.Since(start).Round(time.Millisecond).String(), "output", string(output))
+	return nil
+}
+
+// runOutputHooks runs the hooks of the output converter at idx in order
+// with the artifacts it wrote, stopping at the first failed one. They are
+// also run with the artifacts reused in incremental builds, as with the
+// files left unchanged in other builds.
+func (i *Instance) runOutputHooks(ctx context.Context, idx int, artifacts []*Artifact) error {
+	if idx >= len(i.outputHooks) {
+		return nil
+	}
+	for _, hook := range i.outputHooks[idx] {
+		if err := hook.run(ctx, i.output[idx], artifacts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
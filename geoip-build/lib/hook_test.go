@@ -0,0 +1,207 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNewOutputHooks(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{name: "none", data: ""},
+		{name: "null", data: "null"},
+		{name: "valid", data: `[{"command": ["echo", "{{.Type}}", "{{.Paths}}"], "timeout": "1m"}, {"command": ["echo", "{{.Name}}"], "forEach": true}]`},
+		{name: "not a list", data: `{"command": ["echo"]}`, err: "must be a list of objects"},
+		{name: "empty command", data: `[{"command": []}]`, err: "hooks[0].command: must be a non-empty list"},
+		{name: "empty program", data: `[{"command": [" "]}]`, err: "hooks[0].command: must be a non-empty list"},
+		{name: "paths as program", data: `[{"command": ["{{.Paths}}"]}]`, err: "{{.Paths}} must not be the program"},
+		{name: "paths as spaced program", data: `[{"command": ["{{ .Paths }}", "-v"]}]`, err: "{{.Paths}} must not be the program"},
+		{name: "invalid template", data: `[{"command": ["echo", "{{.Path"]}]`, err: "hooks[0].command"},
+		{name: "unknown field", data: `[{"command": ["echo"]}, {"command": ["echo", "{{.File}}"]}]`, err: "hooks[1].command"},
+		{name: "invalid timeout", data: `[{"command": ["echo"], "timeout": "soon"}]`, err: `invalid duration "soon"`},
+		{name: "zero timeout", data: `[{"command": ["echo"], "timeout": "0s"}]`, err: "must be positive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newOutputHooks([]byte(tt.data))
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("newOutputHooks error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("newOutputHooks error = %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
+
+// testHook returns the only hook of the config data.
+func testHook(t *testing.T, data string) *outputHook {
+	t.Helper()
+	hooks, err := newOutputHooks([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hooks) != 1 {
+		t.Fatalf("newOutputHooks returns %d hooks, want 1", len(hooks))
+	}
+	return hooks[0]
+}
+
+func TestOutputHookExpand(t *testing.T) {
+	hook := testHook(t, `[{"command": ["echo", "{{.Type}}:{{.Name}}", "{{.Dir}}", "{{join .Lists \",\"}}", "{{.Paths}}", "n={{len .Paths}}"]}]`)
+	data := &hookData{
+		Type:  "text",
+		Path:  "output/text/cn.txt",
+		Dir:   "output/text",
+		Name:  "cn.txt",
+		Lists: []string{"cn", "private"},
+		Paths: []string{"output/text/cn.txt", "output/text/us.txt"},
+	}
+
+	var got []string
+	for _, tmpl := range hook.command {
+		args, err := hook.expand(tmpl, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, args...)
+	}
+	want := []string{"echo", "text:cn.txt", "output/text", "cn,private", "output/text/cn.txt", "output/text/us.txt", "n=2"}
+	if !slices.Equal(got, want) {
+		t.Errorf("args = %q, want %q", got, want)
+	}
+
+	// No files written expand into no args
+	args, err := hook.expand(hook.command[4], &hookData{Type: "text"})
+	if err != nil || len(args) != 0 {
+		t.Errorf("args of no files = %q, %v, want none", args, err)
+	}
+}
+
+// testArtifacts returns the artifacts of the files of names in a temporary
+// directory.
+func testArtifacts(t *testing.T, names ...string) []*Artifact {
+	t.Helper()
+	dir := t.TempDir()
+	artifacts := make([]*Artifact, 0, len(names))
+	for _, name := range names {
+		artifacts = append(artifacts, &Artifact{Type: "testOutput", Path: filepath.Join(dir, name), Lists: []string{strings.TrimSuffix(name, ".txt")}})
+	}
+	return artifacts
+}
+
+func TestOutputHookRun(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("sh is not found")
+	}
+	artifacts := testArtifacts(t, "cn.txt", "us.txt")
+	logFile := filepath.Join(t.TempDir(), "log")
+
+	tests := []struct {
+		name    string
+		command string
+		forEach bool
+		want    []string
+	}{
+		{
+			name:    "once for all files",
+			command: `["sh", "-c", "echo $# {{.Type}} >> ` + logFile + `", "sh", "{{.Paths}}"]`,
+			want:    []string{"2 testOutput"},
+		},
+		{
+			name:    "for each file",
+			command: `["sh", "-c", "echo {{.Name}} {{join .Lists \",\"}} {{len .Paths}} >> ` + logFile + `"]`,
+			forEach: true,
+			want:    []string{"cn.txt cn 2", "us.txt us 2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(logFile)
+			forEach := "false"
+			if tt.forEach {
+				forEach = "true"
+			}
+			hook := testHook(t, `[{"command": `+tt.command+`, "forEach": `+forEach+`}]`)
+			if err := hook.run(context.Background(), &testOutput{}, artifacts); err != nil {
+				t.Fatalf("run error = %v", err)
+			}
+			content, err := os.ReadFile(logFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Split(strings.TrimSpace(string(content)), "\n"); !slices.Equal(got, tt.want) {
+				t.Errorf("runs = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputHookFailure(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("sh is not found")
+	}
+	artifacts := testArtifacts(t, "cn.txt")
+
+	t.Run("exit status", func(t *testing.T) {
+		hook := testHook(t, `[{"command": ["sh", "-c", "echo checked {{join .Paths \" \"}}; exit 3"]}]`)
+		err := hook.run(context.Background(), &testOutput{}, artifacts)
+		if err == nil || !strings.Contains(err.Error(), "exit status 3") || !strings.HasSuffix(err.Error(), "\nchecked "+artifacts[0].Path) {
+			t.Errorf("run error = %v, want exit status 3 with the output", err)
+		}
+	})
+
+	t.Run("output truncated", func(t *testing.T) {
+		hook := testHook(t, `[{"command": ["sh", "-c", "i=0; while [ $i -lt 300 ]; do echo 0123456789; i=$((i+1)); done; echo last; exit 1"]}]`)
+		err := hook.run(context.Background(), &testOutput{}, artifacts)
+		if err == nil {
+			t.Fatal("run error = nil, want an error")
+		}
+		_, output, _ := strings.Cut(err.Error(), "\n")
+		if !strings.HasPrefix(output, "...") || !strings.HasSuffix(output, "\nlast") || len(output) != len("...")+maxHookOutput {
+			t.Errorf("output of %d bytes = %.20q...%q, want the last %d bytes after ...", len(output), output, output[max(len(output)-10, 0):], maxHookOutput)
+		}
+	})
+
+	t.Run("empty program", func(t *testing.T) {
+		// The path of a file is empty without forEach
+		hook := testHook(t, `[{"command": ["{{.Path}}"]}]`)
+		err := hook.run(context.Background(), &testOutput{}, artifacts)
+		if err == nil || !strings.Contains(err.Error(), "the program is empty") {
+			t.Errorf("run error = %v, want the program is empty", err)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		hook := testHook(t, `[{"command": ["sleep", "10"], "timeout": "50ms"}]`)
+		err := hook.run(context.Background(), &testOutput{}, artifacts)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("run error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("stops at first failure", func(t *testing.T) {
+		artifacts := testArtifacts(t, "cn.txt", "us.txt")
+		logFile := filepath.Join(t.TempDir(), "log")
+		hook := testHook(t, `[{"command": ["sh", "-c", "echo {{.Name}} >> `+logFile+`; exit 1"], "forEach": true}]`)
+		if err := hook.run(context.Background(), &testOutput{}, artifacts); err == nil {
+			t.Fatal("run error = nil, want an error")
+		}
+		if content, _ := os.ReadFile(logFile); string(content) != "cn.txt\n" {
+			t.Errorf("runs = %q, want only the first file", content)
+		}
+	})
+}
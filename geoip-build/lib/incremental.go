@@ -0,0 +1,157 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+)
+
+// incrementalVersion is changed whenever the format of the state file or the
+// way of computing digests is changed, to invalidate old states.
+const incrementalVersion = "geoip-incremental-v1"
+
+// typeIncremental is the type of the state file of incremental builds.
+const typeIncremental = "incremental"
+
+// Incremental tracks the digests of the inputs each output converter is
+// generated from in a state file, so that output converters whose config
+// and inputs are unchanged since the last build are skipped, and the files
+// they wrote in the last build are recorded as unchanged artifacts again.
+//
+// Output converters writing no file, and all output converters in a build
+// with any input that cannot be tracked, e.g. reading from stdin, or that
+// failed, are always run.
+type Incremental struct {
+	File string
+
+	outputs map[string][]*Artifact
+}
+
+type incrementalState struct {
+	Version string                 `json:"version"`
+	Outputs map[string][]*Artifact `json:"outputs"`
+}
+
+// NewIncremental returns an Incremental with the state file of the last
+// build, which is created after the next build if it does not exist yet.
+func NewIncremental(file string) (*Incremental, error) {
+	inc := &Incremental{File: file, outputs: make(map[string][]*Artifact)}
+
+	data, err := os.ReadFile(file)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return inc, nil
+	case err != nil:
+		return nil, err
+	}
+
+	var state incrementalState
+	if err := json.Unmarshal(data, &state); err != nil || state.Version != incrementalVersion {
+		slog.Warn("⚠️ invalid or outdated state file of incremental builds, ignored", "path", file)
+		return inc, nil
+	}
+	if state.Outputs != nil {
+		inc.outputs = state.Outputs
+	}
+	return inc, nil
+}
+
+// SetIncremental enables incremental builds with the state of inc in the
+// next runs, or disables them if inc is nil.
+func (i *Instance) SetIncremental(inc *Incremental) {
+	i.incremental = inc
+}
+
+// outputDigests returns the digest of each output converter computed from
+// its config and the digests of all inputs, or nil if incremental builds
+// are disabled or any input cannot be tracked in the last run.
+func (i *Instance) outputDigests() []string {
+	if i.incremental == nil || len(i.inputDigests) != len(i.input) {
+		return nil
+	}
+	for _, digest := range i.inputDigests {
+		if digest == "" {
+			return nil
+		}
+	}
+
+	digests := make([]string, len(i.output))
+	for idx, oc := range i.output {
+		var args json.RawMessage
+		if idx < len(i.outputArgs) {
+			args = i.outputArgs[idx]
+		}
+		// The content of a rank file is not tracked
+		limit := i.outputLimits[idx]
+		if limit != nil && limit.rankFile != "" {
+			continue
+		}
+		hash := sha256.New()
+		fmt.Fprintf(hash, "%s\n%s\n%s\n%s\n", incrementalVersion, oc.GetType(), oc.GetAction(), args)
+		if limit != nil {
+			fmt.Fprintf(hash, "%d\n%v\n%s\n", limit.maxEntries, limit.perList, limit.onExceed)
+		}
+		for _, hook := range i.outputHooks[idx] {
+			fmt.Fprintf(hash, "%s\n", hook.raw)
+		}
+		if policy := i.outputPolicies[idx]; policy != nil {
+			fmt.Fprintf(hash, "%s\n", policy.raw)
+		}
+		for input, digest := range i.inputDigests {
+			fmt.Fprintf(hash, "%s\n", digest)
+			// The lists of inputs are also changed by how they are merged,
+			// the metadata attached to them and their IPv4-mapped CIDRs
+			metadata, _ := json.Marshal(i.inputMetadata[input])
+			fmt.Fprintf(hash, "%s\n%s\n%s\n", i.inputCollisions[input], metadata, i.inputMappedIPv4[input])
+		}
+		digests[idx] = hex.EncodeToString(hash.Sum(nil))
+	}
+	return digests
+}
+
+// reuse records the files written in the last build by the output converter
+// with digest as unchanged artifacts again, and reports whether they are
+// all intact. Nothing is recorded if any of them is changed or removed.
+func (inc *Incremental) reuse(digest string) ([]*Artifact, bool) {
+	previous := inc.outputs[digest]
+	if len(previous) == 0 {
+		return nil, false
+	}
+	for _, artifact := range previous {
+		if sum, err := outputSHA256(artifact.Path); err != nil || sum != artifact.SHA256 {
+			return nil, false
+		}
+	}
+
+	artifacts := make([]*Artifact, 0, len(previous))
+	for _, artifact := range previous {
+		reused := *artifact
+		reused.Unchanged = true
+		recordArtifact(&reused)
+		artifacts = append(artifacts, &reused)
+	}
+	return artifacts, true
+}
+
+// save replaces the state with the artifacts written by each output
+// converter in the current build, keyed by its digest.
+func (inc *Incremental) save(outputs map[string][]*Artifact) error {
+	if dryRun {
+		return nil
+	}
+	inc.outputs = outputs
+
+	data, err := json.MarshalIndent(&incrementalState{Version: incrementalVersion, Outputs: outputs}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(inc.File, data); err != nil {
+		return &RunError{Kind: ErrorKindOutput, Type: typeIncremental, Action: ActionOutput, Err: err}
+	}
+	return nil
+}
@@ -1,20 +1,68 @@
 package lib
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"os"
+	"fmt"
+	"io"
+	"log/slog"
 	"strings"
+	"time"
 
 	"github.com/tailscale/hujson"
 )
 
 type Instance struct {
-	config *config
-	input  []InputConverter
-	output []OutputConverter
+	config          *config
+	input           []InputConverter
+	inputOptional   []bool
+	inputFreshness  []*Freshness
+	inputSources    []string
+	inputArgs       []json.RawMessage
+	inputNotices    []*attributionNotice
+	inputCollisions []string
+	inputMetadata   []*inputMetadata
+	inputMaxInvalid []float64
+	inputMappedIPv4 []string
+	inputLines      []*lineTracker
+	inputDone       []bool
+	inputDigests    []string
+	output          []OutputConverter
+	outputArgs      []json.RawMessage
+	outputLimits    []*entryLimit
+	outputHooks     [][]*outputHook
+	outputPolicies  []*outputPolicy
+	outputInputs    []Container
+	container       Container
+	maxFailures     int
+	concurrency     int
+	parseCache      *ParseCache
+	incremental     *Incremental
+	failures        []*SourceFailure
+	timings         []*StageTiming
+
+	outputConcurrency int
+	maxMemory         int64
+
+	trackProvenance bool
+	provenance      *Provenance
+}
+
+// StageTiming is the time taken by a converter in the last run.
+type StageTiming struct {
+	Stage    string
+	Type     string
+	Action   Action
+	Duration time.Duration
 }
 
+// Stages of a run recorded in StageTiming.
+const (
+	StageInput  = "input"
+	StageOutput = "output"
+)
+
 func NewInstance() (*Instance, error) {
 	return &Instance{
 		config: new(config),
@@ -24,74 +72,394 @@ func NewInstance() (*Instance, error) {
 }
 
 func (i *Instance) Init(configFile string) error {
-	var content []byte
-	var err error
-	configFile = strings.TrimSpace(configFile)
-	if strings.HasPrefix(strings.ToLower(configFile), "http://") || strings.HasPrefix(strings.ToLower(configFile), "https://") {
-		content, err = GetRemoteURLContent(configFile)
-	} else {
-		content, err = os.ReadFile(configFile)
-	}
+	content, err := ReadConfig(configFile)
 	if err != nil {
 		return err
 	}
 
+	return i.InitFromBytes(content)
+}
+
+// ReadConfig reads the content of config file from local file path or remote HTTP(S) URL.
+// Config files in YAML or TOML format, detected by the file extension,
+// are converted to JSON format, the config files listed in "include"
+// are merged into it, and placeholders like ${NAME} in string values
+// are replaced with the environment variables.
+func ReadConfig(configFile string) ([]byte, error) {
+	content, err := readConfig(strings.TrimSpace(configFile), nil)
+	return content, newConfigError(err)
+}
+
+func (i *Instance) InitFromBytes(content []byte) error {
 	// Support JSON with comments and trailing commas
 	content, _ = hujson.Standardize(content)
 
+	if err := ValidateConfig(content); err != nil {
+		return newConfigError(err)
+	}
+
+	content, err := applyOutputSelection(content)
+	if err != nil {
+		return newConfigError(err)
+	}
+
 	if err := json.Unmarshal(content, &i.config); err != nil {
-		return err
+		return newConfigError(err)
 	}
 
 	for _, input := range i.config.Input {
 		i.input = append(i.input, input.converter)
+		i.inputOptional = append(i.inputOptional, input.optional)
+		i.inputFreshness = append(i.inputFreshness, input.freshness)
+		i.inputSources = append(i.inputSources, input.source)
+		i.inputArgs = append(i.inputArgs, input.args)
+		i.inputNotices = append(i.inputNotices, input.notice)
+		onCollision := input.onCollision
+		if onCollision == "" {
+			onCollision = i.config.OnCollision
+		}
+		i.inputCollisions = append(i.inputCollisions, onCollision)
+		i.inputMetadata = append(i.inputMetadata, input.metadata)
+		var maxInvalid float64
+		switch {
+		case input.maxInvalid != nil:
+			maxInvalid = *input.maxInvalid
+		case i.config.MaxInvalidRatio != nil:
+			maxInvalid = *i.config.MaxInvalidRatio
+		}
+		i.inputMaxInvalid = append(i.inputMaxInvalid, maxInvalid)
+		mappedIPv4 := input.mappedIPv4
+		if mappedIPv4 == "" {
+			mappedIPv4 = i.config.MappedIPv4
+		}
+		if mappedIPv4, err = checkMappedIPv4(mappedIPv4); err != nil {
+			return newConfigError(err)
+		}
+		i.inputMappedIPv4 = append(i.inputMappedIPv4, mappedIPv4)
 	}
 
 	for _, output := range i.config.Output {
 		i.output = append(i.output, output.converter)
+		i.outputArgs = append(i.outputArgs, output.args)
+		i.outputLimits = append(i.outputLimits, output.limit)
+		i.outputHooks = append(i.outputHooks, output.hooks)
+		i.outputPolicies = append(i.outputPolicies, output.policy)
+		if user, ok := output.converter.(ProvenanceUser); ok && user.UseProvenance() {
+			i.trackProvenance = true
+		}
 	}
 
 	return nil
 }
 
-func (i *Instance) InitFromBytes(content []byte) error {
-	// Support JSON with comments and trailing commas
-	content, _ = hujson.Standardize(content)
+// Run runs all input converters and then all output converters. Once ctx
+// is done, no more converters are started, the running ones are asked to
+// stop, and the error of ctx is returned.
+func (i *Instance) Run(ctx context.Context) error {
+	if len(i.input) == 0 || len(i.output) == 0 {
+		return errors.New("input type and output type must be specified")
+	}
 
-	if err := json.Unmarshal(content, &i.config); err != nil {
+	container, err := i.RunInput(ctx)
+	if err != nil {
 		return err
 	}
 
-	for _, input := range i.config.Input {
-		i.input = append(i.input, input.converter)
+	return i.RunOutput(ctx, container)
+}
+
+// RunInput runs all input converters only and returns the generated container.
+func (i *Instance) RunInput(ctx context.Context) (Container, error) {
+	if len(i.input) == 0 {
+		return nil, errors.New("input type must be specified")
 	}
 
-	for _, output := range i.config.Output {
-		i.output = append(i.output, output.converter)
+	i.failures = make([]*SourceFailure, 0)
+	i.inputDone = make([]bool, len(i.input))
+	i.inputDigests = make([]string, len(i.input))
+	i.inputLines = make([]*lineTracker, len(i.input))
+	i.resetTimings(StageInput)
+	ResetSources()
+	container := NewContainer()
+	if i.trackProvenance {
+		i.provenance = new(Provenance)
+	}
+	pool := i.prefetchInputs(ctx)
+	defer pool.wait()
+	for idx, ic := range i.input {
+		if err := ctx.Err(); err != nil {
+			return nil, newCanceledError(ErrorKindConversion, ic, err)
+		}
+		container = i.provenanceContainer(container, idx, ic)
+		target := i.inputContainer(container, idx, ic)
+		showStageProgress("parsing and merging", idx+1, len(i.input), ic)
+		result := pool.result(idx)
+		start := time.Now()
+		var next Container
+		var err error
+		if result != nil {
+			next, err = result.apply(ctx, target, idx, ic)
+			start = start.Add(-result.duration)
+			i.inputLines[idx] = result.lines
+		} else {
+			next, err = i.runInputConverter(ctx, idx, ic, target)
+		}
+		if err == nil {
+			err = i.checkInvalidLines(idx, ic)
+		}
+		i.recordTiming(StageInput, ic, time.Since(start))
+		if err != nil {
+			// Cancellation is never tolerated as a failure of the input
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, newCanceledError(ErrorKindConversion, ic, ctxErr)
+			}
+			optional := idx < len(i.inputOptional) && i.inputOptional[idx]
+			if err := i.tolerateFailure(ic, optional, err); err != nil {
+				return nil, newConverterError(ErrorKindConversion, ic, err)
+			}
+			continue
+		}
+		container = unwrapInputContainer(next)
+		i.inputDone[idx] = true
+		if result != nil {
+			i.inputDigests[idx] = result.digest
+		}
+		logConverterDone(ic, time.Since(start))
+	}
+	if i.maxMemory > 0 {
+		var err error
+		if container, err = spill(container); err != nil {
+			return nil, err
+		}
+	}
+	i.container = container
+
+	return container, nil
+}
+
+// runInputConverter checks the freshness of the remote files of the input
+// converter ic at idx if required, and runs it with container, collecting
+// the invalid lines of its sources.
+func (i *Instance) runInputConverter(ctx context.Context, idx int, ic InputConverter, container Container) (Container, error) {
+	if err := i.checkFreshness(idx, ic); err != nil {
+		return nil, err
 	}
+	i.inputLines[idx] = newLineTracker(idx, ic)
+	return ic.Input(withLineTracker(ctx, i.inputLines[idx]), container)
+}
 
+func (i *Instance) checkFreshness(idx int, ic InputConverter) error {
+	if idx < len(i.inputFreshness) && i.inputFreshness[idx] != nil {
+		return i.inputFreshness[idx].check(ic)
+	}
 	return nil
 }
 
-func (i *Instance) Run() error {
-	if len(i.input) == 0 || len(i.output) == 0 {
-		return errors.New("input type and output type must be specified")
+// RunOutput runs all output converters only with the given container.
+func (i *Instance) RunOutput(ctx context.Context, container Container) error {
+	if len(i.output) == 0 {
+		return errors.New("output type must be specified")
 	}
 
-	var err error
-	container := NewContainer()
-	for _, ic := range i.input {
-		container, err = ic.Input(container)
-		if err != nil {
-			return err
+	i.container = container
+	i.outputInputs = make([]Container, len(i.output))
+	i.resetTimings(StageOutput)
+	ResetArtifacts()
+	digests := i.outputDigests()
+	if digests == nil {
+		digests = make([]string, len(i.output))
+	}
+
+	// IP sets of entries must be built before output converters read them
+	// at the same time, or they are run one by one, which they always are
+	// with a memory limit
+	var results []*outputResult
+	if i.outputConcurrency > 1 && len(i.output) > 1 && i.maxMemory <= 0 && buildIPSets(container) == nil {
+		results = i.runOutputsConcurrently(ctx, container, digests)
+	} else {
+		results = make([]*outputResult, len(i.output))
+		for idx, oc := range i.output {
+			showStageProgress("writing", idx+1, len(i.output), oc)
+			results[idx] = i.runOutputConverter(ctx, idx, container, digests[idx])
+			if results[idx].err != nil {
+				results = results[:idx+1]
+				break
+			}
+		}
+	}
+
+	outputs := make(map[string][]*Artifact, len(digests))
+	for idx, result := range results {
+		oc := i.output[idx]
+		i.recordTiming(StageOutput, oc, result.duration)
+		if result.err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil && errors.Is(result.err, ctxErr) {
+				return newCanceledError(ErrorKindOutput, oc, ctxErr)
+			}
+			return newConverterError(ErrorKindOutput, oc, result.err)
+		}
+		if digests[idx] != "" {
+			outputs[digests[idx]] = result.artifacts
+		}
+	}
+
+	if i.incremental != nil && len(outputs) > 0 {
+		return i.incremental.save(outputs)
+	}
+
+	return nil
+}
+
+// outputResult is the result of an output converter.
+type outputResult struct {
+	artifacts []*Artifact
+	duration  time.Duration
+	err       error
+}
+
+// runOutputConverter runs the output converter at idx with container, with
+// the lists exceeding its limit trimmed, or skips it if the files it wrote
+// in the last build with the same digest are reused. The artifacts of the
+// converter are the ones of its type recorded while it runs, with which its
+// hooks are run after it writes or reuses them.
+func (i *Instance) runOutputConverter(ctx context.Context, idx int, container Container, digest string) *outputResult {
+	oc := i.output[idx]
+	start := time.Now()
+	if err := ctx.Err(); err != nil {
+		return &outputResult{err: err}
+	}
+	if digest != "" {
+		if artifacts, reused := i.incremental.reuse(digest); reused {
+			clearProgress()
+			slog.Info(fmt.Sprintf("♻️ [%s] %s skipped, inputs unchanged since last build", oc.GetType(), oc.GetAction()), "type", oc.GetType(), "action", oc.GetAction(), "unchanged", true)
+			if err := i.runOutputHooks(ctx, idx, artifacts); err != nil {
+				return &outputResult{duration: time.Since(start), err: err}
+			}
+			return &outputResult{artifacts: artifacts, duration: time.Since(start)}
+		}
+	}
+
+	if limit := i.outputLimits[idx]; limit != nil {
+		var err error
+		if container, err = limit.apply(ctx, oc, container); err != nil {
+			return &outputResult{duration: time.Since(start), err: err}
 		}
 	}
+	i.outputInputs[idx] = container
+
+	written := artifactCount()
+	if err := i.writeOutput(ctx, idx, container, written); err != nil {
+		return &outputResult{duration: time.Since(start), err: err}
+	}
+	artifacts := artifactsSince(written, oc.GetType())
+	if err := i.runOutputHooks(ctx, idx, artifacts); err != nil {
+		return &outputResult{duration: time.Since(start), err: err}
+	}
+	duration := time.Since(start)
+	logConverterDone(oc, duration)
+	return &outputResult{artifacts: artifacts, duration: duration}
+}
+
+// Container returns the lists generated by the inputs of the last run, or
+// nil if the outputs have not been run yet.
+func (i *Instance) Container() Container {
+	return i.container
+}
 
-	for _, oc := range i.output {
-		if err := oc.Output(container); err != nil {
-			return err
+// Timings returns the time taken by each converter run in the last run,
+// including the failed ones.
+func (i *Instance) Timings() []*StageTiming {
+	return i.timings
+}
+
+func (i *Instance) resetTimings(stage string) {
+	timings := make([]*StageTiming, 0, len(i.timings))
+	for _, timing := range i.timings {
+		if timing.Stage != stage {
+			timings = append(timings, timing)
 		}
 	}
+	i.timings = timings
+}
+
+func (i *Instance) recordTiming(stage string, c interface {
+	Typer
+	Actioner
+}, duration time.Duration) {
+	i.timings = append(i.timings, &StageTiming{
+		Stage:    stage,
+		Type:     c.GetType(),
+		Action:   c.GetAction(),
+		Duration: duration,
+	})
+}
+
+// EnableProvenance enables tracking which input converter added or removed
+// each CIDR of each list in the next runs.
+func (i *Instance) EnableProvenance() {
+	i.trackProvenance = true
+}
+
+// Provenance returns the provenance tracked in the last run, or nil if
+// tracking is not enabled.
+func (i *Instance) Provenance() *Provenance {
+	return i.provenance
+}
+
+// provenanceContainer wraps container to record the changes made by the input
+// converter ic at idx into the provenance if tracking is enabled.
+func (i *Instance) provenanceContainer(container Container, idx int, ic InputConverter) Container {
+	if i.provenance == nil {
+		return container
+	}
+	c, ok := container.(*provenanceContainer)
+	if !ok {
+		c = &provenanceContainer{Container: container, provenance: i.provenance}
+	}
+	c.input, c.iType = idx, ic.GetType()
+	if idx < len(i.inputSources) {
+		c.source = i.inputSources[idx]
+	}
+	return c
+}
+
+func logConverterDone(c interface {
+	Typer
+	Actioner
+}, duration time.Duration) {
+	clearProgress()
+	duration = duration.Round(time.Millisecond)
+	slog.Info(fmt.Sprintf("⏱️ [%s] %s done in %s", c.GetType(), c.GetAction(), duration), "type", c.GetType(), "action", c.GetAction(), "duration", duration)
+}
+
+// PrintSummary writes the stats of the lists generated by the last run
+// and the artifacts written by output converters.
+func (i *Instance) PrintSummary(w io.Writer) error {
+	summary, err := i.Summary()
+	if err != nil {
+		return err
+	}
+	PrintStats(w, summary.Lists, summary.Artifacts)
+	PrintFailures(w, summary.Failures)
 
 	return nil
 }
+
+// Summary returns the stats of the lists generated by the last run
+// and the artifacts written by output converters.
+func (i *Instance) Summary() (*Summary, error) {
+	if i.container == nil {
+		return nil, errors.New("instance has not been run yet")
+	}
+
+	stats, err := GetStats(i.container)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Summary{
+		Lists:     stats,
+		Artifacts: Artifacts(),
+		Failures:  i.failures,
+	}, nil
+}
@@ -0,0 +1,243 @@
+package lib
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// configKeyMaxInvalidRatio is the key of the ratio of invalid lines a
+// source of an input may have at the top level of config, and of a single
+// input in the input.
+const configKeyMaxInvalidRatio = "maxInvalidRatio"
+
+// typeInvalidLines is the type of the invalid lines report recorded as an
+// artifact.
+const typeInvalidLines = "invalidLines"
+
+// maxInvalidLinesPerSource is the number of invalid lines of a source kept
+// for the report, the ones after which are only counted.
+const maxInvalidLinesPerSource = 1000
+
+// InvalidLine is a line of a source that cannot be parsed.
+type InvalidLine struct {
+	Line    int    `json:"line"`
+	Content string `json:"content"`
+	Reason  string `json:"reason"`
+}
+
+// SourceLines is the result of parsing the lines of a source of an input
+// converter.
+type SourceLines struct {
+	Input  int    `json:"input"`
+	Type   string `json:"type"`
+	Action Action `json:"action"`
+	Source string `json:"source"`
+	// Lines is the number of lines with an IP or CIDR, excluding empty
+	// lines and comments.
+	Lines        int            `json:"lines"`
+	Invalid      int            `json:"invalid"`
+	InvalidLines []*InvalidLine `json:"invalidLines"`
+}
+
+// Ratio returns the ratio of invalid lines of the source.
+func (s *SourceLines) Ratio() float64 {
+	if s.Lines == 0 {
+		return 0
+	}
+	return float64(s.Invalid) / float64(s.Lines)
+}
+
+// lineTracker collects the invalid lines of the sources of an input
+// converter run, so that it parses all lines of its sources instead of
+// failing at the first invalid one.
+type lineTracker struct {
+	mu      sync.Mutex
+	input   int
+	iType   string
+	action  Action
+	sources []*SourceLines
+}
+
+// newLineTracker returns the lineTracker of a run of the input converter
+// ic at idx.
+func newLineTracker(idx int, ic InputConverter) *lineTracker {
+	return &lineTracker{input: idx, iType: ic.GetType(), action: ic.GetAction()}
+}
+
+type lineTrackerKey struct{}
+
+func withLineTracker(ctx context.Context, t *lineTracker) context.Context {
+	return context.WithValue(ctx, lineTrackerKey{}, t)
+}
+
+// AddLine adds the IP or CIDR of the line numbered lineNo of source to
+// entry. If the input converter is run by an Instance, an invalid line is
+// recorded and skipped, and the input converter fails after parsing all
+// lines if the ratio of invalid lines of source exceeds maxInvalidRatio.
+// Otherwise, the error of the invalid line is returned.
+func AddLine(ctx context.Context, entry *Entry, source string, lineNo int, line string) error {
+	return TrackLine(ctx, source, lineNo, line, entry.AddPrefix(line))
+}
+
+// TrackLine records the line numbered lineNo of source parsed by an input
+// converter, which is invalid if err is not nil, the same way as AddLine,
+// e.g. for a record of a CSV file of which the CIDR is added to several
+// lists. The error of an invalid line is returned if the input converter is
+// not run by an Instance.
+func TrackLine(ctx context.Context, source string, lineNo int, line string, err error) error {
+	t, _ := ctx.Value(lineTrackerKey{}).(*lineTracker)
+	if t == nil {
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", source, lineNo, err)
+		}
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var s *SourceLines
+	if n := len(t.sources); n > 0 && t.sources[n-1].Source == source {
+		s = t.sources[n-1]
+	} else {
+		s = &SourceLines{Input: t.input, Type: t.iType, Action: t.action, Source: source, InvalidLines: make([]*InvalidLine, 0)}
+		t.sources = append(t.sources, s)
+	}
+	s.Lines++
+	if err != nil {
+		s.Invalid++
+		if len(s.InvalidLines) < maxInvalidLinesPerSource {
+			s.InvalidLines = append(s.InvalidLines, &InvalidLine{Line: lineNo, Content: line, Reason: err.Error()})
+		}
+	}
+	return nil
+}
+
+// ReadCSV reads the records after the header of the CSV file source with
+// reader, and calls fn with each record of at least minFields fields. The
+// malformed records and the ones fn returns an error for are invalid lines
+// recorded by TrackLine, so that they count against maxInvalidRatio instead
+// of failing the input converter at the first one.
+func ReadCSV(ctx context.Context, reader *csv.Reader, source string, minFields int, fn func(record []string) error) error {
+	reader.Read() // skip header
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+
+		var lineNo int
+		var parseErr *csv.ParseError
+		switch {
+		case errors.As(err, &parseErr):
+			lineNo, err = parseErr.StartLine, parseErr.Err
+		case err != nil:
+			return err
+		default:
+			lineNo, _ = reader.FieldPos(0)
+			if len(record) < minFields {
+				err = fmt.Errorf("%d fields, want at least %d", len(record), minFields)
+			} else {
+				err = fn(record)
+			}
+		}
+
+		// Records are only joined for the report, as most are valid
+		var line string
+		if err != nil {
+			line = strings.Join(record, ",")
+		}
+		if err := TrackLine(ctx, source, lineNo, line, err); err != nil {
+			return err
+		}
+	}
+}
+
+func (t *lineTracker) invalid() bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range t.sources {
+		if s.Invalid > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func checkMaxInvalidRatio(ratio float64) error {
+	if ratio < 0 || ratio > 1 {
+		return fmt.Errorf("must be between 0 and 1")
+	}
+	return nil
+}
+
+// checkInvalidLines returns an error if the ratio of invalid lines of any
+// source of the input converter ic at idx exceeds its maxInvalidRatio, and
+// warns about the invalid lines of the other sources.
+func (i *Instance) checkInvalidLines(idx int, ic InputConverter) error {
+	if idx >= len(i.inputLines) || i.inputLines[idx] == nil {
+		return nil
+	}
+	var maxRatio float64
+	if idx < len(i.inputMaxInvalid) {
+		maxRatio = i.inputMaxInvalid[idx]
+	}
+
+	t := i.inputLines[idx]
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range t.sources {
+		if s.Invalid == 0 {
+			continue
+		}
+		first := s.InvalidLines[0]
+		if s.Ratio() > maxRatio {
+			return fmt.Errorf("❌ [type %s | action %s] %d of %d lines of %s are invalid, exceeding %s %g, e.g. line %d %q: %s", ic.GetType(), ic.GetAction(), s.Invalid, s.Lines, s.Source, configKeyMaxInvalidRatio, maxRatio, first.Line, first.Content, first.Reason)
+		}
+		slog.Warn(fmt.Sprintf("⚠️ [%s] %s skipped %d invalid lines of %d lines of %s", ic.GetType(), ic.GetAction(), s.Invalid, s.Lines, s.Source), "type", ic.GetType(), "action", ic.GetAction(), "source", s.Source, "invalid", s.Invalid, "lines", s.Lines)
+	}
+	return nil
+}
+
+// InvalidLines returns the sources with invalid lines of the input
+// converters run in the last run, in config order.
+func (i *Instance) InvalidLines() []*SourceLines {
+	result := make([]*SourceLines, 0)
+	for _, t := range i.inputLines {
+		if t == nil {
+			continue
+		}
+		t.mu.Lock()
+		for _, s := range t.sources {
+			if s.Invalid > 0 {
+				result = append(result, s)
+			}
+		}
+		t.mu.Unlock()
+	}
+	return result
+}
+
+// WriteInvalidLines writes the sources with invalid lines of the last run
+// as a JSON array to file, reporting the line number, content and reason
+// of each invalid line, which is recorded as an artifact.
+func (i *Instance) WriteInvalidLines(file string) error {
+	data, err := json.MarshalIndent(i.InvalidLines(), "", "  ")
+	if err == nil {
+		err = WriteFile(typeInvalidLines, file, append(data, '\n'))
+	}
+	if err != nil {
+		return &RunError{Kind: ErrorKindOutput, Type: typeInvalidLines, Action: ActionOutput, Err: err}
+	}
+	return nil
+}
@@ -1,5 +1,7 @@
 package lib
 
+import "context"
+
 const (
 	ActionAdd    Action = "add"
 	ActionRemove Action = "remove"
@@ -40,14 +42,18 @@ type InputConverter interface {
 	Typer
 	Actioner
 	Descriptioner
-	Input(Container) (Container, error)
+	// Input reads its sources into the container, and should stop and return
+	// the error of ctx once ctx is done.
+	Input(ctx context.Context, container Container) (Container, error)
 }
 
 type OutputConverter interface {
 	Typer
 	Actioner
 	Descriptioner
-	Output(Container) error
+	// Output writes the container, and should stop and return the error of
+	// ctx once ctx is done, without replacing any file half-written.
+	Output(ctx context.Context, container Container) error
 }
 
 type IgnoreIPOption func() IPType
@@ -59,3 +65,30 @@ func IgnoreIPv4() IPType {
 func IgnoreIPv6() IPType {
 	return IPv6
 }
+
+// Verifier is implemented by output converters that are able to re-read
+// the artifacts they have written and check them against the container.
+type Verifier interface {
+	Verify(ctx context.Context, container Container) error
+}
+
+// IPTypeWriter is implemented by output converters that are able to write
+// the CIDRs of only one IP type, so that the CIDRs they write can be counted.
+type IPTypeWriter interface {
+	// WritesIPType returns the IP type of the CIDRs written, or "" if both.
+	WritesIPType() IPType
+}
+
+// ignoreUnwritten returns the option ignoring the IP type of the CIDRs the
+// output converter oc does not write, or nil if it writes both.
+func ignoreUnwritten(oc OutputConverter) IgnoreIPOption {
+	if writer, ok := oc.(IPTypeWriter); ok {
+		switch writer.WritesIPType() {
+		case IPv4:
+			return IgnoreIPv6
+		case IPv6:
+			return IgnoreIPv4
+		}
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package lib
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"go4.org/netipx"
+)
+
+// Policies of an output on a list having more CIDRs than its maximum.
+const (
+	OnExceedFail                = "fail"
+	OnExceedTrimLongestPrefixes = "trim-longest-prefixes-first"
+	OnExceedTrimByRank          = "trim-by-rank"
+)
+
+// entryLimit is the maximum number of CIDRs of the lists written by an
+// output, for targets running out of memory with larger sets, and what to
+// do with the lists exceeding it. Only the CIDRs of the IP type the output
+// writes are counted and trimmed if it writes one, see IPTypeWriter.
+type entryLimit struct {
+	maxEntries int
+	perList    map[string]int
+	onExceed   string
+	rankFile   string
+}
+
+func newEntryLimit(maxEntries int, perList map[string]int, onExceed, rankFile string) (*entryLimit, error) {
+	if maxEntries == 0 && len(perList) == 0 {
+		if onExceed != "" || rankFile != "" {
+			return nil, fmt.Errorf("onExceed and rankFile require maxEntries or maxEntriesPerList")
+		}
+		return nil, nil
+	}
+
+	l := &entryLimit{
+		maxEntries: maxEntries,
+		perList:    make(map[string]int, len(perList)),
+		onExceed:   strings.ToLower(strings.TrimSpace(onExceed)),
+		rankFile:   strings.TrimSpace(rankFile),
+	}
+	if maxEntries < 0 {
+		return nil, fmt.Errorf("invalid maxEntries %d, must be positive", maxEntries)
+	}
+	for name, max := range perList {
+		if max <= 0 {
+			return nil, fmt.Errorf("invalid maxEntriesPerList %d of list %s, must be positive", max, name)
+		}
+		l.perList[strings.ToUpper(strings.TrimSpace(name))] = max
+	}
+
+	switch l.onExceed {
+	case "":
+		l.onExceed = OnExceedFail
+	case OnExceedFail, OnExceedTrimLongestPrefixes, OnExceedTrimByRank:
+	default:
+		return nil, fmt.Errorf("invalid onExceed %q, available options: %s, %s, %s", onExceed, OnExceedFail, OnExceedTrimLongestPrefixes, OnExceedTrimByRank)
+	}
+	if (l.onExceed == OnExceedTrimByRank) != (l.rankFile != "") {
+		return nil, fmt.Errorf("rankFile must be specified if and only if onExceed is %s", OnExceedTrimByRank)
+	}
+
+	return l, nil
+}
+
+// max returns the maximum number of CIDRs of the list of name, or 0 if
+// it is unlimited.
+func (l *entryLimit) max(name string) int {
+	if max, found := l.perList[name]; found {
+		return max
+	}
+	return l.maxEntries
+}
+
+// apply returns container with the lists exceeding their maximums trimmed,
+// or an error if any exceeds its maximum with the fail policy.
+func (l *entryLimit) apply(ctx context.Context, oc OutputConverter, container Container) (Container, error) {
+	var ranks []netip.Prefix
+	if l.onExceed == OnExceedTrimByRank {
+		var err error
+		if ranks, err = readRankFile(ctx, l.rankFile); err != nil {
+			return nil, fmt.Errorf("❌ [type %s | action %s] invalid rankFile %s: %w", oc.GetType(), oc.GetAction(), l.rankFile, err)
+		}
+	}
+
+	entries := container.Loop()
+	defer func() {
+		for range entries {
+		}
+	}()
+
+	ignore := ignoreUnwritten(oc)
+	trimmed := make(map[string]*Entry)
+	for entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		name := entry.GetName()
+		max := l.max(name)
+		if max <= 0 {
+			continue
+		}
+		prefixes, err := entry.MarshalPrefix(ignore)
+		if err != nil || len(prefixes) <= max {
+			continue
+		}
+
+		if l.onExceed == OnExceedFail {
+			return nil, fmt.Errorf("❌ [type %s | action %s] list %s has %d CIDRs, more than the maximum %d", oc.GetType(), oc.GetAction(), name, len(prefixes), max)
+		}
+
+		kept := trimPrefixes(prefixes, max, ranks)
+		// The CIDRs of the IP type not written are left untouched
+		keptAll := kept
+		if ignore != nil {
+			keptAll = slices.Clone(kept)
+			all, _ := entry.MarshalPrefix()
+			for _, prefix := range all {
+				if prefix.Addr().Is4() == (ignore() == IPv4) {
+					keptAll = append(keptAll, prefix)
+				}
+			}
+		}
+		if trimmed[name], err = newEntryFromPrefixes(name, keptAll); err != nil {
+			return nil, err
+		}
+		trimmed[name].metadata = entry.metadata
+		slog.Warn(fmt.Sprintf("✂️ [%s] list %s trimmed from %d to %d CIDRs by %s", oc.GetType(), name, len(prefixes), len(kept), l.onExceed),
+			"type", oc.GetType(), "list", name, "from", len(prefixes), "to", len(kept), "policy", l.onExceed)
+	}
+
+	if len(trimmed) == 0 {
+		return container, nil
+	}
+	return &limitedContainer{Container: container, trimmed: trimmed}, nil
+}
+
+// trimPrefixes returns max of prefixes, dropping the ones covering the
+// fewest addresses first. If ranks is not nil, the ones overlapping no
+// CIDR in ranks are dropped first, and then the ones of which the first
+// CIDR overlapped in ranks is the latest.
+func trimPrefixes(prefixes []netip.Prefix, max int, ranks []netip.Prefix) []netip.Prefix {
+	type ranked struct {
+		prefix netip.Prefix
+		rank   int
+		bits   int // the bits of prefix as an IPv6 one, to compare sizes across IP types
+	}
+
+	list := make([]ranked, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		r := ranked{prefix: prefix, bits: prefix.Bits()}
+		if prefix.Addr().Is4() {
+			r.bits += 96
+		}
+		if ranks != nil {
+			r.rank = slices.IndexFunc(ranks, prefix.Overlaps)
+			if r.rank < 0 {
+				r.rank = len(ranks)
+			}
+		}
+		list = append(list, r)
+	}
+
+	slices.SortStableFunc(list, func(a, b ranked) int {
+		if a.rank != b.rank {
+			return a.rank - b.rank
+		}
+		return a.bits - b.bits
+	})
+
+	kept := make([]netip.Prefix, 0, max)
+	for _, r := range list[:max] {
+		kept = append(kept, r.prefix)
+	}
+	return kept
+}
+
+// readRankFile reads the CIDRs or IPs in the file at uri, one per line and
+// the most important first. Empty lines and comments starting with "#" are
+// ignored.
+func readRankFile(ctx context.Context, uri string) ([]netip.Prefix, error) {
+	f, err := OpenURI(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ranks := make([]netip.Prefix, 0, 1024)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		prefix, err := parsePrefixOrAddr(line)
+		if err != nil {
+			return nil, err
+		}
+		ranks = append(ranks, prefix)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return ranks, nil
+}
+
+func newEntryFromPrefixes(name string, prefixes []netip.Prefix) (*Entry, error) {
+	var ipv4, ipv6 netipx.IPSetBuilder
+	hasIPv4, hasIPv6 := false, false
+	for _, prefix := range prefixes {
+		if prefix.Addr().Is4() {
+			ipv4.AddPrefix(prefix)
+			hasIPv4 = true
+		} else {
+			ipv6.AddPrefix(prefix)
+			hasIPv6 = true
+		}
+	}
+
+	var err error
+	entry := &Entry{name: name}
+	if hasIPv4 {
+		if entry.ipv4Set, err = ipv4.IPSet(); err != nil {
+			return nil, err
+		}
+	}
+	if hasIPv6 {
+		if entry.ipv6Set, err = ipv6.IPSet(); err != nil {
+			return nil, err
+		}
+	}
+	return entry, nil
+}
+
+// limitedContainer is the container of an output with the trimmed lists in
+// place of the ones of the container it wraps.
+type limitedContainer struct {
+	Container
+	trimmed map[string]*Entry
+}
+
+func (c *limitedContainer) GetEntry(name string) (*Entry, bool) {
+	if entry, found := c.trimmed[strings.ToUpper(strings.TrimSpace(name))]; found {
+		return entry, true
+	}
+	return c.Container.GetEntry(name)
+}
+
+func (c *limitedContainer) Loop() <-chan *Entry {
+	ch := make(chan *Entry, 300)
+	go func() {
+		for entry := range c.Container.Loop() {
+			if trimmed, found := c.trimmed[entry.GetName()]; found {
+				entry = trimmed
+			}
+			ch <- entry
+		}
+		close(ch)
+	}()
+	return ch
+}
+
+func (c *limitedContainer) Lookup(ipOrCidr string, searchList ...string) ([]string, bool, error) {
+	return lookup(c, ipOrCidr, searchList...)
+}
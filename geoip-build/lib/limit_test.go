@@ -0,0 +1,183 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testOutput is an output converter writing the CIDRs of ipType, or both
+// IP types if empty.
+type testOutput struct {
+	ipType IPType
+}
+
+func (o *testOutput) GetType() string                                       { return "testOutput" }
+func (o *testOutput) GetAction() Action                                     { return ActionOutput }
+func (o *testOutput) GetDescription() string                                { return "" }
+func (o *testOutput) Output(ctx context.Context, container Container) error { return nil }
+func (o *testOutput) WritesIPType() IPType                                  { return o.ipType }
+
+// testContainer returns a container of the lists of names and their CIDRs.
+func testContainer(t *testing.T, lists map[string][]string) Container {
+	t.Helper()
+	container := NewContainer()
+	for name, cidrs := range lists {
+		entry := NewEntry(name)
+		for _, cidr := range cidrs {
+			if err := entry.AddPrefix(cidr); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := container.Add(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return container
+}
+
+func TestEntryLimit(t *testing.T) {
+	rankFile := filepath.Join(t.TempDir(), "rank.txt")
+	if err := os.WriteFile(rankFile, []byte("# most important first\n1.1.1.1\n2001:db8:2::/48\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lists := map[string][]string{
+		"aa": {"10.0.0.0/8", "1.1.1.0/24", "192.0.2.0/28", "2001:db8::/32", "2001:db9:2::/48"},
+		"bb": {"198.51.100.0/24"},
+	}
+
+	tests := []struct {
+		name       string
+		maxEntries int
+		perList    map[string]int
+		onExceed   string
+		rankFile   string
+		ipType     IPType
+		// want is the CIDRs of list AA written by the output, or err the
+		// error of applying the limit.
+		want []string
+		err  string
+	}{
+		{name: "within", maxEntries: 5, want: lists["aa"]},
+		{name: "fail", maxEntries: 4, err: "list AA has 5 CIDRs, more than the maximum 4"},
+		{name: "fail counting only ipv4", maxEntries: 2, ipType: IPv4, err: "list AA has 3 CIDRs, more than the maximum 2"},
+		{name: "within counting only ipv6", maxEntries: 2, ipType: IPv6, want: []string{"2001:db8::/32", "2001:db9:2::/48"}},
+		{name: "per list", maxEntries: 1, perList: map[string]int{"aa": 5}, want: lists["aa"]},
+		{
+			name: "trim longest prefixes first", maxEntries: 3, onExceed: OnExceedTrimLongestPrefixes,
+			want: []string{"10.0.0.0/8", "2001:db8::/32", "2001:db9:2::/48"},
+		},
+		{
+			name: "trim longest prefixes first of ipv4", maxEntries: 1, onExceed: OnExceedTrimLongestPrefixes, ipType: IPv4,
+			want: []string{"10.0.0.0/8"},
+		},
+		{
+			name: "trim longest prefixes first of ipv6", maxEntries: 1, onExceed: OnExceedTrimLongestPrefixes, ipType: IPv6,
+			want: []string{"2001:db8::/32"},
+		},
+		{
+			name: "trim by rank", maxEntries: 2, onExceed: OnExceedTrimByRank, rankFile: rankFile,
+			want: []string{"1.1.1.0/24", "2001:db8::/32"},
+		},
+		{
+			name: "trim by rank of ipv4", maxEntries: 2, onExceed: OnExceedTrimByRank, rankFile: rankFile, ipType: IPv4,
+			want: []string{"1.1.1.0/24", "10.0.0.0/8"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit, err := newEntryLimit(tt.maxEntries, tt.perList, tt.onExceed, tt.rankFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			oc := &testOutput{ipType: tt.ipType}
+			container, err := limit.apply(context.Background(), oc, testContainer(t, lists))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("apply error = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("apply error = %v", err)
+			}
+
+			entry, found := container.GetEntry("aa")
+			if !found {
+				t.Fatal("list AA is not found")
+			}
+			got, err := entry.MarshalText(ignoreUnwritten(oc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := slices.Clone(tt.want)
+			slices.Sort(got)
+			slices.Sort(want)
+			if !slices.Equal(got, want) {
+				t.Errorf("list AA = %v, want %v", got, want)
+			}
+
+			// The CIDRs of the IP type not written are left untouched
+			if tt.ipType != "" {
+				all, _ := entry.MarshalText()
+				if len(all)-len(got) != len(lists["aa"])-len(onlyIPType(lists["aa"], tt.ipType)) {
+					t.Errorf("list AA = %v, want the CIDRs of the other IP type untouched", all)
+				}
+			}
+
+			if entry, _ := container.GetEntry("bb"); entry == nil {
+				t.Error("list BB is not found")
+			}
+		})
+	}
+}
+
+func TestNewEntryLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxEntries int
+		perList    map[string]int
+		onExceed   string
+		rankFile   string
+		err        string
+	}{
+		{name: "unlimited"},
+		{name: "onExceed without maximum", onExceed: OnExceedFail, err: "require maxEntries"},
+		{name: "negative maximum", maxEntries: -1, err: "must be positive"},
+		{name: "zero maximum of list", perList: map[string]int{"cn": 0}, err: "must be positive"},
+		{name: "unknown onExceed", maxEntries: 1, onExceed: "drop", err: "invalid onExceed"},
+		{name: "trim by rank without rankFile", maxEntries: 1, onExceed: OnExceedTrimByRank, err: "rankFile must be specified"},
+		{name: "rankFile without trim by rank", maxEntries: 1, rankFile: "rank.txt", err: "rankFile must be specified"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newEntryLimit(tt.maxEntries, tt.perList, tt.onExceed, tt.rankFile)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("newEntryLimit error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("newEntryLimit error = %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
+
+// onlyIPType returns the CIDRs of cidrs of ipType.
+func onlyIPType(cidrs []string, ipType IPType) []string {
+	var list []string
+	for _, cidr := range cidrs {
+		if strings.Contains(cidr, ":") == (ipType == IPv6) {
+			list = append(list, cidr)
+		}
+	}
+	return list
+}
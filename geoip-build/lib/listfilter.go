@@ -0,0 +1,139 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ListFilter matches names of lists against the items of wantedList or
+// excludedList, case-insensitively. Each item is one of:
+//   - a name, e.g. "cn"
+//   - a glob pattern, in which "*" matches any characters and "?" matches
+//     one character, e.g. "category-*"
+//   - a regular expression enclosed in slashes, e.g. "/^(cn|hk|mo)$/"
+//   - a preset, which is expanded to the names of its lists, e.g.
+//     "preset:cn-full", see Presets
+//
+// A nil ListFilter is empty.
+type ListFilter struct {
+	items []*listFilterItem
+	names map[string]bool
+}
+
+type listFilterItem struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// NewListFilter returns the filter of the items in list. Empty items are ignored.
+func NewListFilter(list []string) (*ListFilter, error) {
+	list, err := expandPresets(list)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &ListFilter{
+		items: make([]*listFilterItem, 0, len(list)),
+		names: make(map[string]bool, len(list)),
+	}
+
+	for _, item := range list {
+		item = strings.TrimSpace(item)
+		switch {
+		case item == "":
+			continue
+
+		case len(item) > 2 && strings.HasPrefix(item, "/") && strings.HasSuffix(item, "/"):
+			pattern, err := regexp.Compile("(?i)" + item[1:len(item)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression %s: %w", item, err)
+			}
+			f.items = append(f.items, &listFilterItem{pattern: pattern})
+
+		case strings.ContainsAny(item, "*?"):
+			expr := regexp.QuoteMeta(item)
+			expr = strings.ReplaceAll(expr, `\*`, ".*")
+			expr = strings.ReplaceAll(expr, `\?`, ".")
+			f.items = append(f.items, &listFilterItem{pattern: regexp.MustCompile("(?i)^" + expr + "$")})
+
+		default:
+			name := strings.ToUpper(item)
+			if !f.names[name] {
+				f.names[name] = true
+				f.items = append(f.items, &listFilterItem{name: name})
+			}
+		}
+	}
+
+	return f, nil
+}
+
+// IsEmpty reports whether the filter has no items.
+func (f *ListFilter) IsEmpty() bool {
+	return f == nil || len(f.items) == 0
+}
+
+// Match reports whether name matches any item of the filter.
+func (f *ListFilter) Match(name string) bool {
+	if f.IsEmpty() {
+		return false
+	}
+
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if f.names[name] {
+		return true
+	}
+	for _, item := range f.items {
+		if item.pattern != nil && item.pattern.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Wants reports whether name is wanted by the filter used as a wantedList,
+// which wants all names if it is empty.
+func (f *ListFilter) Wants(name string) bool {
+	return f.IsEmpty() || f.Match(name)
+}
+
+// Expand returns the names of the filter in order, with each pattern replaced
+// by the sorted names of the entries in container it matches, leaving out the
+// names matched by exclude.
+func (f *ListFilter) Expand(container Container, exclude *ListFilter) []string {
+	if f.IsEmpty() {
+		return nil
+	}
+
+	var entryNames []string
+	added := make(map[string]bool)
+	list := make([]string, 0, len(f.items))
+	for _, item := range f.items {
+		if item.pattern == nil {
+			if !added[item.name] && !exclude.Match(item.name) {
+				added[item.name] = true
+				list = append(list, item.name)
+			}
+			continue
+		}
+
+		if entryNames == nil {
+			entryNames = make([]string, 0, 300)
+			for entry := range container.Loop() {
+				entryNames = append(entryNames, entry.GetName())
+			}
+			slices.Sort(entryNames)
+		}
+		for _, name := range entryNames {
+			if !added[name] && item.pattern.MatchString(name) && !exclude.Match(name) {
+				added[name] = true
+				list = append(list, name)
+			}
+		}
+	}
+
+	return list
+}
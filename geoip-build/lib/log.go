@@ -0,0 +1,95 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// SetupLogger sets the default logger writing to w with the minimum level
+// ("debug", "info", "warn" or "error") and format ("text" or "json").
+// Messages printed by the standard log package are logged at info level.
+func SetupLogger(w io.Writer, level, format string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level: %s", level)
+	}
+
+	w = &progressClearingWriter{w: w}
+	opts := &slog.HandlerOptions{Level: l}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case LogFormatText:
+		handler = slog.NewTextHandler(w, opts)
+	case LogFormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid log format: %s", format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// TrackRemoteReader wraps the body of the response of url, reports the download
+// progress, and when closed, logs the number of bytes read and the time elapsed
+// since start, and records the version of the remote file.
+func TrackRemoteReader(url string, start time.Time, resp *http.Response) io.ReadCloser {
+	return &remoteReader{
+		ReadCloser: resp.Body,
+		url:        url,
+		start:      start,
+		total:      resp.ContentLength,
+		hash:       sha256.New(),
+		source: &SourceVersion{
+			URL:          url,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		},
+	}
+}
+
+type remoteReader struct {
+	io.ReadCloser
+	url    string
+	start  time.Time
+	n      int64
+	total  int64
+	hash   hash.Hash
+	source *SourceVersion
+	once   sync.Once
+}
+
+func (r *remoteReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	r.hash.Write(p[:n])
+	showDownloadProgress(r.url, r.n, r.total)
+	return n, err
+}
+
+func (r *remoteReader) Close() error {
+	r.once.Do(func() {
+		logDownload(r.url, r.n, time.Since(r.start))
+		r.source.Size = r.n
+		r.source.SHA256 = fmt.Sprintf("%x", r.hash.Sum(nil))
+		recordSource(r.source)
+	})
+	return r.ReadCloser.Close()
+}
+
+func logDownload(url string, n int64, duration time.Duration) {
+	clearProgress()
+	slog.Info("⬇️ downloaded "+url, "url", url, "bytes", n, "duration", duration.Round(time.Millisecond))
+}
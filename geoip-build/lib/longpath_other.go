@@ -0,0 +1,9 @@
+//go:build !windows
+
+package lib
+
+// osPath returns name as is, as there is no limit of the length of paths
+// other than the ones of the file system.
+func osPath(name string) string {
+	return name
+}
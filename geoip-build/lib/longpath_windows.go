@@ -0,0 +1,16 @@
+//go:build windows
+
+package lib
+
+import "path/filepath"
+
+// osPath returns the absolute path of name, which the os package converts
+// to the extended-length form of Windows if it is longer than MAX_PATH, so
+// that outputs can be written to deeply nested directories without the
+// LongPathsEnabled policy of the system.
+func osPath(name string) string {
+	if abs, err := filepath.Abs(name); err == nil {
+		return abs
+	}
+	return name
+}
@@ -0,0 +1,165 @@
+package lib
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// typeManifest is the type of the manifest file recorded as an artifact.
+const typeManifest = "manifest"
+
+var (
+	sourceMu   sync.Mutex
+	sourceList = make([]*SourceVersion, 0, 16)
+)
+
+// SourceVersion describes the version of a remote file downloaded by input converters.
+type SourceVersion struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Size         int64  `json:"size"`
+	SHA256       string `json:"sha256"`
+}
+
+func recordSource(source *SourceVersion) {
+	sourceMu.Lock()
+	defer sourceMu.Unlock()
+	sourceList = append(sourceList, source)
+}
+
+// ResetSources removes all recorded source versions.
+func ResetSources() {
+	sourceMu.Lock()
+	defer sourceMu.Unlock()
+	sourceList = sourceList[:0]
+}
+
+// Sources returns the recorded source versions sorted by URL. If a remote
+// file is downloaded more than once, only its last version is returned.
+func Sources() []*SourceVersion {
+	sourceMu.Lock()
+	defer sourceMu.Unlock()
+
+	latest := make(map[string]*SourceVersion, len(sourceList))
+	for _, source := range sourceList {
+		latest[source.URL] = source
+	}
+
+	list := make([]*SourceVersion, 0, len(latest))
+	for _, source := range latest {
+		list = append(list, source)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].URL < list[j].URL
+	})
+
+	return list
+}
+
+// downloadedBytes returns the total size of all remote files read since the last reset.
+func downloadedBytes() int64 {
+	sourceMu.Lock()
+	defer sourceMu.Unlock()
+
+	var n int64
+	for _, source := range sourceList {
+		n += source.Size
+	}
+	return n
+}
+
+// Manifest describes the artifacts of a run and the sources they are built from,
+// so that downstream updaters can decide whether to fetch them.
+type Manifest struct {
+	BuildTime time.Time `json:"buildTime"`
+	// AsOf is the date of the archived sources of a build as of a date.
+	AsOf      string              `json:"asOf,omitempty"`
+	Builder   *BuildInfo          `json:"builder"`
+	Artifacts []*ManifestArtifact `json:"artifacts"`
+	Sources   []*SourceVersion    `json:"sources"`
+}
+
+// ManifestArtifact is an artifact in the manifest, with the path relative
+// to the directory of the manifest file.
+type ManifestArtifact struct {
+	Type   string        `json:"type"`
+	Path   string        `json:"path"`
+	Size   int64         `json:"size"`
+	SHA256 string        `json:"sha256"`
+	Lists  []*EntryStats `json:"lists"`
+}
+
+// Manifest returns the manifest of the last run, with the paths of artifacts
+// relative to dir.
+func (i *Instance) Manifest(dir string) (*Manifest, error) {
+	stats := make(map[string]*EntryStats)
+	if i.container != nil {
+		list, err := GetStats(i.container)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range list {
+			stats[s.Name] = s
+		}
+	}
+
+	manifest := &Manifest{
+		BuildTime: time.Unix(BuildEpoch(), 0).UTC(),
+		AsOf:      AsOf(),
+		Builder:   GetBuildInfo(),
+		Artifacts: make([]*ManifestArtifact, 0, 16),
+		Sources:   Sources(),
+	}
+	for _, artifact := range Artifacts() {
+		path, err := filepath.Rel(dir, artifact.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		lists := make([]*EntryStats, 0, len(artifact.Lists))
+		for _, name := range artifact.Lists {
+			if s, found := stats[name]; found {
+				lists = append(lists, s)
+			} else {
+				lists = append(lists, &EntryStats{Name: name})
+			}
+		}
+
+		manifest.Artifacts = append(manifest.Artifacts, &ManifestArtifact{
+			Type:   artifact.Type,
+			Path:   filepath.ToSlash(path),
+			Size:   artifact.Size,
+			SHA256: artifact.SHA256,
+			Lists:  lists,
+		})
+	}
+
+	return manifest, nil
+}
+
+// WriteManifest writes the manifest of the last run in JSON format to file,
+// which is recorded as an artifact.
+func (i *Instance) WriteManifest(file string) error {
+	if err := i.writeManifest(file); err != nil {
+		return &RunError{Kind: ErrorKindOutput, Type: typeManifest, Action: ActionOutput, Err: err}
+	}
+	return nil
+}
+
+func (i *Instance) writeManifest(file string) error {
+	manifest, err := i.Manifest(filepath.Dir(file))
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return WriteFile(typeManifest, file, append(data, '\n'))
+}
@@ -0,0 +1,126 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// configKeyMetadata is the key of the metadata an input attaches to the
+// lists it adds.
+const configKeyMetadata = "metadata"
+
+// ArgMetadataHeader is the argument of the output converters writing the
+// metadata of each list as a header comment block.
+var ArgMetadataHeader = Arg{
+	Name:        "metadataHeader",
+	Type:        ArgTypeBool,
+	Description: "Write a header comment block with the name, description, sources and generation time of each list, from the metadata attached by the inputs",
+}
+
+// ListMetadata describes a list, attached by the inputs adding it, so that
+// published lists are self-describing.
+type ListMetadata struct {
+	Description string   `json:"description,omitempty"`
+	Sources     []string `json:"sources,omitempty"`
+}
+
+// inputMetadata is the metadata of an input in config, which is attached
+// to all lists it adds.
+type inputMetadata struct {
+	Description string `json:"description"`
+	// Descriptions are the descriptions of certain lists, overriding Description.
+	Descriptions map[string]string `json:"descriptions"`
+	// Source defaults to the remote URLs in the args of the input.
+	Source string `json:"source"`
+
+	sources []string
+}
+
+// newInputMetadata returns the metadata of an input of data with args, or
+// nil if data is empty.
+func newInputMetadata(data, args json.RawMessage) (*inputMetadata, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+
+	var m inputMetadata
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", configKeyMetadata, err)
+	}
+	descriptions := make(map[string]string, len(m.Descriptions))
+	for name, description := range m.Descriptions {
+		descriptions[strings.ToUpper(strings.TrimSpace(name))] = singleLine(description)
+	}
+	m.Description, m.Descriptions = singleLine(m.Description), descriptions
+
+	if source := strings.TrimSpace(m.Source); source != "" {
+		m.sources = []string{source}
+	} else if len(args) > 0 {
+		var decoded any
+		if err := json.Unmarshal(args, &decoded); err == nil {
+			m.sources = findURLs(decoded)
+		}
+	}
+	return &m, nil
+}
+
+// list returns the metadata attached to the list name.
+func (m *inputMetadata) list(name string) *ListMetadata {
+	description, found := m.Descriptions[name]
+	if !found {
+		description = m.Description
+	}
+	return &ListMetadata{Description: description, Sources: m.sources}
+}
+
+// singleLine replaces the line breaks of s with spaces, so that it fits in
+// a comment line.
+func singleLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Metadata returns the metadata attached to the entry by the inputs adding
+// it, or nil if none.
+func (e *Entry) Metadata() *ListMetadata {
+	return e.metadata
+}
+
+// addMetadata merges m into the metadata of the entry, in which the first
+// description is kept and the sources are appended.
+func (e *Entry) addMetadata(m *ListMetadata) {
+	if m == nil {
+		return
+	}
+	if e.metadata == nil {
+		e.metadata = &ListMetadata{Description: m.Description, Sources: slices.Clone(m.Sources)}
+		return
+	}
+	if e.metadata.Description == "" {
+		e.metadata.Description = m.Description
+	}
+	for _, source := range m.Sources {
+		if !slices.Contains(e.metadata.Sources, source) {
+			e.metadata.Sources = append(e.metadata.Sources, source)
+		}
+	}
+}
+
+// MetadataHeader returns the lines of the header of the entry, without
+// comment markers, describing the list by its name, metadata and the build
+// timestamp.
+func MetadataHeader(entry *Entry) []string {
+	lines := []string{"Name: " + strings.ToLower(entry.GetName())}
+	if m := entry.Metadata(); m != nil {
+		if m.Description != "" {
+			lines = append(lines, "Description: "+m.Description)
+		}
+		for _, source := range m.Sources {
+			lines = append(lines, "Source: "+source)
+		}
+	}
+	lines = append(lines, "Generated-At: "+time.Unix(BuildEpoch(), 0).UTC().Format(time.RFC3339))
+	return lines
+}
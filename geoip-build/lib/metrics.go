@@ -0,0 +1,219 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metricsContentType is the content type of the Prometheus text exposition format.
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// MetricsExporter exports the metrics of builds in the Prometheus text format
+// to a file for the textfile collector of node_exporter, or a Pushgateway.
+type MetricsExporter struct {
+	// File is the path to write the metrics to if not empty, which is
+	// replaced atomically so that collectors never read partial files.
+	File string
+	// PushURL is the base URL of the Pushgateway to push the metrics to
+	// if not empty, e.g. "http://localhost:9091".
+	PushURL string
+	// Job is the job label of the metrics pushed to the Pushgateway.
+	Job string
+
+	client *http.Client
+}
+
+// NewMetricsExporter returns the exporter of metrics to file and the
+// Pushgateway of pushURL, or nil if both are empty.
+func NewMetricsExporter(file, pushURL, job string) (*MetricsExporter, error) {
+	if file == "" && pushURL == "" {
+		return nil, nil
+	}
+	if pushURL != "" {
+		u, err := url.Parse(pushURL)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("invalid Pushgateway URL %q", pushURL)
+		}
+		if job == "" {
+			return nil, fmt.Errorf("job of pushed metrics must be specified")
+		}
+	}
+
+	return &MetricsExporter{
+		File:    file,
+		PushURL: strings.TrimSuffix(pushURL, "/"),
+		Job:     job,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Export writes and pushes the metrics of the build run by instance, which
+// started at start and failed with err if not nil. Instance may be nil if
+// the build failed before running.
+func (e *MetricsExporter) Export(instance *Instance, start time.Time, err error) error {
+	if e == nil {
+		return nil
+	}
+
+	data := BuildMetrics(instance, start, err)
+	if e.File != "" {
+		if err := writeFileAtomic(e.File, data); err != nil {
+			return fmt.Errorf("failed to write metrics to %s: %w", e.File, err)
+		}
+		slog.Info("📈 metrics written to "+e.File, "file", e.File)
+	}
+	if e.PushURL != "" {
+		if err := e.push(data); err != nil {
+			return fmt.Errorf("failed to push metrics to %s: %w", e.PushURL, err)
+		}
+		slog.Info("📈 metrics pushed to "+e.PushURL, "url", e.PushURL, "job", e.Job)
+	}
+
+	return nil
+}
+
+// push replaces all metrics of the job in the Pushgateway with data.
+func (e *MetricsExporter) push(data []byte) error {
+	req, err := http.NewRequest(http.MethodPut, e.PushURL+"/metrics/job/"+url.PathEscape(e.Job), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", metricsContentType)
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// BuildMetrics returns the metrics of the build run by instance in the
+// Prometheus text format, see Export for the arguments.
+func BuildMetrics(instance *Instance, start time.Time, err error) []byte {
+	m := new(metricsWriter)
+
+	m.family("geoip_build_success", "gauge", "Whether the last build succeeded")
+	m.sample("geoip_build_success", nil, boolValue(err == nil))
+	m.family("geoip_build_duration_seconds", "gauge", "Time taken by the last build")
+	m.sample("geoip_build_duration_seconds", nil, time.Since(start).Seconds())
+	m.family("geoip_build_last_run_timestamp_seconds", "gauge", "Unix time of the completion of the last build")
+	m.sample("geoip_build_last_run_timestamp_seconds", nil, float64(time.Now().Unix()))
+
+	m.family("geoip_build_exit_code", "gauge", "Exit code of the last build, 0 if it succeeded")
+	if err == nil {
+		m.sample("geoip_build_exit_code", nil, 0)
+	} else {
+		m.sample("geoip_build_exit_code", []string{"kind", string(NewErrorReport(err, nil).Kind)}, float64(ExitCode(err)))
+	}
+
+	m.family("geoip_downloaded_bytes", "gauge", "Total size of the remote files downloaded by the last build")
+	m.sample("geoip_downloaded_bytes", nil, float64(downloadedBytes()))
+
+	if instance == nil {
+		return m.Bytes()
+	}
+
+	m.family("geoip_input_failures", "gauge", "Number of failed inputs skipped by the last build")
+	m.sample("geoip_input_failures", nil, float64(len(instance.Failures())))
+
+	if timings := instance.Timings(); len(timings) > 0 {
+		m.family("geoip_stage_duration_seconds", "gauge", "Time taken by each input and output of the last build")
+		counts := make(map[string]int)
+		for _, timing := range timings {
+			index := counts[timing.Stage]
+			counts[timing.Stage]++
+			m.sample("geoip_stage_duration_seconds", []string{
+				"stage", timing.Stage,
+				"index", strconv.Itoa(index),
+				"type", timing.Type,
+				"action", string(timing.Action),
+			}, timing.Duration.Seconds())
+		}
+	}
+
+	if instance.container != nil {
+		if stats, err := GetStats(instance.container); err == nil && len(stats) > 0 {
+			m.family("geoip_list_prefixes", "gauge", "Number of CIDR prefixes of each list generated by the last build")
+			for _, stat := range stats {
+				m.sample("geoip_list_prefixes", []string{"list", stat.Name, "family", "ipv4"}, float64(stat.IPv4))
+				m.sample("geoip_list_prefixes", []string{"list", stat.Name, "family", "ipv6"}, float64(stat.IPv6))
+			}
+		}
+	}
+
+	if artifacts := Artifacts(); len(artifacts) > 0 {
+		m.family("geoip_artifact_bytes", "gauge", "Size of each file written by the last build")
+		for _, artifact := range artifacts {
+			m.sample("geoip_artifact_bytes", []string{"type", artifact.Type, "path", artifact.Path}, float64(artifact.Size))
+		}
+	}
+
+	return m.Bytes()
+}
+
+// metricsWriter writes metrics in the Prometheus text format.
+type metricsWriter struct {
+	bytes.Buffer
+}
+
+func (m *metricsWriter) family(name, typ, help string) {
+	fmt.Fprintf(m, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes a sample of the metric name with labels in name-value pairs.
+func (m *metricsWriter) sample(name string, labels []string, value float64) {
+	m.WriteString(name)
+	if len(labels) > 0 {
+		m.WriteByte('{')
+		for idx := 0; idx+1 < len(labels); idx += 2 {
+			if idx > 0 {
+				m.WriteByte(',')
+			}
+			fmt.Fprintf(m, "%s=\"%s\"", labels[idx], escapeLabelValue(labels[idx+1]))
+		}
+		m.WriteByte('}')
+	}
+	m.WriteByte(' ')
+	m.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	m.WriteByte('\n')
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// writeFileAtomic writes data to a temporary file in the directory of
+// file and renames it to file, on the local disk whatever the OutputFS is.
+func writeFileAtomic(file string, data []byte) error {
+	f, err := osFS{}.Create(file)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Discard()
+		return err
+	}
+	return f.Close()
+}
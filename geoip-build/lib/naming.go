@@ -0,0 +1,74 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Cases of the names of the files written per list.
+const (
+	NameCaseLower = "lower"
+	NameCaseUpper = "upper"
+)
+
+// Arguments of the names of the files written per list, shared by the
+// output converters writing a file for each list.
+var (
+	ArgNameCase = Arg{
+		Name:        "nameCase",
+		Type:        ArgTypeString,
+		Description: "The case of the list names in the file names",
+		Default:     NameCaseLower,
+		Enum:        []string{NameCaseLower, NameCaseUpper},
+	}
+	ArgNamePrefix = Arg{
+		Name:        "namePrefix",
+		Type:        ArgTypeString,
+		Description: "The prefix of the file names before the list names, e.g. \"geoip-\"",
+	}
+	ArgNameSuffix = Arg{
+		Name:        "nameSuffix",
+		Type:        ArgTypeString,
+		Description: "The suffix of the file names after the list names and before the extension",
+	}
+)
+
+// ListNaming is how an output converter writing a file for each list names
+// the files, e.g. "geoip-cn.txt" or "CN.txt", to follow the conventions of
+// different downstream ecosystems.
+type ListNaming struct {
+	Case   string
+	Prefix string
+	Suffix string
+}
+
+// NewListNaming returns the naming of the args nameCase, namePrefix and
+// nameSuffix, which is lowercase without prefix and suffix by default.
+func NewListNaming(nameCase, prefix, suffix string) (*ListNaming, error) {
+	n := &ListNaming{
+		Case:   strings.ToLower(strings.TrimSpace(nameCase)),
+		Prefix: prefix,
+		Suffix: suffix,
+	}
+	switch n.Case {
+	case "":
+		n.Case = NameCaseLower
+	case NameCaseLower, NameCaseUpper:
+	default:
+		return nil, fmt.Errorf("invalid nameCase %q, available options: %s, %s", nameCase, NameCaseLower, NameCaseUpper)
+	}
+	if strings.ContainsAny(prefix+suffix, `/\`) {
+		return nil, fmt.Errorf("namePrefix and nameSuffix must not contain path separators")
+	}
+	return n, nil
+}
+
+// FileName returns the name of the file of the list name with ext.
+func (n *ListNaming) FileName(name, ext string) string {
+	if n.Case == NameCaseUpper {
+		name = strings.ToUpper(name)
+	} else {
+		name = strings.ToLower(name)
+	}
+	return n.Prefix + name + n.Suffix + ext
+}
@@ -0,0 +1,156 @@
+package lib
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"go4.org/netipx"
+)
+
+// Modes of the IPv4-mapped IPv6 addresses and CIDRs like ::ffff:1.2.3.4,
+// which are added to the lists as IPv4 by default.
+const (
+	MappedIPv4AsIPv4 = "ipv4"
+	MappedIPv4AsIPv6 = "ipv6"
+)
+
+// configKeyMappedIPv4 is the key of the mode of the IPv4-mapped IPv6 CIDRs
+// of all inputs at the top level of config, and of a single input in the
+// input.
+const configKeyMappedIPv4 = "mappedIPv4"
+
+var mappedIPv4Modes = []string{MappedIPv4AsIPv4, MappedIPv4AsIPv6}
+
+// mappedIPv4Range is the range of the IPv4-mapped IPv6 addresses.
+var mappedIPv4Range = netip.MustParsePrefix("::ffff:0:0/96")
+
+// mappedIPv4 is the mode of the configs not specifying mappedIPv4.
+var mappedIPv4 = MappedIPv4AsIPv4
+
+// SetMappedIPv4 sets whether the IPv4-mapped IPv6 addresses and CIDRs are
+// added to the lists as IPv4, or kept as IPv6 in the ::ffff:0:0/96 range,
+// by the inputs of configs not specifying mappedIPv4 and by ParsePrefix.
+func SetMappedIPv4(mode string) error {
+	mode, err := checkMappedIPv4(mode)
+	if err != nil {
+		return err
+	}
+	mappedIPv4 = mode
+	return nil
+}
+
+// checkMappedIPv4 returns the mode of the IPv4-mapped IPv6 CIDRs in
+// lowercase, which is the default mode if empty.
+func checkMappedIPv4(mode string) (string, error) {
+	switch mode = strings.ToLower(strings.TrimSpace(mode)); mode {
+	case "":
+		return mappedIPv4, nil
+	case MappedIPv4AsIPv4, MappedIPv4AsIPv6:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid mapped IPv4 mode %q, available options: %s", mode, strings.Join(mappedIPv4Modes, ", "))
+}
+
+// ParsePrefix parses an IP address or CIDR in text form into its normalized
+// CIDR, so that all converters accept the same forms of IPv6: uppercase hex,
+// brackets like [2001:db8::1], zone IDs like fe80::1%eth0 which are dropped,
+// and IPv4-mapped addresses which are converted as set by SetMappedIPv4.
+func ParsePrefix(s string) (netip.Prefix, IPType, error) {
+	return parsePrefix(s, mappedIPv4 == MappedIPv4AsIPv6)
+}
+
+// parsePrefix is ParsePrefix keeping IPv4-mapped addresses as IPv6 if
+// keepMapped is true, or converting them to IPv4 otherwise.
+func parsePrefix(s string, keepMapped bool) (netip.Prefix, IPType, error) {
+	s = strings.TrimSpace(s)
+	addr, bits, isCIDR := strings.Cut(s, "/")
+	addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	addr, _, _ = strings.Cut(addr, "%")
+
+	if !isCIDR {
+		ip, err := netip.ParseAddr(addr)
+		if err != nil {
+			return netip.Prefix{}, "", ErrInvalidIP
+		}
+		return normalizePrefix(netip.PrefixFrom(ip, ip.BitLen()), keepMapped)
+	}
+
+	s = addr + "/" + bits
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		// net.ParseCIDR is slower but accepts more, e.g. leading zeros in prefix length
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return netip.Prefix{}, "", ErrInvalidCIDR
+		}
+		var ok bool
+		if prefix, ok = netipx.FromStdIPNet(network); !ok {
+			return netip.Prefix{}, "", ErrInvalidIPNet
+		}
+	}
+	return normalizePrefix(prefix, keepMapped)
+}
+
+// NormalizePrefix returns prefix with the host bits and the zone of its
+// address cleared, and IPv4-mapped prefixes converted as set by
+// SetMappedIPv4, along with the IP type of the list it belongs to.
+func NormalizePrefix(prefix netip.Prefix) (netip.Prefix, IPType, error) {
+	return normalizePrefix(prefix, mappedIPv4 == MappedIPv4AsIPv6)
+}
+
+func normalizePrefix(prefix netip.Prefix, keepMapped bool) (netip.Prefix, IPType, error) {
+	ip, bits := prefix.Addr().WithZone(""), prefix.Bits()
+	switch {
+	case ip.Is4():
+	case ip.Is4In6():
+		if bits < mappedIPv4Range.Bits() {
+			return netip.Prefix{}, "", ErrInvalidPrefix
+		}
+		if !keepMapped {
+			ip, bits = ip.Unmap(), bits-mappedIPv4Range.Bits()
+		}
+	case ip.Is6():
+	default:
+		return netip.Prefix{}, "", ErrInvalidIPLength
+	}
+
+	normalized, err := ip.Prefix(bits)
+	if err != nil {
+		return netip.Prefix{}, "", ErrInvalidPrefix
+	}
+	if normalized.Addr().Is4() {
+		return normalized, IPv4, nil
+	}
+	return normalized, IPv6, nil
+}
+
+// unmapIPv4 moves the IPv4-mapped IPv6 CIDRs of the entry to IPv4. Entries
+// keep them as IPv6 when adding them, so that the inputs parsing their
+// sources at the same time can be of different modes, which are applied
+// once the entries are added to the lists, see inputContainer.
+func (e *Entry) unmapIPv4() {
+	if !e.hasIPv6Builder() {
+		return
+	}
+	var mapped []netip.Prefix
+	e.ipv6Builder.root.walk(func(prefix netip.Prefix) {
+		// CIDRs larger than the range, e.g. ::/3, are IPv6 ones
+		if prefix.Addr().Is4In6() && prefix.Bits() >= mappedIPv4Range.Bits() {
+			mapped = append(mapped, prefix)
+		}
+	})
+	if len(mapped) == 0 {
+		return
+	}
+
+	if !e.hasIPv4Builder() {
+		e.ipv4Builder = new(prefixTrie)
+	}
+	for _, prefix := range mapped {
+		e.ipv6Builder.RemovePrefix(prefix)
+		e.ipv4Builder.AddPrefix(netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-mappedIPv4Range.Bits()))
+	}
+	e.ipv4Set, e.ipv6Set = nil, nil
+}
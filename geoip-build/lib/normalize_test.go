@@ -0,0 +1,178 @@
+package lib
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestParsePrefix(t *testing.T) {
+	t.Cleanup(func() { SetMappedIPv4(MappedIPv4AsIPv4) })
+
+	tests := []struct {
+		in string
+		// want and wantType are in the MappedIPv4AsIPv4 mode, and wantMapped
+		// and wantMappedType in the MappedIPv4AsIPv6 mode if different.
+		want           string
+		wantType       IPType
+		wantMapped     string
+		wantMappedType IPType
+		err            error
+	}{
+		{in: "1.2.3.4", want: "1.2.3.4/32", wantType: IPv4},
+		{in: " 1.2.3.4 ", want: "1.2.3.4/32", wantType: IPv4},
+		{in: "1.2.3.4/24", want: "1.2.3.0/24", wantType: IPv4},
+		{in: "1.2.3.5/31", want: "1.2.3.4/31", wantType: IPv4},
+		{in: "2001:DB8::1", want: "2001:db8::1/128", wantType: IPv6},
+		{in: "2001:db8::1/127", want: "2001:db8::/127", wantType: IPv6},
+		{in: "[2001:db8::1]", want: "2001:db8::1/128", wantType: IPv6},
+		{in: "[2001:db8::1]/64", want: "2001:db8::/64", wantType: IPv6},
+		{in: "fe80::1%eth0", want: "fe80::1/128", wantType: IPv6},
+		{in: "fe80::1%eth0/64", want: "fe80::/64", wantType: IPv6},
+		{in: "[fe80::1%eth0]", want: "fe80::1/128", wantType: IPv6},
+		{in: "::ffff:1.2.3.4", want: "1.2.3.4/32", wantType: IPv4, wantMapped: "::ffff:1.2.3.4/128", wantMappedType: IPv6},
+		{in: "::FFFF:1.2.3.4/120", want: "1.2.3.0/24", wantType: IPv4, wantMapped: "::ffff:1.2.3.0/120", wantMappedType: IPv6},
+		{in: "[::ffff:1.2.3.5]/127", want: "1.2.3.4/31", wantType: IPv4, wantMapped: "::ffff:1.2.3.4/127", wantMappedType: IPv6},
+		{in: "::ffff:1.2.3.4/96", want: "0.0.0.0/0", wantType: IPv4, wantMapped: "::ffff:0.0.0.0/96", wantMappedType: IPv6},
+		{in: "::ffff:1.2.3.4/90", err: ErrInvalidPrefix},
+		{in: "::/3", want: "::/3", wantType: IPv6},
+		{in: "1.2.3.4/33", err: ErrInvalidCIDR},
+		{in: "2001:db8::/129", err: ErrInvalidCIDR},
+		{in: "1.2.3", err: ErrInvalidIP},
+		{in: "example.com", err: ErrInvalidIP},
+		{in: "", err: ErrInvalidIP},
+	}
+
+	for _, mode := range []string{MappedIPv4AsIPv4, MappedIPv4AsIPv6} {
+		if err := SetMappedIPv4(mode); err != nil {
+			t.Fatal(err)
+		}
+		for _, tt := range tests {
+			t.Run(mode+"/"+tt.in, func(t *testing.T) {
+				want, wantType := tt.want, tt.wantType
+				if mode == MappedIPv4AsIPv6 && tt.wantMapped != "" {
+					want, wantType = tt.wantMapped, tt.wantMappedType
+				}
+
+				prefix, ipType, err := ParsePrefix(tt.in)
+				if tt.err != nil {
+					if !errors.Is(err, tt.err) {
+						t.Fatalf("ParsePrefix(%q) error = %v, want %v", tt.in, err, tt.err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("ParsePrefix(%q) error = %v", tt.in, err)
+				}
+				if prefix.String() != want || ipType != wantType {
+					t.Errorf("ParsePrefix(%q) = %s, %s, want %s, %s", tt.in, prefix, ipType, want, wantType)
+				}
+			})
+		}
+	}
+}
+
+func TestNormalizePrefix(t *testing.T) {
+	t.Cleanup(func() { SetMappedIPv4(MappedIPv4AsIPv4) })
+
+	tests := []struct {
+		name           string
+		in             netip.Prefix
+		want           string
+		wantType       IPType
+		wantMapped     string
+		wantMappedType IPType
+		err            error
+	}{
+		{name: "ipv4 host bits", in: netip.MustParsePrefix("1.2.3.5/31"), want: "1.2.3.4/31", wantType: IPv4},
+		{name: "ipv6 host bits", in: netip.MustParsePrefix("2001:db8::1/127"), want: "2001:db8::/127", wantType: IPv6},
+		{name: "zone", in: netip.PrefixFrom(netip.MustParseAddr("fe80::1%eth0"), 64), want: "fe80::/64", wantType: IPv6},
+		{name: "mapped address", in: netip.PrefixFrom(netip.MustParseAddr("::ffff:1.2.3.4"), 128), want: "1.2.3.4/32", wantType: IPv4, wantMapped: "::ffff:1.2.3.4/128", wantMappedType: IPv6},
+		{name: "mapped cidr", in: netip.MustParsePrefix("::ffff:1.2.3.4/104"), want: "1.0.0.0/8", wantType: IPv4, wantMapped: "::ffff:1.0.0.0/104", wantMappedType: IPv6},
+		{name: "mapped cidr shorter than 96", in: netip.MustParsePrefix("::ffff:1.2.3.4/95"), err: ErrInvalidPrefix},
+		{name: "invalid bits", in: netip.PrefixFrom(netip.MustParseAddr("1.2.3.4"), 33), err: ErrInvalidPrefix},
+		{name: "zero", in: netip.Prefix{}, err: ErrInvalidIPLength},
+	}
+
+	for _, mode := range []string{MappedIPv4AsIPv4, MappedIPv4AsIPv6} {
+		if err := SetMappedIPv4(mode); err != nil {
+			t.Fatal(err)
+		}
+		for _, tt := range tests {
+			t.Run(mode+"/"+tt.name, func(t *testing.T) {
+				want, wantType := tt.want, tt.wantType
+				if mode == MappedIPv4AsIPv6 && tt.wantMapped != "" {
+					want, wantType = tt.wantMapped, tt.wantMappedType
+				}
+
+				prefix, ipType, err := NormalizePrefix(tt.in)
+				if tt.err != nil {
+					if !errors.Is(err, tt.err) {
+						t.Fatalf("NormalizePrefix(%s) error = %v, want %v", tt.in, err, tt.err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("NormalizePrefix(%s) error = %v", tt.in, err)
+				}
+				if prefix.String() != want || ipType != wantType {
+					t.Errorf("NormalizePrefix(%s) = %s, %s, want %s, %s", tt.in, prefix, ipType, want, wantType)
+				}
+			})
+		}
+	}
+}
+
+func TestSetMappedIPv4(t *testing.T) {
+	t.Cleanup(func() { SetMappedIPv4(MappedIPv4AsIPv4) })
+
+	for _, mode := range []string{"", "ipv4", " IPv6 "} {
+		if err := SetMappedIPv4(mode); err != nil {
+			t.Errorf("SetMappedIPv4(%q) error = %v", mode, err)
+		}
+	}
+	if err := SetMappedIPv4("ipv5"); err == nil {
+		t.Error("SetMappedIPv4(\"ipv5\") error = nil, want an error")
+	}
+}
+
+func TestEntryUnmapIPv4(t *testing.T) {
+	entry := NewEntry("test")
+	for _, cidr := range []string{"::ffff:1.2.3.0/120", "::ffff:5.6.7.8", "2001:db8::/32", "9.9.9.9"} {
+		if err := entry.AddPrefix(cidr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Entries keep IPv4-mapped CIDRs as IPv6 whatever the mode is
+	if prefixes, _ := entry.MarshalText(IgnoreIPv4); len(prefixes) != 3 {
+		t.Fatalf("IPv6 CIDRs = %v, want 3 before unmapping", prefixes)
+	}
+
+	entry.unmapIPv4()
+	ipv4, err := entry.MarshalText(IgnoreIPv6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipv6, err := entry.MarshalText(IgnoreIPv4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1.2.3.0/24", "5.6.7.8/32", "9.9.9.9/32"}; !slices.Equal(ipv4, want) {
+		t.Errorf("IPv4 CIDRs = %v, want %v", ipv4, want)
+	}
+	if want := []string{"2001:db8::/32"}; !slices.Equal(ipv6, want) {
+		t.Errorf("IPv6 CIDRs = %v, want %v", ipv6, want)
+	}
+
+	// CIDRs larger than the range of IPv4-mapped addresses are IPv6
+	entry = NewEntry("bogon")
+	if err := entry.AddPrefix("::/3"); err != nil {
+		t.Fatal(err)
+	}
+	entry.unmapIPv4()
+	if ipv4, _ := entry.MarshalText(IgnoreIPv6); len(ipv4) != 0 {
+		t.Errorf("IPv4 CIDRs = %v, want none", ipv4)
+	}
+}
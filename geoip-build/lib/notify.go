@@ -0,0 +1,177 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// When to send notifications of builds.
+const (
+	NotifyAlways  = "always"
+	NotifySuccess = "success"
+	NotifyFailure = "failure"
+)
+
+// TelegramBotTokenEnv is the environment variable of the token of the Telegram bot
+// sending notifications.
+const TelegramBotTokenEnv = "TELEGRAM_BOT_TOKEN"
+
+// BuildReport is the result of a build sent in notifications.
+type BuildReport struct {
+	Success   bool         `json:"success"`
+	Config    string       `json:"config"`
+	StartedAt time.Time    `json:"startedAt"`
+	Duration  string       `json:"duration"`
+	Summary   *Summary     `json:"summary,omitempty"`
+	Error     *ErrorReport `json:"error,omitempty"`
+}
+
+// NewBuildReport returns the report of a build of config started at start,
+// which failed with err if not nil.
+func NewBuildReport(config string, start time.Time, summary *Summary, err error, failures []*SourceFailure) *BuildReport {
+	report := &BuildReport{
+		Success:   err == nil,
+		Config:    config,
+		StartedAt: start,
+		Duration:  time.Since(start).Round(time.Millisecond).String(),
+		Summary:   summary,
+	}
+	if err != nil {
+		report.Error = NewErrorReport(err, failures)
+	}
+	return report
+}
+
+// Notifier sends the reports of builds to webhooks and Telegram chats.
+type Notifier struct {
+	// Webhooks are the URLs to POST the reports in JSON format to.
+	Webhooks []string
+	// TelegramToken and TelegramChatID are the token of the Telegram bot
+	// and the ID of the chat to send messages to.
+	TelegramToken  string
+	TelegramChatID string
+	// TelegramAPIURL is the base URL of the Telegram Bot API.
+	TelegramAPIURL string
+	// On is one of NotifyAlways, NotifySuccess and NotifyFailure.
+	On string
+
+	client *http.Client
+}
+
+// NewNotifier returns the notifier sending reports on the builds of on,
+// or nil if there is neither webhook nor Telegram chat.
+func NewNotifier(webhooks []string, telegramToken, telegramChatID, on string) (*Notifier, error) {
+	switch on {
+	case NotifyAlways, NotifySuccess, NotifyFailure:
+	default:
+		return nil, fmt.Errorf("invalid notify-on %q, available options: %s, %s, %s", on, NotifyAlways, NotifySuccess, NotifyFailure)
+	}
+	if telegramChatID != "" && telegramToken == "" {
+		return nil, fmt.Errorf("token of Telegram bot must be specified by the %s environment variable", TelegramBotTokenEnv)
+	}
+	if len(webhooks) == 0 && telegramChatID == "" {
+		return nil, nil
+	}
+
+	return &Notifier{
+		Webhooks:       webhooks,
+		TelegramToken:  telegramToken,
+		TelegramChatID: telegramChatID,
+		TelegramAPIURL: "https://api.telegram.org",
+		On:             on,
+		client:         &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Notify sends report to all webhooks and the Telegram chat if the build
+// is of the kind to notify on, and returns the errors of failed ones.
+func (n *Notifier) Notify(report *BuildReport) error {
+	if n == nil || (n.On == NotifySuccess && !report.Success) || (n.On == NotifyFailure && report.Success) {
+		return nil
+	}
+
+	var errs []error
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	for _, webhook := range n.Webhooks {
+		if err := n.post(webhook, data); err != nil {
+			errs = append(errs, fmt.Errorf("failed to notify webhook %s: %w", webhook, err))
+			continue
+		}
+		slog.Info("📣 notified webhook "+webhook, "url", webhook, "success", report.Success)
+	}
+
+	if n.TelegramChatID != "" {
+		message, _ := json.Marshal(map[string]string{
+			"chat_id": n.TelegramChatID,
+			"text":    telegramMessage(report),
+		})
+		// Keep the token out of errors
+		if err := n.post(n.TelegramAPIURL+"/bot"+n.TelegramToken+"/sendMessage", message); err != nil {
+			errs = append(errs, fmt.Errorf("failed to notify Telegram chat %s: %s", n.TelegramChatID, strings.ReplaceAll(err.Error(), n.TelegramToken, "***")))
+		} else {
+			slog.Info("📣 notified Telegram chat "+n.TelegramChatID, "chat", n.TelegramChatID, "success", report.Success)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (n *Notifier) post(url string, data []byte) error {
+	resp, err := n.client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// telegramMessage returns the plain text message of report.
+func telegramMessage(report *BuildReport) string {
+	var b strings.Builder
+	if report.Success {
+		fmt.Fprintf(&b, "✅ geoip build succeeded in %s\n", report.Duration)
+	} else {
+		fmt.Fprintf(&b, "❌ geoip build failed in %s\n", report.Duration)
+	}
+	fmt.Fprintf(&b, "Config: %s\n", report.Config)
+
+	if report.Error != nil {
+		fmt.Fprintf(&b, "Error (%s): %s\n", report.Error.Kind, report.Error.Error)
+	}
+	if s := report.Summary; s != nil {
+		changed := 0
+		for _, artifact := range s.Artifacts {
+			if !artifact.Unchanged {
+				changed++
+			}
+		}
+		fmt.Fprintf(&b, "Lists: %d, artifacts: %d (%d changed)\n", len(s.Lists), len(s.Artifacts), changed)
+	}
+
+	var failures []*SourceFailure
+	if report.Error != nil {
+		failures = report.Error.Failures
+	} else if report.Summary != nil {
+		failures = report.Summary.Failures
+	}
+	for _, f := range failures {
+		fmt.Fprintf(&b, "⚠️ skipped [%s] %s: %s\n", f.Type, f.Action, f.Error)
+	}
+
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,287 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing/fstest"
+	"time"
+)
+
+// OutputFS is a file system output converters write files to, so that builds
+// can write outputs to memory or stream them to remote storage instead of the
+// local disk. Names are the paths of files as configured, which do not have
+// to be valid fs.FS paths. Its Open method opens the existing file of a name
+// to check whether its content is changed, which returns an error satisfying
+// errors.Is(err, fs.ErrNotExist) if there is none.
+type OutputFS interface {
+	fs.FS
+	// Create returns a file to write the new content of the file of name to.
+	Create(name string) (OutputFile, error)
+}
+
+// OutputFile is a file being written to an OutputFS. The content written to
+// it replaces the file of its name only once it is closed, and is dropped if
+// it is discarded. Discarding a closed file does nothing.
+type OutputFile interface {
+	io.Writer
+	Close() error
+	Discard() error
+}
+
+var (
+	outputFS OutputFS  = osFS{}
+	stdout   io.Writer = os.Stdout
+
+	fileMode fs.FileMode = 0644
+)
+
+// SetOutputFS sets the file system output converters write files to, or
+// restores the local disk if fsys is nil.
+func SetOutputFS(fsys OutputFS) {
+	if fsys == nil {
+		fsys = osFS{}
+	}
+	outputFS = fsys
+}
+
+// SetStdout sets the writer output converters writing to the standard output
+// write to instead, or restores the standard output if w is nil.
+func SetStdout(w io.Writer) {
+	if w == nil {
+		w = os.Stdout
+	}
+	stdout = w
+}
+
+// Stdout returns the writer output converters writing to the standard output
+// should write to.
+func Stdout() io.Writer {
+	return stdout
+}
+
+// ParseFileMode parses the permission bits of files in octal, e.g. "0644"
+// or "640", which must allow the owner to read and write the files, as the
+// files are replaced instead of written in place.
+func ParseFileMode(s string) (fs.FileMode, error) {
+	mode, err := strconv.ParseUint(strings.TrimSpace(s), 8, 32)
+	if err != nil || fs.FileMode(mode)&^fs.ModePerm != 0 {
+		return 0, fmt.Errorf("invalid file mode %q, must be permission bits in octal like \"0644\"", s)
+	}
+	if fs.FileMode(mode)&0600 != 0600 {
+		return 0, fmt.Errorf("invalid file mode %q, must allow the owner to read and write", s)
+	}
+	return fs.FileMode(mode), nil
+}
+
+// SetFileMode sets the permission bits of the files written by output
+// converters, and of the directories created for them with the execute bit
+// set wherever the read bit is. Only the read-only attribute is set from it
+// on Windows, which is never set as the owner must be able to write.
+func SetFileMode(mode fs.FileMode) {
+	fileMode = mode & fs.ModePerm
+}
+
+// FileMode returns the permission bits of the files written by output
+// converters, which is 0644 by default.
+func FileMode() fs.FileMode {
+	return fileMode
+}
+
+func dirMode() fs.FileMode {
+	return fileMode | (fileMode&0444)>>2
+}
+
+// osFS is the OutputFS of the local disk.
+type osFS struct{}
+
+// processStart is when the process started, before which the temporary
+// files of outputs are left by interrupted runs.
+var processStart = time.Now()
+
+func (osFS) Open(name string) (fs.File, error) {
+	return os.Open(osPath(name))
+}
+
+// Create writes the content to a temporary file in the directory of name,
+// creating the directory if necessary, which is synced to disk and renamed
+// to name once closed, so that name is never seen truncated even if the run
+// crashes. Temporary files of name left by interrupted runs are removed.
+func (osFS) Create(name string) (OutputFile, error) {
+	name = osPath(filepath.Clean(name))
+	dir := filepath.Dir(name)
+	if err := os.MkdirAll(dir, dirMode()); err != nil {
+		return nil, err
+	}
+	removeStaleTemp(name)
+	tmp, err := os.CreateTemp(dir, tempPattern(name))
+	if err != nil {
+		return nil, err
+	}
+	return &osFile{name: name, tmp: tmp, buf: bufio.NewWriter(tmp)}, nil
+}
+
+type osFile struct {
+	name     string
+	tmp      *os.File
+	buf      *bufio.Writer
+	done     bool
+	finished bool
+	err      error
+}
+
+func (f *osFile) Write(p []byte) (int, error) {
+	return f.buf.Write(p)
+}
+
+func (f *osFile) Close() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+	defer os.Remove(f.tmp.Name())
+
+	if err := f.finish(); err != nil {
+		return err
+	}
+	return os.Rename(f.tmp.Name(), f.name)
+}
+
+// finish syncs the content to the temporary file and closes it, which is
+// then renamed to name by Close, so that a staged file does not keep its
+// descriptor open until it is committed.
+func (f *osFile) finish() error {
+	if f.finished {
+		return f.err
+	}
+	f.finished = true
+
+	if f.err = f.buf.Flush(); f.err != nil {
+		f.tmp.Close()
+		return f.err
+	}
+	if f.err = f.tmp.Sync(); f.err != nil {
+		f.tmp.Close()
+		return f.err
+	}
+	if f.err = f.tmp.Close(); f.err != nil {
+		return f.err
+	}
+	f.err = os.Chmod(f.tmp.Name(), fileMode)
+	return f.err
+}
+
+func (f *osFile) Discard() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+	if !f.finished {
+		f.tmp.Close()
+	}
+	return os.Remove(f.tmp.Name())
+}
+
+// tempPattern is the pattern of the names of the temporary files of name.
+func tempPattern(name string) string {
+	return "." + filepath.Base(name) + ".*"
+}
+
+// removeStaleTemp removes the temporary files of name last modified before
+// the process started, which are left by runs killed or crashed while
+// writing name.
+func removeStaleTemp(name string) {
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(name), tempPattern(name)))
+	for _, match := range matches {
+		if info, err := os.Lstat(match); err == nil && info.Mode().IsRegular() && info.ModTime().Before(processStart) {
+			if err := os.Remove(match); err == nil {
+				slog.Debug("removed stale temporary file", "path", match)
+			}
+		}
+	}
+}
+
+// MemFS is an OutputFS keeping files in memory, e.g. for builds whose outputs
+// are served or uploaded directly. A name is cleaned and converted to a valid
+// fs.FS path, e.g. "./output/geoip.dat" and "/output/geoip.dat" are both
+// "output/geoip.dat", so that the files can be walked with fs.WalkDir.
+type MemFS struct {
+	mu    sync.Mutex
+	files fstest.MapFS
+}
+
+// NewMemFS returns an empty MemFS.
+func NewMemFS() *MemFS {
+	return &MemFS{files: make(fstest.MapFS)}
+}
+
+func memFSPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+}
+
+func (m *MemFS) Open(name string) (fs.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.files.Open(memFSPath(name))
+}
+
+func (m *MemFS) Create(name string) (OutputFile, error) {
+	name = memFSPath(name)
+	if name == "" {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrInvalid}
+	}
+	return &memFile{fs: m, name: name}, nil
+}
+
+// ReadFile returns the content of the file of name.
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.files.ReadFile(memFSPath(name))
+}
+
+// Names returns the names of all files, sorted.
+func (m *MemFS) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return sortedKeys(m.files)
+}
+
+type memFile struct {
+	fs   *MemFS
+	name string
+	buf  bytes.Buffer
+	done bool
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	return f.buf.Write(p)
+}
+
+func (f *memFile) Close() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	// A new file replaces the old one, as opened files still read the old data
+	f.fs.files[f.name] = &fstest.MapFile{Data: f.buf.Bytes(), Mode: fileMode, ModTime: time.Now()}
+	return nil
+}
+
+func (f *memFile) Discard() error {
+	f.done = true
+	f.buf.Reset()
+	return nil
+}
@@ -0,0 +1,298 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// SetConcurrency sets the max number of input converters parsing their
+// sources at the same time in the next runs. No input converter runs
+// concurrently if n is less than 2.
+func (i *Instance) SetConcurrency(n int) {
+	i.concurrency = n
+}
+
+// containerOp is a change made by an input converter to a recordingContainer.
+type containerOp struct {
+	entry  *Entry
+	remove bool
+	rCase  CaseRemove
+	opts   []IgnoreIPOption
+}
+
+// recordingContainer records the entries added or removed by an input
+// converter running in a worker goroutine, to be applied to the shared
+// container later in config order. An input converter reading the
+// container is marked stateful, since its result depends on the inputs
+// before it, and must be run again with the shared container.
+type recordingContainer struct {
+	ops      []containerOp
+	stateful bool
+}
+
+func (c *recordingContainer) GetEntry(name string) (*Entry, bool) {
+	c.stateful = true
+	return nil, false
+}
+
+func (c *recordingContainer) Add(entry *Entry, opts ...IgnoreIPOption) error {
+	c.ops = append(c.ops, containerOp{entry: entry, opts: opts})
+	return nil
+}
+
+func (c *recordingContainer) Remove(entry *Entry, rCase CaseRemove, opts ...IgnoreIPOption) error {
+	c.ops = append(c.ops, containerOp{entry: entry, remove: true, rCase: rCase, opts: opts})
+	return nil
+}
+
+func (c *recordingContainer) Loop() <-chan *Entry {
+	c.stateful = true
+	ch := make(chan *Entry)
+	close(ch)
+	return ch
+}
+
+func (c *recordingContainer) Lookup(ipOrCidr string, searchList ...string) ([]string, bool, error) {
+	c.stateful = true
+	return nil, false, nil
+}
+
+// inputResult is the result of an input converter run by a worker goroutine.
+type inputResult struct {
+	done     chan struct{}
+	ops      []containerOp
+	stateful bool
+	// freshErr is the result of the freshness check, which is not repeated
+	// if the input converter is run again.
+	freshErr error
+	err      error
+	duration time.Duration
+	// digest is the digest of the input converter and its sources, or empty
+	// if it cannot be tracked.
+	digest string
+	// lines is the invalid lines of the sources of the last run of the input
+	// converter.
+	lines *lineTracker
+}
+
+// apply applies the changes made by the input converter ic at idx to
+// container, or runs ic again with container if it is stateful.
+func (r *inputResult) apply(ctx context.Context, container Container, idx int, ic InputConverter) (Container, error) {
+	if r.freshErr != nil {
+		return nil, r.freshErr
+	}
+	if r.stateful {
+		r.lines = newLineTracker(idx, ic)
+		return ic.Input(withLineTracker(ctx, r.lines), container)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	for _, op := range r.ops {
+		var err error
+		if op.remove {
+			err = container.Remove(op.entry, op.rCase, op.opts...)
+		} else {
+			err = container.Add(op.entry, op.opts...)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return container, nil
+}
+
+// inputPool runs input converters in a bounded number of worker goroutines.
+type inputPool struct {
+	wg      sync.WaitGroup
+	results []*inputResult
+	// pending runs the input converter at idx when its result is waited for,
+	// if input converters are not run ahead of time.
+	pending func(idx int)
+}
+
+// prefetchInputs starts running all input converters concurrently if
+// concurrency, the parse cache or incremental builds are enabled, or returns nil otherwise.
+// With a memory limit, each input converter is run only when its result is
+// waited for, so that the results of at most one of them are kept in memory.
+// Input converters not started yet once ctx is done fail with its error.
+func (i *Instance) prefetchInputs(ctx context.Context) *inputPool {
+	if i.parseCache == nil && i.incremental == nil && (i.concurrency < 2 || len(i.input) < 2 || i.maxMemory > 0) {
+		return nil
+	}
+
+	pool := &inputPool{results: make([]*inputResult, len(i.input))}
+	for idx := range i.input {
+		pool.results[idx] = &inputResult{done: make(chan struct{})}
+	}
+	if i.maxMemory > 0 {
+		pool.pending = func(idx int) {
+			i.prefetchInput(ctx, idx, i.input[idx], pool.results[idx])
+		}
+		return pool
+	}
+
+	sem := make(chan struct{}, max(i.concurrency, 1))
+	for idx, ic := range i.input {
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			i.prefetchInput(ctx, idx, ic, pool.results[idx])
+		}()
+	}
+	return pool
+}
+
+// prefetchInput runs the input converter ic at idx with a recordingContainer
+// or loads its result from the parse cache, and stores it in result.
+func (i *Instance) prefetchInput(ctx context.Context, idx int, ic InputConverter, result *inputResult) {
+	defer close(result.done)
+	if result.err = ctx.Err(); result.err != nil {
+		return
+	}
+
+	start := time.Now()
+	defer func() { result.duration = time.Since(start) }()
+	if result.freshErr = i.checkFreshness(idx, ic); result.freshErr != nil {
+		return
+	}
+
+	key, cacheable := i.digestInput(ctx, idx, ic)
+	result.digest = key
+	if cacheable {
+		if ops, found := i.parseCache.load(key); found {
+			slog.Info(fmt.Sprintf("♻️ [%s] %s parsed from cache", ic.GetType(), ic.GetAction()), "type", ic.GetType(), "action", ic.GetAction(), "key", key)
+			result.ops = ops
+			return
+		}
+	}
+
+	rec := new(recordingContainer)
+	result.lines = newLineTracker(idx, ic)
+	container, err := ic.Input(withLineTracker(ctx, result.lines), rec)
+	result.ops, result.err = rec.ops, err
+	result.stateful = rec.stateful || (err == nil && container != Container(rec))
+
+	// Results with invalid lines are not cached, so that they are always
+	// reported and checked against the maxInvalidRatio of later runs
+	if cacheable && result.err == nil && !result.stateful && !result.lines.invalid() {
+		if err := i.parseCache.store(key, result.ops); err != nil {
+			slog.Warn(fmt.Sprintf("⚠️ [%s] %s failed to write parse cache", ic.GetType(), ic.GetAction()), "type", ic.GetType(), "action", ic.GetAction(), "error", err)
+		}
+	}
+}
+
+// digestInput returns the digest of the input converter ic at idx, and
+// whether it can be cached by the parse cache. The digest is empty if
+// neither the parse cache nor incremental builds are enabled, or ic
+// cannot be tracked.
+func (i *Instance) digestInput(ctx context.Context, idx int, ic InputConverter) (string, bool) {
+	if i.parseCache == nil && i.incremental == nil {
+		return "", false
+	}
+	var args json.RawMessage
+	if idx < len(i.inputArgs) {
+		args = i.inputArgs[idx]
+	}
+	digest, sourced, err := inputDigest(ctx, ic, args)
+	if err != nil {
+		slog.Debug(fmt.Sprintf("[%s] %s not tracked", ic.GetType(), ic.GetAction()), "type", ic.GetType(), "action", ic.GetAction(), "error", err)
+		return "", false
+	}
+	return digest, sourced && i.parseCache != nil
+}
+
+// result waits for the input converter at idx to finish and returns its
+// result, or nil if it is not run by the pool.
+func (p *inputPool) result(idx int) *inputResult {
+	if p == nil {
+		return nil
+	}
+	result := p.results[idx]
+	if p.pending != nil {
+		p.pending(idx)
+	}
+	<-result.done
+	return result
+}
+
+// wait waits for all worker goroutines to exit, and removes the remote
+// files downloaded to be hashed.
+func (p *inputPool) wait() {
+	if p != nil {
+		p.wg.Wait()
+		removeDownloaded()
+	}
+}
+
+// StdoutWriter is implemented by output converters writing to stdout, which
+// never run at the same time so that their outputs are not interleaved.
+type StdoutWriter interface {
+	WritesStdout() bool
+}
+
+// SetOutputConcurrency sets the max number of output converters writing at
+// the same time in the next runs. Output converters of the same type, and
+// ones writing to stdout, always run one by one in config order.
+func (i *Instance) SetOutputConcurrency(n int) {
+	i.outputConcurrency = n
+}
+
+// runOutputsConcurrently runs all output converters with container in a
+// bounded number of worker goroutines, and returns their results in config
+// order. Output converters in the same group run one by one, and the ones
+// after a failed one in its group are not run and have nil results.
+func (i *Instance) runOutputsConcurrently(ctx context.Context, container Container, digests []string) []*outputResult {
+	groups := make(map[string][]int)
+	order := make([]string, 0, len(i.output))
+	for idx, oc := range i.output {
+		group := oc.GetType()
+		if writer, ok := oc.(StdoutWriter); ok && writer.WritesStdout() {
+			group = "stdout"
+		}
+		if _, found := groups[group]; !found {
+			order = append(order, group)
+		}
+		groups[group] = append(groups[group], idx)
+	}
+
+	results := make([]*outputResult, len(i.output))
+	sem := make(chan struct{}, i.outputConcurrency)
+	var wg sync.WaitGroup
+	for _, group := range order {
+		wg.Add(1)
+		go func(indexes []int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			for _, idx := range indexes {
+				results[idx] = i.runOutputConverter(ctx, idx, container, digests[idx])
+				if results[idx].err != nil {
+					return
+				}
+			}
+		}(groups[group])
+	}
+	wg.Wait()
+
+	return results
+}
+
+// buildIPSets builds the IP sets of all entries in container, which are
+// otherwise built lazily by the output converters reading them.
+func buildIPSets(container Container) error {
+	var err error
+	for entry := range container.Loop() {
+		if buildErr := entry.buildIPSet(); buildErr != nil && err == nil {
+			err = buildErr
+		}
+	}
+	return err
+}
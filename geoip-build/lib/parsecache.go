@@ -0,0 +1,302 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// parseCacheVersion is changed whenever the format of cache files or the
+// way input converters parse sources is changed, to invalidate old caches.
+const parseCacheVersion = "geoip-parse-cache-v1"
+
+// ParseCache caches the entries parsed by input converters in a directory,
+// keyed by the input converter, its args and the content hash of its
+// sources, so that unchanged sources are not parsed again in later runs.
+//
+// Only input converters describing their args with GetArgs are cached, the
+// sources of which are the local files and directories and remote URLs in
+// their args, including the default ones. Input converters without any
+// source, volatile ones, and ones reading the container, e.g. to remove
+// entries added by the inputs before them, are never cached.
+type ParseCache struct {
+	Dir string
+}
+
+// downloadedFiles are the remote files downloaded to be hashed
+// in the current run, which are read by input converters instead of
+// downloading them again.
+var (
+	downloadedMu    sync.Mutex
+	downloadedFiles = make(map[string]string)
+)
+
+// cachedOp is a containerOp stored in a cache file.
+type cachedOp struct {
+	List     string
+	Remove   bool
+	RCase    CaseRemove
+	Ignore   IPType
+	Prefixes []netip.Prefix
+}
+
+// NewParseCache returns a ParseCache storing cache files in dir.
+func NewParseCache(dir string) (*ParseCache, error) {
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		return nil, fmt.Errorf("parse cache directory must be specified")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &ParseCache{Dir: dir}, nil
+}
+
+// SetParseCache sets the cache of parsed sources used in the next runs,
+// or disables it if cache is nil.
+func (i *Instance) SetParseCache(cache *ParseCache) {
+	i.parseCache = cache
+}
+
+// VolatileInput is implemented by input converters whose result does not
+// only depend on their args and sources, e.g. reading from stdin. They are
+// never cached, and outputs are always regenerated in incremental builds.
+type VolatileInput interface {
+	IsVolatile() bool
+}
+
+// inputDigest returns the digest of the input converter ic with args and the
+// content of its sources, and whether any source is found. The digest is
+// empty if ic is volatile or does not describe its args. Remote sources are
+// downloaded to be hashed, and are read from the downloaded files by ic in
+// the same run.
+func inputDigest(ctx context.Context, ic InputConverter, args json.RawMessage) (string, bool, error) {
+	if volatile, ok := ic.(VolatileInput); ok && volatile.IsVolatile() {
+		return "", false, nil
+	}
+	argumenter, ok := ic.(Argumenter)
+	if !ok {
+		return "", false, nil
+	}
+
+	var fields map[string]any
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &fields); err != nil {
+			return "", false, err
+		}
+	}
+
+	values := make(map[string]bool)
+	for _, arg := range argumenter.GetArgs() {
+		if arg.Type != ArgTypeString {
+			continue
+		}
+		value, _ := fields[arg.Name].(string)
+		if value = strings.TrimSpace(value); value == "" {
+			value = arg.Default
+		}
+		if value != "" {
+			values[value] = true
+		}
+	}
+	for _, url := range findURLs(fields) {
+		values[url] = true
+	}
+
+	sources := make([]string, 0, len(values))
+	for value := range values {
+		sources = append(sources, value)
+	}
+	sort.Strings(sources)
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n%s\n%s\n", parseCacheVersion, ic.GetType(), ic.GetAction(), args)
+	hashed := 0
+	for _, source := range sources {
+		sum, found, err := hashSource(ctx, source)
+		if err != nil {
+			return "", false, err
+		}
+		if found {
+			fmt.Fprintf(hash, "%s %s\n", sum, source)
+			hashed++
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), hashed > 0, nil
+}
+
+// hashSource returns the content hash of the remote URL, local file or
+// local directory of source, or false if source is none of them.
+func hashSource(ctx context.Context, source string) (string, bool, error) {
+	if IsRemoteURI(source) {
+		file, err := downloadOnce(ctx, source)
+		if err != nil {
+			return "", false, err
+		}
+		sum, err := fileSHA256(file)
+		return sum, err == nil, err
+	}
+
+	info, err := os.Stat(source)
+	if err != nil {
+		return "", false, nil
+	}
+	if !info.IsDir() {
+		sum, err := fileSHA256(source)
+		return sum, err == nil, err
+	}
+
+	hash := sha256.New()
+	err = filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(source, path)
+		fmt.Fprintf(hash, "%s %s\n", sum, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return "", false, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), true, nil
+}
+
+// downloadOnce downloads the remote file of url once in a run, and returns
+// the path to the downloaded file, which is the one of the download cache
+// if enabled.
+func downloadOnce(ctx context.Context, url string) (string, error) {
+	if file, found, err := sharedFile(ctx, url); found {
+		return file, err
+	}
+
+	downloadedMu.Lock()
+	file, found := downloadedFiles[url]
+	downloadedMu.Unlock()
+	if found {
+		return file, nil
+	}
+
+	file, err := GetRemoteURLFile(ctx, url)
+	if err != nil {
+		return "", err
+	}
+
+	downloadedMu.Lock()
+	defer downloadedMu.Unlock()
+	if existing, found := downloadedFiles[url]; found {
+		os.Remove(file)
+		return existing, nil
+	}
+	downloadedFiles[url] = file
+	return file, nil
+}
+
+// openDownloaded opens the file of url downloaded in the current run, if any.
+func openDownloaded(url string) (io.ReadCloser, bool) {
+	downloadedMu.Lock()
+	file, found := downloadedFiles[url]
+	downloadedMu.Unlock()
+	if !found {
+		return nil, false
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, false
+	}
+	return f, true
+}
+
+// removeDownloaded removes the files downloaded in the current run.
+func removeDownloaded() {
+	downloadedMu.Lock()
+	defer downloadedMu.Unlock()
+	for url, file := range downloadedFiles {
+		os.Remove(file)
+		delete(downloadedFiles, url)
+	}
+}
+
+func (c *ParseCache) path(key string) string {
+	return filepath.Join(c.Dir, key+".gob")
+}
+
+// load returns the changes to the container cached with key, if any.
+func (c *ParseCache) load(key string) ([]containerOp, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+
+	var cached []cachedOp
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&cached); err != nil {
+		slog.Warn("⚠️ invalid parse cache file, ignored", "path", c.path(key), "error", err)
+		return nil, false
+	}
+
+	ops := make([]containerOp, 0, len(cached))
+	for _, op := range cached {
+		entry := NewEntry(op.List)
+		for _, prefix := range op.Prefixes {
+			if err := entry.AddPrefix(prefix); err != nil {
+				return nil, false
+			}
+		}
+		var opts []IgnoreIPOption
+		switch op.Ignore {
+		case IPv4:
+			opts = append(opts, IgnoreIPv4)
+		case IPv6:
+			opts = append(opts, IgnoreIPv6)
+		}
+		ops = append(ops, containerOp{entry: entry, remove: op.Remove, rCase: op.RCase, opts: opts})
+	}
+	return ops, true
+}
+
+// store caches the changes to the container with key.
+func (c *ParseCache) store(key string, ops []containerOp) error {
+	cached := make([]cachedOp, 0, len(ops))
+	for _, op := range ops {
+		prefixes, err := builderPrefixes(op.entry)
+		if err != nil {
+			return err
+		}
+		var ignore IPType
+		for _, opt := range op.opts {
+			if opt != nil {
+				ignore = opt()
+			}
+		}
+		cached = append(cached, cachedOp{
+			List:     op.entry.GetName(),
+			Remove:   op.remove,
+			RCase:    op.rCase,
+			Ignore:   ignore,
+			Prefixes: prefixes,
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(cached); err != nil {
+		return err
+	}
+	return writeFileAtomic(c.path(key), buf.Bytes())
+}
@@ -0,0 +1,134 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// configKeyPolicy is the key of the lists an output must and must not write.
+const configKeyPolicy = "policy"
+
+// outputPolicy is the gate the files written by an output are checked
+// against before they are published, so that a build writing a stripped or
+// bloated artifact fails instead of publishing it.
+type outputPolicy struct {
+	// require is the minimum number of CIDRs of each list that must be
+	// written, 0 if the list only has to exist.
+	require map[string]int
+	// deny matches the lists that must not be written.
+	deny *ListFilter
+	// raw is the config of the policy, hashed into the digest of the output
+	// so that changing it builds the output again in incremental builds.
+	raw json.RawMessage
+}
+
+// newOutputPolicy parses the policy of an output.
+func newOutputPolicy(data json.RawMessage) (*outputPolicy, error) {
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return nil, nil
+	}
+	var temp struct {
+		Require map[string]int `json:"require"`
+		Deny    []string       `json:"deny"`
+	}
+	if err := json.Unmarshal(data, &temp); err != nil {
+		return nil, fmt.Errorf("%s: must be an object of require and deny", configKeyPolicy)
+	}
+
+	p := &outputPolicy{require: make(map[string]int, len(temp.Require)), raw: data}
+	for name, min := range temp.Require {
+		if min < 0 {
+			return nil, fmt.Errorf("%s.require.%s: must be a non-negative integer", configKeyPolicy, name)
+		}
+		p.require[strings.ToUpper(strings.TrimSpace(name))] = min
+	}
+	var err error
+	if p.deny, err = NewListFilter(temp.Deny); err != nil {
+		return nil, fmt.Errorf("%s.deny: %v", configKeyPolicy, err)
+	}
+	for name := range p.require {
+		if p.deny.Match(name) {
+			return nil, fmt.Errorf("%s: list %s is both required and denied", configKeyPolicy, name)
+		}
+	}
+	return p, nil
+}
+
+// check returns an error if the artifacts written by the output converter
+// oc with container miss a required list, have fewer CIDRs of it than its
+// minimum, or have a denied list. It is run before the artifacts are
+// committed, see stageOutput.
+func (p *outputPolicy) check(oc OutputConverter, container Container, artifacts []*Artifact) error {
+	written := make(map[string][]string)
+	for _, artifact := range artifacts {
+		for _, list := range artifact.Lists {
+			list = strings.ToUpper(list)
+			written[list] = append(written[list], artifact.Path)
+		}
+	}
+
+	for _, list := range sortedKeys(written) {
+		if p.deny.Match(list) {
+			return fmt.Errorf("❌ [type %s | action %s] list %s denied by %s is written to %s", oc.GetType(), oc.GetAction(), list, configKeyPolicy, strings.Join(written[list], ", "))
+		}
+	}
+
+	// Only the CIDRs of the IP type the output converter writes are counted
+	ignore := ignoreUnwritten(oc)
+
+	for _, list := range sortedKeys(p.require) {
+		if _, found := written[list]; !found {
+			return fmt.Errorf("❌ [type %s | action %s] list %s required by %s is not written", oc.GetType(), oc.GetAction(), list, configKeyPolicy)
+		}
+		min := p.require[list]
+		if min == 0 {
+			continue
+		}
+		var n int
+		if entry, found := container.GetEntry(list); found {
+			if prefixes, err := entry.MarshalPrefix(ignore); err == nil {
+				n = len(prefixes)
+			}
+		}
+		if n < min {
+			return fmt.Errorf("❌ [type %s | action %s] list %s has %d CIDRs, fewer than the minimum %d required by %s", oc.GetType(), oc.GetAction(), list, n, min, configKeyPolicy)
+		}
+	}
+
+	return nil
+}
+
+// writeOutput runs the output converter at idx with container, of which
+// written artifacts are recorded before. With a policy, the files it writes
+// are staged, and replace the files of their names only once they comply
+// with the policy, being dropped along with their artifacts otherwise.
+func (i *Instance) writeOutput(ctx context.Context, idx int, container Container, written int) error {
+	oc := i.output[idx]
+	if idx >= len(i.outputPolicies) || i.outputPolicies[idx] == nil {
+		return oc.Output(ctx, container)
+	}
+
+	staged := stageOutput(oc.GetType())
+	defer staged.unstage(oc.GetType())
+
+	err := oc.Output(ctx, container)
+	if err == nil {
+		err = i.outputPolicies[idx].check(oc, container, artifactsSince(written, oc.GetType()))
+	}
+	if err == nil {
+		err = staged.commit()
+	}
+	if err != nil {
+		staged.discard()
+		if dropped := len(artifactsSince(written, oc.GetType())); dropped > 0 {
+			removeArtifactsSince(written, oc.GetType())
+			slog.Warn(fmt.Sprintf("🗑️ [%s] %s discarded %d written files", oc.GetType(), oc.GetAction(), dropped), "type", oc.GetType(), "action", oc.GetAction(), "files", dropped)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package lib
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// PresetPrefix is the prefix of the items of wantedList and excludedList
+// naming a preset, e.g. "preset:cn-full".
+const PresetPrefix = "preset:"
+
+// Preset is a named group of lists curated for a common use, which an item
+// "preset:<name>" of wantedList or excludedList expands to.
+type Preset struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Lists       []string `json:"lists"`
+}
+
+var presets = map[string]*Preset{
+	"cn-full": {
+		Name:        "cn-full",
+		Description: "Mainland China, Hong Kong and Macao",
+		Lists:       []string{"cn", "hk", "mo"},
+	},
+	"private": {
+		Name:        "private",
+		Description: "Private, reserved and special-purpose networks",
+		Lists:       []string{"private"},
+	},
+	"cdn": {
+		Name:        "cdn",
+		Description: "Content delivery networks",
+		Lists:       []string{"cloudflare", "cloudfront", "fastly"},
+	},
+	"streaming": {
+		Name:        "streaming",
+		Description: "Video streaming services",
+		Lists:       []string{"netflix"},
+	},
+	"social": {
+		Name:        "social",
+		Description: "Social networks and messengers",
+		Lists:       []string{"facebook", "telegram", "twitter"},
+	},
+	"sanctioned": {
+		Name:        "sanctioned",
+		Description: "Countries under comprehensive US sanctions",
+		Lists:       []string{"cu", "ir", "kp", "sy"},
+	},
+	"eu": {
+		Name:        "eu",
+		Description: "Member states of the European Union",
+		Lists: []string{
+			"at", "be", "bg", "cy", "cz", "de", "dk", "ee", "es",
+			"fi", "fr", "gr", "hr", "hu", "ie", "it", "lt", "lu",
+			"lv", "mt", "nl", "pl", "pt", "ro", "se", "si", "sk",
+		},
+	},
+}
+
+// GetPreset returns the preset of name, case-insensitively.
+func GetPreset(name string) (*Preset, bool) {
+	preset, found := presets[strings.ToLower(strings.TrimSpace(name))]
+	return preset, found
+}
+
+// Presets returns all presets, sorted by name.
+func Presets() []*Preset {
+	list := make([]*Preset, 0, len(presets))
+	for _, name := range sortedKeys(presets) {
+		list = append(list, presets[name])
+	}
+	return list
+}
+
+// expandPresets returns the items with each item naming a preset replaced
+// by the lists of the preset.
+func expandPresets(items []string) ([]string, error) {
+	if !slices.ContainsFunc(items, isPresetItem) {
+		return items, nil
+	}
+
+	expanded := make([]string, 0, len(items))
+	for _, item := range items {
+		if !isPresetItem(item) {
+			expanded = append(expanded, item)
+			continue
+		}
+		name := strings.TrimSpace(item)[len(PresetPrefix):]
+		preset, found := GetPreset(name)
+		if !found {
+			return nil, fmt.Errorf("unknown preset %q, run the presets command for all available ones", name)
+		}
+		expanded = append(expanded, preset.Lists...)
+	}
+	return expanded, nil
+}
+
+func isPresetItem(item string) bool {
+	item = strings.TrimSpace(item)
+	return len(item) > len(PresetPrefix) && strings.EqualFold(item[:len(PresetPrefix)], PresetPrefix)
+}
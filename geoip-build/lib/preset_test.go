@@ -0,0 +1,128 @@
+package lib
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExpandPresets(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []string
+		want  []string
+		err   string
+	}{
+		{name: "no preset", items: []string{"cn", "us"}, want: []string{"cn", "us"}},
+		{name: "preset", items: []string{"preset:cn-full"}, want: []string{"cn", "hk", "mo"}},
+		{name: "case-insensitive", items: []string{" PRESET:CN-Full "}, want: []string{"cn", "hk", "mo"}},
+		{name: "with lists", items: []string{"us", "preset:sanctioned", "category-*"}, want: []string{"us", "cu", "ir", "kp", "sy", "category-*"}},
+		{name: "several presets", items: []string{"preset:private", "preset:streaming"}, want: []string{"private", "netflix"}},
+		{name: "prefix only", items: []string{"preset:"}, want: []string{"preset:"}},
+		{name: "unknown preset", items: []string{"cn", "preset:nowhere"}, err: `unknown preset "nowhere"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandPresets(tt.items)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expandPresets(%q) error = %v, want %s", tt.items, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expandPresets(%q) error = %v", tt.items, err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expandPresets(%q) = %q, want %q", tt.items, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListFilterPresets(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    []string
+		exclude []string
+		wanted  []string
+		ignored []string
+	}{
+		{
+			name:    "preset",
+			want:    []string{"preset:cn-full"},
+			wanted:  []string{"cn", "HK", "mo"},
+			ignored: []string{"tw", "us"},
+		},
+		{
+			name:    "preset with lists",
+			want:    []string{"preset:cn-full", "tw"},
+			wanted:  []string{"cn", "hk", "mo", "tw"},
+			ignored: []string{"us"},
+		},
+		{
+			name:    "lists of preset excluded",
+			want:    []string{"preset:cn-full"},
+			exclude: []string{"hk", "mo"},
+			wanted:  []string{"cn"},
+			ignored: []string{"hk", "mo", "us"},
+		},
+		{
+			name:    "preset excluded",
+			exclude: []string{"preset:eu"},
+			wanted:  []string{"cn", "us"},
+			ignored: []string{"de", "fr"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := NewListFilter(tt.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			exclude, err := NewListFilter(tt.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range tt.wanted {
+				if !want.Wants(name) || exclude.Match(name) {
+					t.Errorf("list %s is ignored, want it wanted", name)
+				}
+			}
+			for _, name := range tt.ignored {
+				if want.Wants(name) && !exclude.Match(name) {
+					t.Errorf("list %s is wanted, want it ignored", name)
+				}
+			}
+		})
+	}
+
+	if _, err := NewListFilter([]string{"preset:nowhere"}); err == nil {
+		t.Error("NewListFilter with an unknown preset error = nil, want an error")
+	}
+}
+
+func TestPresets(t *testing.T) {
+	list := Presets()
+	if len(list) != len(presets) {
+		t.Fatalf("Presets() returns %d presets, want %d", len(list), len(presets))
+	}
+	if !slices.IsSortedFunc(list, func(a, b *Preset) int { return strings.Compare(a.Name, b.Name) }) {
+		t.Error("Presets() is not sorted by name")
+	}
+	for _, preset := range list {
+		if got, found := GetPreset(strings.ToUpper(preset.Name)); !found || got != preset {
+			t.Errorf("GetPreset(%q) = %v, %v, want the preset", strings.ToUpper(preset.Name), got, found)
+		}
+		if preset.Description == "" || len(preset.Lists) == 0 {
+			t.Errorf("preset %s has no description or lists", preset.Name)
+		}
+		for _, list := range preset.Lists {
+			if list != strings.ToLower(list) || isPresetItem(list) {
+				t.Errorf("list %q of preset %s is not a lowercase list name", list, preset.Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const progressInterval = 200 * time.Millisecond
+
+var (
+	progressMu      sync.Mutex
+	progressEnabled bool
+	progressLast    time.Time
+	progressShown   bool
+)
+
+// SetProgress enables or disables the progress reporting of downloads and stages
+// on stderr. It should be disabled when stderr is not a terminal, e.g. in CI logs.
+func SetProgress(enabled bool) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	progressEnabled = enabled
+}
+
+// IsTerminal reports whether the file is a terminal.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// showProgress replaces the current progress line with the message.
+// Unless force is true, updates more frequent than progressInterval are dropped.
+func showProgress(force bool, format string, v ...any) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+
+	if !progressEnabled || (!force && time.Since(progressLast) < progressInterval) {
+		return
+	}
+	progressLast = time.Now()
+	progressShown = true
+	fmt.Fprintf(os.Stderr, "\r\033[K"+format, v...)
+}
+
+// clearProgress clears the current progress line, so that logs can be written.
+func clearProgress() {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+
+	if !progressShown {
+		return
+	}
+	progressShown = false
+	fmt.Fprint(os.Stderr, "\r\033[K")
+}
+
+// progressClearingWriter clears the current progress line before each write.
+type progressClearingWriter struct {
+	w io.Writer
+}
+
+func (p *progressClearingWriter) Write(b []byte) (int, error) {
+	clearProgress()
+	return p.w.Write(b)
+}
+
+func showDownloadProgress(url string, n, total int64) {
+	if total > 0 {
+		showProgress(false, "⬇️ %s %s / %s (%d%%)", url, formatBytes(n), formatBytes(total), n*100/total)
+		return
+	}
+	showProgress(false, "⬇️ %s %s", url, formatBytes(n))
+}
+
+func showStageProgress(stage string, idx, total int, c interface {
+	Typer
+	Actioner
+}) {
+	showProgress(true, "⏳ [%d/%d] %s: [%s] %s", idx, total, stage, c.GetType(), c.GetAction())
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,241 @@
+package lib
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ProvenanceRecord is a change of a list made by an input converter.
+type ProvenanceRecord struct {
+	List string `json:"list"`
+	// Prefix is the added or removed CIDR, or invalid if the whole list is removed.
+	Prefix netip.Prefix `json:"prefix"`
+	Action Action       `json:"action"`
+	// Input is the index of the input converter in config.
+	Input  int    `json:"input"`
+	Type   string `json:"type"`
+	Source string `json:"source,omitempty"`
+}
+
+// Provenance records which input converter added or removed each CIDR of each list.
+type Provenance struct {
+	mu      sync.Mutex
+	records []*ProvenanceRecord
+}
+
+// ProvenanceUser is implemented by output converters that need the provenance
+// of entries, the tracking of which is enabled only if any output needs it.
+type ProvenanceUser interface {
+	UseProvenance() bool
+}
+
+// GetProvenance returns the provenance tracked in container, if any.
+func GetProvenance(container Container) (*Provenance, bool) {
+	if c, ok := container.(*provenanceContainer); ok {
+		return c.provenance, true
+	}
+	return nil, false
+}
+
+// Records returns all records in the order of changes.
+func (p *Provenance) Records() []*ProvenanceRecord {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.records
+}
+
+// Why returns the records of changes in the order they were made that
+// affect the IP or CIDR, i.e. the added or removed CIDRs overlapping it
+// and the removals of the lists it was added to.
+func (p *Provenance) Why(ipOrCIDR string) ([]*ProvenanceRecord, error) {
+	target, err := parsePrefixOrAddr(ipOrCIDR)
+	if err != nil {
+		return nil, err
+	}
+
+	added := make(map[string]bool)
+	result := make([]*ProvenanceRecord, 0, 8)
+	for _, record := range p.Records() {
+		switch {
+		case !record.Prefix.IsValid():
+			if added[record.List] {
+				result = append(result, record)
+			}
+		case record.Prefix.Overlaps(target):
+			result = append(result, record)
+			if record.Action == ActionAdd {
+				added[record.List] = true
+			}
+		}
+	}
+	return result, nil
+}
+
+// WriteCSV writes the records of the wanted lists in CSV format with a header.
+func (p *Provenance) WriteCSV(w io.Writer, want, exclude *ListFilter) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"list", "prefix", "action", "input", "type", "source"})
+	for _, record := range p.Records() {
+		if !want.Wants(record.List) || exclude.Match(record.List) {
+			continue
+		}
+		prefix := ""
+		if record.Prefix.IsValid() {
+			prefix = record.Prefix.String()
+		}
+		cw.Write([]string{record.List, prefix, string(record.Action), strconv.Itoa(record.Input), record.Type, record.Source})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes the records of the wanted lists as a JSON array.
+func (p *Provenance) WriteJSON(w io.Writer, want, exclude *ListFilter) error {
+	records := make([]*ProvenanceRecord, 0, len(p.Records()))
+	for _, record := range p.Records() {
+		if want.Wants(record.List) && !exclude.Match(record.List) {
+			records = append(records, record)
+		}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(records)
+}
+
+func (p *Provenance) record(records ...*ProvenanceRecord) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.records = append(p.records, records...)
+}
+
+// provenanceContainer records the changes made by the input converter
+// currently running to the container it wraps.
+type provenanceContainer struct {
+	Container
+	provenance *Provenance
+
+	input  int
+	iType  string
+	source string
+}
+
+func (c *provenanceContainer) Add(entry *Entry, opts ...IgnoreIPOption) error {
+	prefixes, err := builderPrefixes(entry, opts...)
+	if err != nil {
+		return err
+	}
+	if err := c.Container.Add(entry, opts...); err != nil {
+		return err
+	}
+	c.recordPrefixes(entry.GetName(), ActionAdd, prefixes)
+	return nil
+}
+
+func (c *provenanceContainer) Remove(entry *Entry, rCase CaseRemove, opts ...IgnoreIPOption) error {
+	var prefixes []netip.Prefix
+	if rCase == CaseRemovePrefix {
+		var err error
+		if prefixes, err = builderPrefixes(entry, opts...); err != nil {
+			return err
+		}
+	}
+	if err := c.Container.Remove(entry, rCase, opts...); err != nil {
+		return err
+	}
+
+	if rCase == CaseRemoveEntry {
+		c.provenance.record(&ProvenanceRecord{
+			List:   entry.GetName(),
+			Action: ActionRemove,
+			Input:  c.input,
+			Type:   c.iType,
+			Source: c.source,
+		})
+		return nil
+	}
+	c.recordPrefixes(entry.GetName(), ActionRemove, prefixes)
+	return nil
+}
+
+func (c *provenanceContainer) recordPrefixes(name string, action Action, prefixes []netip.Prefix) {
+	records := make([]*ProvenanceRecord, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		records = append(records, &ProvenanceRecord{
+			List:   name,
+			Prefix: prefix,
+			Action: action,
+			Input:  c.input,
+			Type:   c.iType,
+			Source: c.source,
+		})
+	}
+	c.provenance.record(records...)
+}
+
+// builderPrefixes returns the CIDRs in the builders of entry, without
+// building the IP sets of entry which would stop it from being changed.
+func builderPrefixes(entry *Entry, opts ...IgnoreIPOption) ([]netip.Prefix, error) {
+	var ignoreIPType IPType
+	for _, opt := range opts {
+		if opt != nil {
+			ignoreIPType = opt()
+		}
+	}
+
+	prefixes := make([]netip.Prefix, 0, 16)
+	for _, b := range []struct {
+		ipType  IPType
+		builder *prefixTrie
+	}{
+		{IPv4, entry.ipv4Builder},
+		{IPv6, entry.ipv6Builder},
+	} {
+		if b.builder == nil || b.ipType == ignoreIPType {
+			continue
+		}
+		set, err := b.builder.IPSet()
+		if err != nil {
+			return nil, err
+		}
+		prefixes = appendSetPrefixes(prefixes, set)
+	}
+	return prefixes, nil
+}
+
+func parsePrefixOrAddr(ipOrCIDR string) (netip.Prefix, error) {
+	prefix, _, err := ParsePrefix(ipOrCIDR)
+	return prefix, err
+}
+
+// describeSource returns the local path or remote URL of the input file
+// or directory in the args of an input converter.
+func describeSource(args json.RawMessage) string {
+	var fields map[string]any
+	if err := json.Unmarshal(args, &fields); err != nil {
+		return ""
+	}
+	for _, key := range []string{ArgURI.Name, "inputDir"} {
+		if value, ok := fields[key].(string); ok && strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return strings.Join(findURLs(fields), ", ")
+}
+
+func (r *ProvenanceRecord) String() string {
+	prefix := "(whole list)"
+	if r.Prefix.IsValid() {
+		prefix = r.Prefix.String()
+	}
+	desc := fmt.Sprintf("input[%d] %s", r.Input, r.Type)
+	if r.Source != "" {
+		desc += " " + r.Source
+	}
+	return fmt.Sprintf("%s %s %s by %s", r.Action, prefix, r.List, desc)
+}
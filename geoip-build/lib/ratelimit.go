@@ -0,0 +1,160 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HostLimit limits the requests to the remote sources and config files at
+// Host, so that fetching many files from an API does not get banned by it.
+type HostLimit struct {
+	Host string
+	// Concurrency is the maximum number of requests in flight, including
+	// the downloads of the responses. Zero means no limit.
+	Concurrency int
+	// Interval is the minimum time between the starts of two requests.
+	// Zero means no limit.
+	Interval time.Duration
+}
+
+var hostLimiters map[string]*hostLimiter
+
+// ParseHostLimit parses a limit in the form of "host=concurrency[,rate]",
+// in which rate is the number of requests per second, minute or hour like
+// "1/s" or "30/m", e.g. "api.ripe.net=2,1/s".
+func ParseHostLimit(s string) (*HostLimit, error) {
+	host, value, found := strings.Cut(s, "=")
+	limit := &HostLimit{Host: strings.ToLower(strings.TrimSpace(host))}
+	if !found || limit.Host == "" {
+		return nil, fmt.Errorf("invalid host limit %q, must be in the form of host=concurrency[,rate]", s)
+	}
+
+	concurrency, rate, _ := strings.Cut(value, ",")
+	var err error
+	if limit.Concurrency, err = strconv.Atoi(strings.TrimSpace(concurrency)); err != nil || limit.Concurrency < 0 {
+		return nil, fmt.Errorf("invalid concurrency of host limit %q, must be a non-negative integer", s)
+	}
+
+	if rate = strings.TrimSpace(rate); rate != "" {
+		count, unit, _ := strings.Cut(rate, "/")
+		n, err := strconv.Atoi(strings.TrimSpace(count))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid rate of host limit %q, must be like \"1/s\" or \"30/m\"", s)
+		}
+		var period time.Duration
+		switch strings.TrimSpace(unit) {
+		case "s":
+			period = time.Second
+		case "m":
+			period = time.Minute
+		case "h":
+			period = time.Hour
+		default:
+			return nil, fmt.Errorf("invalid rate of host limit %q, must be like \"1/s\" or \"30/m\"", s)
+		}
+		limit.Interval = period / time.Duration(n)
+	}
+
+	return limit, nil
+}
+
+// SetHostLimits sets the limits of the requests to remote sources and
+// config files per host.
+func SetHostLimits(limits []*HostLimit) {
+	hostLimiters = make(map[string]*hostLimiter, len(limits))
+	for _, limit := range limits {
+		l := &hostLimiter{interval: limit.Interval}
+		if limit.Concurrency > 0 {
+			l.sem = make(chan struct{}, limit.Concurrency)
+		}
+		hostLimiters[limit.Host] = l
+	}
+}
+
+type hostLimiter struct {
+	sem      chan struct{}
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// acquire waits until a request is allowed or ctx is done.
+func (l *hostLimiter) acquire(ctx context.Context) error {
+	if l.sem != nil {
+		select {
+		case l.sem <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if l.interval > 0 {
+		l.mu.Lock()
+		now := time.Now()
+		start := l.next
+		if start.Before(now) {
+			start = now
+		}
+		l.next = start.Add(l.interval)
+		l.mu.Unlock()
+
+		if wait := start.Sub(now); wait > 0 {
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				l.release()
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+func (l *hostLimiter) release() {
+	if l.sem != nil {
+		<-l.sem
+	}
+}
+
+// limitTransport limits the requests by hostLimiters.
+type limitTransport struct {
+	base http.RoundTripper
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	limiter := hostLimiters[strings.ToLower(req.URL.Hostname())]
+	if limiter == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	if err := limiter.acquire(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		limiter.release()
+		return nil, err
+	}
+	// The request is in flight until its response is read
+	resp.Body = &limitedBody{ReadCloser: resp.Body, release: sync.OnceFunc(limiter.release)}
+	return resp, nil
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *limitedBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
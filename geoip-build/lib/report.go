@@ -0,0 +1,178 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Exit codes of the errors of a run.
+const (
+	ExitCodeGeneral    = 1
+	ExitCodeConfig     = 2
+	ExitCodeDownload   = 3
+	ExitCodeConversion = 4
+	ExitCodeOutput     = 5
+	ExitCodePublish    = 6
+	// ExitCodeUnchanged is the exit code of a successful build producing the
+	// same artifacts as the last build of the state file, so that automation
+	// skips publishing them.
+	ExitCodeUnchanged = 7
+	// ExitCodeCanceled is the conventional exit code of processes terminated by SIGINT.
+	ExitCodeCanceled = 130
+)
+
+// ErrorKind classifies the error of a run.
+type ErrorKind string
+
+const (
+	ErrorKindGeneral    ErrorKind = "general"
+	ErrorKindConfig     ErrorKind = "config"
+	ErrorKindDownload   ErrorKind = "download"
+	ErrorKindConversion ErrorKind = "conversion"
+	ErrorKindOutput     ErrorKind = "output"
+	ErrorKindPublish    ErrorKind = "publish"
+)
+
+// DownloadError is the error of getting a remote file.
+type DownloadError struct {
+	URL string
+	Err error
+}
+
+func (e *DownloadError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DownloadError) Unwrap() error {
+	return e.Err
+}
+
+// RunError is the error of a stage of a run, reporting where it failed.
+type RunError struct {
+	Kind   ErrorKind
+	Type   string
+	Action Action
+	Err    error
+}
+
+func (e *RunError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RunError) Unwrap() error {
+	return e.Err
+}
+
+func newConfigError(err error) error {
+	var runErr *RunError
+	if err == nil || errors.As(err, &runErr) {
+		return err
+	}
+	return &RunError{Kind: ErrorKindConfig, Err: err}
+}
+
+// NewPublishError marks err as the error of publishing artifacts to target.
+func NewPublishError(target string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &RunError{Kind: ErrorKindPublish, Type: target, Err: err}
+}
+
+func newConverterError(kind ErrorKind, c interface {
+	Typer
+	Actioner
+}, err error) error {
+	var downloadErr *DownloadError
+	if errors.As(err, &downloadErr) {
+		kind = ErrorKindDownload
+	}
+	return &RunError{Kind: kind, Type: c.GetType(), Action: c.GetAction(), Err: err}
+}
+
+// newCanceledError marks the converter c as stopped by the error err of a
+// done context.
+func newCanceledError(kind ErrorKind, c interface {
+	Typer
+	Actioner
+}, err error) error {
+	return newConverterError(kind, c, fmt.Errorf("❌ [type %s | action %s] canceled: %w", c.GetType(), c.GetAction(), err))
+}
+
+// ErrorReport describes what failed where in a run.
+type ErrorReport struct {
+	Kind     ErrorKind        `json:"kind"`
+	ExitCode int              `json:"exitCode"`
+	Type     string           `json:"type,omitempty"`
+	Action   Action           `json:"action,omitempty"`
+	URL      string           `json:"url,omitempty"`
+	Error    string           `json:"error"`
+	Failures []*SourceFailure `json:"failures,omitempty"`
+}
+
+// NewErrorReport returns the report of err, and the input converters
+// that failed and were skipped before it.
+func NewErrorReport(err error, failures []*SourceFailure) *ErrorReport {
+	report := &ErrorReport{
+		Kind:     ErrorKindGeneral,
+		ExitCode: ExitCode(err),
+		Error:    err.Error(),
+		Failures: failures,
+	}
+
+	var runErr *RunError
+	if errors.As(err, &runErr) {
+		report.Kind = runErr.Kind
+		report.Type = runErr.Type
+		report.Action = runErr.Action
+	}
+
+	var downloadErr *DownloadError
+	if errors.As(err, &downloadErr) {
+		report.Kind = ErrorKindDownload
+		report.URL = downloadErr.URL
+	}
+
+	return report
+}
+
+// ExitCode returns the exit code for err.
+func ExitCode(err error) int {
+	if errors.Is(err, context.Canceled) {
+		return ExitCodeCanceled
+	}
+
+	var downloadErr *DownloadError
+	if errors.As(err, &downloadErr) {
+		return ExitCodeDownload
+	}
+
+	var runErr *RunError
+	if !errors.As(err, &runErr) {
+		return ExitCodeGeneral
+	}
+
+	switch runErr.Kind {
+	case ErrorKindConfig:
+		return ExitCodeConfig
+	case ErrorKindDownload:
+		return ExitCodeDownload
+	case ErrorKindConversion:
+		return ExitCodeConversion
+	case ErrorKindOutput:
+		return ExitCodeOutput
+	case ErrorKindPublish:
+		return ExitCodePublish
+	default:
+		return ExitCodeGeneral
+	}
+}
+
+// WrapDownloadError marks err as the error of getting the remote file of url.
+func WrapDownloadError(url string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &DownloadError{URL: url, Err: err}
+}
@@ -0,0 +1,263 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// metaSHA256 is the metadata header of uploaded objects holding the SHA256
+// checksum of their content, used to skip uploading unchanged files.
+const metaSHA256 = "x-amz-meta-sha256"
+
+// S3Config is the configuration of an S3-compatible bucket, e.g. AWS S3,
+// Cloudflare R2, or Google Cloud Storage in interoperability mode.
+type S3Config struct {
+	// Endpoint is the base URL of the S3 API, e.g. "https://s3.us-east-1.amazonaws.com"
+	// or "https://<account id>.r2.cloudflarestorage.com". Objects are addressed
+	// in path style, i.e. <endpoint>/<bucket>/<key>.
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Prefix is prepended to the key of each object, e.g. "geoip/".
+	Prefix string
+	// CacheControl is the Cache-Control header of uploaded objects if not empty.
+	CacheControl string
+
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// S3Uploader uploads files to an S3-compatible bucket with requests signed
+// by AWS Signature Version 4.
+type S3Uploader struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewS3Uploader returns the uploader of the bucket in config.
+func NewS3Uploader(config S3Config) (*S3Uploader, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("bucket must be specified")
+	}
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, fmt.Errorf("access key ID and secret access key must be specified")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+
+	endpoint, err := url.Parse(strings.TrimSuffix(config.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return nil, fmt.Errorf("invalid endpoint %q", config.Endpoint)
+	}
+
+	return &S3Uploader{
+		config:   config,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 5 * time.Minute},
+		now:      time.Now,
+	}, nil
+}
+
+// UploadDir uploads all files in dir to the bucket, keyed by the prefix and
+// their paths relative to dir. Files with the same SHA256 checksum as the
+// existing objects are skipped. It returns the number of uploaded files.
+func (u *S3Uploader) UploadDir(dir string) (int, error) {
+	files := make([]string, 0, 16)
+	if err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	sort.Strings(files)
+
+	uploaded := 0
+	for _, file := range files {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return uploaded, err
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return uploaded, err
+		}
+
+		key := u.config.Prefix + filepath.ToSlash(rel)
+		changed, err := u.Upload(key, data)
+		if err != nil {
+			return uploaded, err
+		}
+		if changed {
+			uploaded++
+		}
+	}
+
+	return uploaded, nil
+}
+
+// Upload puts data as the object of key, unless the existing object has
+// the same SHA256 checksum, and reports whether it is uploaded.
+func (u *S3Uploader) Upload(key string, data []byte) (bool, error) {
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+	target := u.config.Bucket + "/" + key
+
+	if dryRun {
+		slog.Info(fmt.Sprintf("☁️ [s3] %s (dry run, %d bytes)", target, len(data)), "bucket", u.config.Bucket, "key", key, "bytes", len(data), "dryRun", true)
+		return false, nil
+	}
+
+	resp, err := u.do(http.MethodHead, key, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK && resp.Header.Get(metaSHA256) == checksum {
+		slog.Info(fmt.Sprintf("✅ [s3] %s (unchanged)", target), "bucket", u.config.Bucket, "key", key, "bytes", len(data), "unchanged", true)
+		return false, nil
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	header.Set(metaSHA256, checksum)
+	if u.config.CacheControl != "" {
+		header.Set("Cache-Control", u.config.CacheControl)
+	}
+
+	resp, err = u.do(http.MethodPut, key, header, data)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return false, fmt.Errorf("failed to upload %s: %s %s", target, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	slog.Info(fmt.Sprintf("☁️ [s3] %s", target), "bucket", u.config.Bucket, "key", key, "bytes", len(data))
+	return true, nil
+}
+
+func (u *S3Uploader) do(method, key string, header http.Header, body []byte) (*http.Response, error) {
+	reqURL := *u.endpoint
+	reqURL.Path = u.endpoint.Path + "/" + u.config.Bucket + "/" + key
+	reqURL.RawPath = u.endpoint.Path + "/" + encodeS3Path(u.config.Bucket+"/"+key)
+
+	req, err := http.NewRequest(method, reqURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	u.sign(req, body)
+
+	return u.client.Do(req)
+}
+
+// sign adds the authorization header of AWS Signature Version 4 to req,
+// signing the host header, all x-amz-* headers and the payload.
+func (u *S3Uploader) sign(req *http.Request, body []byte) {
+	now := u.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadSum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(payloadSum[:])
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if u.config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", u.config.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		if name = strings.ToLower(name); strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + u.config.Region + "/s3/aws4_request"
+	requestSum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestSum[:])
+
+	key := hmacSHA256([]byte("AWS4"+u.config.SecretAccessKey), date)
+	key = hmacSHA256(key, u.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		u.config.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// encodeS3Path escapes each segment of p as required by AWS Signature Version 4,
+// keeping only unreserved characters.
+func encodeS3Path(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,561 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var (
+	inputActions  = []Action{ActionAdd, ActionRemove}
+	outputActions = []Action{ActionOutput}
+
+	configKeys          = []string{"input", "output"}
+	inputConverterKeys  = []string{"type", "action", "args", "optional", "maxAge", "onStale", configKeyOnCollision, configKeyMaxInvalidRatio, configKeyMappedIPv4, configKeyArchive, configKeyMetadata, "license", "attribution"}
+	outputConverterKeys = []string{"type", "action", "args", "maxEntries", "maxEntriesPerList", "onExceed", "rankFile", configKeyHooks, configKeyPolicy}
+)
+
+// ConfigSchema returns the JSON Schema of config file generated from
+// the arguments of all registered converters.
+func ConfigSchema() map[string]any {
+	return map[string]any{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                "geoip config",
+		"type":                 "object",
+		"additionalProperties": false,
+		"required":             []string{"input", "output"},
+		"properties": map[string]any{
+			configKeyInclude: map[string]any{
+				"description": "Config files to be merged into this one, relative to the directory of this one, glob patterns are supported",
+				"type":        "array",
+				"items":       map[string]any{"type": "string"},
+			},
+			ArgWantedList.Name: map[string]any{
+				"description": "The lists to be processed by all outputs supporting wantedList and not specifying wantedList or excludedList of their own",
+				"type":        "array",
+				"items":       map[string]any{"type": "string"},
+			},
+			ArgExcludedList.Name: map[string]any{
+				"description": "The lists to be ignored by all outputs supporting excludedList and not specifying wantedList or excludedList of their own",
+				"type":        "array",
+				"items":       map[string]any{"type": "string"},
+			},
+			configKeyOnCollision: map[string]any{
+				"description": "What to do when an input adds a list that already exists, for all inputs not specifying onCollision of their own",
+				"enum":        collisionPolicies,
+				"default":     CollisionUnion,
+			},
+			configKeyMaxInvalidRatio: map[string]any{
+				"description": "Ratio of invalid lines a source may have, which are skipped and reported, before its input fails, for all inputs not specifying maxInvalidRatio of their own",
+				"type":        "number",
+				"minimum":     0,
+				"maximum":     1,
+				"default":     0,
+			},
+			configKeyMappedIPv4: map[string]any{
+				"description": "Whether the IPv4-mapped IPv6 addresses and CIDRs like ::ffff:1.2.3.4 of all inputs not specifying mappedIPv4 of their own are converted to IPv4 or kept as IPv6, defaults to the mode of the --mapped-ipv4 flag",
+				"enum":        mappedIPv4Modes,
+			},
+			"input":  converterListSchema(InputConverterInfos(), inputActions, true),
+			"output": converterListSchema(OutputConverterInfos(), outputActions, false),
+		},
+	}
+}
+
+func converterListSchema(infos []*ConverterInfo, actions []Action, isInput bool) map[string]any {
+	items := make([]any, 0, len(infos))
+	for _, info := range infos {
+		required := []string{"type"}
+		if isInput {
+			required = append(required, "action")
+		}
+
+		args := make(map[string]any, len(info.Args))
+		requiredArgs := make([]string, 0)
+		for _, arg := range info.Args {
+			args[arg.Name] = argSchema(arg)
+			if arg.Required {
+				requiredArgs = append(requiredArgs, arg.Name)
+			}
+		}
+		argsSchema := map[string]any{
+			"type":                 "object",
+			"additionalProperties": false,
+			"properties":           args,
+		}
+		if len(requiredArgs) > 0 {
+			argsSchema["required"] = requiredArgs
+			required = append(required, "args")
+		}
+
+		properties := map[string]any{
+			"type":   map[string]any{"const": info.Name},
+			"action": map[string]any{"enum": actions},
+			"args":   argsSchema,
+		}
+		if isInput {
+			properties["optional"] = map[string]any{
+				"description": "Skip this input instead of failing the run if it fails",
+				"type":        "boolean",
+			}
+			properties["maxAge"] = map[string]any{
+				"description": "Maximum age of the remote files of this input by their Last-Modified headers, like \"36h\" or \"7d\"",
+				"type":        "string",
+			}
+			properties["onStale"] = map[string]any{
+				"description": "Whether to warn or fail if any remote file of this input is older than maxAge",
+				"enum":        []string{StaleActionWarn, StaleActionFail},
+				"default":     StaleActionFail,
+			}
+			properties[configKeyOnCollision] = map[string]any{
+				"description": "What to do when this input adds a list that already exists: merge the CIDRs into it, replace it, or fail",
+				"enum":        collisionPolicies,
+			}
+			properties[configKeyMaxInvalidRatio] = map[string]any{
+				"description": "Ratio of invalid lines a source of this input may have, which are skipped and reported, before this input fails",
+				"type":        "number",
+				"minimum":     0,
+				"maximum":     1,
+			}
+			properties[configKeyMappedIPv4] = map[string]any{
+				"description": "Whether the IPv4-mapped IPv6 addresses and CIDRs like ::ffff:1.2.3.4 of this input are converted to IPv4 or kept as IPv6",
+				"enum":        mappedIPv4Modes,
+			}
+			properties[configKeyArchive] = map[string]any{
+				"description": "Go template of the URLs of the archived versions of the remote sources of this input, used instead of them in builds as of a date, with the date as {{.Date}} like \"2024-01-31\" or {{.Time}} and the current URL as {{.URL}}",
+				"type":        "string",
+			}
+			properties[configKeyMetadata] = map[string]any{
+				"description":          "Metadata attached to the lists added by this input, written by the outputs with metadataHeader",
+				"type":                 "object",
+				"additionalProperties": false,
+				"properties": map[string]any{
+					"description": map[string]any{
+						"description": "Description of the lists",
+						"type":        "string",
+					},
+					"descriptions": map[string]any{
+						"description":          "Descriptions of certain lists, overriding description",
+						"type":                 "object",
+						"additionalProperties": map[string]any{"type": "string"},
+					},
+					"source": map[string]any{
+						"description": "Source URL of the lists, defaults to the remote URLs in the args",
+						"type":        "string",
+					},
+				},
+			}
+			properties["license"] = map[string]any{
+				"description": "License of the data of this input, e.g. \"CC BY-SA 4.0\", written into the attributions file",
+				"type":        "string",
+			}
+			properties["attribution"] = map[string]any{
+				"description": "Attribution notice required by the data of this input, written into the attributions file",
+				"type":        "string",
+			}
+		} else {
+			properties["maxEntries"] = map[string]any{
+				"description": "Maximum number of CIDRs of each list written by this output",
+				"type":        "integer",
+				"minimum":     1,
+			}
+			properties["maxEntriesPerList"] = map[string]any{
+				"description":          "Maximum number of CIDRs of certain lists written by this output, overriding maxEntries",
+				"type":                 "object",
+				"additionalProperties": map[string]any{"type": "integer", "minimum": 1},
+			}
+			properties["onExceed"] = map[string]any{
+				"description": "Whether to fail, or trim the CIDRs covering the fewest addresses or ranked last by rankFile first, if any list has more CIDRs than its maximum",
+				"enum":        []string{OnExceedFail, OnExceedTrimLongestPrefixes, OnExceedTrimByRank},
+				"default":     OnExceedFail,
+			}
+			properties["rankFile"] = map[string]any{
+				"description": "Local file path or remote HTTP(S) URL of the file of CIDRs or IPs to be kept, one per line and the most important first, for onExceed trim-by-rank",
+				"type":        "string",
+			}
+			properties[configKeyHooks] = map[string]any{
+				"description": "Commands run in order after this output writes its files, failing it if any exits with a non-zero status",
+				"type":        "array",
+				"items": map[string]any{
+					"type":                 "object",
+					"additionalProperties": false,
+					"required":             []string{"command"},
+					"properties": map[string]any{
+						"command": map[string]any{
+							"description": "The program and its args, which are Go templates with the file as {{.Path}}, {{.Dir}} and {{.Name}} and its lists as {{.Lists}} for forEach, and the output type as {{.Type}}. The arg {{.Paths}} is expanded into the paths of all files",
+							"type":        "array",
+							"items":       map[string]any{"type": "string"},
+							"minItems":    1,
+						},
+						"forEach": map[string]any{
+							"description": "Run the command once for each file written by this output instead of once for all of them",
+							"type":        "boolean",
+						},
+						"timeout": map[string]any{
+							"description": "Maximum time the command may take, like \"2m\"",
+							"type":        "string",
+						},
+					},
+				},
+			}
+			properties[configKeyPolicy] = map[string]any{
+				"description":          "Lists the files written by this output must and must not have, failing it if violated before its files replace the existing ones and its hooks are run",
+				"type":                 "object",
+				"additionalProperties": false,
+				"properties": map[string]any{
+					"require": map[string]any{
+						"description": "Names of the lists that must be written, each to the minimum number of CIDRs it must have, 0 if it only has to exist",
+						"type":        "object",
+						"additionalProperties": map[string]any{
+							"type":    "integer",
+							"minimum": 0,
+						},
+					},
+					"deny": map[string]any{
+						"description": "Names, glob patterns, /regular expressions/ or presets of the lists that must not be written",
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+					},
+				},
+			}
+		}
+
+		items = append(items, map[string]any{
+			"description":          info.Description,
+			"type":                 "object",
+			"additionalProperties": false,
+			"required":             required,
+			"properties":           properties,
+		})
+	}
+
+	return map[string]any{
+		"type":  "array",
+		"items": map[string]any{"oneOf": items},
+	}
+}
+
+func argSchema(arg Arg) map[string]any {
+	schema := map[string]any{"description": arg.Description}
+	switch arg.Type {
+	case ArgTypeString:
+		schema["type"] = "string"
+		if len(arg.Enum) > 0 {
+			schema["enum"] = arg.Enum
+		}
+	case ArgTypeBool:
+		schema["type"] = "boolean"
+	case ArgTypeInt:
+		schema["type"] = "integer"
+	case ArgTypeStringList:
+		schema["type"] = "array"
+		schema["items"] = map[string]any{"type": "string"}
+	case ArgTypeStringListMap:
+		schema["type"] = "object"
+		schema["additionalProperties"] = map[string]any{
+			"type":  "array",
+			"items": map[string]any{"type": "string"},
+		}
+	}
+	if arg.Default != "" {
+		schema["default"] = arg.Default
+	}
+	return schema
+}
+
+// ValidateConfig checks the JSON config content against the arguments
+// of all registered converters, and reports the path of the first
+// unknown key or invalid value.
+func ValidateConfig(content []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(content, &fields); err != nil {
+		return err
+	}
+	if err := checkKeys("", fields, append(append(slices.Clone(configKeys), selectionKeys...), configKeyOnCollision, configKeyMaxInvalidRatio, configKeyMappedIPv4)); err != nil {
+		return err
+	}
+	if data, found := fields[configKeyMaxInvalidRatio]; found {
+		if err := checkInvalidRatioValue(data); err != nil {
+			return fmt.Errorf("invalid config: %s: %w", configKeyMaxInvalidRatio, err)
+		}
+	}
+	if data, found := fields[configKeyOnCollision]; found {
+		if err := checkArgValue(Arg{Type: ArgTypeString, Enum: collisionPolicies}, data); err != nil {
+			return fmt.Errorf("invalid config: %s: %w", configKeyOnCollision, err)
+		}
+	}
+	if data, found := fields[configKeyMappedIPv4]; found {
+		if err := checkArgValue(Arg{Type: ArgTypeString, Enum: mappedIPv4Modes}, data); err != nil {
+			return fmt.Errorf("invalid config: %s: %w", configKeyMappedIPv4, err)
+		}
+	}
+	for _, key := range selectionKeys {
+		if data, found := fields[key]; found {
+			if err := checkArgValue(Arg{Type: ArgTypeStringList}, data); err != nil {
+				return fmt.Errorf("invalid config: %s: %w", key, err)
+			}
+		}
+	}
+
+	for _, key := range configKeys {
+		data, found := fields[key]
+		if !found || bytes.Equal(data, []byte("null")) {
+			continue
+		}
+
+		var list []map[string]json.RawMessage
+		if err := json.Unmarshal(data, &list); err != nil {
+			return fmt.Errorf("invalid config: %s: must be a list of objects", key)
+		}
+
+		infos, actions, keys := InputConverterInfos(), inputActions, inputConverterKeys
+		if key == "output" {
+			infos, actions, keys = OutputConverterInfos(), outputActions, outputConverterKeys
+		}
+		for idx, item := range list {
+			if err := validateConverter(fmt.Sprintf("%s[%d]", key, idx), item, infos, actions, keys); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateConverter(path string, item map[string]json.RawMessage, infos []*ConverterInfo, actions []Action, keys []string) error {
+	if err := checkKeys(path, item, keys); err != nil {
+		return err
+	}
+	if data, found := item["optional"]; found {
+		var optional bool
+		if err := json.Unmarshal(data, &optional); err != nil {
+			return fmt.Errorf("invalid config: %s.optional: must be of type bool", path)
+		}
+	}
+	if data, found := item["maxAge"]; found {
+		var maxAge string
+		if err := json.Unmarshal(data, &maxAge); err != nil {
+			return fmt.Errorf("invalid config: %s.maxAge: must be of type string", path)
+		}
+		if _, err := ParseMaxAge(maxAge); err != nil {
+			return fmt.Errorf("invalid config: %s.maxAge: %w", path, err)
+		}
+	}
+	if data, found := item["onStale"]; found {
+		if err := checkArgValue(Arg{Type: ArgTypeString, Enum: []string{StaleActionWarn, StaleActionFail}}, data); err != nil {
+			return fmt.Errorf("invalid config: %s.onStale: %w", path, err)
+		}
+	}
+	if data, found := item[configKeyMetadata]; found {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return fmt.Errorf("invalid config: %s.%s: must be an object", path, configKeyMetadata)
+		}
+		if err := checkKeys(path+"."+configKeyMetadata, fields, []string{"description", "descriptions", "source"}); err != nil {
+			return err
+		}
+		if _, err := newInputMetadata(data, nil); err != nil {
+			return fmt.Errorf("invalid config: %s.%s: %w", path, configKeyMetadata, err)
+		}
+	}
+	if data, found := item[configKeyOnCollision]; found {
+		if err := checkArgValue(Arg{Type: ArgTypeString, Enum: collisionPolicies}, data); err != nil {
+			return fmt.Errorf("invalid config: %s.%s: %w", path, configKeyOnCollision, err)
+		}
+	}
+	if data, found := item[configKeyMappedIPv4]; found {
+		if err := checkArgValue(Arg{Type: ArgTypeString, Enum: mappedIPv4Modes}, data); err != nil {
+			return fmt.Errorf("invalid config: %s.%s: %w", path, configKeyMappedIPv4, err)
+		}
+	}
+
+	if data, found := item[configKeyMaxInvalidRatio]; found {
+		if err := checkInvalidRatioValue(data); err != nil {
+			return fmt.Errorf("invalid config: %s.%s: %w", path, configKeyMaxInvalidRatio, err)
+		}
+	}
+
+	if data, found := item[configKeyArchive]; found {
+		var archive string
+		if err := json.Unmarshal(data, &archive); err != nil {
+			return fmt.Errorf("invalid config: %s.%s: must be of type string", path, configKeyArchive)
+		}
+		if _, err := newArchive(archive); err != nil {
+			return fmt.Errorf("invalid config: %s.%s: %w", path, configKeyArchive, err)
+		}
+	}
+
+	if data, found := item["maxEntries"]; found {
+		var maxEntries int
+		if err := json.Unmarshal(data, &maxEntries); err != nil || maxEntries < 1 {
+			return fmt.Errorf("invalid config: %s.maxEntries: must be a positive integer", path)
+		}
+	}
+	if data, found := item["maxEntriesPerList"]; found {
+		var perList map[string]int
+		if err := json.Unmarshal(data, &perList); err != nil {
+			return fmt.Errorf("invalid config: %s.maxEntriesPerList: must be an object of positive integers", path)
+		}
+		for list, max := range perList {
+			if max < 1 {
+				return fmt.Errorf("invalid config: %s.maxEntriesPerList.%s: must be a positive integer", path, list)
+			}
+		}
+	}
+	if data, found := item["onExceed"]; found {
+		if err := checkArgValue(Arg{Type: ArgTypeString, Enum: []string{OnExceedFail, OnExceedTrimLongestPrefixes, OnExceedTrimByRank}}, data); err != nil {
+			return fmt.Errorf("invalid config: %s.onExceed: %w", path, err)
+		}
+	}
+
+	if data, found := item[configKeyHooks]; found {
+		var list []map[string]json.RawMessage
+		if err := json.Unmarshal(data, &list); err != nil {
+			return fmt.Errorf("invalid config: %s.%s: must be a list of objects", path, configKeyHooks)
+		}
+		for idx, hook := range list {
+			if err := checkKeys(fmt.Sprintf("%s.%s[%d]", path, configKeyHooks, idx), hook, []string{"command", "forEach", "timeout"}); err != nil {
+				return err
+			}
+		}
+		if _, err := newOutputHooks(data); err != nil {
+			return fmt.Errorf("invalid config: %s.%w", path, err)
+		}
+	}
+
+	if data, found := item[configKeyPolicy]; found {
+		var policy map[string]json.RawMessage
+		if err := json.Unmarshal(data, &policy); err != nil {
+			return fmt.Errorf("invalid config: %s.%s: must be an object", path, configKeyPolicy)
+		}
+		if err := checkKeys(fmt.Sprintf("%s.%s", path, configKeyPolicy), policy, []string{"require", "deny"}); err != nil {
+			return err
+		}
+		if _, err := newOutputPolicy(data); err != nil {
+			return fmt.Errorf("invalid config: %s.%w", path, err)
+		}
+	}
+
+	for _, key := range []string{"license", "attribution", "rankFile"} {
+		if data, found := item[key]; found {
+			if err := checkArgValue(Arg{Type: ArgTypeString}, data); err != nil {
+				return fmt.Errorf("invalid config: %s.%s: %w", path, key, err)
+			}
+		}
+	}
+
+	var iType string
+	if err := json.Unmarshal(item["type"], &iType); err != nil || iType == "" {
+		return fmt.Errorf("invalid config: %s.type: must be a non-empty string", path)
+	}
+	idx := slices.IndexFunc(infos, func(info *ConverterInfo) bool {
+		return strings.EqualFold(info.Name, iType)
+	})
+	if idx < 0 {
+		return fmt.Errorf("invalid config: %s.type: unknown type %q", path, iType)
+	}
+	info := infos[idx]
+
+	if data, found := item["action"]; found {
+		var action Action
+		if err := json.Unmarshal(data, &action); err != nil || !slices.Contains(actions, action) {
+			return fmt.Errorf("invalid config: %s.action: must be one of %v", path, actions)
+		}
+	}
+
+	var args map[string]json.RawMessage
+	if data, found := item["args"]; found && !bytes.Equal(data, []byte("null")) {
+		if err := json.Unmarshal(data, &args); err != nil {
+			return fmt.Errorf("invalid config: %s.args: must be an object", path)
+		}
+	}
+
+	names := make([]string, 0, len(info.Args))
+	for _, arg := range info.Args {
+		names = append(names, arg.Name)
+	}
+	if err := checkKeys(path+".args", args, names); err != nil {
+		return err
+	}
+
+	for _, arg := range info.Args {
+		data, found := args[arg.Name]
+		if !found {
+			if arg.Required {
+				return fmt.Errorf("invalid config: %s.args.%s: required by type %s", path, arg.Name, info.Name)
+			}
+			continue
+		}
+		if err := checkArgValue(arg, data); err != nil {
+			return fmt.Errorf("invalid config: %s.args.%s: %w", path, arg.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// checkKeys reports the first key of fields not in allowed,
+// suggesting the allowed key differing only in case.
+func checkKeys(path string, fields map[string]json.RawMessage, allowed []string) error {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		if slices.Contains(allowed, key) {
+			continue
+		}
+
+		keyPath := key
+		if path != "" {
+			keyPath = path + "." + key
+		}
+		for _, name := range allowed {
+			if strings.EqualFold(name, key) {
+				return fmt.Errorf("invalid config: %s: unknown key, did you mean %q?", keyPath, name)
+			}
+		}
+		return fmt.Errorf("invalid config: %s: unknown key, available keys: %s", keyPath, strings.Join(allowed, ", "))
+	}
+
+	return nil
+}
+
+func checkInvalidRatioValue(data json.RawMessage) error {
+	var ratio float64
+	if err := json.Unmarshal(data, &ratio); err != nil {
+		return fmt.Errorf("must be a number")
+	}
+	return checkMaxInvalidRatio(ratio)
+}
+
+func checkArgValue(arg Arg, data json.RawMessage) error {
+	var err error
+	switch arg.Type {
+	case ArgTypeString:
+		var value string
+		if err = json.Unmarshal(data, &value); err == nil && len(arg.Enum) > 0 && value != "" && !slices.Contains(arg.Enum, value) {
+			return fmt.Errorf("must be one of %v", arg.Enum)
+		}
+	case ArgTypeBool:
+		var value bool
+		err = json.Unmarshal(data, &value)
+	case ArgTypeInt:
+		var value int
+		err = json.Unmarshal(data, &value)
+	case ArgTypeStringList:
+		var value []string
+		err = json.Unmarshal(data, &value)
+	case ArgTypeStringListMap:
+		var value map[string][]string
+		err = json.Unmarshal(data, &value)
+	}
+	if err != nil {
+		return fmt.Errorf("must be of type %s", arg.Type)
+	}
+	return nil
+}
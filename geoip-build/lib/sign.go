@@ -0,0 +1,153 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Tools to sign artifacts with.
+const (
+	SignToolMinisign = "minisign"
+	SignToolGPG      = "gpg"
+)
+
+// typeSignature is the type of the signature files recorded as artifacts.
+const typeSignature = "signature"
+
+// SignPassphraseEnv is the environment variable of the passphrase of the
+// signing key, passed to the signing tool through stdin if set.
+const SignPassphraseEnv = "GEOIP_SIGN_PASSPHRASE"
+
+// Signer writes detached signatures of artifacts by invoking minisign or gpg.
+type Signer struct {
+	// Tool is either SignToolMinisign or SignToolGPG.
+	Tool string
+	// Key is the path to the secret key file for minisign, or the key ID
+	// or user ID of the key for gpg, in which case the default key is
+	// used if it is empty.
+	Key string
+}
+
+// NewSigner returns the signer of tool with key, checking that tool is installed.
+func NewSigner(tool, key string) (*Signer, error) {
+	tool = strings.ToLower(strings.TrimSpace(tool))
+	switch tool {
+	case SignToolMinisign:
+		if key == "" {
+			return nil, fmt.Errorf("a secret key file must be specified to sign with %s", tool)
+		}
+	case SignToolGPG:
+	default:
+		return nil, fmt.Errorf("unsupported sign tool %q, available options: %s, %s", tool, SignToolMinisign, SignToolGPG)
+	}
+
+	if _, err := exec.LookPath(tool); err != nil {
+		return nil, fmt.Errorf("sign tool %s is not installed: %w", tool, err)
+	}
+
+	return &Signer{Tool: tool, Key: key}, nil
+}
+
+// Ext returns the extension of the signature files.
+func (s *Signer) Ext() string {
+	if s.Tool == SignToolMinisign {
+		return ".minisig"
+	}
+	return ".asc"
+}
+
+// SignArtifacts writes a detached signature next to each recorded artifact.
+// Signatures of unchanged artifacts are kept if they exist, and no signature
+// is written in dry-run mode.
+func (s *Signer) SignArtifacts() error {
+	if err := s.signArtifacts(); err != nil {
+		return &RunError{Kind: ErrorKindOutput, Type: typeSignature, Action: ActionOutput, Err: err}
+	}
+	return nil
+}
+
+func (s *Signer) signArtifacts() error {
+	if dryRun {
+		return nil
+	}
+
+	tempDir, err := os.MkdirTemp("", "geoip-sign-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	for _, artifact := range Artifacts() {
+		if artifact.Type == typeSignature {
+			continue
+		}
+
+		sigPath := artifact.Path + s.Ext()
+		if artifact.Unchanged {
+			if sig, err := os.ReadFile(sigPath); err == nil {
+				recordArtifact(&Artifact{
+					Type:      typeSignature,
+					Path:      sigPath,
+					Size:      int64(len(sig)),
+					SHA256:    fmt.Sprintf("%x", sha256.Sum256(sig)),
+					Unchanged: true,
+				})
+				continue
+			}
+		}
+
+		tempFile := filepath.Join(tempDir, filepath.Base(sigPath))
+		if err := s.sign(artifact.Path, tempFile); err != nil {
+			return fmt.Errorf("failed to sign %s with %s: %w", artifact.Path, s.Tool, err)
+		}
+		sig, err := os.ReadFile(tempFile)
+		if err != nil {
+			return err
+		}
+		if err := WriteFile(typeSignature, sigPath, sig); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sign writes the detached signature of file to sigFile.
+func (s *Signer) sign(file, sigFile string) error {
+	passphrase, hasPassphrase := os.LookupEnv(SignPassphraseEnv)
+
+	var cmd *exec.Cmd
+	switch s.Tool {
+	case SignToolMinisign:
+		cmd = exec.Command(s.Tool, "-S", "-s", s.Key, "-m", file, "-x", sigFile)
+	case SignToolGPG:
+		args := []string{"--batch", "--yes", "--armor", "--detach-sign", "--output", sigFile}
+		if s.Key != "" {
+			args = append(args, "--local-user", s.Key)
+		}
+		if hasPassphrase {
+			args = append(args, "--pinentry-mode", "loopback", "--passphrase-fd", "0")
+		}
+		cmd = exec.Command(s.Tool, append(args, file)...)
+	}
+
+	if hasPassphrase {
+		cmd.Stdin = strings.NewReader(passphrase + "\n")
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+
+	return nil
+}
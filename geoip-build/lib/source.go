@@ -0,0 +1,103 @@
+package lib
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/tailscale/hujson"
+)
+
+// Source is a remote HTTP(S) URL referenced in the args of an input converter.
+type Source struct {
+	Type     string
+	Action   Action
+	URL      string
+	Optional bool
+	// Freshness is nil if maxAge is not specified for the input converter.
+	Freshness *Freshness
+}
+
+// ConfigSources returns all remote HTTP(S) URLs referenced in the args
+// of input converters in config content, in the order they appear.
+func ConfigSources(content []byte) ([]*Source, error) {
+	// Support JSON with comments and trailing commas
+	content, _ = hujson.Standardize(content)
+
+	var temp struct {
+		Input []struct {
+			Type     string          `json:"type"`
+			Action   Action          `json:"action"`
+			Args     json.RawMessage `json:"args"`
+			Optional bool            `json:"optional"`
+			MaxAge   string          `json:"maxAge"`
+			OnStale  string          `json:"onStale"`
+		} `json:"input"`
+	}
+	if err := json.Unmarshal(content, &temp); err != nil {
+		return nil, err
+	}
+
+	list := make([]*Source, 0, len(temp.Input))
+	for _, input := range temp.Input {
+		if len(input.Args) == 0 {
+			continue
+		}
+
+		var args any
+		if err := json.Unmarshal(input.Args, &args); err != nil {
+			return nil, err
+		}
+
+		freshness, err := newFreshness(input.MaxAge, input.OnStale, input.Args)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, url := range findURLs(args) {
+			list = append(list, &Source{
+				Type:     input.Type,
+				Action:   input.Action,
+				URL:      url,
+				Optional: input.Optional,
+
+				Freshness: freshness,
+			})
+		}
+	}
+
+	return list, nil
+}
+
+// findURLs returns the deduplicated HTTP(S) URLs found in the decoded JSON value.
+func findURLs(value any) []string {
+	found := make(map[string]bool)
+
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case string:
+			lower := strings.ToLower(strings.TrimSpace(v))
+			if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+				found[strings.TrimSpace(v)] = true
+			}
+		case []any:
+			for _, item := range v {
+				walk(item)
+			}
+		case map[string]any:
+			for _, item := range v {
+				walk(item)
+			}
+		}
+	}
+	walk(value)
+
+	list := make([]string, 0, len(found))
+	for url := range found {
+		list = append(list, url)
+	}
+	sort.Strings(list)
+
+	return list
+}
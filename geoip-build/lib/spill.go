@@ -0,0 +1,244 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go4.org/netipx"
+)
+
+// SetMaxMemory sets the memory in bytes the next runs should fit in, or
+// removes the limit if n is not positive. With a limit, input and output
+// converters run one by one, and after all inputs are run, the lists of the
+// container are spilled to a temporary file, from which output converters
+// load them one at a time, instead of keeping all of them in memory.
+//
+// It is a hint rather than a hard limit, the soft memory limit of the Go
+// runtime should be set to n as well, e.g. by debug.SetMemoryLimit.
+func (i *Instance) SetMaxMemory(n int64) {
+	i.maxMemory = n
+}
+
+// ParseSize parses a size in bytes with an optional unit, e.g. "512MB",
+// "1.5G" or "4096". All units are binary, i.e. "1K", "1KB" and "1KiB" are
+// all 1024 bytes.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	num := strings.TrimRightFunc(s, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	unit := strings.ToUpper(strings.TrimSpace(s[len(num):]))
+	unit = strings.TrimSuffix(strings.TrimSuffix(unit, "B"), "I")
+
+	shift := 0
+	switch unit {
+	case "":
+	case "K":
+		shift = 10
+	case "M":
+		shift = 20
+	case "G":
+		shift = 30
+	case "T":
+		shift = 40
+	default:
+		return 0, fmt.Errorf("invalid size %q: unknown unit", s)
+	}
+
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(int64(1)<<shift)), nil
+}
+
+// spilledEntry is an entry stored in the spill file.
+type spilledEntry struct {
+	Name         string
+	HasIPv4      bool
+	HasIPv6      bool
+	IPv4Prefixes []netip.Prefix
+	IPv6Prefixes []netip.Prefix
+	Metadata     *ListMetadata
+}
+
+// spilledContainer is a read-only container of the entries spilled to a
+// temporary file, which are loaded on each access and not kept in memory.
+type spilledContainer struct {
+	file    *os.File
+	offsets map[string][2]int64 // offset and length in file of each entry
+}
+
+// spilledFiles are the spill files that cannot be removed while open,
+// which are removed when inputs are run again.
+var spilledFiles []string
+
+// spill moves all entries of src to a temporary file one by one, and
+// returns a container loading them from the file. If src tracks the
+// provenance, only the container it wraps is replaced.
+func spill(src Container) (Container, error) {
+	if c, ok := src.(*provenanceContainer); ok {
+		spilled, err := spill(c.Container)
+		if err != nil {
+			return nil, err
+		}
+		c.Container = spilled
+		return c, nil
+	}
+	c, ok := src.(*container)
+	if !ok {
+		return src, nil
+	}
+
+	removeSpilled()
+	file, err := os.CreateTemp("", "geoip-spill-*")
+	if err != nil {
+		return nil, err
+	}
+	// The file is removed right after being created, so that it is cleaned
+	// up by the OS once closed or the process exits.
+	if err := os.Remove(file.Name()); err != nil {
+		spilledFiles = append(spilledFiles, file.Name())
+	}
+
+	spilled := &spilledContainer{file: file, offsets: make(map[string][2]int64, len(c.entries))}
+	var offset int64
+	var buf bytes.Buffer
+	for name, entry := range c.entries {
+		if err := entry.builderErr(); err != nil {
+			return nil, err
+		}
+		stored := &spilledEntry{
+			Name:     name,
+			HasIPv4:  entry.hasIPv4Builder(),
+			HasIPv6:  entry.hasIPv6Builder(),
+			Metadata: entry.metadata,
+		}
+		if stored.HasIPv4 {
+			entry.ipv4Builder.root.walk(func(prefix netip.Prefix) {
+				stored.IPv4Prefixes = append(stored.IPv4Prefixes, prefix)
+			})
+		}
+		if stored.HasIPv6 {
+			entry.ipv6Builder.root.walk(func(prefix netip.Prefix) {
+				stored.IPv6Prefixes = append(stored.IPv6Prefixes, prefix)
+			})
+		}
+
+		buf.Reset()
+		if err := gob.NewEncoder(&buf).Encode(stored); err != nil {
+			return nil, err
+		}
+		if _, err := file.Write(buf.Bytes()); err != nil {
+			return nil, err
+		}
+		spilled.offsets[name] = [2]int64{offset, int64(buf.Len())}
+		offset += int64(buf.Len())
+
+		// Free the entry as soon as it is spilled
+		delete(c.entries, name)
+	}
+
+	slog.Debug("entries spilled to temporary file", "lists", len(spilled.offsets), "bytes", offset)
+	return spilled, nil
+}
+
+// removeSpilled removes the spill files that could not be removed when
+// they were created.
+func removeSpilled() {
+	for _, file := range spilledFiles {
+		os.Remove(file)
+	}
+	spilledFiles = nil
+}
+
+func (c *spilledContainer) load(name string) (*Entry, error) {
+	pos, found := c.offsets[name]
+	if !found {
+		return nil, fmt.Errorf("entry %s not found", name)
+	}
+
+	data := make([]byte, pos[1])
+	if _, err := c.file.ReadAt(data, pos[0]); err != nil {
+		return nil, err
+	}
+	var stored spilledEntry
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&stored); err != nil {
+		return nil, err
+	}
+
+	var err error
+	entry := &Entry{name: stored.Name, metadata: stored.Metadata}
+	if stored.HasIPv4 {
+		if entry.ipv4Set, err = prefixesIPSet(stored.IPv4Prefixes); err != nil {
+			return nil, err
+		}
+	}
+	if stored.HasIPv6 {
+		if entry.ipv6Set, err = prefixesIPSet(stored.IPv6Prefixes); err != nil {
+			return nil, err
+		}
+	}
+	return entry, nil
+}
+
+func prefixesIPSet(prefixes []netip.Prefix) (*netipx.IPSet, error) {
+	var builder netipx.IPSetBuilder
+	for _, prefix := range prefixes {
+		builder.AddPrefix(prefix)
+	}
+	return builder.IPSet()
+}
+
+func (c *spilledContainer) GetEntry(name string) (*Entry, bool) {
+	entry, err := c.load(strings.ToUpper(strings.TrimSpace(name)))
+	if err != nil {
+		return nil, false
+	}
+	return entry, true
+}
+
+// Loop loads the entries one by one in the order of their names.
+func (c *spilledContainer) Loop() <-chan *Entry {
+	names := make([]string, 0, len(c.offsets))
+	for name := range c.offsets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	ch := make(chan *Entry)
+	go func() {
+		defer close(ch)
+		for _, name := range names {
+			entry, err := c.load(name)
+			if err != nil {
+				slog.Error("❌ failed to load spilled entry: "+err.Error(), "list", name)
+				continue
+			}
+			ch <- entry
+		}
+	}()
+	return ch
+}
+
+var errSpilledReadOnly = errors.New("entries spilled to temporary file cannot be changed")
+
+func (c *spilledContainer) Add(entry *Entry, opts ...IgnoreIPOption) error {
+	return errSpilledReadOnly
+}
+
+func (c *spilledContainer) Remove(entry *Entry, rCase CaseRemove, opts ...IgnoreIPOption) error {
+	return errSpilledReadOnly
+}
+
+func (c *spilledContainer) Lookup(ipOrCidr string, searchList ...string) ([]string, bool, error) {
+	return lookup(c, ipOrCidr, searchList...)
+}
@@ -0,0 +1,123 @@
+package lib
+
+import "sync"
+
+// stagedFS is the OutputFS of output converters of a type whose files are
+// staged: the files they write replace the files of their names only once
+// committed, and are dropped if discarded, e.g. so that files failing the
+// policy of the output are never published.
+type stagedFS struct {
+	OutputFS
+
+	mu    sync.Mutex
+	files []OutputFile
+}
+
+var (
+	stagedMu    sync.Mutex
+	stagedTypes = make(map[string]*stagedFS)
+)
+
+// stageOutput stages the files written by output converters of type iType
+// until commit or discard is called on the returned stagedFS. Output
+// converters of the same type never run at the same time.
+func stageOutput(iType string) *stagedFS {
+	s := &stagedFS{OutputFS: outputFS}
+	stagedMu.Lock()
+	defer stagedMu.Unlock()
+	stagedTypes[iType] = s
+	return s
+}
+
+// outputFSOf returns the OutputFS output converters of type iType write
+// files to.
+func outputFSOf(iType string) OutputFS {
+	stagedMu.Lock()
+	defer stagedMu.Unlock()
+	if s, found := stagedTypes[iType]; found {
+		return s
+	}
+	return outputFS
+}
+
+// unstage stops staging the files of iType.
+func (s *stagedFS) unstage(iType string) {
+	stagedMu.Lock()
+	defer stagedMu.Unlock()
+	if stagedTypes[iType] == s {
+		delete(stagedTypes, iType)
+	}
+}
+
+func (s *stagedFS) Create(name string) (OutputFile, error) {
+	f, err := s.OutputFS.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &stagedFile{OutputFile: f, fs: s}, nil
+}
+
+// commit replaces the files of the names of all staged files with them in
+// the order they are written, and returns the first error.
+func (s *stagedFS) commit() error {
+	s.mu.Lock()
+	files := s.files
+	s.files = nil
+	s.mu.Unlock()
+
+	var err error
+	for _, f := range files {
+		if err != nil {
+			f.Discard()
+			continue
+		}
+		err = f.Close()
+	}
+	return err
+}
+
+// discard drops all staged files.
+func (s *stagedFS) discard() {
+	s.mu.Lock()
+	files := s.files
+	s.files = nil
+	s.mu.Unlock()
+
+	for _, f := range files {
+		f.Discard()
+	}
+}
+
+// stagedFile is a file written to a stagedFS, which is closed by it once
+// committed.
+type stagedFile struct {
+	OutputFile
+	fs   *stagedFS
+	done bool
+}
+
+func (f *stagedFile) Close() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+
+	if finisher, ok := f.OutputFile.(interface{ finish() error }); ok {
+		if err := finisher.finish(); err != nil {
+			f.OutputFile.Discard()
+			return err
+		}
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	f.fs.files = append(f.fs.files, f.OutputFile)
+	return nil
+}
+
+func (f *stagedFile) Discard() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+	return f.OutputFile.Discard()
+}
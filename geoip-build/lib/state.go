@@ -0,0 +1,100 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"net/netip"
+	"os"
+)
+
+// buildStateVersion is changed whenever the format of the state file is
+// changed, to invalidate old states.
+const buildStateVersion = "geoip-build-state-v1"
+
+// typeBuildState is the type of the build state file.
+const typeBuildState = "state"
+
+// BuildState tracks the SHA256 checksums of all artifacts of a build in
+// a state file, so that automation can skip publishing and notifying when
+// the next build produces exactly the same artifacts. The CIDRs of the
+// lists of the build are also tracked for changelogs if saved.
+type BuildState struct {
+	File string
+
+	artifacts map[string]string // map[path]sha256
+	lists     map[string][]netip.Prefix
+	found     bool
+}
+
+type buildState struct {
+	Version   string                    `json:"version"`
+	Artifacts map[string]string         `json:"artifacts"`
+	Lists     map[string][]netip.Prefix `json:"lists,omitempty"`
+}
+
+// NewBuildState returns a BuildState with the state file of the last build,
+// which is created by Save if it does not exist yet.
+func NewBuildState(file string) (*BuildState, error) {
+	s := &BuildState{File: file, artifacts: make(map[string]string)}
+
+	data, err := os.ReadFile(file)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return s, nil
+	case err != nil:
+		return nil, err
+	}
+
+	var state buildState
+	if err := json.Unmarshal(data, &state); err != nil || state.Version != buildStateVersion {
+		slog.Warn("⚠️ invalid or outdated build state file, ignored", "path", file)
+		return s, nil
+	}
+	if state.Artifacts != nil {
+		s.artifacts = state.Artifacts
+	}
+	s.lists = state.Lists
+	s.found = true
+	return s, nil
+}
+
+// Changed reports whether artifacts differ from those of the last build in
+// paths or contents. It is always true if there is no last build.
+func (s *BuildState) Changed(artifacts []*Artifact) bool {
+	return !s.found || !maps.Equal(s.artifacts, artifactSums(artifacts))
+}
+
+// HasLists reports whether the CIDRs of the lists of the last build are
+// tracked.
+func (s *BuildState) HasLists() bool {
+	return s.lists != nil
+}
+
+// Save replaces the state with the checksums of artifacts and the CIDRs of
+// lists, which are not tracked if nil.
+func (s *BuildState) Save(artifacts []*Artifact, lists map[string][]netip.Prefix) error {
+	if dryRun {
+		return nil
+	}
+	s.artifacts, s.lists, s.found = artifactSums(artifacts), lists, true
+
+	data, err := json.MarshalIndent(&buildState{Version: buildStateVersion, Artifacts: s.artifacts, Lists: s.lists}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.File, data); err != nil {
+		return &RunError{Kind: ErrorKindOutput, Type: typeBuildState, Action: ActionOutput, Err: err}
+	}
+	return nil
+}
+
+func artifactSums(artifacts []*Artifact) map[string]string {
+	sums := make(map[string]string, len(artifacts))
+	for _, artifact := range artifacts {
+		sums[artifact.Path] = artifact.SHA256
+	}
+	return sums
+}
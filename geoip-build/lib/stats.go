@@ -0,0 +1,78 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// EntryStats is the number of prefixes of an entry.
+type EntryStats struct {
+	Name string `json:"name"`
+	IPv4 int    `json:"ipv4"`
+	IPv6 int    `json:"ipv6"`
+}
+
+// Summary is the result of a run of an instance.
+type Summary struct {
+	Lists     []*EntryStats    `json:"lists"`
+	Artifacts []*Artifact      `json:"artifacts"`
+	Failures  []*SourceFailure `json:"failures"`
+}
+
+// GetStats returns the stats of all entries in the container sorted by name.
+func GetStats(container Container) ([]*EntryStats, error) {
+	list := make([]*EntryStats, 0, 300)
+	for entry := range container.Loop() {
+		ipv4Count, ipv6Count, err := entry.CountPrefix()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, &EntryStats{
+			Name: entry.GetName(),
+			IPv4: ipv4Count,
+			IPv6: ipv6Count,
+		})
+	}
+
+	slices.SortFunc(list, func(a, b *EntryStats) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return list, nil
+}
+
+// PrintStats writes the stats of entries and artifacts in table format.
+// Entries without any prefix are marked, as they usually indicate
+// a broken source.
+func PrintStats(w io.Writer, stats []*EntryStats, artifacts []*Artifact) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	var totalIPv4, totalIPv6 int
+	fmt.Fprintln(tw, "LIST\tIPV4\tIPV6\tTOTAL\t")
+	for _, s := range stats {
+		mark := ""
+		if s.IPv4+s.IPv6 == 0 {
+			mark = "⚠️ empty"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\n", s.Name, s.IPv4, s.IPv6, s.IPv4+s.IPv6, mark)
+		totalIPv4 += s.IPv4
+		totalIPv6 += s.IPv6
+	}
+	fmt.Fprintf(tw, "%d lists\t%d\t%d\t%d\t\n", len(stats), totalIPv4, totalIPv6, totalIPv4+totalIPv6)
+
+	if len(artifacts) > 0 {
+		var totalSize int64
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "ARTIFACT\tTYPE\tLISTS\tSIZE\t")
+		for _, a := range artifacts {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t\n", a.Path, a.Type, len(a.Lists), a.Size)
+			totalSize += a.Size
+		}
+		fmt.Fprintf(tw, "%d artifacts\t\t\t%d\t\n", len(artifacts), totalSize)
+	}
+
+	tw.Flush()
+}
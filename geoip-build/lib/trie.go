@@ -0,0 +1,202 @@
+package lib
+
+import (
+	"math/bits"
+	"net/netip"
+
+	"go4.org/netipx"
+)
+
+// prefixTrie is a path-compressed binary radix (Patricia) trie of the
+// CIDRs of one IP family, used to build the IP sets of entries. Adding or
+// removing a CIDR takes O(bits) time regardless of the size of the trie,
+// overlapping CIDRs are merged on insertion, and sibling CIDRs are
+// aggregated into their parent, so that alternating additions and removals
+// on large lists stay fast.
+type prefixTrie struct {
+	root *trieNode
+	err  error
+}
+
+// trieNode is a node of prefixTrie. The CIDRs of its children are longer
+// than its own CIDR, and the bit after its CIDR selects the child.
+type trieNode struct {
+	prefix   netip.Prefix
+	full     bool // the whole CIDR is in the trie, so it has no children
+	children [2]*trieNode
+}
+
+// AddPrefix adds the CIDR to the trie.
+func (t *prefixTrie) AddPrefix(prefix netip.Prefix) {
+	if !prefix.IsValid() {
+		t.err = ErrInvalidPrefix
+		return
+	}
+	t.root = insertTrieNode(t.root, prefix.Masked())
+}
+
+// RemovePrefix removes the CIDR from the trie.
+func (t *prefixTrie) RemovePrefix(prefix netip.Prefix) {
+	if !prefix.IsValid() {
+		t.err = ErrInvalidPrefix
+		return
+	}
+	t.root = removeTrieNode(t.root, prefix.Masked())
+}
+
+// AddTrie adds all CIDRs of other to the trie.
+func (t *prefixTrie) AddTrie(other *prefixTrie) {
+	if other == nil {
+		return
+	}
+	if other.err != nil {
+		t.err = other.err
+	}
+	other.root.walk(func(prefix netip.Prefix) {
+		t.root = insertTrieNode(t.root, prefix)
+	})
+}
+
+// RemoveTrie removes all CIDRs of other from the trie.
+func (t *prefixTrie) RemoveTrie(other *prefixTrie) {
+	if other == nil {
+		return
+	}
+	if other.err != nil {
+		t.err = other.err
+	}
+	other.root.walk(func(prefix netip.Prefix) {
+		t.root = removeTrieNode(t.root, prefix)
+	})
+}
+
+// IPSet returns the IP set of the CIDRs in the trie, or the first error
+// of invalid CIDRs given to it.
+func (t *prefixTrie) IPSet() (*netipx.IPSet, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	var builder netipx.IPSetBuilder
+	t.root.walk(builder.AddPrefix)
+	return builder.IPSet()
+}
+
+// walk calls fn with the CIDRs in the trie in ascending order.
+func (n *trieNode) walk(fn func(netip.Prefix)) {
+	if n == nil {
+		return
+	}
+	if n.full {
+		fn(n.prefix)
+		return
+	}
+	n.children[0].walk(fn)
+	n.children[1].walk(fn)
+}
+
+func insertTrieNode(n *trieNode, prefix netip.Prefix) *trieNode {
+	switch {
+	case n == nil:
+		return &trieNode{prefix: prefix, full: true}
+
+	case n.prefix.Bits() <= prefix.Bits() && n.prefix.Contains(prefix.Addr()):
+		if n.full {
+			return n
+		}
+		if n.prefix.Bits() == prefix.Bits() {
+			n.full, n.children = true, [2]*trieNode{}
+			return n
+		}
+		b := addrBit(prefix.Addr(), n.prefix.Bits())
+		n.children[b] = insertTrieNode(n.children[b], prefix)
+		return n.aggregate()
+
+	case prefix.Contains(n.prefix.Addr()):
+		return &trieNode{prefix: prefix, full: true}
+
+	default:
+		parent := &trieNode{prefix: commonPrefix(n.prefix, prefix)}
+		parent.children[addrBit(n.prefix.Addr(), parent.prefix.Bits())] = n
+		parent.children[addrBit(prefix.Addr(), parent.prefix.Bits())] = &trieNode{prefix: prefix, full: true}
+		return parent.aggregate()
+	}
+}
+
+func removeTrieNode(n *trieNode, prefix netip.Prefix) *trieNode {
+	switch {
+	case n == nil:
+		return nil
+
+	case prefix.Bits() <= n.prefix.Bits() && prefix.Contains(n.prefix.Addr()):
+		return nil
+
+	case n.prefix.Contains(prefix.Addr()):
+		if n.full {
+			childBits := n.prefix.Bits() + 1
+			n.full = false
+			n.children[0] = &trieNode{prefix: netip.PrefixFrom(n.prefix.Addr(), childBits), full: true}
+			n.children[1] = &trieNode{prefix: netip.PrefixFrom(setAddrBit(n.prefix.Addr(), n.prefix.Bits()), childBits), full: true}
+		}
+		b := addrBit(prefix.Addr(), n.prefix.Bits())
+		n.children[b] = removeTrieNode(n.children[b], prefix)
+		switch {
+		case n.children[0] == nil:
+			return n.children[1]
+		case n.children[1] == nil:
+			return n.children[0]
+		}
+		return n
+
+	default:
+		return n
+	}
+}
+
+// aggregate marks n as full if its children are its two full halves.
+func (n *trieNode) aggregate() *trieNode {
+	childBits := n.prefix.Bits() + 1
+	for _, child := range n.children {
+		if child == nil || !child.full || child.prefix.Bits() != childBits {
+			return n
+		}
+	}
+	n.full, n.children = true, [2]*trieNode{}
+	return n
+}
+
+// addrBit returns the bit of addr at index i, counting from the most significant bit.
+func addrBit(addr netip.Addr, i int) int {
+	b := addr.As16()
+	if addr.Is4() {
+		i += 96
+	}
+	return int(b[i/8]>>(7-i%8)) & 1
+}
+
+// setAddrBit returns addr with the bit at index i set.
+func setAddrBit(addr netip.Addr, i int) netip.Addr {
+	b := addr.As16()
+	if addr.Is4() {
+		i += 96
+		b[i/8] |= 1 << (7 - i%8)
+		return netip.AddrFrom4([4]byte(b[12:]))
+	}
+	b[i/8] |= 1 << (7 - i%8)
+	return netip.AddrFrom16(b)
+}
+
+// commonPrefix returns the longest CIDR containing both CIDRs a and b of the same IP family.
+func commonPrefix(a, b netip.Prefix) netip.Prefix {
+	x, y := a.Addr().As16(), b.Addr().As16()
+	common := 128
+	for i := range x {
+		if d := x[i] ^ y[i]; d != 0 {
+			common = i*8 + bits.LeadingZeros8(d)
+			break
+		}
+	}
+	if a.Addr().Is4() {
+		common -= 96
+	}
+	return netip.PrefixFrom(a.Addr(), min(common, a.Bits(), b.Bits())).Masked()
+}
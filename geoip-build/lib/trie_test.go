@@ -0,0 +1,225 @@
+package lib
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+
+	"go4.org/netipx"
+)
+
+// trieOp adds a CIDR to or, prefixed by "-", removes it from the tries.
+type trieOp string
+
+// applyTrieOps applies ops to a trie of each IP family, as entries do, and
+// to an IPSetBuilder, and returns the CIDRs of both.
+func applyTrieOps(t *testing.T, ops []trieOp) (got, want []netip.Prefix) {
+	t.Helper()
+	var ipv4, ipv6 prefixTrie
+	var builder netipx.IPSetBuilder
+	for _, op := range ops {
+		cidr, remove := strings.CutPrefix(string(op), "-")
+		prefix := netip.MustParsePrefix(cidr)
+		trie := &ipv6
+		if prefix.Addr().Is4() {
+			trie = &ipv4
+		}
+		if remove {
+			trie.RemovePrefix(prefix)
+			builder.RemovePrefix(prefix)
+		} else {
+			trie.AddPrefix(prefix)
+			builder.AddPrefix(prefix)
+		}
+	}
+
+	for _, trie := range []*prefixTrie{&ipv4, &ipv6} {
+		set, err := trie.IPSet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, set.Prefixes()...)
+	}
+	set, err := builder.IPSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got, set.Prefixes()
+}
+
+func TestPrefixTrie(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []trieOp
+		// want is the CIDRs in the trie, which are also compared with the
+		// ones of an IPSetBuilder.
+		want []string
+	}{
+		{name: "empty"},
+		{name: "single", ops: []trieOp{"192.0.2.0/24"}, want: []string{"192.0.2.0/24"}},
+		{name: "host bits", ops: []trieOp{"192.0.2.1/24"}, want: []string{"192.0.2.0/24"}},
+		{name: "duplicate", ops: []trieOp{"192.0.2.0/24", "192.0.2.0/24"}, want: []string{"192.0.2.0/24"}},
+		{name: "contained after", ops: []trieOp{"10.0.0.0/8", "10.1.0.0/16"}, want: []string{"10.0.0.0/8"}},
+		{name: "containing after", ops: []trieOp{"10.1.0.0/16", "10.2.3.0/24", "10.0.0.0/8"}, want: []string{"10.0.0.0/8"}},
+		{name: "siblings aggregated", ops: []trieOp{"10.0.0.0/9", "10.128.0.0/9"}, want: []string{"10.0.0.0/8"}},
+		{
+			name: "siblings aggregated up several levels",
+			ops:  []trieOp{"10.0.0.0/10", "10.64.0.0/10", "10.128.0.0/9"},
+			want: []string{"10.0.0.0/8"},
+		},
+		{name: "disjoint", ops: []trieOp{"10.0.0.0/8", "192.0.2.0/24"}, want: []string{"10.0.0.0/8", "192.0.2.0/24"}},
+		{name: "remove all", ops: []trieOp{"10.0.0.0/8", "-10.0.0.0/8"}},
+		{name: "remove containing", ops: []trieOp{"10.1.0.0/16", "10.2.0.0/16", "-10.0.0.0/8"}},
+		{name: "remove missing", ops: []trieOp{"10.0.0.0/8", "-192.0.2.0/24"}, want: []string{"10.0.0.0/8"}},
+		{
+			name: "remove splitting",
+			ops:  []trieOp{"10.0.0.0/8", "-10.1.0.0/16"},
+			want: []string{"10.0.0.0/16", "10.2.0.0/15", "10.4.0.0/14", "10.8.0.0/13", "10.16.0.0/12", "10.32.0.0/11", "10.64.0.0/10", "10.128.0.0/9"},
+		},
+		{
+			name: "remove splitting then add back",
+			ops:  []trieOp{"10.0.0.0/8", "-10.1.2.3/32", "10.1.2.3/32"},
+			want: []string{"10.0.0.0/8"},
+		},
+		{name: "ipv4 /0", ops: []trieOp{"192.0.2.0/24", "0.0.0.0/0"}, want: []string{"0.0.0.0/0"}},
+		{
+			name: "ipv4 /0 remove splitting",
+			ops:  []trieOp{"0.0.0.0/0", "-128.0.0.0/1", "-64.0.0.0/2"},
+			want: []string{"0.0.0.0/2"},
+		},
+		{name: "ipv4 /32", ops: []trieOp{"192.0.2.1/32", "192.0.2.0/32"}, want: []string{"192.0.2.0/31"}},
+		{
+			name: "ipv4 /32 removed",
+			ops:  []trieOp{"192.0.2.0/30", "-192.0.2.2/32"},
+			want: []string{"192.0.2.0/31", "192.0.2.3/32"},
+		},
+		{name: "ipv6 /0", ops: []trieOp{"2001:db8::/32", "::/0"}, want: []string{"::/0"}},
+		{name: "ipv6 /0 removed", ops: []trieOp{"2001:db8::/32", "::/1", "-::/0"}},
+		{name: "ipv6 /128", ops: []trieOp{"2001:db8::1/128", "2001:db8::/128"}, want: []string{"2001:db8::/127"}},
+		{
+			name: "ipv6 /128 removed",
+			ops:  []trieOp{"2001:db8::/126", "-2001:db8::1/128"},
+			want: []string{"2001:db8::/128", "2001:db8::2/127"},
+		},
+		{
+			name: "ipv4 and ipv6",
+			ops:  []trieOp{"10.0.0.0/8", "2001:db8::/32", "-10.0.0.0/9", "-2001:db8::/33"},
+			want: []string{"10.128.0.0/9", "2001:db8:8000::/33"},
+		},
+		{
+			name: "mapped ipv4 kept apart from ipv4",
+			ops:  []trieOp{"1.2.3.0/24", "::ffff:1.2.3.0/120", "-1.2.3.0/25"},
+			want: []string{"1.2.3.128/25", "::ffff:1.2.3.0/120"},
+		},
+		{
+			name: "mapped ipv4 aggregated with ipv6",
+			ops:  []trieOp{"::ffff:0.0.0.0/97", "::ffff:128.0.0.0/97", "::fffe:0:0/96"},
+			want: []string{"::fffe:0:0/95"},
+		},
+		{
+			name: "mapped ipv4 removed from ipv6",
+			ops:  []trieOp{"::/64", "-::ffff:0:0/96", "-::/80"},
+			want: []string{"::1:0:0:0/80", "::2:0:0:0/79", "::4:0:0:0/78", "::8:0:0:0/77", "::10:0:0:0/76", "::20:0:0:0/75", "::40:0:0:0/74", "::80:0:0:0/73", "::100:0:0:0/72", "::200:0:0:0/71", "::400:0:0:0/70", "::800:0:0:0/69", "::1000:0:0:0/68", "::2000:0:0:0/67", "::4000:0:0:0/66", "::8000:0:0:0/65"},
+		},
+		{
+			name: "ipv6 removal splitting across mapped ipv4",
+			ops:  []trieOp{"::ffff:0:0/96", "-::ffff:10.0.0.0/104"},
+			want: []string{"::ffff:0.0.0.0/101", "::ffff:8.0.0.0/103", "::ffff:11.0.0.0/104", "::ffff:12.0.0.0/102", "::ffff:16.0.0.0/100", "::ffff:32.0.0.0/99", "::ffff:64.0.0.0/98", "::ffff:128.0.0.0/97"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, want := applyTrieOps(t, tt.ops)
+			if !slices.Equal(got, want) {
+				t.Fatalf("trie CIDRs = %v, IPSetBuilder CIDRs = %v", got, want)
+			}
+			if gotText := prefixStrings(got); !slices.Equal(gotText, tt.want) {
+				t.Errorf("trie CIDRs = %v, want %v", gotText, tt.want)
+			}
+		})
+	}
+}
+
+// TestPrefixTrieRandom compares the trie with an IPSetBuilder for random
+// additions and removals of overlapping CIDRs.
+func TestPrefixTrieRandom(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 1))
+	for round := range 200 {
+		ops := make([]trieOp, 0, 64)
+		for range cap(ops) {
+			var prefix netip.Prefix
+			switch r.IntN(3) {
+			case 0:
+				addr := netip.AddrFrom4([4]byte{10, byte(r.IntN(4)), byte(r.Uint32()), byte(r.Uint32())})
+				prefix = netip.PrefixFrom(addr, 8+r.IntN(25))
+			case 1:
+				addr := netip.AddrFrom16([16]byte{0x20, 0x01, 0x0d, 0xb8, byte(r.IntN(4)), 15: byte(r.Uint32())})
+				prefix = netip.PrefixFrom(addr, 32+r.IntN(97))
+			default:
+				addr := netip.AddrFrom16([16]byte{10: 0xff, 11: 0xff, 12: 10, 13: byte(r.IntN(4)), 14: byte(r.Uint32()), 15: byte(r.Uint32())})
+				prefix = netip.PrefixFrom(addr, 96+r.IntN(33))
+			}
+			op := trieOp(prefix.Masked().String())
+			if r.IntN(3) == 0 {
+				op = "-" + op
+			}
+			ops = append(ops, op)
+		}
+
+		got, want := applyTrieOps(t, ops)
+		if !slices.Equal(got, want) {
+			t.Fatalf("round %d: trie CIDRs = %v, IPSetBuilder CIDRs = %v of %v", round, got, want, ops)
+		}
+	}
+}
+
+func TestPrefixTrieInvalid(t *testing.T) {
+	var trie prefixTrie
+	trie.AddPrefix(netip.MustParsePrefix("192.0.2.0/24"))
+	trie.RemovePrefix(netip.Prefix{})
+	if _, err := trie.IPSet(); !errors.Is(err, ErrInvalidPrefix) {
+		t.Errorf("IPSet error = %v, want %v", err, ErrInvalidPrefix)
+	}
+
+	var other prefixTrie
+	other.AddTrie(&trie)
+	if _, err := other.IPSet(); !errors.Is(err, ErrInvalidPrefix) {
+		t.Errorf("IPSet error of the trie added = %v, want %v", err, ErrInvalidPrefix)
+	}
+}
+
+func TestPrefixTrieAddRemoveTrie(t *testing.T) {
+	var trie, added, removed prefixTrie
+	trie.AddPrefix(netip.MustParsePrefix("10.0.0.0/9"))
+	added.AddPrefix(netip.MustParsePrefix("10.128.0.0/9"))
+	added.AddPrefix(netip.MustParsePrefix("192.0.2.0/24"))
+	removed.AddPrefix(netip.MustParsePrefix("10.0.0.0/16"))
+	removed.AddPrefix(netip.MustParsePrefix("192.0.2.128/25"))
+
+	trie.AddTrie(&added)
+	trie.RemoveTrie(&removed)
+	trie.AddTrie(nil)
+	trie.RemoveTrie(nil)
+
+	set, err := trie.IPSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"10.1.0.0/16", "10.2.0.0/15", "10.4.0.0/14", "10.8.0.0/13", "10.16.0.0/12", "10.32.0.0/11", "10.64.0.0/10", "10.128.0.0/9", "192.0.2.0/25"}
+	if got := prefixStrings(set.Prefixes()); !slices.Equal(got, want) {
+		t.Errorf("trie CIDRs = %v, want %v", got, want)
+	}
+}
+
+// prefixStrings returns the CIDRs of prefixes in text form.
+func prefixStrings(prefixes []netip.Prefix) []string {
+	var list []string
+	for _, prefix := range prefixes {
+		list = append(list, prefix.String())
+	}
+	return list
+}
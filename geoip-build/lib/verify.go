@@ -0,0 +1,79 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// verifySampleSize is the maximum number of prefixes of each entry
+// to be checked when verifying an artifact.
+const verifySampleSize = 100
+
+// VerifyContainer checks the container re-read from an artifact against
+// the origin container of the build. Every entry of the re-read container
+// must exist in the origin container, and a sample of its prefixes must be
+// contained in the corresponding origin entry.
+func VerifyContainer(reread, origin Container) error {
+	entries := make([]*Entry, 0, 300)
+	for entry := range reread.Loop() {
+		entries = append(entries, entry)
+	}
+
+	if len(entries) == 0 {
+		return ErrNoEntry
+	}
+
+	for _, entry := range entries {
+		name := entry.GetName()
+		originEntry, found := origin.GetEntry(name)
+		if !found {
+			return fmt.Errorf("entry %s not found in build", name)
+		}
+
+		prefixes, err := entry.MarshalPrefix()
+		if err != nil {
+			return err
+		}
+
+		step := max(1, len(prefixes)/verifySampleSize)
+		for idx := 0; idx < len(prefixes); idx += step {
+			contained, err := originEntry.ContainsPrefix(prefixes[idx])
+			if err != nil {
+				return err
+			}
+			if !contained {
+				return fmt.Errorf("entry %s: prefix %s not found in build", name, prefixes[idx])
+			}
+		}
+	}
+
+	return nil
+}
+
+// Verify re-reads the artifacts written by the output converters of the last run
+// and checks them against the container of the build.
+func (i *Instance) Verify(ctx context.Context) error {
+	if i.container == nil {
+		return fmt.Errorf("instance has not been run yet")
+	}
+
+	for idx, oc := range i.output {
+		verifier, ok := oc.(Verifier)
+		if !ok {
+			slog.Warn(fmt.Sprintf("⚠️ [%s] verification is not supported, skipped", oc.GetType()), "type", oc.GetType())
+			continue
+		}
+		// Outputs are checked against the container they wrote, with their
+		// lists exceeding the limit trimmed
+		container := i.container
+		if idx < len(i.outputInputs) && i.outputInputs[idx] != nil {
+			container = i.outputInputs[idx]
+		}
+		if err := verifier.Verify(ctx, container); err != nil {
+			return fmt.Errorf("❌ [type %s | action %s] verification failed: %w", oc.GetType(), oc.GetAction(), err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package lib
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Version, Commit and Date describe the build of the binary, which can be
+// set at build time like:
+//
+//	go build -ldflags "-X github.com/Loyalsoldier/geoip/lib.Version=v1.0.0 -X github.com/Loyalsoldier/geoip/lib.Commit=$(git rev-parse HEAD)"
+//
+// The ones not set are taken from the build info embedded by the Go
+// toolchain, which records the VCS revision when built in a checkout.
+var (
+	Version string
+	Commit  string
+	Date    string
+)
+
+// BuildInfo describes the build of the binary, so that artifacts can be
+// traced back to the exact revision of the builder.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"goVersion"`
+}
+
+// GetBuildInfo returns the build info of the binary.
+func GetBuildInfo() *BuildInfo {
+	info := &BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+	}
+
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && buildInfo.Main.Version != "(devel)" {
+			info.Version = buildInfo.Main.Version
+		}
+		for _, setting := range buildInfo.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true" && Commit == ""
+			}
+		}
+	}
+
+	if info.Version == "" {
+		info.Version = "devel"
+	}
+	return info
+}
+
+// String returns the build info in one line, e.g.
+// "geoip v1.0.0 (commit 0123456789ab, 2024-01-02T03:04:05Z)".
+func (b *BuildInfo) String() string {
+	var details []string
+	if b.Commit != "" {
+		commit := b.Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		if b.Modified {
+			commit += "-dirty"
+		}
+		details = append(details, "commit "+commit)
+	}
+	if b.Date != "" {
+		details = append(details, b.Date)
+	}
+	if len(details) == 0 {
+		return fmt.Sprintf("geoip %s", b.Version)
+	}
+	return fmt.Sprintf("geoip %s (%s)", b.Version, strings.Join(details, ", "))
+}
@@ -14,6 +14,11 @@ var listCmd = &cobra.Command{
 	Aliases: []string{"l", "ls"},
 	Short:   "List all available input and output formats",
 	Run: func(cmd *cobra.Command, args []string) {
+		if isJSONOutput(cmd) {
+			printConverterInfosJSON(lib.InputConverterInfos(), lib.OutputConverterInfos())
+			return
+		}
+
 		lib.ListInputConverter()
 		println()
 		lib.ListOutputConverter()
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Loyalsoldier/geoip/lib"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(listFormatsCmd)
+}
+
+var listFormatsCmd = &cobra.Command{
+	Use:     "list-formats",
+	Aliases: []string{"formats"},
+	Short:   "List all available input and output formats with their arguments in config file",
+	Run: func(cmd *cobra.Command, args []string) {
+		if isJSONOutput(cmd) {
+			printConverterInfosJSON(lib.InputConverterInfos(), lib.OutputConverterInfos())
+			return
+		}
+
+		fmt.Println("All available input formats:")
+		printConverterInfos(lib.InputConverterInfos())
+		fmt.Println()
+		fmt.Println("All available output formats:")
+		printConverterInfos(lib.OutputConverterInfos())
+	},
+}
+
+func printConverterInfos(infos []*lib.ConverterInfo) {
+	for _, info := range infos {
+		fmt.Printf("  - %s (%s)\n", info.Name, info.Description)
+		for _, arg := range info.Args {
+			var attrs []string
+			if arg.Required {
+				attrs = append(attrs, "required")
+			}
+			if len(arg.Enum) > 0 {
+				attrs = append(attrs, "one of: "+strings.Join(arg.Enum, ", "))
+			}
+			if arg.Default != "" {
+				attrs = append(attrs, "default: "+arg.Default)
+			}
+
+			fmt.Printf("      %s <%s> %s", arg.Name, arg.Type, arg.Description)
+			if len(attrs) > 0 {
+				fmt.Printf(" (%s)", strings.Join(attrs, "; "))
+			}
+			fmt.Println()
+		}
+	}
+}
+
+func printConverterInfosJSON(input, output []*lib.ConverterInfo) {
+	printJSON(struct {
+		Input  []*lib.ConverterInfo `json:"input"`
+		Output []*lib.ConverterInfo `json:"output"`
+	}{
+		Input:  input,
+		Output: output,
+	})
+}
@@ -2,10 +2,11 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
 	"fmt"
-	"log"
-	"net/netip"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/Loyalsoldier/geoip/lib"
@@ -26,15 +27,18 @@ var supportedInputFormats = map[string]bool{
 func init() {
 	rootCmd.AddCommand(lookupCmd)
 
-	lookupCmd.Flags().StringP("format", "f", "", "(Required) The input format. Available formats: text, v2rayGeoIPDat, maxmindMMDB, mihomoMRS, singboxSRS, clashRuleSet, clashRuleSetClassical, surgeRuleSet")
+	lookupCmd.Flags().StringP("format", "f", "", "The input format, required unless \"config\" flag is used. Available formats: text, v2rayGeoIPDat, maxmindMMDB, mihomoMRS, singboxSRS, clashRuleSet, clashRuleSetClassical, surgeRuleSet")
 	lookupCmd.Flags().StringP("uri", "u", "", "URI of the input file, support both local file path and remote HTTP(S) URL. (Cannot be used with \"dir\" flag)")
 	lookupCmd.Flags().StringP("dir", "d", "", "Path to the input directory. The filename without extension will be as the name of the list. (Cannot be used with \"uri\" flag)")
+	lookupCmd.Flags().StringP("config", "c", "", "URI of the config file, the lists generated by the inputs of which are searched from. (Cannot be used with \"uri\" or \"dir\" flag)")
 	lookupCmd.Flags().StringSliceP("searchlist", "l", []string{}, "The lists to search from, separated by comma")
+	lookupCmd.Flags().String("why", "", "IP or CIDR to look up and explain which inputs added or removed it in each list")
 
-	lookupCmd.MarkFlagRequired("format")
-	lookupCmd.MarkFlagsOneRequired("uri", "dir")
-	lookupCmd.MarkFlagsMutuallyExclusive("uri", "dir")
+	lookupCmd.MarkFlagsOneRequired("uri", "dir", "config")
+	lookupCmd.MarkFlagsMutuallyExclusive("uri", "dir", "config")
 	lookupCmd.MarkFlagDirname("dir")
+	lookupCmd.MarkFlagFilename("config", "json", "yaml", "yml", "toml")
+	lookupCmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions([]string{"text", "v2rayGeoIPDat", "maxmindMMDB", "mihomoMRS", "singboxSRS", "clashRuleSet", "clashRuleSetClassical", "surgeRuleSet"}, cobra.ShellCompDirectiveNoFileComp))
 }
 
 var lookupCmd = &cobra.Command{
@@ -43,11 +47,21 @@ var lookupCmd = &cobra.Command{
 	Short:   "Lookup if specified IP or CIDR is in specified lists",
 	Args:    cobra.RangeArgs(0, 1),
 	Run: func(cmd *cobra.Command, args []string) {
+		// Get config
+		configFile, _ := cmd.Flags().GetString("config")
+
+		// Get why
+		why, _ := cmd.Flags().GetString("why")
+		why = strings.ToLower(strings.TrimSpace(why))
+		if why != "" && len(args) > 0 {
+			fatal("the IP or CIDR to search must be specified either as argument or by \"why\" flag")
+		}
+
 		// Validate format
 		format, _ := cmd.Flags().GetString("format")
 		format = strings.ToLower(strings.TrimSpace(format))
-		if _, found := supportedInputFormats[format]; !found {
-			log.Fatal("unsupported input format")
+		if _, found := supportedInputFormats[format]; !found && configFile == "" {
+			fatal("unsupported input format")
 		}
 
 		// Set name
@@ -66,15 +80,52 @@ var lookupCmd = &cobra.Command{
 			searchListStr = fmt.Sprint(`"`, searchListStr, `"`) // `"cn", "en"`
 		}
 
+		// Set output format
+		outputFormat := outputFormatText
+		if isJSONOutput(cmd) {
+			outputFormat = outputFormatJSON
+		}
+
+		if configFile != "" || why != "" {
+			container, provenance := runLookupInputs(cmd.Context(), configFile, format, name, uri, dir, why)
+			search := why
+			if len(args) > 0 {
+				search = strings.ToLower(strings.TrimSpace(args[0]))
+			}
+			if search != "" {
+				lookupInContainer(container, provenance, search, searchList, outputFormat)
+				return
+			}
+
+			fmt.Println(`Enter IP or CIDR (type "exit" to quit):`)
+			fmt.Print(">> ")
+			scanner := bufio.NewScanner(os.Stdin)
+			for scanner.Scan() {
+				search := strings.ToLower(strings.TrimSpace(scanner.Text()))
+				if search == "exit" || search == `"exit"` {
+					break
+				}
+				if search != "" {
+					lookupInContainer(container, provenance, search, searchList, outputFormat)
+				}
+				fmt.Println()
+				fmt.Print(">> ")
+			}
+			if err := scanner.Err(); err != nil {
+				fatal(err)
+			}
+			return
+		}
+
 		switch len(args) > 0 {
 		case true: // With search arg, run in once mode
 			search := strings.ToLower(strings.TrimSpace(args[0]))
 			if !isValidIPOrCIDR(search) {
-				fmt.Println("false")
+				printNotFound(search, outputFormat)
 				return
 			}
 
-			execute(format, name, uri, dir, search, searchListStr)
+			execute(cmd.Context(), format, name, uri, dir, search, searchListStr, outputFormat)
 
 		case false: // No search arg, run in REPL mode
 			fmt.Println(`Enter IP or CIDR (type "exit" to quit):`)
@@ -92,19 +143,19 @@ var lookupCmd = &cobra.Command{
 				}
 
 				if !isValidIPOrCIDR(search) {
-					fmt.Println("false")
+					printNotFound(search, outputFormat)
 					fmt.Println()
 					fmt.Print(">> ")
 					continue
 				}
 
-				execute(format, name, uri, dir, search, searchListStr)
+				execute(cmd.Context(), format, name, uri, dir, search, searchListStr, outputFormat)
 
 				fmt.Println()
 				fmt.Print(">> ")
 			}
 			if err := scanner.Err(); err != nil {
-				log.Fatal(err)
+				fatal(err)
 			}
 		}
 	},
@@ -116,58 +167,175 @@ func isValidIPOrCIDR(search string) bool {
 		return false
 	}
 
-	var err error
-	switch strings.Contains(search, "/") {
-	case true: // CIDR
-		_, err = netip.ParsePrefix(search)
-	case false: // IP
-		_, err = netip.ParseAddr(search)
-	}
-
+	_, _, err := lib.ParsePrefix(search)
 	return err == nil
 }
 
-func execute(format, name, uri, dir, search, searchListStr string) {
-	config := generateConfigForLookup(format, name, uri, dir, search, searchListStr)
+// Print the result of a search target not found in any list
+func printNotFound(search, outputFormat string) {
+	if outputFormat == outputFormatJSON {
+		result, _ := json.Marshal(struct {
+			Search string   `json:"search"`
+			Found  bool     `json:"found"`
+			Lists  []string `json:"lists"`
+		}{
+			Search: search,
+			Lists:  []string{},
+		})
+		fmt.Println(string(result))
+		return
+	}
+	fmt.Println("false")
+}
+
+func execute(ctx context.Context, format, name, uri, dir, search, searchListStr, outputFormat string) {
+	config := generateConfigForLookup(format, name, uri, dir, search, searchListStr, outputFormat)
 
 	instance, err := lib.NewInstance()
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 
 	if err := instance.InitFromBytes([]byte(config)); err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 
-	if err := instance.Run(); err != nil {
-		log.Fatal(err)
+	if err := instance.Run(ctx); err != nil {
+		fatal(err)
 	}
 }
 
-func generateConfigForLookup(format, name, uri, dir, search, searchListStr string) string {
-	return fmt.Sprintf(`
-{
-	"input": [
-		{
-			"type": "%s",
-			"action": "add",
-			"args": {
-				"name": "%s",
-				"uri": "%s",
-				"inputDir": "%s"
+// runLookupInputs runs the inputs of config file, or the input generated
+// from the flags if configFile is empty, and returns the generated lists
+// and the provenance of them if why is not empty.
+func runLookupInputs(ctx context.Context, configFile, format, name, uri, dir, why string) (lib.Container, *lib.Provenance) {
+	instance, err := lib.NewInstance()
+	if err != nil {
+		fatal(err)
+	}
+
+	if configFile != "" {
+		err = instance.Init(configFile)
+	} else {
+		err = instance.InitFromBytes([]byte(generateConfigForLookup(format, name, uri, dir, why, "", outputFormatText)))
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	if why != "" {
+		instance.EnableProvenance()
+	}
+	container, err := instance.RunInput(ctx)
+	if err != nil {
+		fatal(err)
+	}
+
+	if why == "" {
+		return container, nil
+	}
+	return container, instance.Provenance()
+}
+
+// lookupInContainer prints the lists in container containing search,
+// followed by the changes made to them by inputs if provenance is not nil.
+func lookupInContainer(container lib.Container, provenance *lib.Provenance, search string, searchList []string, outputFormat string) {
+	if !isValidIPOrCIDR(search) {
+		printNotFound(search, outputFormat)
+		return
+	}
+
+	lists, found, err := container.Lookup(search, searchList...)
+	if err != nil {
+		fatal(err)
+	}
+	slices.Sort(lists)
+	for idx := range lists {
+		lists[idx] = strings.ToLower(lists[idx])
+	}
+
+	var records []*lib.ProvenanceRecord
+	if provenance != nil {
+		if records, err = provenance.Why(search); err != nil {
+			fatal(err)
+		}
+		if len(searchList) > 0 {
+			filter, err := lib.NewListFilter(searchList)
+			if err != nil {
+				fatal(err)
 			}
+			records = slices.DeleteFunc(records, func(record *lib.ProvenanceRecord) bool {
+				return !filter.Match(record.List)
+			})
+		}
+	}
+
+	if outputFormat == outputFormatJSON {
+		result, _ := json.Marshal(struct {
+			Search     string                  `json:"search"`
+			Found      bool                    `json:"found"`
+			Lists      []string                `json:"lists"`
+			Provenance []*lib.ProvenanceRecord `json:"provenance,omitempty"`
+		}{
+			Search:     search,
+			Found:      found,
+			Lists:      append([]string{}, lists...),
+			Provenance: records,
+		})
+		fmt.Println(string(result))
+		return
+	}
+
+	if found {
+		fmt.Println(strings.Join(lists, ","))
+	} else {
+		fmt.Println("false")
+	}
+	for _, record := range records {
+		fmt.Println("  " + record.String())
+	}
+}
+
+func generateConfigForLookup(format, name, uri, dir, search, searchListStr, outputFormat string) string {
+	// Only the args set are written, as the text inputs do not allow
+	// inputDir to be used with name or uri, and only those taking a name
+	// are given the name
+	args := make(map[string]string, 2)
+	if dir != "" {
+		args["inputDir"] = dir
+	} else {
+		if hasInputArg(format, "name") {
+			args["name"] = name
 		}
-	],
+		args["uri"] = uri
+	}
+	input, _ := json.Marshal(map[string]any{"type": format, "action": "add", "args": args})
+	searchJSON, _ := json.Marshal(search)
+
+	return fmt.Sprintf(`
+{
+	"input": [%s],
 	"output": [
 		{
 			"type": "lookup",
 			"action": "output",
 			"args": {
-				"search": "%s",
-				"searchList": [%s]
+				"search": %s,
+				"searchList": [%s],
+				"outputFormat": "%s"
 			}
 		}
 	]
 }
-`, format, name, uri, dir, search, searchListStr)
+`, input, searchJSON, searchListStr, outputFormat)
+}
+
+// hasInputArg reports whether the input converter of format takes the arg.
+func hasInputArg(format, arg string) bool {
+	for _, info := range lib.InputConverterInfos() {
+		if strings.EqualFold(info.Name, format) {
+			return slices.ContainsFunc(info.Args, func(a lib.Arg) bool { return a.Name == arg })
+		}
+	}
+	return false
 }
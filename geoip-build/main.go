@@ -1,21 +1,224 @@
 package main
 
 import (
-	"log"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/Loyalsoldier/geoip/lib"
 	"github.com/spf13/cobra"
 )
 
+const (
+	outputFormatText = "text"
+	outputFormatJSON = "json"
+)
+
+var (
+	// errorReportFile is the path to write the error report to when the command fails.
+	errorReportFile string
+	// runInstance is the instance run by the command, the failed and skipped
+	// input converters of which are reported when the command fails.
+	runInstance *lib.Instance
+	// notifier and metricsExporter report the build run by the command when it fails,
+	// started at runStart with the config file runConfig.
+	notifier        *lib.Notifier
+	metricsExporter *lib.MetricsExporter
+	runConfig       string
+	runStart        time.Time
+	// invalidLinesFile is the path to write the report of the invalid lines
+	// of the sources of runInstance to, whether the command fails or not.
+	invalidLinesFile string
+)
+
+func init() {
+	rootCmd.PersistentFlags().String("output", outputFormatText, "Output format of command results, available options: \"text\", \"json\"")
+	rootCmd.PersistentFlags().String("log-level", "info", "Minimum level of logs, available options: \"debug\", \"info\", \"warn\", \"error\"")
+	rootCmd.PersistentFlags().String("log-format", lib.LogFormatText, "Format of logs, available options: \"text\", \"json\"")
+	rootCmd.PersistentFlags().Int64("build-epoch", 0, "Build timestamp as Unix epoch value embedded in outputs for reproducible builds, defaults to the SOURCE_DATE_EPOCH environment variable or the current time")
+	rootCmd.PersistentFlags().String("error-report", "", "Path to the JSON file describing what failed where, written when the command fails")
+	rootCmd.PersistentFlags().Bool("no-progress", false, "Disable progress reporting, which is also disabled when stderr is not a terminal or the CI environment variable is set")
+	rootCmd.PersistentFlags().StringArray("header", []string{}, "Header sent with the requests to remote sources and config files in the form of [host=]Name: Value, e.g. \"raw.githubusercontent.com=Authorization: Bearer ${GITHUB_TOKEN}\" with environment variables expanded, can be used multiple times")
+	rootCmd.PersistentFlags().StringArray("host-limit", []string{}, "Limit of the requests to a host of remote sources and config files in the form of host=concurrency[,rate], e.g. \"api.ripe.net=2,1/s\" for at most 2 concurrent requests and 1 request per second, can be used multiple times")
+	rootCmd.PersistentFlags().String("doh", "", "URL of the DNS-over-HTTPS endpoint resolving the hostnames of remote sources instead of the system resolver, e.g. \"https://dns.google/dns-query\"")
+	rootCmd.PersistentFlags().String("doh-bootstrap", "", "IP to connect to the DNS-over-HTTPS endpoint at, required if the host of the endpoint is not an IP, e.g. \"8.8.8.8\"")
+	rootCmd.PersistentFlags().String("mapped-ipv4", lib.MappedIPv4AsIPv4, "How IPv4-mapped IPv6 addresses and CIDRs like ::ffff:1.2.3.4 are added to the lists, available options: \"ipv4\" to convert them to IPv4, \"ipv6\" to keep them as IPv6, for the configs and inputs not specifying mappedIPv4")
+	rootCmd.PersistentFlags().String("file-mode", "0644", "Permission bits in octal of the written files, directories created for them are also searchable wherever readable, e.g. \"0640\" for 0750 directories")
+	rootCmd.PersistentFlags().String("cpuprofile", "", "Path to write the CPU profile of the command to, for analysis with \"go tool pprof\"")
+	rootCmd.PersistentFlags().String("memprofile", "", "Path to write the heap profile to when the command exits, for analysis with \"go tool pprof\"")
+	rootCmd.MarkPersistentFlagFilename("error-report", "json")
+	rootCmd.MarkPersistentFlagFilename("cpuprofile")
+	rootCmd.MarkPersistentFlagFilename("memprofile")
+	rootCmd.RegisterFlagCompletionFunc("output", cobra.FixedCompletions([]string{outputFormatText, outputFormatJSON}, cobra.ShellCompDirectiveNoFileComp))
+	rootCmd.RegisterFlagCompletionFunc("log-level", cobra.FixedCompletions([]string{"debug", "info", "warn", "error"}, cobra.ShellCompDirectiveNoFileComp))
+	rootCmd.RegisterFlagCompletionFunc("log-format", cobra.FixedCompletions([]string{lib.LogFormatText, lib.LogFormatJSON}, cobra.ShellCompDirectiveNoFileComp))
+}
+
 var rootCmd = &cobra.Command{
 	Use:   "geoip",
 	Short: "geoip is a convenient tool to merge, convert and lookup IP & CIDR from various formats of geoip data.",
-	CompletionOptions: cobra.CompletionOptions{
-		HiddenDefaultCmd: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		switch format, _ := cmd.Flags().GetString("output"); format {
+		case outputFormatText, outputFormatJSON:
+		default:
+			return fmt.Errorf("invalid argument output: %s", format)
+		}
+
+		logLevel, _ := cmd.Flags().GetString("log-level")
+		logFormat, _ := cmd.Flags().GetString("log-format")
+		if err := lib.SetupLogger(os.Stderr, logLevel, logFormat); err != nil {
+			return err
+		}
+
+		buildEpoch, _ := cmd.Flags().GetInt64("build-epoch")
+		if buildEpoch < 0 {
+			return fmt.Errorf("invalid argument build-epoch: %d", buildEpoch)
+		}
+		lib.SetBuildEpoch(buildEpoch)
+
+		mode, _ := cmd.Flags().GetString("file-mode")
+		fileMode, err := lib.ParseFileMode(mode)
+		if err != nil {
+			return err
+		}
+		lib.SetFileMode(fileMode)
+
+		errorReportFile, _ = cmd.Flags().GetString("error-report")
+
+		noProgress, _ := cmd.Flags().GetBool("no-progress")
+		_, ci := os.LookupEnv("CI")
+		lib.SetProgress(!noProgress && !ci && logFormat == lib.LogFormatText && lib.IsTerminal(os.Stderr))
+
+		headerFlags, _ := cmd.Flags().GetStringArray("header")
+		headers := make([]*lib.SourceHeader, 0, len(headerFlags))
+		for _, flag := range headerFlags {
+			header, err := lib.ParseSourceHeader(flag)
+			if err != nil {
+				return err
+			}
+			headers = append(headers, header)
+		}
+		lib.SetSourceHeaders(headers)
+
+		hostLimitFlags, _ := cmd.Flags().GetStringArray("host-limit")
+		hostLimits := make([]*lib.HostLimit, 0, len(hostLimitFlags))
+		for _, flag := range hostLimitFlags {
+			limit, err := lib.ParseHostLimit(flag)
+			if err != nil {
+				return err
+			}
+			hostLimits = append(hostLimits, limit)
+		}
+		lib.SetHostLimits(hostLimits)
+
+		mappedIPv4, _ := cmd.Flags().GetString("mapped-ipv4")
+		if err := lib.SetMappedIPv4(mappedIPv4); err != nil {
+			return err
+		}
+
+		doh, _ := cmd.Flags().GetString("doh")
+		dohBootstrap, _ := cmd.Flags().GetString("doh-bootstrap")
+		if err := lib.SetDoH(doh, dohBootstrap); err != nil {
+			return err
+		}
+
+		cpuProfile, _ := cmd.Flags().GetString("cpuprofile")
+		memProfile, _ := cmd.Flags().GetString("memprofile")
+		return startProfiling(cpuProfile, memProfile)
 	},
 }
 
 func main() {
-	if err := rootCmd.Execute(); err != nil {
-		log.Fatal(err)
+	// Commands are canceled on SIGINT or SIGTERM, so that no output file is
+	// left half-written
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
+		fatal(err)
+	}
+	stopProfiling()
+}
+
+// isJSONOutput reports whether the results of cmd should be printed in JSON format.
+func isJSONOutput(cmd *cobra.Command) bool {
+	format, _ := cmd.Flags().GetString("output")
+	return format == outputFormatJSON
+}
+
+// printJSON writes v to stdout in indented JSON format.
+func printJSON(v any) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		fatal(err)
+	}
+}
+
+// fatal logs the error message at error level and exits.
+func fatal(v ...any) {
+	if len(v) == 1 {
+		if err, ok := v[0].(error); ok {
+			exit(err)
+		}
+	}
+	exit(errors.New(fmt.Sprint(v...)))
+}
+
+// fatalf logs the formatted error message at error level and exits.
+func fatalf(format string, v ...any) {
+	exit(fmt.Errorf(format, v...))
+}
+
+// exit logs err at error level, writes the error report if requested,
+// and exits with the exit code of the kind of err.
+func exit(err error) {
+	slog.Error(err.Error())
+
+	var failures []*lib.SourceFailure
+	if runInstance != nil {
+		failures = runInstance.Failures()
+	}
+
+	if notifier != nil {
+		if err := notifier.Notify(lib.NewBuildReport(runConfig, runStart, nil, err, failures)); err != nil {
+			slog.Error("❌ failed to send notifications: "+err.Error(), "config", runConfig)
+		}
+	}
+
+	if metricsExporter != nil {
+		if err := metricsExporter.Export(runInstance, runStart, err); err != nil {
+			slog.Error("❌ failed to export metrics: "+err.Error(), "config", runConfig)
+		}
+	}
+
+	if invalidLinesFile != "" && runInstance != nil {
+		if err := runInstance.WriteInvalidLines(invalidLinesFile); err != nil {
+			slog.Error(fmt.Sprintf("failed to write invalid lines report: %v", err), "file", invalidLinesFile)
+		}
+	}
+
+	if errorReportFile != "" {
+		if err := writeErrorReport(errorReportFile, lib.NewErrorReport(err, failures)); err != nil {
+			slog.Error(fmt.Sprintf("failed to write error report: %v", err), "file", errorReportFile)
+		}
+	}
+
+	lib.RemoveDownloadCache()
+	stopProfiling()
+	os.Exit(lib.ExitCode(err))
+}
+
+func writeErrorReport(file string, report *lib.ErrorReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
 	}
+	return os.WriteFile(file, append(data, '\n'), lib.FileMode())
 }
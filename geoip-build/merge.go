@@ -1,7 +1,6 @@
 package main
 
 import (
-	"log"
 	"strings"
 
 	"github.com/Loyalsoldier/geoip/lib"
@@ -88,7 +87,7 @@ var mergeCmd = &cobra.Command{
 		otype = strings.ToLower(strings.TrimSpace(otype))
 
 		if otype != "" && otype != "ipv4" && otype != "ipv6" {
-			log.Fatal("invalid argument onlyiptype: ", otype)
+			fatal("invalid argument onlyiptype: ", otype)
 		}
 
 		var configBytes []byte
@@ -103,15 +102,15 @@ var mergeCmd = &cobra.Command{
 
 		instance, err := lib.NewInstance()
 		if err != nil {
-			log.Fatal(err)
+			fatal(err)
 		}
 
 		if err := instance.InitFromBytes(configBytes); err != nil {
-			log.Fatal(err)
+			fatal(err)
 		}
 
-		if err := instance.Run(); err != nil {
-			log.Fatal(err)
+		if err := instance.Run(cmd.Context()); err != nil {
+			fatal(err)
 		}
 	},
 }
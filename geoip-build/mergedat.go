@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/Loyalsoldier/geoip/lib"
+	"github.com/spf13/cobra"
+)
+
+const (
+	mergePolicyUnion       = "union"
+	mergePolicyPreferFirst = "prefer-first"
+	mergePolicyError       = "error"
+)
+
+func init() {
+	rootCmd.AddCommand(mergeDatCmd)
+
+	mergeDatCmd.Flags().StringP("outputfile", "o", "./output/dat/geoip.dat", "Path to the merged V2Ray GeoIP dat file")
+	mergeDatCmd.Flags().StringP("policy", "p", mergePolicyUnion, "Policy for lists existing in more than one file, available options: \"union\", \"prefer-first\", \"error\"")
+}
+
+var mergeDatCmd = &cobra.Command{
+	Use:   "merge-dat file1.dat file2.dat [...]",
+	Short: "Merge multiple V2Ray GeoIP dat files into one, support both local file path and remote HTTP(S) URL",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("outputfile")
+		policy, _ := cmd.Flags().GetString("policy")
+		policy = strings.ToLower(strings.TrimSpace(policy))
+
+		switch policy {
+		case mergePolicyUnion, mergePolicyPreferFirst, mergePolicyError:
+		default:
+			fatal("invalid argument policy: ", policy)
+		}
+
+		merged := lib.NewContainer()
+		for _, uri := range args {
+			container, err := readDatFile(cmd.Context(), uri)
+			if err != nil {
+				fatal(err)
+			}
+
+			for entry := range container.Loop() {
+				if _, found := merged.GetEntry(entry.GetName()); found {
+					switch policy {
+					case mergePolicyPreferFirst:
+						log.Printf("list %s in %s is skipped as it already exists", entry.GetName(), uri)
+						continue
+					case mergePolicyError:
+						fatalf("list %s in %s already exists", entry.GetName(), uri)
+					}
+				}
+
+				if err := merged.Add(entry); err != nil {
+					fatal(err)
+				}
+			}
+		}
+
+		if err := writeDatFile(cmd.Context(), output, merged); err != nil {
+			fatal(err)
+		}
+	},
+}
+
+func readDatFile(ctx context.Context, uri string) (lib.Container, error) {
+	config := fmt.Sprintf(`{"input": [{"type": "v2rayGeoIPDat", "action": "add", "args": {"uri": %s}}]}`, jsonString(uri))
+
+	instance, err := lib.NewInstance()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := instance.InitFromBytes([]byte(config)); err != nil {
+		return nil, err
+	}
+
+	return instance.RunInput(ctx)
+}
+
+func writeDatFile(ctx context.Context, path string, container lib.Container) error {
+	config := fmt.Sprintf(`{"output": [{"type": "v2rayGeoIPDat", "action": "output", "args": {"outputDir": %s, "outputName": %s}}]}`,
+		jsonString(filepath.Dir(path)), jsonString(filepath.Base(path)))
+
+	instance, err := lib.NewInstance()
+	if err != nil {
+		return err
+	}
+
+	if err := instance.InitFromBytes([]byte(config)); err != nil {
+		return err
+	}
+
+	return instance.RunOutput(ctx, container)
+}
+
+func jsonString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
@@ -0,0 +1,248 @@
+// Package geoip runs geoip builds in-process with the same config files,
+// converters and pipeline as the geoip command, so that Go programs do not
+// have to shell out to it. Importing it registers all built-in converters.
+//
+// The sources and artifacts recorded by a build, the OutputFS and the
+// standard output are shared by the process, so only one build runs at a
+// time: the Build, Input and Output methods of all Builders, SetOutputFS and
+// SetStdout wait for the running one to return.
+package geoip
+
+import (
+	"context"
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/Loyalsoldier/geoip/lib"
+	_ "github.com/Loyalsoldier/geoip/plugin/maxmind"
+	_ "github.com/Loyalsoldier/geoip/plugin/plaintext"
+	_ "github.com/Loyalsoldier/geoip/plugin/special"
+	_ "github.com/Loyalsoldier/geoip/plugin/v2ray"
+)
+
+type (
+	// Container is the lists generated by input converters and read by output converters.
+	Container = lib.Container
+	// Entry is a list of IPv4 and IPv6 CIDRs.
+	Entry = lib.Entry
+	// Summary is the stats of the lists and the artifacts of a build.
+	Summary = lib.Summary
+	// Artifact is a file written by an output converter.
+	Artifact = lib.Artifact
+	// SourceFailure is an input converter skipped because it failed.
+	SourceFailure = lib.SourceFailure
+
+	// Action is the action of a converter, i.e. "add", "remove" or "output".
+	Action = lib.Action
+	// InputConverter reads a format into the lists of a container.
+	InputConverter = lib.InputConverter
+	// OutputConverter writes the lists of a container in a format.
+	OutputConverter = lib.OutputConverter
+	// InputConfigCreator creates an input converter from the args in config file.
+	InputConfigCreator = lib.InputConfigCreator
+	// OutputConfigCreator creates an output converter from the args in config file.
+	OutputConfigCreator = lib.OutputConfigCreator
+
+	// OutputFS is a file system outputs are written to.
+	OutputFS = lib.OutputFS
+	// OutputFile is a file being written to an OutputFS.
+	OutputFile = lib.OutputFile
+	// MemFS is an OutputFS keeping files in memory.
+	MemFS = lib.MemFS
+)
+
+// buildMu serializes builds, as they share the state of the process.
+var buildMu sync.Mutex
+
+// RegisterInput registers an input format of type iType for config files of
+// all builds, so that formats can be added without patching the built-in
+// plugins. info describes the format, e.g. with its description and args if
+// it implements lib.Argumenter, and create creates its input converters.
+// It must be called before builds are created, typically in an init function.
+func RegisterInput(iType string, info InputConverter, create InputConfigCreator) error {
+	return lib.RegisterInput(iType, info, create)
+}
+
+// RegisterOutput registers an output format of type oType, like RegisterInput.
+func RegisterOutput(oType string, info OutputConverter, create OutputConfigCreator) error {
+	return lib.RegisterOutput(oType, info, create)
+}
+
+// SetOutputFS sets the file system outputs of all builds are written to, e.g.
+// a MemFS for in-memory builds, or restores the local disk if fsys is nil.
+func SetOutputFS(fsys OutputFS) {
+	buildMu.Lock()
+	defer buildMu.Unlock()
+	lib.SetOutputFS(fsys)
+}
+
+// NewMemFS returns an empty MemFS.
+func NewMemFS() *MemFS {
+	return lib.NewMemFS()
+}
+
+// SetStdout sets the writer outputs of all builds writing to the standard
+// output write to instead, e.g. for the stdout and lookup outputs, or
+// restores the standard output if w is nil.
+func SetStdout(w io.Writer) {
+	buildMu.Lock()
+	defer buildMu.Unlock()
+	lib.SetStdout(w)
+}
+
+// NewContainer returns an empty container.
+func NewContainer() Container {
+	return lib.NewContainer()
+}
+
+// NewEntry returns an empty list with name.
+func NewEntry(name string) *Entry {
+	return lib.NewEntry(name)
+}
+
+// Options are the options of builds, the zero value of which uses the same
+// defaults as the convert command.
+type Options struct {
+	// Jobs is the max number of inputs parsed concurrently, which defaults
+	// to the number of CPUs. 1 parses them one by one.
+	Jobs int
+	// OutputJobs is the max number of outputs written concurrently, which
+	// defaults to the number of CPUs. 1 writes them one by one.
+	OutputJobs int
+	// MaxFailures is the number of failed inputs not marked as optional to
+	// be skipped before a build fails.
+	MaxFailures int
+	// MaxMemory is the memory in bytes a build should fit in, or 0 for no limit.
+	MaxMemory int64
+	// ParseCacheDir is the directory to cache parsed inputs in, if not empty.
+	ParseCacheDir string
+	// IncrementalFile is the state file of incremental builds, if not empty.
+	IncrementalFile string
+
+	// Attributions, Manifest and Checksums are the paths to the files of the
+	// licenses and attributions of inputs, the JSON manifest of outputs, and
+	// the checksums of outputs written after each build, if not empty.
+	Attributions string
+	Manifest     string
+	Checksums    string
+	// ChecksumFiles writes a ".sha256" file next to each output.
+	ChecksumFiles bool
+}
+
+// Builder runs builds of a config.
+type Builder struct {
+	opts     Options
+	instance *lib.Instance
+}
+
+// New returns a Builder of the JSON, YAML or TOML format config content.
+func New(content []byte, opts *Options) (*Builder, error) {
+	instance, err := lib.NewInstance()
+	if err != nil {
+		return nil, err
+	}
+	if err := instance.InitFromBytes(content); err != nil {
+		return nil, err
+	}
+
+	b := &Builder{instance: instance}
+	if opts != nil {
+		b.opts = *opts
+	}
+	if b.opts.Jobs == 0 {
+		b.opts.Jobs = runtime.NumCPU()
+	}
+	if b.opts.OutputJobs == 0 {
+		b.opts.OutputJobs = runtime.NumCPU()
+	}
+
+	instance.SetMaxFailures(b.opts.MaxFailures)
+	instance.SetConcurrency(b.opts.Jobs)
+	instance.SetOutputConcurrency(b.opts.OutputJobs)
+	instance.SetMaxMemory(b.opts.MaxMemory)
+	if b.opts.ParseCacheDir != "" {
+		cache, err := lib.NewParseCache(b.opts.ParseCacheDir)
+		if err != nil {
+			return nil, err
+		}
+		instance.SetParseCache(cache)
+	}
+	if b.opts.IncrementalFile != "" {
+		incremental, err := lib.NewIncremental(b.opts.IncrementalFile)
+		if err != nil {
+			return nil, err
+		}
+		instance.SetIncremental(incremental)
+	}
+
+	return b, nil
+}
+
+// NewFromFile returns a Builder of the config file at uri, which is either a
+// local file path or a remote HTTP(S) URL.
+func NewFromFile(uri string, opts *Options) (*Builder, error) {
+	content, err := lib.ReadConfig(uri)
+	if err != nil {
+		return nil, err
+	}
+	return New(content, opts)
+}
+
+// Build runs all input and output converters, and writes the attributions,
+// manifest and checksums of the build if specified by the options. Once ctx
+// is done, the build stops without replacing any output file half-written,
+// and returns the error of ctx.
+func (b *Builder) Build(ctx context.Context) (*Summary, error) {
+	buildMu.Lock()
+	defer buildMu.Unlock()
+
+	if err := b.instance.Run(ctx); err != nil {
+		return nil, err
+	}
+
+	if b.opts.Attributions != "" {
+		if err := b.instance.WriteAttributions(b.opts.Attributions); err != nil {
+			return nil, err
+		}
+	}
+	if b.opts.Manifest != "" {
+		if err := b.instance.WriteManifest(b.opts.Manifest); err != nil {
+			return nil, err
+		}
+	}
+	if err := lib.WriteChecksums(b.opts.Checksums, b.opts.ChecksumFiles); err != nil {
+		return nil, err
+	}
+
+	return b.instance.Summary()
+}
+
+// Input runs all input converters only and returns the generated lists,
+// which can be changed before being given to Output.
+func (b *Builder) Input(ctx context.Context) (Container, error) {
+	buildMu.Lock()
+	defer buildMu.Unlock()
+	return b.instance.RunInput(ctx)
+}
+
+// Output runs all output converters only with container.
+func (b *Builder) Output(ctx context.Context, container Container) error {
+	if container == nil {
+		return errors.New("container must not be nil")
+	}
+	buildMu.Lock()
+	defer buildMu.Unlock()
+	return b.instance.RunOutput(ctx, container)
+}
+
+// Failures returns the input converters skipped because they failed in the last build.
+func (b *Builder) Failures() []*SourceFailure {
+	return b.instance.Failures()
+}
+
+// Instance returns the underlying instance, for the features not covered by Builder.
+func (b *Builder) Instance() *lib.Instance {
+	return b.instance
+}
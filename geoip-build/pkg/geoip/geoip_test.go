@@ -0,0 +1,122 @@
+package geoip_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Loyalsoldier/geoip/pkg/geoip"
+)
+
+func init() {
+	geoip.RegisterOutput(typeSlowOut, &slowOut{}, func(geoip.Action, json.RawMessage) (geoip.OutputConverter, error) {
+		return &slowOut{}, nil
+	})
+}
+
+const typeSlowOut = "testSlow"
+
+// slowOut is an output taking a while and writing nothing, which records
+// whether several of them run at the same time.
+type slowOut struct{}
+
+var (
+	slowOutRunning atomic.Int32
+	slowOutOverlap atomic.Bool
+)
+
+func (s *slowOut) GetType() string         { return typeSlowOut }
+func (s *slowOut) GetAction() geoip.Action { return "output" }
+func (s *slowOut) GetDescription() string  { return "Take a while and write nothing" }
+func (s *slowOut) Output(ctx context.Context, container geoip.Container) error {
+	if slowOutRunning.Add(1) > 1 {
+		slowOutOverlap.Store(true)
+	}
+	defer slowOutRunning.Add(-1)
+	time.Sleep(20 * time.Millisecond)
+	return nil
+}
+
+// testConfig returns a config of a list name of cidrs written as text to
+// outputDir, and the outputs of types extra.
+func testConfig(name, outputDir string, cidrs []string, extra ...string) []byte {
+	outputs := fmt.Sprintf(`{"type": "text", "action": "output", "args": {"outputDir": %q}}`, outputDir)
+	for _, oType := range extra {
+		outputs += fmt.Sprintf(`, {"type": %q, "action": "output"}`, oType)
+	}
+	return fmt.Appendf(nil, `{
+		"input": [{"type": "text", "action": "add", "args": {"name": %q, "ipOrCIDR": [%s]}}],
+		"output": [%s]
+	}`, name, `"`+strings.Join(cidrs, `", "`)+`"`, outputs)
+}
+
+func TestBuilderMemFS(t *testing.T) {
+	fsys := geoip.NewMemFS()
+	geoip.SetOutputFS(fsys)
+	t.Cleanup(func() { geoip.SetOutputFS(nil) })
+
+	b, err := geoip.New(testConfig("cn", "./output", []string{"1.0.0.0/24", "1.0.1.0/24", "2001:db8::/32"}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := b.Build(context.Background())
+	if err != nil {
+		t.Fatalf("Build error = %v", err)
+	}
+
+	content, err := fsys.ReadFile("output/cn.txt")
+	if err != nil {
+		t.Fatalf("output is not written to MemFS: %v", err)
+	}
+	if got, want := string(content), "1.0.0.0/23\n2001:db8::/32\n"; got != want {
+		t.Errorf("output/cn.txt = %q, want %q", got, want)
+	}
+
+	if len(summary.Lists) != 1 || summary.Lists[0].Name != "CN" {
+		t.Errorf("summary lists = %v, want list CN", summary.Lists)
+	}
+	if len(summary.Artifacts) != 1 || summary.Artifacts[0].Path != "output/cn.txt" {
+		t.Errorf("summary artifacts = %v, want output/cn.txt", summary.Artifacts)
+	}
+}
+
+func TestBuilderConcurrent(t *testing.T) {
+	fsys := geoip.NewMemFS()
+	geoip.SetOutputFS(fsys)
+	t.Cleanup(func() { geoip.SetOutputFS(nil) })
+
+	// Builds run one by one, so the summary of each has only its artifacts
+	var wg sync.WaitGroup
+	for i := range 8 {
+		b, err := geoip.New(testConfig(fmt.Sprintf("list%d", i), fmt.Sprintf("./output%d", i), []string{"192.0.2.0/24"}, typeSlowOut), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			summary, err := b.Build(context.Background())
+			if err != nil {
+				t.Errorf("Build error = %v", err)
+				return
+			}
+			want := fmt.Sprintf("output%d/list%d.txt", i, i)
+			if len(summary.Artifacts) != 1 || summary.Artifacts[0].Path != want {
+				t.Errorf("summary artifacts = %v, want %s", summary.Artifacts, want)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if slowOutOverlap.Load() {
+		t.Error("builds ran at the same time, want one by one")
+	}
+	if names := fsys.Names(); len(names) != 8 {
+		t.Errorf("MemFS files = %v, want 8", names)
+	}
+}
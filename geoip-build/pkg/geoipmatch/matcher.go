@@ -0,0 +1,386 @@
+// Package geoipmatch answers which lists of a geoip artifact written by the
+// build, i.e. a V2Ray dat file or a MaxMind mmdb file, an IP address is in,
+// so that services can e.g. geofence requests with the same data. It does
+// not depend on the converters of the build.
+package geoipmatch
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+	"go4.org/netipx"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// mmdbMetadataMarker marks the start of the metadata section of mmdb files.
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// Field numbers of the messages in geoip.proto of the dat format.
+const (
+	geoIPListEntryField protowire.Number = 1
+	geoIPCodeField      protowire.Number = 1
+	geoIPCIDRField      protowire.Number = 2
+	cidrIPField         protowire.Number = 1
+	cidrPrefixField     protowire.Number = 2
+)
+
+// Matcher matches IP addresses against the lists of a geoip artifact. It is
+// immutable once loaded, and safe for concurrent use.
+type Matcher struct {
+	lists []string
+	ipv4  table
+	ipv6  table
+}
+
+// table maps sorted, non-overlapping IP ranges covering the whole address
+// space of one IP family to the lists containing them.
+type table struct {
+	starts []netip.Addr
+	lists  [][]string
+}
+
+// Load loads the dat or mmdb file at path, detected by its content. Only
+// the lists in wantedLists are loaded if any is given.
+func Load(path string, wantedLists ...string) (*Matcher, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Contains(data[max(len(data)-128*1024, 0):], mmdbMetadataMarker) {
+		return LoadMMDB(data, wantedLists...)
+	}
+	return LoadDat(data, wantedLists...)
+}
+
+// LoadDat loads the content of a V2Ray geoip dat file. Only the lists in
+// wantedLists are loaded if any is given.
+func LoadDat(data []byte, wantedLists ...string) (*Matcher, error) {
+	want := wantFunc(wantedLists)
+	sets := make(map[string]*netipx.IPSetBuilder)
+
+	for len(data) > 0 {
+		entry, err := consumeField(&data, geoIPListEntryField)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			continue
+		}
+		if err := parseGeoIP(entry, want, sets); err != nil {
+			return nil, err
+		}
+	}
+
+	return newMatcher(sets)
+}
+
+func parseGeoIP(data []byte, want func(string) bool, sets map[string]*netipx.IPSetBuilder) error {
+	var name string
+	var cidrs [][]byte
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if typ != protowire.BytesType || (num != geoIPCodeField && num != geoIPCIDRField) {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+		value, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if num == geoIPCodeField {
+			name = strings.ToUpper(strings.TrimSpace(string(value)))
+		} else {
+			cidrs = append(cidrs, value)
+		}
+	}
+
+	if name == "" || !want(name) {
+		return nil
+	}
+	builder, found := sets[name]
+	if !found {
+		builder = new(netipx.IPSetBuilder)
+		sets[name] = builder
+	}
+	for _, cidr := range cidrs {
+		prefix, err := parseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR in list %s: %w", name, err)
+		}
+		builder.AddPrefix(prefix)
+	}
+	return nil
+}
+
+func parseCIDR(data []byte) (netip.Prefix, error) {
+	var ip []byte
+	var bits uint64
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return netip.Prefix{}, protowire.ParseError(n)
+		}
+		data = data[n:]
+		switch {
+		case num == cidrIPField && typ == protowire.BytesType:
+			ip, n = protowire.ConsumeBytes(data)
+		case num == cidrPrefixField && typ == protowire.VarintType:
+			bits, n = protowire.ConsumeVarint(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return netip.Prefix{}, protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return netip.Prefix{}, errors.New("invalid IP length")
+	}
+	prefix := netip.PrefixFrom(addr.Unmap(), int(bits))
+	if addr.Is4In6() {
+		prefix = netip.PrefixFrom(addr.Unmap(), int(bits)-96)
+	}
+	if !prefix.IsValid() {
+		return netip.Prefix{}, errors.New("invalid prefix length")
+	}
+	return prefix.Masked(), nil
+}
+
+// consumeField consumes the next field of data, and returns its value if it
+// is the bytes field num, or nil otherwise.
+func consumeField(data *[]byte, num protowire.Number) ([]byte, error) {
+	fieldNum, typ, n := protowire.ConsumeTag(*data)
+	if n < 0 {
+		return nil, protowire.ParseError(n)
+	}
+	*data = (*data)[n:]
+	if fieldNum != num || typ != protowire.BytesType {
+		n = protowire.ConsumeFieldValue(fieldNum, typ, *data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		*data = (*data)[n:]
+		return nil, nil
+	}
+	value, n := protowire.ConsumeBytes(*data)
+	if n < 0 {
+		return nil, protowire.ParseError(n)
+	}
+	*data = (*data)[n:]
+	return value, nil
+}
+
+// LoadMMDB loads the content of a MaxMind mmdb file, the list of each
+// network of which is the ISO code of its country, registered country or
+// represented country, in the same order the mmdb input of the build reads
+// them. Only the lists in wantedLists are loaded if any is given.
+func LoadMMDB(data []byte, wantedLists ...string) (*Matcher, error) {
+	db, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	want := wantFunc(wantedLists)
+	sets := make(map[string]*netipx.IPSetBuilder)
+	networks := db.Networks(maxminddb.SkipAliasedNetworks)
+	for networks.Next() {
+		var record struct {
+			Country struct {
+				IsoCode string `maxminddb:"iso_code"`
+			} `maxminddb:"country"`
+			RegisteredCountry struct {
+				IsoCode string `maxminddb:"iso_code"`
+			} `maxminddb:"registered_country"`
+			RepresentedCountry struct {
+				IsoCode string `maxminddb:"iso_code"`
+			} `maxminddb:"represented_country"`
+		}
+		subnet, err := networks.Network(&record)
+		if err != nil {
+			continue
+		}
+
+		var name string
+		for _, code := range []string{record.Country.IsoCode, record.RegisteredCountry.IsoCode, record.RepresentedCountry.IsoCode} {
+			if name = strings.ToUpper(strings.TrimSpace(code)); name != "" {
+				break
+			}
+		}
+		if name == "" || !want(name) {
+			continue
+		}
+
+		prefix, ok := netipx.FromStdIPNet(subnet)
+		if !ok {
+			continue
+		}
+		builder, found := sets[name]
+		if !found {
+			builder = new(netipx.IPSetBuilder)
+			sets[name] = builder
+		}
+		builder.AddPrefix(prefix)
+	}
+	if err := networks.Err(); err != nil {
+		return nil, err
+	}
+
+	return newMatcher(sets)
+}
+
+func wantFunc(wantedLists []string) func(string) bool {
+	if len(wantedLists) == 0 {
+		return func(string) bool { return true }
+	}
+	wanted := make(map[string]bool, len(wantedLists))
+	for _, name := range wantedLists {
+		wanted[strings.ToUpper(strings.TrimSpace(name))] = true
+	}
+	return func(name string) bool { return wanted[name] }
+}
+
+// event is the start or the end of a range of a list.
+type event struct {
+	addr  netip.Addr
+	list  int
+	start bool
+}
+
+func newMatcher(builders map[string]*netipx.IPSetBuilder) (*Matcher, error) {
+	m := &Matcher{lists: make([]string, 0, len(builders))}
+	for name := range builders {
+		m.lists = append(m.lists, name)
+	}
+	slices.Sort(m.lists)
+
+	var ipv4Events, ipv6Events []event
+	for idx, name := range m.lists {
+		set, err := builders[name].IPSet()
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDRs in list %s: %w", name, err)
+		}
+		for _, r := range set.Ranges() {
+			events := &ipv6Events
+			if r.From().Is4() {
+				events = &ipv4Events
+			}
+			*events = append(*events, event{addr: r.From(), list: idx, start: true})
+			if next := r.To().Next(); next.IsValid() {
+				*events = append(*events, event{addr: next, list: idx})
+			}
+		}
+	}
+
+	m.ipv4 = newTable(ipv4Events, m.lists)
+	m.ipv6 = newTable(ipv6Events, m.lists)
+	return m, nil
+}
+
+// newTable sweeps the sorted events of the ranges of all lists, recording the
+// lists containing each range between two adjacent events. Identical sets of
+// lists share the same slice.
+func newTable(events []event, lists []string) table {
+	slices.SortFunc(events, func(a, b event) int {
+		return a.addr.Compare(b.addr)
+	})
+
+	var t table
+	interned := make(map[string][]string)
+	var active []int // indexes of the lists containing the current range, sorted
+	for i := 0; i < len(events); {
+		addr := events[i].addr
+		for ; i < len(events) && events[i].addr == addr; i++ {
+			pos, found := slices.BinarySearch(active, events[i].list)
+			switch {
+			case events[i].start && !found:
+				active = slices.Insert(active, pos, events[i].list)
+			case !events[i].start && found:
+				active = slices.Delete(active, pos, pos+1)
+			}
+		}
+
+		names := make([]string, len(active))
+		for j, idx := range active {
+			names[j] = lists[idx]
+		}
+		key := strings.Join(names, "\x00")
+		if shared, found := interned[key]; found {
+			names = shared
+		} else {
+			interned[key] = names
+		}
+		if len(active) == 0 {
+			names = nil
+		}
+
+		if n := len(t.lists); n > 0 && slices.Equal(t.lists[n-1], names) {
+			continue
+		}
+		t.starts = append(t.starts, addr)
+		t.lists = append(t.lists, names)
+	}
+	return t
+}
+
+func (t *table) match(addr netip.Addr) []string {
+	i, found := slices.BinarySearchFunc(t.starts, addr, netip.Addr.Compare)
+	if !found {
+		i--
+	}
+	if i < 0 {
+		return nil
+	}
+	return t.lists[i]
+}
+
+// Match returns the names of the lists containing the IP address, sorted
+// by name. The returned slice is shared and must not be modified.
+func (m *Matcher) Match(addr netip.Addr) []string {
+	addr = addr.Unmap().WithZone("")
+	switch {
+	case addr.Is4():
+		return m.ipv4.match(addr)
+	case addr.Is6():
+		return m.ipv6.match(addr)
+	}
+	return nil
+}
+
+// MatchString is like Match, but with the IP address in string form.
+func (m *Matcher) MatchString(ip string) ([]string, error) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return nil, err
+	}
+	return m.Match(addr), nil
+}
+
+// Contains reports whether the list contains the IP address.
+func (m *Matcher) Contains(list string, addr netip.Addr) bool {
+	_, found := slices.BinarySearch(m.Match(addr), strings.ToUpper(strings.TrimSpace(list)))
+	return found
+}
+
+// Lists returns the names of all loaded lists, sorted by name.
+func (m *Matcher) Lists() []string {
+	return slices.Clone(m.lists)
+}
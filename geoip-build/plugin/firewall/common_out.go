@@ -0,0 +1,324 @@
+package firewall
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/Loyalsoldier/geoip/lib"
+)
+
+const defaultSetName = "{{.Name}}_{{.Family}}"
+
+var (
+	defaultOutputDirForNftablesOut = filepath.Join("./", "output", "nftables")
+	defaultOutputDirForIPSetOut    = filepath.Join("./", "output", "ipset")
+)
+
+// firewallOut writes each list as the sets of a firewall, one for the IPv4
+// CIDRs and one for the IPv6 CIDRs as the sets of firewalls hold a single
+// family, and an include file declaring all sets.
+type firewallOut struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	OutputDir   string
+	Want        *lib.ListFilter
+	Exclude     *lib.ListFilter
+	OnlyIPType  lib.IPType
+	NameCase    string
+	SetName     *template.Template
+	IncludeFile string
+	IncludeDir  string
+}
+
+// set is a set of a single family of a list.
+type set struct {
+	Name     string
+	List     string
+	Family   lib.IPType
+	Prefixes []string
+}
+
+// setNameData is the data of the set name template.
+type setNameData struct {
+	Name   string
+	Family lib.IPType
+}
+
+func newFirewallOut(iType string, action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp struct {
+		OutputDir   string     `json:"outputDir"`
+		Want        []string   `json:"wantedList"`
+		Exclude     []string   `json:"excludedList"`
+		OnlyIPType  lib.IPType `json:"onlyIPType"`
+		NameCase    string     `json:"nameCase"`
+		SetName     string     `json:"setName"`
+		IncludeFile string     `json:"includeFile"`
+		IncludeDir  string     `json:"includeDir"`
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.OutputDir == "" {
+		switch iType {
+		case typeNftablesOut:
+			tmp.OutputDir = defaultOutputDirForNftablesOut
+		case typeIPSetOut:
+			tmp.OutputDir = defaultOutputDirForIPSetOut
+		}
+	}
+
+	if tmp.SetName == "" {
+		tmp.SetName = defaultSetName
+	}
+	setName, err := template.New("setName").Option("missingkey=error").Parse(tmp.SetName)
+	if err == nil {
+		err = setName.Execute(io.Discard, setNameData{Name: "cn", Family: lib.IPv4})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid setName: %v", iType, action, err)
+	}
+
+	if tmp.IncludeFile == "" {
+		tmp.IncludeFile = defaultIncludeFile(iType)
+	}
+	if strings.ContainsAny(tmp.IncludeFile, `/\`) {
+		return nil, fmt.Errorf("❌ [type %s | action %s] includeFile must be a file name in outputDir", iType, action)
+	}
+	if tmp.IncludeDir == "" {
+		tmp.IncludeDir = tmp.OutputDir
+	}
+
+	// Names of sets are only used for their case
+	naming, err := lib.NewListNaming(tmp.NameCase, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v", iType, action, err)
+	}
+
+	wantList, err := lib.NewListFilter(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid wantedList: %v", iType, action, err)
+	}
+
+	excludeList, err := lib.NewListFilter(tmp.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid excludedList: %v", iType, action, err)
+	}
+
+	return &firewallOut{
+		Type:        iType,
+		Action:      action,
+		Description: description(iType),
+		OutputDir:   tmp.OutputDir,
+		Want:        wantList,
+		Exclude:     excludeList,
+		OnlyIPType:  tmp.OnlyIPType,
+		NameCase:    naming.Case,
+		SetName:     setName,
+		IncludeFile: tmp.IncludeFile,
+		IncludeDir:  tmp.IncludeDir,
+	}, nil
+}
+
+func (f *firewallOut) GetType() string {
+	return f.Type
+}
+
+func (f *firewallOut) GetAction() lib.Action {
+	return f.Action
+}
+
+func (f *firewallOut) GetDescription() string {
+	return f.Description
+}
+
+// WritesIPType implements lib.IPTypeWriter.
+func (f *firewallOut) WritesIPType() lib.IPType {
+	return f.OnlyIPType
+}
+
+func (f *firewallOut) GetArgs() []lib.Arg {
+	return []lib.Arg{
+		lib.ArgOutputDir,
+		lib.ArgWantedList,
+		lib.ArgExcludedList,
+		lib.ArgOnlyIPType,
+		lib.ArgNameCase,
+		{Name: "setName", Type: lib.ArgTypeString, Description: "The Go template of the names of the sets, with the list name as {{.Name}} and the family \"ipv4\" or \"ipv6\" as {{.Family}}", Default: defaultSetName},
+		{Name: "includeFile", Type: lib.ArgTypeString, Description: "The name of the include file declaring all sets, written to outputDir", Default: defaultIncludeFile(f.Type)},
+		{Name: "includeDir", Type: lib.ArgTypeString, Description: "The directory of the set files referenced by the include file on the target system, defaults to outputDir"},
+	}
+}
+
+func (f *firewallOut) Output(ctx context.Context, container lib.Container) error {
+	sets, err := f.sets(container)
+	if err != nil {
+		return err
+	}
+	if len(sets) == 0 {
+		return fmt.Errorf("❌ [type %s | action %s] no set is generated", f.Type, f.Action)
+	}
+
+	for _, s := range sets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		switch f.Type {
+		case typeNftablesOut:
+			marshalNftablesSet(&buf, s)
+		case typeIPSetOut:
+			marshalIPSetElements(&buf, s)
+		default:
+			return lib.ErrNotSupportedFormat
+		}
+		if err := lib.WriteFile(f.Type, filepath.Join(f.OutputDir, f.setFileName(s)), buf.Bytes(), s.List); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	switch f.Type {
+	case typeNftablesOut:
+		f.marshalNftablesInclude(&buf, sets)
+	case typeIPSetOut:
+		marshalIPSetInclude(&buf, sets)
+	}
+	lists := make([]string, 0, len(sets))
+	for _, s := range sets {
+		if !slices.Contains(lists, s.List) {
+			lists = append(lists, s.List)
+		}
+	}
+	return lib.WriteFile(f.Type, filepath.Join(f.OutputDir, f.IncludeFile), buf.Bytes(), lists...)
+}
+
+// sets returns the sets of the wanted lists sorted by name, with the lists
+// having no CIDRs of a family having no set of that family.
+func (f *firewallOut) sets(container lib.Container) ([]*set, error) {
+	sets := make([]*set, 0, 300)
+	names := make(map[string]string) // map[setName]list
+	for _, name := range f.filterAndSortList(container) {
+		entry, found := container.GetEntry(name)
+		if !found {
+			continue
+		}
+
+		for _, family := range []lib.IPType{lib.IPv4, lib.IPv6} {
+			if f.OnlyIPType != "" && f.OnlyIPType != family {
+				continue
+			}
+			ignore := lib.IgnoreIPv6
+			if family == lib.IPv6 {
+				ignore = lib.IgnoreIPv4
+			}
+			prefixes, err := entry.MarshalText(ignore)
+			if err != nil || len(prefixes) == 0 {
+				continue
+			}
+
+			setName, err := f.setName(name, family)
+			if err != nil {
+				return nil, err
+			}
+			switch list, found := names[setName]; {
+			case found && list == name:
+				return nil, fmt.Errorf("❌ [type %s | action %s] set name %s is the same for both families of list %s, setName must include {{.Family}}", f.Type, f.Action, setName, name)
+			case found:
+				return nil, fmt.Errorf("❌ [type %s | action %s] set name %s of list %s is also the set name of list %s", f.Type, f.Action, setName, name, list)
+			}
+			names[setName] = name
+			sets = append(sets, &set{Name: setName, List: name, Family: family, Prefixes: prefixes})
+		}
+	}
+	return sets, nil
+}
+
+func (f *firewallOut) setName(list string, family lib.IPType) (string, error) {
+	name := strings.ToLower(list)
+	if f.NameCase == lib.NameCaseUpper {
+		name = list
+	}
+
+	var buf strings.Builder
+	if err := f.SetName.Execute(&buf, setNameData{Name: name, Family: family}); err != nil {
+		return "", fmt.Errorf("❌ [type %s | action %s] invalid setName: %v", f.Type, f.Action, err)
+	}
+	setName := buf.String()
+	if err := checkSetName(f.Type, setName); err != nil {
+		return "", fmt.Errorf("❌ [type %s | action %s] invalid set name %q of list %s: %v", f.Type, f.Action, setName, list, err)
+	}
+	return setName, nil
+}
+
+func (f *firewallOut) setFileName(s *set) string {
+	switch f.Type {
+	case typeNftablesOut:
+		return s.Name + ".nft"
+	default:
+		return s.Name + ".ipset"
+	}
+}
+
+func (f *firewallOut) filterAndSortList(container lib.Container) []string {
+	if !f.Want.IsEmpty() {
+		wantList := f.Want.Expand(container, f.Exclude)
+		slices.Sort(wantList)
+		return wantList
+	}
+
+	list := make([]string, 0, 300)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if f.Exclude.Match(name) {
+			continue
+		}
+		list = append(list, name)
+	}
+	slices.Sort(list)
+
+	return list
+}
+
+func defaultIncludeFile(iType string) string {
+	switch iType {
+	case typeNftablesOut:
+		return "sets.nft"
+	default:
+		return "sets.ipset"
+	}
+}
+
+func description(iType string) string {
+	switch iType {
+	case typeNftablesOut:
+		return descNftablesOut
+	default:
+		return descIPSetOut
+	}
+}
+
+// checkSetName checks the set name against the limits of the firewall.
+func checkSetName(iType, name string) error {
+	if name == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	if strings.ContainsAny(name, " \t\r\n\"'/\\;{}") {
+		return fmt.Errorf("must not contain spaces, quotes, path separators, semicolons or braces")
+	}
+	if iType == typeIPSetOut && len(name) > maxIPSetNameLength {
+		return fmt.Errorf("must not be longer than %d characters", maxIPSetNameLength)
+	}
+	return nil
+}
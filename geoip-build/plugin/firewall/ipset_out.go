@@ -0,0 +1,54 @@
+package firewall
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Loyalsoldier/geoip/lib"
+)
+
+/*
+The ipset output writes the files in the format of `ipset restore`. The
+include file creates all sets, after which the files of the sets add the
+CIDRs to them, e.g.:
+
+	ipset restore < sets.ipset
+	ipset restore < cn_ipv4.ipset
+*/
+
+const (
+	typeIPSetOut = "ipset"
+	descIPSetOut = "Convert data to ipset restore files with an include file creating all sets"
+
+	// maxIPSetNameLength is the maximum length of the names of sets of ipset.
+	maxIPSetNameLength = 31
+	// minIPSetMaxElem is the default maximum number of elements of sets of ipset.
+	minIPSetMaxElem = 65536
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeIPSetOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newFirewallOut(typeIPSetOut, action, data)
+	})
+	lib.RegisterOutputConverter(typeIPSetOut, &firewallOut{
+		Type:        typeIPSetOut,
+		Description: descIPSetOut,
+	})
+}
+
+func marshalIPSetElements(buf *bytes.Buffer, s *set) {
+	for _, prefix := range s.Prefixes {
+		fmt.Fprintf(buf, "add %s %s -exist\n", s.Name, prefix)
+	}
+}
+
+func marshalIPSetInclude(buf *bytes.Buffer, sets []*set) {
+	for _, s := range sets {
+		family := "inet"
+		if s.Family == lib.IPv6 {
+			family = "inet6"
+		}
+		fmt.Fprintf(buf, "create %s hash:net family %s maxelem %d -exist\n", s.Name, family, max(minIPSetMaxElem, len(s.Prefixes)))
+	}
+}
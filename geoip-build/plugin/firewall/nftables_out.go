@@ -0,0 +1,66 @@
+package firewall
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"strings"
+
+	"github.com/Loyalsoldier/geoip/lib"
+)
+
+/*
+The nftables output writes each set as a set declaration to be included
+in a table of an existing ruleset, e.g.:
+
+	table inet filter {
+		include "/etc/nftables.d/geoip/sets.nft"
+
+		chain input {
+			ip saddr @cn_ipv4 drop
+		}
+	}
+*/
+
+const (
+	typeNftablesOut = "nftables"
+	descNftablesOut = "Convert data to nftables sets with an include file declaring all sets"
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeNftablesOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newFirewallOut(typeNftablesOut, action, data)
+	})
+	lib.RegisterOutputConverter(typeNftablesOut, &firewallOut{
+		Type:        typeNftablesOut,
+		Description: descNftablesOut,
+	})
+}
+
+func marshalNftablesSet(buf *bytes.Buffer, s *set) {
+	addrType := "ipv4_addr"
+	if s.Family == lib.IPv6 {
+		addrType = "ipv6_addr"
+	}
+
+	buf.WriteString("set " + s.Name + " {\n")
+	buf.WriteString("\ttype " + addrType + "\n")
+	buf.WriteString("\tflags interval\n")
+	buf.WriteString("\telements = {\n")
+	for idx, prefix := range s.Prefixes {
+		buf.WriteString("\t\t" + prefix)
+		if idx < len(s.Prefixes)-1 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("\t}\n")
+	buf.WriteString("}\n")
+}
+
+func (f *firewallOut) marshalNftablesInclude(buf *bytes.Buffer, sets []*set) {
+	dir := strings.TrimSuffix(strings.ReplaceAll(f.IncludeDir, `\`, "/"), "/")
+	for _, s := range sets {
+		buf.WriteString(`include "` + path.Join(dir, f.setFileName(s)) + "\"\n")
+	}
+}
@@ -1,11 +1,9 @@
 package maxmind
 
 import (
-	"encoding/csv"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"os"
 	"path/filepath"
 	"strings"
 
@@ -37,6 +35,7 @@ func newGeoLite2ASNCSV(action lib.Action, data json.RawMessage) (lib.InputConver
 		IPv6File   string              `json:"ipv6"`
 		Want       map[string][]string `json:"wantedList"`
 		OnlyIPType lib.IPType          `json:"onlyIPType"`
+		ASNLists   []string            `json:"asnLists"`
 	}
 
 	if len(data) > 0 {
@@ -76,8 +75,19 @@ func newGeoLite2ASNCSV(action lib.Action, data json.RawMessage) (lib.InputConver
 		}
 	}
 
-	if len(wantList) == 0 {
-		return nil, fmt.Errorf("❌ [type %s | action %s] wantedList must be specified in config", typeASNCSV, action)
+	// ASNs may be given without the "as" prefix of their list names
+	for i, asn := range tmp.ASNLists {
+		if asn = strings.TrimSpace(asn); asn != "" && strings.Trim(asn, "0123456789") == "" {
+			tmp.ASNLists[i] = "as" + asn
+		}
+	}
+	asnLists, err := lib.NewListFilter(tmp.ASNLists)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid asnLists: %v", typeASNCSV, action, err)
+	}
+
+	if len(wantList) == 0 && asnLists.IsEmpty() {
+		return nil, fmt.Errorf("❌ [type %s | action %s] wantedList or asnLists must be specified in config", typeASNCSV, action)
 	}
 
 	return &geoLite2ASNCSV{
@@ -88,6 +98,7 @@ func newGeoLite2ASNCSV(action lib.Action, data json.RawMessage) (lib.InputConver
 		IPv6File:    tmp.IPv6File,
 		Want:        wantList,
 		OnlyIPType:  tmp.OnlyIPType,
+		ASNLists:    asnLists,
 	}, nil
 }
 
@@ -99,6 +110,7 @@ type geoLite2ASNCSV struct {
 	IPv6File    string
 	Want        map[string][]string
 	OnlyIPType  lib.IPType
+	ASNLists    *lib.ListFilter
 }
 
 func (g *geoLite2ASNCSV) GetType() string {
@@ -113,17 +125,27 @@ func (g *geoLite2ASNCSV) GetDescription() string {
 	return g.Description
 }
 
-func (g *geoLite2ASNCSV) Input(container lib.Container) (lib.Container, error) {
+func (g *geoLite2ASNCSV) GetArgs() []lib.Arg {
+	return []lib.Arg{
+		{Name: "ipv4", Type: lib.ArgTypeString, Description: "Local file path or remote HTTP(S) URL of the IPv4 CSV file", Default: defaultASNIPv4File},
+		{Name: "ipv6", Type: lib.ArgTypeString, Description: "Local file path or remote HTTP(S) URL of the IPv6 CSV file", Default: defaultASNIPv6File},
+		{Name: "wantedList", Type: lib.ArgTypeStringListMap, Description: "The lists to be generated and the ASNs of each of them. Required unless asnLists is specified"},
+		lib.ArgOnlyIPType,
+		{Name: "asnLists", Type: lib.ArgTypeStringList, Description: "The ASNs to generate a list for each, named like \"as13335\". Supports glob patterns like \"as*\" for all ASNs and regular expressions enclosed in slashes like \"/^as(13335|209242)$/\""},
+	}
+}
+
+func (g *geoLite2ASNCSV) Input(ctx context.Context, container lib.Container) (lib.Container, error) {
 	entries := make(map[string]*lib.Entry)
 
 	if g.IPv4File != "" {
-		if err := g.process(g.IPv4File, entries); err != nil {
+		if err := g.process(ctx, g.IPv4File, entries); err != nil {
 			return nil, err
 		}
 	}
 
 	if g.IPv6File != "" {
-		if err := g.process(g.IPv6File, entries); err != nil {
+		if err := g.process(ctx, g.IPv6File, entries); err != nil {
 			return nil, err
 		}
 	}
@@ -158,42 +180,24 @@ func (g *geoLite2ASNCSV) Input(container lib.Container) (lib.Container, error) {
 	return container, nil
 }
 
-func (g *geoLite2ASNCSV) process(file string, entries map[string]*lib.Entry) error {
+func (g *geoLite2ASNCSV) process(ctx context.Context, file string, entries map[string]*lib.Entry) error {
 	if entries == nil {
 		entries = make(map[string]*lib.Entry)
 	}
 
-	var f io.ReadCloser
-	var err error
-	switch {
-	case strings.HasPrefix(strings.ToLower(file), "http://"), strings.HasPrefix(strings.ToLower(file), "https://"):
-		f, err = lib.GetRemoteURLReader(file)
-	default:
-		f, err = os.Open(file)
-	}
-
+	f, err := lib.OpenURI(ctx, file)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	reader := csv.NewReader(f)
-	reader.Read() // skip header
-
-	for {
-		record, err := reader.Read()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
-
-		if len(record) < 2 {
-			return fmt.Errorf("❌ [type %s | action %s] invalid record: %v", g.Type, g.Action, record)
+	return lib.ReadCSV(ctx, lib.NewCSVReader(f), file, 2, func(record []string) error {
+		asn := strings.TrimSpace(record[1])
+		listArr := g.Want[asn]
+		if asnList := "AS" + asn; asn != "" && g.ASNLists.Match(asnList) {
+			listArr = append(listArr[:len(listArr):len(listArr)], asnList)
 		}
-
-		if listArr, found := g.Want[strings.TrimSpace(record[1])]; found {
+		if len(listArr) > 0 {
 			for _, listName := range listArr {
 				entry, got := entries[listName]
 				if !got {
@@ -205,7 +209,6 @@ func (g *geoLite2ASNCSV) process(file string, entries map[string]*lib.Entry) err
 				entries[listName] = entry
 			}
 		}
-	}
-
-	return nil
+		return nil
+	})
 }
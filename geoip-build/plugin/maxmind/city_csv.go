@@ -0,0 +1,276 @@
+package maxmind
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Loyalsoldier/geoip/lib"
+)
+
+const (
+	typeCityCSV = "maxmindGeoLite2CityCSV"
+	descCityCSV = "Convert MaxMind GeoLite2 city CSV data to other formats"
+)
+
+var (
+	defaultCityLocationsFile = filepath.Join("./", "geolite2", "GeoLite2-City-Locations-en.csv")
+	defaultCityIPv4File      = filepath.Join("./", "geolite2", "GeoLite2-City-Blocks-IPv4.csv")
+	defaultCityIPv6File      = filepath.Join("./", "geolite2", "GeoLite2-City-Blocks-IPv6.csv")
+)
+
+func init() {
+	lib.RegisterInputConfigCreator(typeCityCSV, func(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+		return newGeoLite2CityCSV(action, data)
+	})
+	lib.RegisterInputConverter(typeCityCSV, &geoLite2CityCSV{
+		Description: descCityCSV,
+	})
+}
+
+func newGeoLite2CityCSV(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+	var tmp struct {
+		LocationsFile  string     `json:"city"`
+		IPv4File       string     `json:"ipv4"`
+		IPv6File       string     `json:"ipv6"`
+		Granularity    string     `json:"granularity"`
+		Want           []string   `json:"wantedList"`
+		OnlyIPType     lib.IPType `json:"onlyIPType"`
+		ContinentLists bool       `json:"continentLists"`
+		EUList         bool       `json:"euList"`
+
+		SubdivisionLists  bool   `json:"subdivisionLists"`
+		SubdivisionNaming string `json:"subdivisionNaming"`
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.LocationsFile == "" {
+		tmp.LocationsFile = defaultCityLocationsFile
+	}
+
+	if tmp.IPv4File == "" {
+		tmp.IPv4File = defaultCityIPv4File
+	}
+
+	if tmp.IPv6File == "" {
+		tmp.IPv6File = defaultCityIPv6File
+	}
+
+	tmp.Granularity = strings.ToLower(strings.TrimSpace(tmp.Granularity))
+	if tmp.Granularity == "" {
+		tmp.Granularity = granularityCity
+	}
+	if err := checkGranularity(tmp.Granularity); err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v", typeCityCSV, action, err)
+	}
+
+	tmp.SubdivisionNaming = strings.ToLower(strings.TrimSpace(tmp.SubdivisionNaming))
+	if tmp.SubdivisionNaming == "" {
+		tmp.SubdivisionNaming = subdivisionNamingCode
+	}
+	if err := checkSubdivisionNaming(tmp.SubdivisionNaming); err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v", typeCityCSV, action, err)
+	}
+
+	// Filter want list
+	wantList, err := lib.NewListFilter(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid wantedList: %v", typeCityCSV, action, err)
+	}
+
+	return &geoLite2CityCSV{
+		Type:           typeCityCSV,
+		Action:         action,
+		Description:    descCityCSV,
+		LocationsFile:  tmp.LocationsFile,
+		IPv4File:       tmp.IPv4File,
+		IPv6File:       tmp.IPv6File,
+		Granularity:    tmp.Granularity,
+		Want:           wantList,
+		OnlyIPType:     tmp.OnlyIPType,
+		ContinentLists: tmp.ContinentLists,
+		EUList:         tmp.EUList,
+
+		SubdivisionLists:  tmp.SubdivisionLists,
+		SubdivisionNaming: tmp.SubdivisionNaming,
+	}, nil
+}
+
+// geoLite2CityCSV generates a list for each location of the granularity,
+// named by locationListName, e.g. "US-CA-5368361" for Los Angeles, which
+// the maxmindMMDB output converter with the city schema writes as a City
+// database. With subdivisionLists, the IPs are also added to the list of
+// the first-level subdivision of their location, e.g. "US-CA" or
+// "CN-GUANGDONG", in addition to the list of the granularity.
+type geoLite2CityCSV struct {
+	Type           string
+	Action         lib.Action
+	Description    string
+	LocationsFile  string
+	IPv4File       string
+	IPv6File       string
+	Granularity    string
+	Want           *lib.ListFilter
+	OnlyIPType     lib.IPType
+	ContinentLists bool
+	EUList         bool
+
+	SubdivisionLists  bool
+	SubdivisionNaming string
+}
+
+func (g *geoLite2CityCSV) GetType() string {
+	return g.Type
+}
+
+func (g *geoLite2CityCSV) GetAction() lib.Action {
+	return g.Action
+}
+
+func (g *geoLite2CityCSV) GetDescription() string {
+	return g.Description
+}
+
+func (g *geoLite2CityCSV) GetArgs() []lib.Arg {
+	return []lib.Arg{
+		{Name: "city", Type: lib.ArgTypeString, Description: "Local file path or remote HTTP(S) URL of the city locations CSV file", Default: defaultCityLocationsFile},
+		{Name: "ipv4", Type: lib.ArgTypeString, Description: "Local file path or remote HTTP(S) URL of the IPv4 CSV file", Default: defaultCityIPv4File},
+		{Name: "ipv6", Type: lib.ArgTypeString, Description: "Local file path or remote HTTP(S) URL of the IPv6 CSV file", Default: defaultCityIPv6File},
+		{Name: "granularity", Type: lib.ArgTypeString, Description: "The granularity of the lists, named like \"US\", \"US-CA\" or \"US-CA-5368361\" (the GeoNames ID of the city)", Default: granularityCity, Enum: granularities},
+		{Name: "wantedList", Type: lib.ArgTypeStringList, Description: "The country codes or lists to be processed, others are ignored. Supports glob patterns like \"US-*\" and regular expressions enclosed in slashes like \"/^(cn|hk|mo)$/\""},
+		lib.ArgOnlyIPType,
+		argContinentLists,
+		argEUList,
+		{Name: "subdivisionLists", Type: lib.ArgTypeBool, Description: "Also generate a list for each first-level subdivision in addition to the lists of the granularity, e.g. \"us-ca\", which are selected by wantedList like \"US-*\" to keep the size of outputs sane"},
+		{Name: "subdivisionNaming", Type: lib.ArgTypeString, Description: "The naming of the lists of subdivisions, by the ISO code like \"cn-gd\" or the English name like \"cn-guangdong\", which falls back to the ISO code if it has non-ASCII letters", Default: subdivisionNamingCode, Enum: subdivisionNamings},
+	}
+}
+
+func (g *geoLite2CityCSV) Input(ctx context.Context, container lib.Container) (lib.Container, error) {
+	locations, err := readCityLocations(ctx, g.LocationsFile)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %w", g.Type, g.Action, err)
+	}
+
+	listNames := make(map[string][]string, len(locations)) // map[geonameID][]listName
+	for id, location := range locations {
+		if location.CountryCode == "" {
+			continue
+		}
+		var cityID uint
+		if location.isCity() {
+			cityID = location.GeonameID
+		}
+		var lists []string
+		if name := locationListName(g.Granularity, location.CountryCode, location.SubdivisionCode, cityID); g.Want.Wants(location.CountryCode) || g.Want.Wants(name) {
+			lists = append(lists, name)
+		}
+		derived := derivedLists(location.ContinentCode, location.IsInEU, g.ContinentLists, g.EUList)
+		if g.SubdivisionLists {
+			if name := subdivisionListName(g.SubdivisionNaming, location); name != "" {
+				derived = append(derived, name)
+			}
+		}
+		for _, list := range derived {
+			if g.Want.Wants(list) && !slices.Contains(lists, list) {
+				lists = append(lists, list)
+			}
+		}
+		if len(lists) == 0 {
+			continue
+		}
+		listNames[id] = lists
+	}
+
+	if len(listNames) == 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid city location data", g.Type, g.Action)
+	}
+
+	entries := make(map[string]*lib.Entry, 300)
+
+	if g.IPv4File != "" {
+		if err := g.process(ctx, g.IPv4File, listNames, entries); err != nil {
+			return nil, err
+		}
+	}
+
+	if g.IPv6File != "" {
+		if err := g.process(ctx, g.IPv6File, listNames, entries); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] no entry is generated", g.Type, g.Action)
+	}
+
+	var ignoreIPType lib.IgnoreIPOption
+	switch g.OnlyIPType {
+	case lib.IPv4:
+		ignoreIPType = lib.IgnoreIPv6
+	case lib.IPv6:
+		ignoreIPType = lib.IgnoreIPv4
+	}
+
+	for _, entry := range entries {
+		switch g.Action {
+		case lib.ActionAdd:
+			if err := container.Add(entry, ignoreIPType); err != nil {
+				return nil, err
+			}
+		case lib.ActionRemove:
+			if err := container.Remove(entry, lib.CaseRemovePrefix, ignoreIPType); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, lib.ErrUnknownAction
+		}
+	}
+
+	return container, nil
+}
+
+func (g *geoLite2CityCSV) process(ctx context.Context, file string, listNames map[string][]string, entries map[string]*lib.Entry) error {
+	f, err := lib.OpenURI(ctx, file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return lib.ReadCSV(ctx, lib.NewCSVReader(f), file, 4, func(record []string) error {
+		geonameID := ""
+		switch {
+		case strings.TrimSpace(record[1]) != "":
+			geonameID = strings.TrimSpace(record[1])
+		case strings.TrimSpace(record[2]) != "":
+			geonameID = strings.TrimSpace(record[2])
+		case strings.TrimSpace(record[3]) != "":
+			geonameID = strings.TrimSpace(record[3])
+		default:
+			return nil
+		}
+
+		cidrStr := strings.ToLower(strings.TrimSpace(record[0]))
+		for _, name := range listNames[geonameID] {
+			entry, got := entries[name]
+			if !got {
+				entry = lib.NewEntry(name)
+			}
+
+			if err := entry.AddPrefix(cidrStr); err != nil {
+				return err
+			}
+
+			entries[name] = entry
+		}
+		return nil
+	})
+}
@@ -1,11 +1,10 @@
 package maxmind
 
 import (
-	"encoding/csv"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"os"
 	"path/filepath"
 	"strings"
 
@@ -39,6 +38,8 @@ func newGeoLite2CountryCSV(action lib.Action, data json.RawMessage) (lib.InputCo
 		IPv6File        string     `json:"ipv6"`
 		Want            []string   `json:"wantedList"`
 		OnlyIPType      lib.IPType `json:"onlyIPType"`
+		ContinentLists  bool       `json:"continentLists"`
+		EUList          bool       `json:"euList"`
 	}
 
 	if len(data) > 0 {
@@ -60,11 +61,9 @@ func newGeoLite2CountryCSV(action lib.Action, data json.RawMessage) (lib.InputCo
 	}
 
 	// Filter want list
-	wantList := make(map[string]bool)
-	for _, want := range tmp.Want {
-		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" {
-			wantList[want] = true
-		}
+	wantList, err := lib.NewListFilter(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid wantedList: %v", typeCountryCSV, action, err)
 	}
 
 	return &geoLite2CountryCSV{
@@ -76,6 +75,8 @@ func newGeoLite2CountryCSV(action lib.Action, data json.RawMessage) (lib.InputCo
 		IPv6File:        tmp.IPv6File,
 		Want:            wantList,
 		OnlyIPType:      tmp.OnlyIPType,
+		ContinentLists:  tmp.ContinentLists,
+		EUList:          tmp.EUList,
 	}, nil
 }
 
@@ -86,8 +87,10 @@ type geoLite2CountryCSV struct {
 	CountryCodeFile string
 	IPv4File        string
 	IPv6File        string
-	Want            map[string]bool
+	Want            *lib.ListFilter
 	OnlyIPType      lib.IPType
+	ContinentLists  bool
+	EUList          bool
 }
 
 func (g *geoLite2CountryCSV) GetType() string {
@@ -102,8 +105,20 @@ func (g *geoLite2CountryCSV) GetDescription() string {
 	return g.Description
 }
 
-func (g *geoLite2CountryCSV) Input(container lib.Container) (lib.Container, error) {
-	ccMap, err := g.getCountryCode()
+func (g *geoLite2CountryCSV) GetArgs() []lib.Arg {
+	return []lib.Arg{
+		{Name: "country", Type: lib.ArgTypeString, Description: "Local file path or remote HTTP(S) URL of the country locations CSV file", Default: defaultCCFile},
+		{Name: "ipv4", Type: lib.ArgTypeString, Description: "Local file path or remote HTTP(S) URL of the IPv4 CSV file", Default: defaultCountryIPv4File},
+		{Name: "ipv6", Type: lib.ArgTypeString, Description: "Local file path or remote HTTP(S) URL of the IPv6 CSV file", Default: defaultCountryIPv6File},
+		lib.ArgWantedList,
+		lib.ArgOnlyIPType,
+		argContinentLists,
+		argEUList,
+	}
+}
+
+func (g *geoLite2CountryCSV) Input(ctx context.Context, container lib.Container) (lib.Container, error) {
+	ccMap, err := g.getCountryCode(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -111,13 +126,13 @@ func (g *geoLite2CountryCSV) Input(container lib.Container) (lib.Container, erro
 	entries := make(map[string]*lib.Entry, len(ccMap))
 
 	if g.IPv4File != "" {
-		if err := g.process(g.IPv4File, ccMap, entries); err != nil {
+		if err := g.process(ctx, g.IPv4File, ccMap, entries); err != nil {
 			return nil, err
 		}
 	}
 
 	if g.IPv6File != "" {
-		if err := g.process(g.IPv6File, ccMap, entries); err != nil {
+		if err := g.process(ctx, g.IPv6File, ccMap, entries); err != nil {
 			return nil, err
 		}
 	}
@@ -152,44 +167,53 @@ func (g *geoLite2CountryCSV) Input(container lib.Container) (lib.Container, erro
 	return container, nil
 }
 
-func (g *geoLite2CountryCSV) getCountryCode() (map[string]string, error) {
-	var f io.ReadCloser
-	var err error
-	switch {
-	case strings.HasPrefix(strings.ToLower(g.CountryCodeFile), "http://"), strings.HasPrefix(strings.ToLower(g.CountryCodeFile), "https://"):
-		f, err = lib.GetRemoteURLReader(g.CountryCodeFile)
-	default:
-		f, err = os.Open(g.CountryCodeFile)
-	}
-
+func (g *geoLite2CountryCSV) getCountryCode(ctx context.Context) (map[string][]string, error) {
+	f, err := lib.OpenURI(ctx, g.CountryCodeFile)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 
-	reader := csv.NewReader(f)
-	lines, err := reader.ReadAll()
-	if err != nil {
-		return nil, err
-	}
+	reader := lib.NewCSVReader(f)
+	reader.Read() // skip header
+
+	ccMap := make(map[string][]string) // map[geonameID][]listName
+	for {
+		line, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
 
-	ccMap := make(map[string]string)
-	for _, line := range lines[1:] {
 		if len(line) < 5 {
 			return nil, fmt.Errorf("❌ [type %s | action %s] invalid record: %v", g.Type, g.Action, line)
 		}
 
 		id := strings.TrimSpace(line[0])
 		countryCode := strings.ToUpper(strings.TrimSpace(line[4]))
-		if id == "" || countryCode == "" {
+		if id == "" {
 			continue
 		}
 
-		if len(g.Want) > 0 && !g.Want[countryCode] {
+		// Locations of continents only have no country code, but are
+		// still in the lists of their continents
+		var lists []string
+		if countryCode != "" && g.Want.Wants(countryCode) {
+			lists = append(lists, countryCode)
+		}
+		isInEU := len(line) > 6 && strings.TrimSpace(line[6]) == "1"
+		for _, list := range derivedLists(line[2], isInEU, g.ContinentLists, g.EUList) {
+			if g.Want.Wants(list) {
+				lists = append(lists, list)
+			}
+		}
+		if len(lists) == 0 {
 			continue
 		}
 
-		ccMap[id] = countryCode
+		ccMap[id] = lists
 	}
 
 	if len(ccMap) == 0 {
@@ -199,7 +223,7 @@ func (g *geoLite2CountryCSV) getCountryCode() (map[string]string, error) {
 	return ccMap, nil
 }
 
-func (g *geoLite2CountryCSV) process(file string, ccMap map[string]string, entries map[string]*lib.Entry) error {
+func (g *geoLite2CountryCSV) process(ctx context.Context, file string, ccMap map[string][]string, entries map[string]*lib.Entry) error {
 	if len(ccMap) == 0 {
 		return fmt.Errorf("❌ [type %s | action %s] invalid country code data", g.Type, g.Action)
 	}
@@ -207,36 +231,13 @@ func (g *geoLite2CountryCSV) process(file string, ccMap map[string]string, entri
 		entries = make(map[string]*lib.Entry, len(ccMap))
 	}
 
-	var f io.ReadCloser
-	var err error
-	switch {
-	case strings.HasPrefix(strings.ToLower(file), "http://"), strings.HasPrefix(strings.ToLower(file), "https://"):
-		f, err = lib.GetRemoteURLReader(file)
-	default:
-		f, err = os.Open(file)
-	}
-
+	f, err := lib.OpenURI(ctx, file)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	reader := csv.NewReader(f)
-	reader.Read() // skip header
-
-	for {
-		record, err := reader.Read()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
-
-		if len(record) < 4 {
-			return fmt.Errorf("❌ [type %s | action %s] invalid record: %v", g.Type, g.Action, record)
-		}
-
+	return lib.ReadCSV(ctx, lib.NewCSVReader(f), file, 4, func(record []string) error {
 		ccID := ""
 		switch {
 		case strings.TrimSpace(record[1]) != "":
@@ -246,23 +247,22 @@ func (g *geoLite2CountryCSV) process(file string, ccMap map[string]string, entri
 		case strings.TrimSpace(record[3]) != "":
 			ccID = strings.TrimSpace(record[3])
 		default:
-			continue
+			return nil
 		}
 
-		if countryCode, found := ccMap[ccID]; found {
-			cidrStr := strings.ToLower(strings.TrimSpace(record[0]))
-			entry, got := entries[countryCode]
+		cidrStr := strings.ToLower(strings.TrimSpace(record[0]))
+		for _, list := range ccMap[ccID] {
+			entry, got := entries[list]
 			if !got {
-				entry = lib.NewEntry(countryCode)
+				entry = lib.NewEntry(list)
 			}
 
 			if err := entry.AddPrefix(cidrStr); err != nil {
 				return err
 			}
 
-			entries[countryCode] = entry
+			entries[list] = entry
 		}
-	}
-
-	return nil
+		return nil
+	})
 }
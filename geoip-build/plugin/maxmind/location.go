@@ -0,0 +1,318 @@
+package maxmind
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Loyalsoldier/geoip/lib"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+// The granularities of the lists generated from city-level data.
+const (
+	granularityCountry     = "country"
+	granularitySubdivision = "subdivision"
+	granularityCity        = "city"
+)
+
+var granularities = []string{granularityCountry, granularitySubdivision, granularityCity}
+
+func checkGranularity(granularity string) error {
+	for _, g := range granularities {
+		if granularity == g {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid granularity %q, must be one of %s", granularity, strings.Join(granularities, ", "))
+}
+
+// The namings of the lists of first-level subdivisions.
+const (
+	subdivisionNamingCode = "code"
+	subdivisionNamingName = "name"
+)
+
+var subdivisionNamings = []string{subdivisionNamingCode, subdivisionNamingName}
+
+func checkSubdivisionNaming(naming string) error {
+	for _, n := range subdivisionNamings {
+		if naming == n {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid subdivisionNaming %q, must be one of %s", naming, strings.Join(subdivisionNamings, ", "))
+}
+
+// subdivisionListName returns the name of the list of the first-level
+// subdivision of location in the naming, e.g. "US-CA" by the ISO code or
+// "CN-GUANGDONG" by the English name, or empty if it has no subdivision.
+// Names with characters other than ASCII letters, digits, spaces and
+// punctuation fall back to the ISO code, so that list names are safe file
+// names.
+func subdivisionListName(naming string, location *cityLocation) string {
+	if location.CountryCode == "" || location.SubdivisionCode == "" {
+		return ""
+	}
+	name := location.SubdivisionCode
+	if naming == subdivisionNamingName && location.SubdivisionName != "" {
+		var b strings.Builder
+		ascii := true
+		for _, r := range strings.ToUpper(location.SubdivisionName) {
+			switch {
+			case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+				b.WriteRune(r)
+			case r == ' ' || r == '-' || r == '_' || r == '\'' || r == '.' || r == ',' || r == '(' || r == ')':
+				if s := b.String(); s != "" && !strings.HasSuffix(s, "-") {
+					b.WriteByte('-')
+				}
+			default:
+				ascii = false
+			}
+		}
+		if s := strings.TrimSuffix(b.String(), "-"); ascii && s != "" {
+			name = s
+		}
+	}
+	return location.CountryCode + "-" + name
+}
+
+// continentListNames are the names of the lists of continents by their codes.
+var continentListNames = map[string]string{
+	"AF": "AFRICA",
+	"AN": "ANTARCTICA",
+	"AS": "ASIA",
+	"EU": "EUROPE",
+	"NA": "NORTH-AMERICA",
+	"OC": "OCEANIA",
+	"SA": "SOUTH-AMERICA",
+}
+
+// euListName is the name of the list of the member states of the European
+// Union, which is not the continent code "EU" of Europe.
+const euListName = "EU"
+
+var (
+	argContinentLists = lib.Arg{Name: "continentLists", Type: lib.ArgTypeBool, Description: "Also generate a list for each continent, e.g. \"asia\" and \"north-america\""}
+	argEUList         = lib.Arg{Name: "euList", Type: lib.ArgTypeBool, Description: "Also generate the \"eu\" list of the member states of the European Union"}
+)
+
+// derivedLists returns the names of the lists derived from the
+// continent_code and is_in_european_union columns of a location that its
+// IPs are also added to, if enabled.
+func derivedLists(continentCode string, isInEU, continents, eu bool) []string {
+	var lists []string
+	if continents {
+		if name, found := continentListNames[strings.ToUpper(strings.TrimSpace(continentCode))]; found {
+			lists = append(lists, name)
+		}
+	}
+	if eu && isInEU {
+		lists = append(lists, euListName)
+	}
+	return lists
+}
+
+// locationListName returns the name of the list of a location in the
+// granularity, which is the country code, the country code and the ISO code
+// of the first-level subdivision, e.g. "US-CA", or those and the GeoNames ID
+// of the city, e.g. "US-CA-5368361". The parts missing are left out, so that
+// the IPs located only to a country are in the list of the country code, e.g.
+// "US", in every granularity.
+func locationListName(granularity, country, subdivision string, cityID uint) string {
+	name := country
+	if granularity == granularityCountry {
+		return name
+	}
+	if subdivision != "" {
+		name += "-" + subdivision
+	}
+	if granularity == granularityCity && cityID != 0 {
+		name += "-" + strconv.FormatUint(uint64(cityID), 10)
+	}
+	return name
+}
+
+// parseLocationListName parses a list name returned by locationListName.
+// A part is a GeoNames ID if it has only digits and is longer than 3, which
+// an ISO 3166-2 subdivision code never is.
+func parseLocationListName(name string) (country, subdivision string, cityID uint) {
+	parts := strings.Split(name, "-")
+	country = parts[0]
+	for _, part := range parts[1:] {
+		if id, err := strconv.ParseUint(part, 10, 32); err == nil && len(part) > 3 {
+			cityID = uint(id)
+			continue
+		}
+		if subdivision == "" {
+			subdivision = part
+		}
+	}
+	return country, subdivision, cityID
+}
+
+// cityLocation is a location of a GeoLite2 City locations CSV file.
+type cityLocation struct {
+	GeonameID       uint
+	ContinentCode   string
+	ContinentName   string
+	CountryCode     string
+	CountryName     string
+	SubdivisionCode string
+	SubdivisionName string
+	CityName        string
+	TimeZone        string
+	IsInEU          bool
+}
+
+// isCity reports whether the location is a city, rather than a country or
+// subdivision, which the IPs of a block are located to only.
+func (l *cityLocation) isCity() bool {
+	return l.CityName != ""
+}
+
+// readCityLocations reads the GeoLite2 City locations CSV file at uri,
+// keyed by GeoNames ID.
+func readCityLocations(ctx context.Context, uri string) (map[string]*cityLocation, error) {
+	f, err := lib.OpenURI(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := lib.NewCSVReader(f)
+	reader.Read() // skip header
+
+	locations := make(map[string]*cityLocation)
+	for {
+		line, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(line) < 14 {
+			return nil, fmt.Errorf("invalid city location record: %v", line)
+		}
+
+		id := strings.TrimSpace(line[0])
+		geonameID, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid city location record: %v", line)
+		}
+
+		locations[id] = &cityLocation{
+			GeonameID:       uint(geonameID),
+			ContinentCode:   strings.ToUpper(strings.TrimSpace(line[2])),
+			ContinentName:   strings.TrimSpace(line[3]),
+			CountryCode:     strings.ToUpper(strings.TrimSpace(line[4])),
+			CountryName:     strings.TrimSpace(line[5]),
+			SubdivisionCode: strings.ToUpper(strings.TrimSpace(line[6])),
+			SubdivisionName: strings.TrimSpace(line[7]),
+			CityName:        strings.TrimSpace(line[10]),
+			TimeZone:        strings.TrimSpace(line[12]),
+			IsInEU:          strings.TrimSpace(line[13]) == "1",
+		}
+	}
+
+	return locations, nil
+}
+
+// locationIndex looks up the locations of the lists named by locationListName.
+type locationIndex struct {
+	cities       map[uint]*cityLocation
+	countries    map[string]*cityLocation
+	subdivisions map[string]*cityLocation // keyed by "country-subdivision"
+}
+
+func newLocationIndex(locations map[string]*cityLocation) *locationIndex {
+	index := &locationIndex{
+		cities:       make(map[uint]*cityLocation),
+		countries:    make(map[string]*cityLocation),
+		subdivisions: make(map[string]*cityLocation),
+	}
+	for _, location := range locations {
+		if location.CountryCode == "" {
+			continue
+		}
+		if location.isCity() {
+			index.cities[location.GeonameID] = location
+		}
+		if _, found := index.countries[location.CountryCode]; !found || (location.SubdivisionCode == "" && !location.isCity()) {
+			index.countries[location.CountryCode] = location
+		}
+		if location.SubdivisionCode != "" {
+			key := location.CountryCode + "-" + location.SubdivisionCode
+			if _, found := index.subdivisions[key]; !found || !location.isCity() {
+				index.subdivisions[key] = location
+			}
+		}
+	}
+	return index
+}
+
+// countryRecord returns the record of the list in the Country schema.
+func countryRecord(name string) mmdbtype.Map {
+	return mmdbtype.Map{
+		"country": mmdbtype.Map{
+			"iso_code": mmdbtype.String(name),
+		},
+	}
+}
+
+// cityRecord returns the record of the list in the City schema, with the
+// names, continent and time zone of its location if the index has it.
+// The index may be nil.
+func (index *locationIndex) cityRecord(name string) mmdbtype.Map {
+	country, subdivision, cityID := parseLocationListName(name)
+
+	var countryLoc, subdivisionLoc, cityLoc *cityLocation
+	if index != nil {
+		countryLoc = index.countries[country]
+		subdivisionLoc = index.subdivisions[country+"-"+subdivision]
+		cityLoc = index.cities[cityID]
+	}
+
+	countryMap := mmdbtype.Map{"iso_code": mmdbtype.String(country)}
+	record := mmdbtype.Map{"country": countryMap}
+	if countryLoc != nil {
+		if countryLoc.CountryName != "" {
+			countryMap["names"] = mmdbtype.Map{"en": mmdbtype.String(countryLoc.CountryName)}
+		}
+		if countryLoc.IsInEU {
+			countryMap["is_in_european_union"] = mmdbtype.Bool(true)
+		}
+		if countryLoc.ContinentCode != "" {
+			continent := mmdbtype.Map{"code": mmdbtype.String(countryLoc.ContinentCode)}
+			if countryLoc.ContinentName != "" {
+				continent["names"] = mmdbtype.Map{"en": mmdbtype.String(countryLoc.ContinentName)}
+			}
+			record["continent"] = continent
+		}
+	}
+
+	if subdivision != "" {
+		subdivisionMap := mmdbtype.Map{"iso_code": mmdbtype.String(subdivision)}
+		if subdivisionLoc != nil && subdivisionLoc.SubdivisionName != "" {
+			subdivisionMap["names"] = mmdbtype.Map{"en": mmdbtype.String(subdivisionLoc.SubdivisionName)}
+		}
+		record["subdivisions"] = mmdbtype.Slice{subdivisionMap}
+	}
+
+	if cityID != 0 {
+		cityMap := mmdbtype.Map{"geoname_id": mmdbtype.Uint32(cityID)}
+		if cityLoc != nil {
+			cityMap["names"] = mmdbtype.Map{"en": mmdbtype.String(cityLoc.CityName)}
+			if cityLoc.TimeZone != "" {
+				record["location"] = mmdbtype.Map{"time_zone": mmdbtype.String(cityLoc.TimeZone)}
+			}
+		}
+		record["city"] = cityMap
+	}
+
+	return record
+}
@@ -1,6 +1,7 @@
 package maxmind
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -31,9 +32,10 @@ func init() {
 
 func newMaxmindMMDBIn(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
 	var tmp struct {
-		URI        string     `json:"uri"`
-		Want       []string   `json:"wantedList"`
-		OnlyIPType lib.IPType `json:"onlyIPType"`
+		URI         string     `json:"uri"`
+		Want        []string   `json:"wantedList"`
+		OnlyIPType  lib.IPType `json:"onlyIPType"`
+		Granularity string     `json:"granularity"`
 	}
 
 	if len(data) > 0 {
@@ -46,12 +48,18 @@ func newMaxmindMMDBIn(action lib.Action, data json.RawMessage) (lib.InputConvert
 		tmp.URI = defaultMMDBFile
 	}
 
+	tmp.Granularity = strings.ToLower(strings.TrimSpace(tmp.Granularity))
+	if tmp.Granularity == "" {
+		tmp.Granularity = granularityCountry
+	}
+	if err := checkGranularity(tmp.Granularity); err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v", typeMaxmindMMDBIn, action, err)
+	}
+
 	// Filter want list
-	wantList := make(map[string]bool)
-	for _, want := range tmp.Want {
-		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" {
-			wantList[want] = true
-		}
+	wantList, err := lib.NewListFilter(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid wantedList: %v", typeMaxmindMMDBIn, action, err)
 	}
 
 	return &maxmindMMDBIn{
@@ -61,6 +69,7 @@ func newMaxmindMMDBIn(action lib.Action, data json.RawMessage) (lib.InputConvert
 		URI:         tmp.URI,
 		Want:        wantList,
 		OnlyIPType:  tmp.OnlyIPType,
+		Granularity: tmp.Granularity,
 	}, nil
 }
 
@@ -69,8 +78,9 @@ type maxmindMMDBIn struct {
 	Action      lib.Action
 	Description string
 	URI         string
-	Want        map[string]bool
+	Want        *lib.ListFilter
 	OnlyIPType  lib.IPType
+	Granularity string
 }
 
 func (m *maxmindMMDBIn) GetType() string {
@@ -85,22 +95,28 @@ func (m *maxmindMMDBIn) GetDescription() string {
 	return m.Description
 }
 
-func (m *maxmindMMDBIn) Input(container lib.Container) (lib.Container, error) {
-	var content []byte
-	var err error
-	switch {
-	case strings.HasPrefix(strings.ToLower(m.URI), "http://"), strings.HasPrefix(strings.ToLower(m.URI), "https://"):
-		content, err = lib.GetRemoteURLContent(m.URI)
-	default:
-		content, err = os.ReadFile(m.URI)
+func (m *maxmindMMDBIn) GetArgs() []lib.Arg {
+	return []lib.Arg{
+		lib.ArgURI.WithDefault(defaultMMDBFile),
+		lib.ArgWantedList,
+		lib.ArgOnlyIPType,
+		{Name: "granularity", Type: lib.ArgTypeString, Description: "The granularity of the lists, which are named like \"US\", \"US-CA\" or \"US-CA-5368361\" (the GeoNames ID of the city) by the country, subdivision and city of the records of a City database", Default: granularityCountry, Enum: granularities},
 	}
-	if err != nil {
-		return nil, err
+}
+
+func (m *maxmindMMDBIn) Input(ctx context.Context, container lib.Container) (lib.Container, error) {
+	// Download remote file to disk to be memory-mapped instead of read into memory
+	file := m.URI
+	if lib.IsRemoteURI(m.URI) {
+		var err error
+		if file, err = lib.GetRemoteURLFile(ctx, m.URI); err != nil {
+			return nil, err
+		}
+		defer os.Remove(file)
 	}
 
 	entries := make(map[string]*lib.Entry, 300)
-	err = m.generateEntries(content, entries)
-	if err != nil {
+	if err := m.generateEntries(ctx, file, entries); err != nil {
 		return nil, err
 	}
 
@@ -134,8 +150,8 @@ func (m *maxmindMMDBIn) Input(container lib.Container) (lib.Container, error) {
 	return container, nil
 }
 
-func (m *maxmindMMDBIn) generateEntries(content []byte, entries map[string]*lib.Entry) error {
-	db, err := maxminddb.FromBytes(content)
+func (m *maxmindMMDBIn) generateEntries(ctx context.Context, file string, entries map[string]*lib.Entry) error {
+	db, err := maxminddb.Open(file)
 	if err != nil {
 		return err
 	}
@@ -143,6 +159,10 @@ func (m *maxmindMMDBIn) generateEntries(content []byte, entries map[string]*lib.
 
 	networks := db.Networks(maxminddb.SkipAliasedNetworks)
 	for networks.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		record := struct {
 			Country struct {
 				IsoCode string `maxminddb:"iso_code"`
@@ -153,6 +173,12 @@ func (m *maxmindMMDBIn) generateEntries(content []byte, entries map[string]*lib.
 			RepresentedCountry struct {
 				IsoCode string `maxminddb:"iso_code"`
 			} `maxminddb:"represented_country"`
+			Subdivisions []struct {
+				IsoCode string `maxminddb:"iso_code"`
+			} `maxminddb:"subdivisions"`
+			City struct {
+				GeonameID uint `maxminddb:"geoname_id"`
+			} `maxminddb:"city"`
 		}{}
 
 		subnet, err := networks.Network(&record)
@@ -160,19 +186,28 @@ func (m *maxmindMMDBIn) generateEntries(content []byte, entries map[string]*lib.
 			continue
 		}
 
-		name := ""
+		country := ""
 		switch {
 		case strings.TrimSpace(record.Country.IsoCode) != "":
-			name = strings.ToUpper(strings.TrimSpace(record.Country.IsoCode))
+			country = strings.ToUpper(strings.TrimSpace(record.Country.IsoCode))
 		case strings.TrimSpace(record.RegisteredCountry.IsoCode) != "":
-			name = strings.ToUpper(strings.TrimSpace(record.RegisteredCountry.IsoCode))
+			country = strings.ToUpper(strings.TrimSpace(record.RegisteredCountry.IsoCode))
 		case strings.TrimSpace(record.RepresentedCountry.IsoCode) != "":
-			name = strings.ToUpper(strings.TrimSpace(record.RepresentedCountry.IsoCode))
+			country = strings.ToUpper(strings.TrimSpace(record.RepresentedCountry.IsoCode))
 		default:
 			continue
 		}
 
-		if len(m.Want) > 0 && !m.Want[name] {
+		name := country
+		if m.Granularity != granularityCountry {
+			subdivision := ""
+			if len(record.Subdivisions) > 0 {
+				subdivision = strings.ToUpper(strings.TrimSpace(record.Subdivisions[0].IsoCode))
+			}
+			name = locationListName(m.Granularity, country, subdivision, record.City.GeonameID)
+		}
+
+		if !m.Want.Wants(country) && !m.Want.Wants(name) {
 			continue
 		}
 
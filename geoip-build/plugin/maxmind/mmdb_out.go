@@ -1,10 +1,12 @@
 package maxmind
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
-	"log"
-	"net"
-	"os"
+	"fmt"
+	"log/slog"
+	"net/netip"
 	"path/filepath"
 	"slices"
 	"strings"
@@ -12,6 +14,7 @@ import (
 	"github.com/Loyalsoldier/geoip/lib"
 	"github.com/maxmind/mmdbwriter"
 	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"go4.org/netipx"
 )
 
 const (
@@ -24,6 +27,12 @@ var (
 	defaultOutputDir  = filepath.Join("./", "output", "maxmind")
 )
 
+// The schemas of the mmdb files written.
+const (
+	schemaCountry = "country"
+	schemaCity    = "city"
+)
+
 func init() {
 	lib.RegisterOutputConfigCreator(typeMaxmindMMDBOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
 		return newMMDBOut(action, data)
@@ -41,6 +50,8 @@ func newMMDBOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, e
 		Overwrite  []string   `json:"overwriteList"`
 		Exclude    []string   `json:"excludedList"`
 		OnlyIPType lib.IPType `json:"onlyIPType"`
+		Schema     string     `json:"schema"`
+		Locations  string     `json:"locations"`
 	}
 
 	if len(data) > 0 {
@@ -57,16 +68,40 @@ func newMMDBOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, e
 		tmp.OutputDir = defaultOutputDir
 	}
 
+	switch tmp.Schema = strings.ToLower(strings.TrimSpace(tmp.Schema)); tmp.Schema {
+	case "":
+		tmp.Schema = schemaCountry
+	case schemaCountry, schemaCity:
+	default:
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid schema %q, must be %s or %s", typeMaxmindMMDBOut, action, tmp.Schema, schemaCountry, schemaCity)
+	}
+
+	if tmp.Locations != "" && tmp.Schema != schemaCity {
+		return nil, fmt.Errorf("❌ [type %s | action %s] locations is only supported by the %s schema", typeMaxmindMMDBOut, action, schemaCity)
+	}
+
+	wantList, err := lib.NewListFilter(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid wantedList: %v", typeMaxmindMMDBOut, action, err)
+	}
+
+	excludeList, err := lib.NewListFilter(tmp.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid excludedList: %v", typeMaxmindMMDBOut, action, err)
+	}
+
 	return &mmdbOut{
 		Type:        typeMaxmindMMDBOut,
 		Action:      action,
 		Description: descMaxmindMMDBOut,
 		OutputName:  tmp.OutputName,
 		OutputDir:   tmp.OutputDir,
-		Want:        tmp.Want,
+		Want:        wantList,
 		Overwrite:   tmp.Overwrite,
-		Exclude:     tmp.Exclude,
+		Exclude:     excludeList,
 		OnlyIPType:  tmp.OnlyIPType,
+		Schema:      tmp.Schema,
+		Locations:   tmp.Locations,
 	}, nil
 }
 
@@ -76,10 +111,14 @@ type mmdbOut struct {
 	Description string
 	OutputName  string
 	OutputDir   string
-	Want        []string
+	Want        *lib.ListFilter
 	Overwrite   []string
-	Exclude     []string
+	Exclude     *lib.ListFilter
 	OnlyIPType  lib.IPType
+	Schema      string
+	Locations   string
+
+	written []string
 }
 
 func (m *mmdbOut) GetType() string {
@@ -94,36 +133,74 @@ func (m *mmdbOut) GetDescription() string {
 	return m.Description
 }
 
-func (m *mmdbOut) Output(container lib.Container) error {
-	writer, err := mmdbwriter.New(
-		mmdbwriter.Options{
-			DatabaseType:            "GeoLite2-Country",
-			Description:             map[string]string{"en": "Customized GeoLite2 Country database"},
-			RecordSize:              24,
-			IncludeReservedNetworks: true,
-		},
-	)
+// WritesIPType implements lib.IPTypeWriter.
+func (m *mmdbOut) WritesIPType() lib.IPType {
+	return m.OnlyIPType
+}
+
+func (m *mmdbOut) GetArgs() []lib.Arg {
+	return []lib.Arg{
+		lib.ArgOutputName.WithDefault(defaultOutputName),
+		lib.ArgOutputDir.WithDefault(defaultOutputDir),
+		lib.ArgWantedList,
+		{Name: "overwriteList", Type: lib.ArgTypeStringList, Description: "The lists to be written at last to overwrite the duplicated IPs & CIDRs of other lists"},
+		lib.ArgExcludedList,
+		lib.ArgOnlyIPType,
+		{Name: "schema", Type: lib.ArgTypeString, Description: "The schema of the database. The city schema writes each list named like \"US\", \"US-CA\" or \"US-CA-5368361\" as generated by " + typeCityCSV + " with the country, subdivision and city of its name", Default: schemaCountry, Enum: []string{schemaCountry, schemaCity}},
+		{Name: "locations", Type: lib.ArgTypeString, Description: "Local file path or remote HTTP(S) URL of the city locations CSV file to add the names, continent and time zone of locations from, for the city schema"},
+	}
+}
+
+func (m *mmdbOut) Output(ctx context.Context, container lib.Container) error {
+	options := mmdbwriter.Options{
+		DatabaseType:            "GeoLite2-Country",
+		BuildEpoch:              lib.BuildEpoch(),
+		Description:             map[string]string{"en": "Customized GeoLite2 Country database, built by " + lib.GetBuildInfo().String()},
+		RecordSize:              24,
+		IncludeReservedNetworks: true,
+	}
+	newRecord := countryRecord
+
+	if m.Schema == schemaCity {
+		options.DatabaseType = "GeoLite2-City"
+		options.Description = map[string]string{"en": "Customized GeoLite2 City database, built by " + lib.GetBuildInfo().String()}
+		var index *locationIndex
+		if m.Locations != "" {
+			locations, err := readCityLocations(ctx, m.Locations)
+			if err != nil {
+				return fmt.Errorf("❌ [type %s | action %s] %w", m.Type, m.Action, err)
+			}
+			index = newLocationIndex(locations)
+		}
+		newRecord = index.cityRecord
+	}
+
+	writer, err := mmdbwriter.New(options)
 	if err != nil {
 		return err
 	}
 
-	updated := false
+	lists := make([]string, 0, 300)
 	for _, name := range m.filterAndSortList(container) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		entry, found := container.GetEntry(name)
 		if !found {
-			log.Printf("❌ entry %s not found\n", name)
+			slog.Warn(fmt.Sprintf("❌ entry %s not found", name), "type", m.Type, "list", name)
 			continue
 		}
 
-		if err := m.marshalData(writer, entry); err != nil {
+		if err := m.marshalData(writer, entry, newRecord(name)); err != nil {
 			return err
 		}
 
-		updated = true
+		lists = append(lists, name)
 	}
 
-	if updated {
-		return m.writeFile(m.OutputName, writer)
+	if len(lists) > 0 {
+		return m.writeFile(m.OutputName, writer, lists...)
 	}
 
 	return nil
@@ -140,28 +217,14 @@ func (m *mmdbOut) filterAndSortList(container lib.Container) []string {
 		The order of names in wantedList has a higher priority than which of the overwriteList.
 	*/
 
-	excludeMap := make(map[string]bool)
-	for _, exclude := range m.Exclude {
-		if exclude = strings.ToUpper(strings.TrimSpace(exclude)); exclude != "" {
-			excludeMap[exclude] = true
-		}
-	}
-
-	wantList := make([]string, 0, len(m.Want))
-	for _, want := range m.Want {
-		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeMap[want] {
-			wantList = append(wantList, want)
-		}
-	}
-
-	if len(wantList) > 0 {
-		return wantList
+	if !m.Want.IsEmpty() {
+		return m.Want.Expand(container, m.Exclude)
 	}
 
 	overwriteList := make([]string, 0, len(m.Overwrite))
 	overwriteMap := make(map[string]bool)
 	for _, overwrite := range m.Overwrite {
-		if overwrite = strings.ToUpper(strings.TrimSpace(overwrite)); overwrite != "" && !excludeMap[overwrite] {
+		if overwrite = strings.ToUpper(strings.TrimSpace(overwrite)); overwrite != "" && !m.Exclude.Match(overwrite) {
 			overwriteList = append(overwriteList, overwrite)
 			overwriteMap[overwrite] = true
 		}
@@ -170,7 +233,7 @@ func (m *mmdbOut) filterAndSortList(container lib.Container) []string {
 	list := make([]string, 0, 300)
 	for entry := range container.Loop() {
 		name := entry.GetName()
-		if excludeMap[name] || overwriteMap[name] {
+		if m.Exclude.Match(name) || overwriteMap[name] {
 			continue
 		}
 		list = append(list, name)
@@ -185,33 +248,28 @@ func (m *mmdbOut) filterAndSortList(container lib.Container) []string {
 	return list
 }
 
-func (m *mmdbOut) marshalData(writer *mmdbwriter.Tree, entry *lib.Entry) error {
-	var entryCidr []string
+func (m *mmdbOut) marshalData(writer *mmdbwriter.Tree, entry *lib.Entry, record mmdbtype.Map) error {
+	var entryCidr []netip.Prefix
 	var err error
 	switch m.OnlyIPType {
 	case lib.IPv4:
-		entryCidr, err = entry.MarshalText(lib.IgnoreIPv6)
+		entryCidr, err = entry.MarshalPrefix(lib.IgnoreIPv6)
 	case lib.IPv6:
-		entryCidr, err = entry.MarshalText(lib.IgnoreIPv4)
+		entryCidr, err = entry.MarshalPrefix(lib.IgnoreIPv4)
 	default:
-		entryCidr, err = entry.MarshalText()
+		entryCidr, err = entry.MarshalPrefix()
 	}
 	if err != nil {
 		return err
 	}
 
-	record := mmdbtype.Map{
-		"country": mmdbtype.Map{
-			"iso_code": mmdbtype.String(entry.GetName()),
-		},
-	}
-
 	for _, cidr := range entryCidr {
-		_, network, err := net.ParseCIDR(cidr)
-		if err != nil {
-			return err
+		// IPv4-mapped IPv6 networks are aliased to the IPv4 networks in
+		// the database, so they are written as IPv4
+		if cidr.Addr().Is4In6() {
+			cidr = netip.PrefixFrom(cidr.Addr().Unmap(), cidr.Bits()-96)
 		}
-		if err := writer.Insert(network, record); err != nil {
+		if err := writer.Insert(netipx.PrefixIPNet(cidr), record); err != nil {
 			return err
 		}
 	}
@@ -219,22 +277,44 @@ func (m *mmdbOut) marshalData(writer *mmdbwriter.Tree, entry *lib.Entry) error {
 	return nil
 }
 
-func (m *mmdbOut) writeFile(filename string, writer *mmdbwriter.Tree) error {
-	if err := os.MkdirAll(m.OutputDir, 0755); err != nil {
+func (m *mmdbOut) writeFile(filename string, writer *mmdbwriter.Tree, lists ...string) error {
+	var buf bytes.Buffer
+	if _, err := writer.WriteTo(&buf); err != nil {
 		return err
 	}
 
-	f, err := os.OpenFile(filepath.Join(m.OutputDir, filename), os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
-	if err != nil {
+	path := filepath.Join(m.OutputDir, filename)
+	if err := lib.WriteFile(m.Type, path, buf.Bytes(), lists...); err != nil {
 		return err
 	}
+	m.written = append(m.written, path)
 
-	_, err = writer.WriteTo(f)
-	if err != nil {
-		return err
-	}
+	return nil
+}
+
+// Verify re-reads the mmdb files written by mmdbOut
+// and checks them against the container.
+func (m *mmdbOut) Verify(ctx context.Context, container lib.Container) error {
+	for _, path := range m.written {
+		in := &maxmindMMDBIn{
+			Type:   typeMaxmindMMDBIn,
+			Action: lib.ActionAdd,
+			URI:    path,
+		}
+		if m.Schema == schemaCity {
+			in.Granularity = granularityCity
+		}
+
+		reread, err := in.Input(ctx, lib.NewContainer())
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := lib.VerifyContainer(reread, container); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
 
-	log.Printf("✅ [%s] %s --> %s", m.Type, filename, m.OutputDir)
+		slog.Info(fmt.Sprintf("✅ [%s] %s verified", m.Type, path), "type", m.Type, "path", path)
+	}
 
 	return nil
 }
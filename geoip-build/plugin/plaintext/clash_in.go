@@ -24,6 +24,7 @@ func init() {
 		return newTextIn(typeClashRuleSetClassicalIn, action, data)
 	})
 	lib.RegisterInputConverter(typeClashRuleSetClassicalIn, &textIn{
+		Type:        typeClashRuleSetClassicalIn,
 		Description: descClashClassicalIn,
 	})
 
@@ -31,6 +32,7 @@ func init() {
 		return newTextIn(typeClashRuleSetIPCIDRIn, action, data)
 	})
 	lib.RegisterInputConverter(typeClashRuleSetIPCIDRIn, &textIn{
+		Type:        typeClashRuleSetIPCIDRIn,
 		Description: descClashRuleSetIn,
 	})
 }
@@ -24,6 +24,7 @@ func init() {
 		return newTextOut(typeClashRuleSetClassicalOut, action, data)
 	})
 	lib.RegisterOutputConverter(typeClashRuleSetClassicalOut, &textOut{
+		Type:        typeClashRuleSetClassicalOut,
 		Description: descClashClassicalOut,
 	})
 
@@ -31,6 +32,7 @@ func init() {
 		return newTextOut(typeClashRuleSetIPCIDROut, action, data)
 	})
 	lib.RegisterOutputConverter(typeClashRuleSetIPCIDROut, &textOut{
+		Type:        typeClashRuleSetIPCIDROut,
 		Description: descClashRuleSetOut,
 	})
 }
@@ -2,6 +2,7 @@ package plaintext
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"strings"
@@ -19,7 +20,7 @@ type textIn struct {
 	URI         string
 	IPOrCIDR    []string
 	InputDir    string
-	Want        map[string]bool
+	Want        *lib.ListFilter
 	OnlyIPType  lib.IPType
 
 	JSONPath             []string
@@ -27,19 +28,21 @@ type textIn struct {
 	RemoveSuffixesInLine []string
 }
 
-func (t *textIn) scanFile(reader io.Reader, entry *lib.Entry) error {
+// scanFile adds the CIDRs of the file of source read from reader to entry,
+// with the invalid lines collected by lib.AddLine.
+func (t *textIn) scanFile(ctx context.Context, reader io.Reader, entry *lib.Entry, source string) error {
 	var err error
 	switch t.Type {
 	case typeTextIn:
-		err = t.scanFileForTextIn(reader, entry)
+		err = t.scanFileForTextIn(ctx, reader, entry, source)
 	case typeJSONIn:
-		err = t.scanFileForJSONIn(reader, entry)
+		err = t.scanFileForJSONIn(ctx, reader, entry, source)
 	case typeClashRuleSetClassicalIn:
-		err = t.scanFileForClashClassicalRuleSetIn(reader, entry)
+		err = t.scanFileForClashClassicalRuleSetIn(ctx, reader, entry, source)
 	case typeClashRuleSetIPCIDRIn:
-		err = t.scanFileForClashIPCIDRRuleSetIn(reader, entry)
+		err = t.scanFileForClashIPCIDRRuleSetIn(ctx, reader, entry, source)
 	case typeSurgeRuleSetIn:
-		err = t.scanFileForSurgeRuleSetIn(reader, entry)
+		err = t.scanFileForSurgeRuleSetIn(ctx, reader, entry, source)
 	default:
 		return lib.ErrNotSupportedFormat
 	}
@@ -47,9 +50,9 @@ func (t *textIn) scanFile(reader io.Reader, entry *lib.Entry) error {
 	return err
 }
 
-func (t *textIn) scanFileForTextIn(reader io.Reader, entry *lib.Entry) error {
+func (t *textIn) scanFileForTextIn(ctx context.Context, reader io.Reader, entry *lib.Entry, source string) error {
 	scanner := bufio.NewScanner(reader)
-	for scanner.Scan() {
+	for lineNo := 1; scanner.Scan(); lineNo++ {
 		line := scanner.Text()
 
 		line, _, _ = strings.Cut(line, "#")
@@ -72,7 +75,7 @@ func (t *textIn) scanFileForTextIn(reader io.Reader, entry *lib.Entry) error {
 			continue
 		}
 
-		if err := entry.AddPrefix(line); err != nil {
+		if err := lib.AddLine(ctx, entry, source, lineNo, line); err != nil {
 			return err
 		}
 	}
@@ -100,18 +103,19 @@ func (t *textIn) readClashRuleSetYAMLFile(reader io.Reader) ([]string, error) {
 	return payload.Payload, nil
 }
 
-func (t *textIn) scanFileForClashIPCIDRRuleSetIn(reader io.Reader, entry *lib.Entry) error {
+func (t *textIn) scanFileForClashIPCIDRRuleSetIn(ctx context.Context, reader io.Reader, entry *lib.Entry, source string) error {
 	payload, err := t.readClashRuleSetYAMLFile(reader)
 	if err != nil {
 		return err
 	}
 
-	for _, cidrStr := range payload {
+	// Items of payload are numbered as lines
+	for idx, cidrStr := range payload {
 		cidrStr = strings.TrimSpace(cidrStr)
 		if cidrStr == "" {
 			continue
 		}
-		if err := entry.AddPrefix(cidrStr); err != nil {
+		if err := lib.AddLine(ctx, entry, source, idx+1, cidrStr); err != nil {
 			return err
 		}
 	}
@@ -119,13 +123,14 @@ func (t *textIn) scanFileForClashIPCIDRRuleSetIn(reader io.Reader, entry *lib.En
 	return nil
 }
 
-func (t *textIn) scanFileForClashClassicalRuleSetIn(reader io.Reader, entry *lib.Entry) error {
+func (t *textIn) scanFileForClashClassicalRuleSetIn(ctx context.Context, reader io.Reader, entry *lib.Entry, source string) error {
 	payload, err := t.readClashRuleSetYAMLFile(reader)
 	if err != nil {
 		return err
 	}
 
-	for _, line := range payload {
+	// Items of payload are numbered as lines
+	for idx, line := range payload {
 		line = strings.ToLower(strings.TrimSpace(line))
 		if line == "" {
 			continue
@@ -145,7 +150,7 @@ func (t *textIn) scanFileForClashClassicalRuleSetIn(reader io.Reader, entry *lib
 			if line == "" {
 				continue
 			}
-			if err := entry.AddPrefix(line); err != nil {
+			if err := lib.AddLine(ctx, entry, source, idx+1, line); err != nil {
 				return err
 			}
 		}
@@ -154,9 +159,9 @@ func (t *textIn) scanFileForClashClassicalRuleSetIn(reader io.Reader, entry *lib
 	return nil
 }
 
-func (t *textIn) scanFileForSurgeRuleSetIn(reader io.Reader, entry *lib.Entry) error {
+func (t *textIn) scanFileForSurgeRuleSetIn(ctx context.Context, reader io.Reader, entry *lib.Entry, source string) error {
 	scanner := bufio.NewScanner(reader)
-	for scanner.Scan() {
+	for lineNo := 1; scanner.Scan(); lineNo++ {
 		line := scanner.Text()
 
 		line, _, _ = strings.Cut(line, "#")
@@ -181,7 +186,7 @@ func (t *textIn) scanFileForSurgeRuleSetIn(reader io.Reader, entry *lib.Entry) e
 			if line == "" {
 				continue
 			}
-			if err := entry.AddPrefix(line); err != nil {
+			if err := lib.AddLine(ctx, entry, source, lineNo, line); err != nil {
 				return err
 			}
 		}
@@ -193,7 +198,7 @@ func (t *textIn) scanFileForSurgeRuleSetIn(reader io.Reader, entry *lib.Entry) e
 	return nil
 }
 
-func (t *textIn) scanFileForJSONIn(reader io.Reader, entry *lib.Entry) error {
+func (t *textIn) scanFileForJSONIn(ctx context.Context, reader io.Reader, entry *lib.Entry, source string) error {
 	data, err := io.ReadAll(reader)
 	if err != nil {
 		return err
@@ -208,9 +213,10 @@ func (t *textIn) scanFileForJSONIn(reader io.Reader, entry *lib.Entry) error {
 	for _, path := range t.JSONPath {
 		path = strings.TrimSpace(path)
 
+		// Items of the result are numbered as lines, prefixed by the path
 		result := gjson.GetBytes(data, path)
-		for _, cidr := range result.Array() {
-			if err := entry.AddPrefix(cidr.String()); err != nil {
+		for idx, cidr := range result.Array() {
+			if err := lib.AddLine(ctx, entry, source+"#"+path, idx+1, cidr.String()); err != nil {
 				return err
 			}
 		}
@@ -2,11 +2,12 @@ package plaintext
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"log"
-	"net"
-	"os"
+	"fmt"
+	"log/slog"
 	"path/filepath"
+	"strings"
 
 	"github.com/Loyalsoldier/geoip/lib"
 )
@@ -24,12 +25,28 @@ type textOut struct {
 	Description string
 	OutputDir   string
 	OutputExt   string
-	Want        []string
-	Exclude     []string
+	Want        *lib.ListFilter
+	Exclude     *lib.ListFilter
 	OnlyIPType  lib.IPType
+	Naming      *lib.ListNaming
+	// MetadataHeader writes the metadata of each list as a header comment block.
+	MetadataHeader bool
 
 	AddPrefixInLine string
 	AddSuffixInLine string
+
+	// MaxFileSize is the maximum size of each file, lists larger than which
+	// are split into numbered parts listed by an index file, or 0 if unlimited.
+	MaxFileSize int64
+
+	written []writtenFile
+}
+
+// writtenFile is the files written by textOut for a list, which are more
+// than one if the list is split into parts, and the name of the list.
+type writtenFile struct {
+	paths []string
+	name  string
 }
 
 func newTextOut(iType string, action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
@@ -39,9 +56,16 @@ func newTextOut(iType string, action lib.Action, data json.RawMessage) (lib.Outp
 		Want       []string   `json:"wantedList"`
 		Exclude    []string   `json:"excludedList"`
 		OnlyIPType lib.IPType `json:"onlyIPType"`
+		NameCase   string     `json:"nameCase"`
+		NamePrefix string     `json:"namePrefix"`
+		NameSuffix string     `json:"nameSuffix"`
+
+		MetadataHeader bool `json:"metadataHeader"`
 
 		AddPrefixInLine string `json:"addPrefixInLine"`
 		AddSuffixInLine string `json:"addSuffixInLine"`
+
+		MaxFileSize string `json:"maxFileSize"`
 	}
 
 	if len(data) > 0 {
@@ -67,38 +91,130 @@ func newTextOut(iType string, action lib.Action, data json.RawMessage) (lib.Outp
 		tmp.OutputExt = ".txt"
 	}
 
+	var maxFileSize int64
+	if tmp.MaxFileSize != "" {
+		size, err := lib.ParseSize(tmp.MaxFileSize)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("❌ [type %s | action %s] invalid maxFileSize %q: must be a positive size like \"8MB\"", iType, action, tmp.MaxFileSize)
+		}
+		maxFileSize = size
+	}
+
+	wantList, err := lib.NewListFilter(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid wantedList: %v", iType, action, err)
+	}
+
+	excludeList, err := lib.NewListFilter(tmp.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid excludedList: %v", iType, action, err)
+	}
+
+	naming, err := lib.NewListNaming(tmp.NameCase, tmp.NamePrefix, tmp.NameSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v", iType, action, err)
+	}
+
 	return &textOut{
 		Type:        iType,
 		Action:      action,
 		Description: descTextOut,
 		OutputDir:   tmp.OutputDir,
 		OutputExt:   tmp.OutputExt,
-		Want:        tmp.Want,
-		Exclude:     tmp.Exclude,
+		Want:        wantList,
+		Exclude:     excludeList,
 		OnlyIPType:  tmp.OnlyIPType,
+		Naming:      naming,
+
+		MetadataHeader: tmp.MetadataHeader,
 
 		AddPrefixInLine: tmp.AddPrefixInLine,
 		AddSuffixInLine: tmp.AddSuffixInLine,
+
+		MaxFileSize: maxFileSize,
 	}, nil
 }
 
-func (t *textOut) marshalBytes(entry *lib.Entry) ([]byte, error) {
-	var err error
-
-	var entryCidr []string
+func (t *textOut) entryCIDRs(entry *lib.Entry) ([]string, error) {
 	switch t.OnlyIPType {
 	case lib.IPv4:
-		entryCidr, err = entry.MarshalText(lib.IgnoreIPv6)
+		return entry.MarshalText(lib.IgnoreIPv6)
 	case lib.IPv6:
-		entryCidr, err = entry.MarshalText(lib.IgnoreIPv4)
+		return entry.MarshalText(lib.IgnoreIPv4)
 	default:
-		entryCidr, err = entry.MarshalText()
+		return entry.MarshalText()
+	}
+}
+
+func (t *textOut) marshalBytes(entry *lib.Entry) ([]byte, error) {
+	entryCidr, err := t.entryCIDRs(entry)
+	if err != nil {
+		return nil, err
 	}
+	return t.marshalCIDRs(entry, entryCidr)
+}
+
+// marshalParts returns the content of the file of entry, or the contents
+// of its parts if it is larger than MaxFileSize, each of which is a file
+// of the format on its own with at most MaxFileSize bytes.
+func (t *textOut) marshalParts(entry *lib.Entry) ([][]byte, error) {
+	entryCidr, err := t.entryCIDRs(entry)
 	if err != nil {
 		return nil, err
 	}
+	data, err := t.marshalCIDRs(entry, entryCidr)
+	if err != nil {
+		return nil, err
+	}
+	if t.MaxFileSize <= 0 || int64(len(data)) <= t.MaxFileSize {
+		return [][]byte{data}, nil
+	}
 
+	header, err := t.marshalCIDRs(entry, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([][]byte, 0, 2)
+	start, size := 0, int64(len(header))
+	for idx, cidr := range entryCidr {
+		line, err := t.marshalCIDRs(entry, []string{cidr})
+		if err != nil {
+			return nil, err
+		}
+		lineSize := int64(len(line) - len(header))
+		if int64(len(header))+lineSize > t.MaxFileSize {
+			return nil, fmt.Errorf("❌ [type %s | action %s] maxFileSize %d is too small for a single CIDR of list %s", t.Type, t.Action, t.MaxFileSize, entry.GetName())
+		}
+		if size+lineSize > t.MaxFileSize {
+			part, err := t.marshalCIDRs(entry, entryCidr[start:idx])
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, part)
+			start, size = idx, int64(len(header))
+		}
+		size += lineSize
+	}
+	part, err := t.marshalCIDRs(entry, entryCidr[start:])
+	if err != nil {
+		return nil, err
+	}
+	return append(parts, part), nil
+}
+
+// marshalCIDRs returns the content of a file of entry with entryCidr.
+func (t *textOut) marshalCIDRs(entry *lib.Entry, entryCidr []string) ([]byte, error) {
+	var err error
 	var buf bytes.Buffer
+	if t.MetadataHeader {
+		// Lines starting with "#" are comments in all formats
+		for _, line := range lib.MetadataHeader(entry) {
+			buf.WriteString("# ")
+			buf.WriteString(line)
+			buf.WriteString("\n")
+		}
+	}
 	switch t.Type {
 	case typeTextOut:
 		err = t.marshalBytesForTextOut(&buf, entryCidr)
@@ -135,11 +251,7 @@ func (t *textOut) marshalBytesForTextOut(buf *bytes.Buffer, entryCidr []string)
 func (t *textOut) marshalBytesForClashRuleSetClassicalOut(buf *bytes.Buffer, entryCidr []string) error {
 	buf.WriteString("payload:\n")
 	for _, cidr := range entryCidr {
-		ip, _, err := net.ParseCIDR(cidr)
-		if err != nil {
-			return err
-		}
-		if ip.To4() != nil {
+		if !strings.Contains(cidr, ":") {
 			buf.WriteString("  - IP-CIDR,")
 		} else {
 			buf.WriteString("  - IP-CIDR6,")
@@ -164,11 +276,7 @@ func (t *textOut) marshalBytesForClashRuleSetIPCIDROut(buf *bytes.Buffer, entryC
 
 func (t *textOut) marshalBytesForSurgeRuleSetOut(buf *bytes.Buffer, entryCidr []string) error {
 	for _, cidr := range entryCidr {
-		ip, _, err := net.ParseCIDR(cidr)
-		if err != nil {
-			return err
-		}
-		if ip.To4() != nil {
+		if !strings.Contains(cidr, ":") {
 			buf.WriteString("IP-CIDR,")
 		} else {
 			buf.WriteString("IP-CIDR6,")
@@ -183,16 +291,71 @@ func (t *textOut) marshalBytesForSurgeRuleSetOut(buf *bytes.Buffer, entryCidr []
 	return nil
 }
 
-func (t *textOut) writeFile(filename string, data []byte) error {
-	if err := os.MkdirAll(t.OutputDir, 0755); err != nil {
+func (t *textOut) writeFile(filename, name string, data []byte) error {
+	path := filepath.Join(t.OutputDir, filename)
+	if err := lib.WriteFile(t.Type, path, data, name); err != nil {
 		return err
 	}
+	t.written = append(t.written, writtenFile{paths: []string{path}, name: name})
 
-	if err := os.WriteFile(filepath.Join(t.OutputDir, filename), data, 0644); err != nil {
+	return nil
+}
+
+// writeParts writes the parts of the list name as numbered files, e.g.
+// "cn.1.txt" and "cn.2.txt", and the index file "cn.index" listing the
+// names of the files of the parts one per line in order.
+func (t *textOut) writeParts(name string, parts [][]byte) error {
+	file := writtenFile{paths: make([]string, 0, len(parts)), name: name}
+	var index bytes.Buffer
+	for idx, data := range parts {
+		filename := t.Naming.FileName(name, fmt.Sprintf(".%d%s", idx+1, t.OutputExt))
+		path := filepath.Join(t.OutputDir, filename)
+		if err := lib.WriteFile(t.Type, path, data, name); err != nil {
+			return err
+		}
+		file.paths = append(file.paths, path)
+		index.WriteString(filename + "\n")
+	}
+	if err := lib.WriteFile(t.Type, filepath.Join(t.OutputDir, t.Naming.FileName(name, ".index")), index.Bytes(), name); err != nil {
 		return err
 	}
+	t.written = append(t.written, file)
+	slog.Info(fmt.Sprintf("✂️ [%s] list %s is split into %d parts of at most %d bytes", t.Type, name, len(parts), t.MaxFileSize), "type", t.Type, "list", name, "parts", len(parts))
+
+	return nil
+}
+
+// Verify re-reads the files written by textOut with the input converter
+// of the same format, and checks them against the container. The parts
+// of a list are checked as a whole.
+func (t *textOut) Verify(ctx context.Context, container lib.Container) error {
+	for _, file := range t.written {
+		reread := lib.NewContainer()
+		for _, path := range file.paths {
+			in := &textIn{
+				Type:   t.Type,
+				Action: lib.ActionAdd,
+				Name:   file.name,
+				URI:    path,
+			}
+			if t.AddPrefixInLine != "" {
+				in.RemovePrefixesInLine = []string{t.AddPrefixInLine}
+			}
+			if t.AddSuffixInLine != "" {
+				in.RemoveSuffixesInLine = []string{t.AddSuffixInLine}
+			}
 
-	log.Printf("✅ [%s] %s --> %s", t.Type, filename, t.OutputDir)
+			if _, err := in.Input(ctx, reread); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+		path := strings.Join(file.paths, ", ")
+		if err := lib.VerifyContainer(reread, container); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		slog.Info(fmt.Sprintf("✅ [%s] %s verified", t.Type, path), "type", t.Type, "path", path)
+	}
 
 	return nil
 }
@@ -17,6 +17,7 @@ func init() {
 	})
 
 	lib.RegisterInputConverter(typeJSONIn, &textIn{
+		Type:        typeJSONIn,
 		Description: descJSONIn,
 	})
 }
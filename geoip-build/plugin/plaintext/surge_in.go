@@ -21,6 +21,7 @@ func init() {
 		return newTextIn(typeSurgeRuleSetIn, action, data)
 	})
 	lib.RegisterInputConverter(typeSurgeRuleSetIn, &textIn{
+		Type:        typeSurgeRuleSetIn,
 		Description: descSurgeRuleSetIn,
 	})
 }
@@ -21,6 +21,7 @@ func init() {
 		return newTextOut(typeSurgeRuleSetOut, action, data)
 	})
 	lib.RegisterOutputConverter(typeSurgeRuleSetOut, &textOut{
+		Type:        typeSurgeRuleSetOut,
 		Description: descSurgeRuleSetOut,
 	})
 }
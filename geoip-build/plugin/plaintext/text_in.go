@@ -1,9 +1,9 @@
 package plaintext
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -22,6 +22,7 @@ func init() {
 		return newTextIn(typeTextIn, action, data)
 	})
 	lib.RegisterInputConverter(typeTextIn, &textIn{
+		Type:        typeTextIn,
 		Description: descTextIn,
 	})
 }
@@ -70,11 +71,9 @@ func newTextIn(iType string, action lib.Action, data json.RawMessage) (lib.Input
 	}
 
 	// Filter want list
-	wantList := make(map[string]bool)
-	for _, want := range tmp.Want {
-		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" {
-			wantList[want] = true
-		}
+	wantList, err := lib.NewListFilter(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid wantedList: %v", iType, action, err)
 	}
 
 	return &textIn{
@@ -106,20 +105,53 @@ func (t *textIn) GetDescription() string {
 	return t.Description
 }
 
-func (t *textIn) Input(container lib.Container) (lib.Container, error) {
+func (t *textIn) GetArgs() []lib.Arg {
+	args := []lib.Arg{
+		{Name: "name", Type: lib.ArgTypeString, Description: "The name of the list, required when using uri or ipOrCIDR"},
+		lib.ArgURI,
+	}
+
+	switch t.Type {
+	case typeTextIn:
+		args = append(args,
+			lib.Arg{Name: "ipOrCIDR", Type: lib.ArgTypeStringList, Description: "IPs & CIDRs of the list"},
+		)
+	case typeJSONIn:
+		args = append(args,
+			lib.Arg{Name: "jsonPath", Type: lib.ArgTypeStringList, Description: "The JSON paths to the IPs & CIDRs, see https://github.com/tidwall/gjson/blob/master/SYNTAX.md", Required: true},
+		)
+	}
+
+	args = append(args,
+		lib.Arg{Name: "inputDir", Type: lib.ArgTypeString, Description: "The directory of the input files, of which filenames without extension are the names of the lists (cannot be used with name, uri or ipOrCIDR)"},
+		lib.ArgWantedList,
+		lib.ArgOnlyIPType,
+	)
+
+	if t.Type == typeTextIn {
+		args = append(args,
+			lib.Arg{Name: "removePrefixesInLine", Type: lib.ArgTypeStringList, Description: "The prefixes to be removed in each line"},
+			lib.Arg{Name: "removeSuffixesInLine", Type: lib.ArgTypeStringList, Description: "The suffixes to be removed in each line"},
+		)
+	}
+
+	return args
+}
+
+func (t *textIn) Input(ctx context.Context, container lib.Container) (lib.Container, error) {
 	entries := make(map[string]*lib.Entry)
 	var err error
 
 	switch {
 	case t.InputDir != "":
-		err = t.walkDir(t.InputDir, entries)
+		err = t.walkDir(ctx, t.InputDir, entries)
 
 	case t.Name != "" && t.URI != "":
 		switch {
 		case strings.HasPrefix(strings.ToLower(t.URI), "http://"), strings.HasPrefix(strings.ToLower(t.URI), "https://"):
-			err = t.walkRemoteFile(t.URI, t.Name, entries)
+			err = t.walkRemoteFile(ctx, t.URI, t.Name, entries)
 		default:
-			err = t.walkLocalFile(t.URI, t.Name, entries)
+			err = t.walkLocalFile(ctx, t.URI, t.Name, entries)
 		}
 		if err != nil {
 			return nil, err
@@ -168,7 +200,7 @@ func (t *textIn) Input(container lib.Container) (lib.Container, error) {
 	return container, nil
 }
 
-func (t *textIn) walkDir(dir string, entries map[string]*lib.Entry) error {
+func (t *textIn) walkDir(ctx context.Context, dir string, entries map[string]*lib.Entry) error {
 	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -177,7 +209,7 @@ func (t *textIn) walkDir(dir string, entries map[string]*lib.Entry) error {
 			return nil
 		}
 
-		if err := t.walkLocalFile(path, "", entries); err != nil {
+		if err := t.walkLocalFile(ctx, path, "", entries); err != nil {
 			return err
 		}
 
@@ -187,7 +219,7 @@ func (t *textIn) walkDir(dir string, entries map[string]*lib.Entry) error {
 	return err
 }
 
-func (t *textIn) walkLocalFile(path, name string, entries map[string]*lib.Entry) error {
+func (t *textIn) walkLocalFile(ctx context.Context, path, name string, entries map[string]*lib.Entry) error {
 	entryName := ""
 	name = strings.TrimSpace(name)
 	if name != "" {
@@ -209,7 +241,7 @@ func (t *textIn) walkLocalFile(path, name string, entries map[string]*lib.Entry)
 
 	entryName = strings.ToUpper(entryName)
 
-	if len(t.Want) > 0 && !t.Want[entryName] {
+	if !t.Want.Wants(entryName) {
 		return nil
 	}
 	if _, found := entries[entryName]; found {
@@ -217,12 +249,12 @@ func (t *textIn) walkLocalFile(path, name string, entries map[string]*lib.Entry)
 	}
 
 	entry := lib.NewEntry(entryName)
-	file, err := os.Open(path)
+	file, err := lib.OpenURI(ctx, path)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
-	if err := t.scanFile(file, entry); err != nil {
+	if err := t.scanFile(ctx, file, entry, path); err != nil {
 		return err
 	}
 
@@ -231,25 +263,21 @@ func (t *textIn) walkLocalFile(path, name string, entries map[string]*lib.Entry)
 	return nil
 }
 
-func (t *textIn) walkRemoteFile(url, name string, entries map[string]*lib.Entry) error {
-	resp, err := http.Get(url)
+func (t *textIn) walkRemoteFile(ctx context.Context, url, name string, entries map[string]*lib.Entry) error {
+	body, err := lib.GetRemoteURLReader(ctx, url)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("❌ [type %s | action %s] failed to get remote file %s, http status code %d", t.Type, t.Action, url, resp.StatusCode)
-	}
+	defer body.Close()
 
 	name = strings.ToUpper(name)
 
-	if len(t.Want) > 0 && !t.Want[name] {
+	if !t.Want.Wants(name) {
 		return nil
 	}
 
 	entry := lib.NewEntry(name)
-	if err := t.scanFile(resp.Body, entry); err != nil {
+	if err := t.scanFile(ctx, body, entry, url); err != nil {
 		return err
 	}
 
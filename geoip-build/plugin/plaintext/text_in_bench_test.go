@@ -0,0 +1,51 @@
+package plaintext
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Loyalsoldier/geoip/lib"
+)
+
+// BenchmarkTextIn parses a text file of 150k IPv4 and 50k IPv6 random
+// CIDRs, which are the same in every run.
+func BenchmarkTextIn(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "cn.txt")
+	f, err := os.Create(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	r := rand.New(rand.NewPCG(1, 1))
+	for range 150000 {
+		fmt.Fprintf(w, "%d.%d.%d.0/%d\n", r.IntN(224), r.IntN(256), r.IntN(256), 16+r.IntN(9))
+	}
+	for range 50000 {
+		fmt.Fprintf(w, "2%03x:%x:%x::/%d\n", r.IntN(0x1000), r.IntN(0x10000), r.IntN(0x10000), 32+r.IntN(17))
+	}
+	if err := w.Flush(); err != nil {
+		b.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		b.Fatal(err)
+	}
+
+	args, _ := json.Marshal(map[string]string{"name": "cn", "uri": path})
+	in, err := newTextIn(typeTextIn, lib.ActionAdd, args)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		if _, err := in.Input(context.Background(), lib.NewContainer()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
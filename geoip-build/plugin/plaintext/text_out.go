@@ -1,10 +1,11 @@
 package plaintext
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
 	"slices"
-	"strings"
 
 	"github.com/Loyalsoldier/geoip/lib"
 )
@@ -19,6 +20,7 @@ func init() {
 		return newTextOut(typeTextOut, action, data)
 	})
 	lib.RegisterOutputConverter(typeTextOut, &textOut{
+		Type:        typeTextOut,
 		Description: descTextOut,
 	})
 }
@@ -35,21 +37,65 @@ func (t *textOut) GetDescription() string {
 	return t.Description
 }
 
-func (t *textOut) Output(container lib.Container) error {
+// WritesIPType implements lib.IPTypeWriter.
+func (t *textOut) WritesIPType() lib.IPType {
+	return t.OnlyIPType
+}
+
+func (t *textOut) GetArgs() []lib.Arg {
+	args := []lib.Arg{
+		lib.ArgOutputDir,
+		{Name: "outputExtension", Type: lib.ArgTypeString, Description: "The extension of the output files", Default: ".txt"},
+		lib.ArgWantedList,
+		lib.ArgExcludedList,
+		lib.ArgOnlyIPType,
+		lib.ArgNameCase,
+		lib.ArgNamePrefix,
+		lib.ArgNameSuffix,
+		lib.ArgMetadataHeader,
+		{Name: "maxFileSize", Type: lib.ArgTypeString, Description: "The maximum size of each output file like \"8MB\", lists larger than which are split into numbered parts like \"cn.1.txt\" and \"cn.2.txt\" with an index file \"cn.index\" listing them"},
+	}
+
+	switch t.Type {
+	case typeTextOut:
+		args = append(args,
+			lib.Arg{Name: "addPrefixInLine", Type: lib.ArgTypeString, Description: "The prefix to be added in each line"},
+			lib.Arg{Name: "addSuffixInLine", Type: lib.ArgTypeString, Description: "The suffix to be added in each line"},
+		)
+	case typeSurgeRuleSetOut:
+		args = append(args,
+			lib.Arg{Name: "addSuffixInLine", Type: lib.ArgTypeString, Description: "The suffix to be added in each line"},
+		)
+	}
+
+	return args
+}
+
+func (t *textOut) Output(ctx context.Context, container lib.Container) error {
 	for _, name := range t.filterAndSortList(container) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		entry, found := container.GetEntry(name)
 		if !found {
-			log.Printf("❌ entry %s not found\n", name)
+			slog.Warn(fmt.Sprintf("❌ entry %s not found", name), "type", t.Type, "list", name)
 			continue
 		}
 
-		data, err := t.marshalBytes(entry)
+		parts, err := t.marshalParts(entry)
 		if err != nil {
 			return err
 		}
 
-		filename := strings.ToLower(entry.GetName()) + t.OutputExt
-		if err := t.writeFile(filename, data); err != nil {
+		if len(parts) > 1 {
+			if err := t.writeParts(entry.GetName(), parts); err != nil {
+				return err
+			}
+			continue
+		}
+		filename := t.Naming.FileName(entry.GetName(), t.OutputExt)
+		if err := t.writeFile(filename, entry.GetName(), parts[0]); err != nil {
 			return err
 		}
 	}
@@ -58,21 +104,8 @@ func (t *textOut) Output(container lib.Container) error {
 }
 
 func (t *textOut) filterAndSortList(container lib.Container) []string {
-	excludeMap := make(map[string]bool)
-	for _, exclude := range t.Exclude {
-		if exclude = strings.ToUpper(strings.TrimSpace(exclude)); exclude != "" {
-			excludeMap[exclude] = true
-		}
-	}
-
-	wantList := make([]string, 0, len(t.Want))
-	for _, want := range t.Want {
-		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeMap[want] {
-			wantList = append(wantList, want)
-		}
-	}
-
-	if len(wantList) > 0 {
+	if !t.Want.IsEmpty() {
+		wantList := t.Want.Expand(container, t.Exclude)
 		// Sort the list
 		slices.Sort(wantList)
 		return wantList
@@ -81,7 +114,7 @@ func (t *textOut) filterAndSortList(container lib.Container) []string {
 	list := make([]string, 0, 300)
 	for entry := range container.Loop() {
 		name := entry.GetName()
-		if excludeMap[name] {
+		if t.Exclude.Match(name) {
 			continue
 		}
 		list = append(list, name)
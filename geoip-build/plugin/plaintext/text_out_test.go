@@ -0,0 +1,163 @@
+package plaintext
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Loyalsoldier/geoip/lib"
+)
+
+// testSplitContainer returns a container of the list cn of 40 IPv4 and 10
+// IPv6 CIDRs not aggregated, and the list us of a single CIDR.
+func testSplitContainer(t *testing.T) lib.Container {
+	t.Helper()
+	container := lib.NewContainer()
+	cn := lib.NewEntry("cn")
+	for i := range 40 {
+		if err := cn.AddPrefix(fmt.Sprintf("10.0.%d.0/24", 2*i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range 10 {
+		if err := cn.AddPrefix(fmt.Sprintf("2001:db8:%x::/48", 2*i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	us := lib.NewEntry("us")
+	if err := us.AddPrefix("192.0.2.0/24"); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range []*lib.Entry{cn, us} {
+		if err := container.Add(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return container
+}
+
+// testTextOut returns an output of oType writing to a temporary directory
+// with the args.
+func testTextOut(t *testing.T, oType string, args map[string]any) *textOut {
+	t.Helper()
+	args["outputDir"] = t.TempDir()
+	data, err := json.Marshal(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := newTextOut(oType, lib.ActionOutput, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.(*textOut)
+}
+
+// readLines returns the lines of the file at path.
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) == 0 || data[len(data)-1] != '\n' {
+		t.Errorf("%s = %q, want lines ending with a newline", path, data)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func TestTextOutMaxFileSize(t *testing.T) {
+	tests := []struct {
+		oType string
+		// header is the lines at the beginning of every file of the format.
+		header []string
+	}{
+		{oType: typeTextOut},
+		{oType: typeClashRuleSetIPCIDROut, header: []string{"payload:"}},
+		{oType: typeClashRuleSetClassicalOut, header: []string{"payload:"}},
+		{oType: typeSurgeRuleSetOut},
+	}
+
+	const maxFileSize = 200
+	for _, tt := range tests {
+		t.Run(tt.oType, func(t *testing.T) {
+			container := testSplitContainer(t)
+
+			whole := testTextOut(t, tt.oType, map[string]any{})
+			if err := whole.Output(context.Background(), container); err != nil {
+				t.Fatal(err)
+			}
+			wantLines := readLines(t, filepath.Join(whole.OutputDir, "cn.txt"))[len(tt.header):]
+
+			split := testTextOut(t, tt.oType, map[string]any{"maxFileSize": fmt.Sprint(maxFileSize)})
+			if err := split.Output(context.Background(), container); err != nil {
+				t.Fatal(err)
+			}
+
+			// The index lists the parts in order, which are all the files
+			// of the list along with the index
+			index := readLines(t, filepath.Join(split.OutputDir, "cn.index"))
+			if len(index) < 2 {
+				t.Fatalf("cn.index = %q, want at least 2 parts", index)
+			}
+			for idx, filename := range index {
+				if want := fmt.Sprintf("cn.%d.txt", idx+1); filename != want {
+					t.Errorf("part %d = %s, want %s", idx+1, filename, want)
+				}
+			}
+			files, err := filepath.Glob(filepath.Join(split.OutputDir, "cn.*"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != len(index)+1 {
+				t.Errorf("files of list cn = %v, want %d parts and the index", files, len(index))
+			}
+
+			// Each part is a file of the format on its own within the size,
+			// and the parts have all the lines in order, none of which is
+			// split across parts
+			var gotLines []string
+			for _, filename := range index {
+				path := filepath.Join(split.OutputDir, filename)
+				info, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Size() > maxFileSize {
+					t.Errorf("%s has %d bytes, more than %d", filename, info.Size(), maxFileSize)
+				}
+				lines := readLines(t, path)
+				if !slices.Equal(lines[:len(tt.header)], tt.header) {
+					t.Errorf("%s starts with %q, want %q", filename, lines[:len(tt.header)], tt.header)
+				}
+				if len(lines) == len(tt.header) {
+					t.Errorf("%s has no CIDRs", filename)
+				}
+				gotLines = append(gotLines, lines[len(tt.header):]...)
+			}
+			if !slices.Equal(gotLines, wantLines) {
+				t.Errorf("lines of the parts = %q, want %q", gotLines, wantLines)
+			}
+
+			// Lists within the size are not split
+			if _, err := os.Stat(filepath.Join(split.OutputDir, "us.txt")); err != nil {
+				t.Errorf("us.txt is not written: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(split.OutputDir, "us.index")); !os.IsNotExist(err) {
+				t.Errorf("us.index is written, want none: %v", err)
+			}
+		})
+	}
+}
+
+func TestTextOutMaxFileSizeTooSmall(t *testing.T) {
+	out := testTextOut(t, typeClashRuleSetIPCIDROut, map[string]any{"maxFileSize": "16"})
+	err := out.Output(context.Background(), testSplitContainer(t))
+	if err == nil || !strings.Contains(err.Error(), "maxFileSize 16 is too small for a single CIDR of list CN") {
+		t.Errorf("Output error = %v, want maxFileSize too small", err)
+	}
+}
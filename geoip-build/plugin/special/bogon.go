@@ -0,0 +1,228 @@
+package special
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Loyalsoldier/geoip/lib"
+)
+
+const (
+	typeBogon = "bogon"
+	descBogon = "Remove bogon, reserved and unallocated space, and optionally known anycast ranges, from the lists generated by previous steps"
+)
+
+// bogonCIDRs are the reserved IPv4 ranges, and the IPv6 ranges outside the
+// global unicast space 2000::/3 and the reserved ones in it, which are never
+// routed on the Internet and so belong to no country.
+var bogonCIDRs = []string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/3",
+	"4000::/2",
+	"8000::/1",
+	"2001:2::/48",
+	"2001:10::/28",
+	"2001:20::/28",
+	"2001:db8::/32",
+	"3fff::/20",
+}
+
+// anycastCIDRs are the known anycast ranges announced from all over the
+// world, which upstream data often locates to the country of the operator.
+var anycastCIDRs = []string{
+	"1.0.0.0/24",          // Cloudflare DNS
+	"1.1.1.0/24",          // Cloudflare DNS
+	"8.8.4.0/24",          // Google Public DNS
+	"8.8.8.0/24",          // Google Public DNS
+	"9.9.9.0/24",          // Quad9
+	"149.112.112.0/24",    // Quad9
+	"192.88.99.0/24",      // 6to4 relay anycast, deprecated
+	"208.67.220.0/24",     // OpenDNS
+	"208.67.222.0/24",     // OpenDNS
+	"2001:4860:4860::/48", // Google Public DNS
+	"2606:4700:4700::/48", // Cloudflare DNS
+	"2620:fe::/48",        // Quad9
+	"2620:119:35::/48",    // OpenDNS
+	"2620:119:53::/48",    // OpenDNS
+}
+
+func init() {
+	lib.RegisterInputConfigCreator(typeBogon, func(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+		return newBogon(action, data)
+	})
+	lib.RegisterInputConverter(typeBogon, &bogon{
+		Description: descBogon,
+	})
+}
+
+func newBogon(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+	var tmp struct {
+		URI        string     `json:"uri"`
+		IPOrCIDR   []string   `json:"ipOrCIDR"`
+		Anycast    bool       `json:"anycast"`
+		Want       []string   `json:"wantedList"`
+		Exclude    []string   `json:"excludedList"`
+		OnlyIPType lib.IPType `json:"onlyIPType"`
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if action != lib.ActionRemove {
+		return nil, fmt.Errorf("❌ [type %s] only supports `remove` action", typeBogon)
+	}
+
+	// The private list consists of bogons on purpose
+	if len(tmp.Want) == 0 && len(tmp.Exclude) == 0 {
+		tmp.Exclude = []string{entryNamePrivate}
+	}
+
+	wantList, err := lib.NewListFilter(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s] invalid wantedList: %v", typeBogon, err)
+	}
+
+	excludeList, err := lib.NewListFilter(tmp.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s] invalid excludedList: %v", typeBogon, err)
+	}
+
+	return &bogon{
+		Type:        typeBogon,
+		Action:      action,
+		Description: descBogon,
+		URI:         strings.TrimSpace(tmp.URI),
+		IPOrCIDR:    tmp.IPOrCIDR,
+		Anycast:     tmp.Anycast,
+		Want:        wantList,
+		Exclude:     excludeList,
+		OnlyIPType:  tmp.OnlyIPType,
+	}, nil
+}
+
+// bogon removes the bogons from every wanted list, after the inputs before
+// it have merged all lists. The built-in bogons are replaced by the ones
+// of URI if specified.
+type bogon struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	URI         string
+	IPOrCIDR    []string
+	Anycast     bool
+	Want        *lib.ListFilter
+	Exclude     *lib.ListFilter
+	OnlyIPType  lib.IPType
+}
+
+func (b *bogon) GetType() string {
+	return b.Type
+}
+
+func (b *bogon) GetAction() lib.Action {
+	return b.Action
+}
+
+func (b *bogon) GetDescription() string {
+	return b.Description
+}
+
+func (b *bogon) GetArgs() []lib.Arg {
+	return []lib.Arg{
+		{Name: "uri", Type: lib.ArgTypeString, Description: "Local file path or remote HTTP(S) URL of the plaintext file of bogons replacing the built-in ones, e.g. the full bogons list of Team Cymru"},
+		{Name: "ipOrCIDR", Type: lib.ArgTypeStringList, Description: "The IPs or CIDRs removed in addition to the bogons"},
+		{Name: "anycast", Type: lib.ArgTypeBool, Description: "Also remove the known anycast ranges of public DNS resolvers and 6to4 relays"},
+		{Name: "wantedList", Type: lib.ArgTypeStringList, Description: "The lists the bogons are removed from, defaults to all lists except \"private\". Supports glob patterns like \"cn*\" and regular expressions enclosed in slashes like \"/^(cn|hk|mo)$/\""},
+		lib.ArgExcludedList,
+		lib.ArgOnlyIPType,
+	}
+}
+
+func (b *bogon) Input(ctx context.Context, container lib.Container) (lib.Container, error) {
+	cidrs, err := b.cidrs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ignoreIPType lib.IgnoreIPOption
+	switch b.OnlyIPType {
+	case lib.IPv4:
+		ignoreIPType = lib.IgnoreIPv6
+	case lib.IPv6:
+		ignoreIPType = lib.IgnoreIPv4
+	}
+
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if !b.Want.Wants(name) || b.Exclude.Match(name) {
+			continue
+		}
+
+		bogons := lib.NewEntry(name)
+		for _, cidr := range cidrs {
+			if err := bogons.AddPrefix(cidr); err != nil {
+				return nil, err
+			}
+		}
+		if err := container.Remove(bogons, lib.CaseRemovePrefix, ignoreIPType); err != nil {
+			return nil, err
+		}
+	}
+
+	return container, nil
+}
+
+// cidrs returns the bogons to be removed.
+func (b *bogon) cidrs(ctx context.Context) ([]string, error) {
+	cidrs := bogonCIDRs
+	if b.URI != "" {
+		f, err := lib.OpenURI(ctx, b.URI)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		entry := lib.NewEntry(typeBogon)
+		scanner := bufio.NewScanner(f)
+		for lineNo := 1; scanner.Scan(); lineNo++ {
+			line, _, _ := strings.Cut(scanner.Text(), "#")
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			if err := lib.AddLine(ctx, entry, b.URI, lineNo, line); err != nil {
+				return nil, err
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		if cidrs, err = entry.MarshalText(); err != nil {
+			return nil, fmt.Errorf("❌ [type %s | action %s] no bogon is found in %s: %v", b.Type, b.Action, b.URI, err)
+		}
+	}
+
+	if b.Anycast {
+		cidrs = append(cidrs[:len(cidrs):len(cidrs)], anycastCIDRs...)
+	}
+	return append(cidrs[:len(cidrs):len(cidrs)], b.IPOrCIDR...), nil
+}
@@ -1,9 +1,9 @@
 package special
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"strings"
 
 	"github.com/Loyalsoldier/geoip/lib"
 )
@@ -39,14 +39,12 @@ func newCutter(action lib.Action, data json.RawMessage) (lib.InputConverter, err
 	}
 
 	// Filter want list
-	wantList := make(map[string]bool)
-	for _, want := range tmp.Want {
-		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" {
-			wantList[want] = true
-		}
+	wantList, err := lib.NewListFilter(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s] invalid wantedList: %v", typeCutter, err)
 	}
 
-	if len(wantList) == 0 {
+	if wantList.IsEmpty() {
 		return nil, fmt.Errorf("❌ [type %s] wantedList must be specified", typeCutter)
 	}
 
@@ -63,7 +61,7 @@ type cutter struct {
 	Type        string
 	Action      lib.Action
 	Description string
-	Want        map[string]bool
+	Want        *lib.ListFilter
 	OnlyIPType  lib.IPType
 }
 
@@ -79,7 +77,14 @@ func (c *cutter) GetDescription() string {
 	return c.Description
 }
 
-func (c *cutter) Input(container lib.Container) (lib.Container, error) {
+func (c *cutter) GetArgs() []lib.Arg {
+	return []lib.Arg{
+		lib.ArgWantedList.WithRequired(),
+		lib.ArgOnlyIPType,
+	}
+}
+
+func (c *cutter) Input(_ context.Context, container lib.Container) (lib.Container, error) {
 	var ignoreIPType lib.IgnoreIPOption
 	switch c.OnlyIPType {
 	case lib.IPv4:
@@ -89,7 +94,7 @@ func (c *cutter) Input(container lib.Container) (lib.Container, error) {
 	}
 
 	for entry := range container.Loop() {
-		if len(c.Want) > 0 && !c.Want[entry.GetName()] {
+		if !c.Want.Wants(entry.GetName()) {
 			continue
 		}
 
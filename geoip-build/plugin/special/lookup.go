@@ -1,10 +1,10 @@
 package special
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net/netip"
 	"slices"
 	"strings"
 
@@ -27,8 +27,9 @@ func init() {
 
 func newLookup(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
 	var tmp struct {
-		Search     string   `json:"search"`
-		SearchList []string `json:"searchList"`
+		Search       string   `json:"search"`
+		SearchList   []string `json:"searchList"`
+		OutputFormat string   `json:"outputFormat"`
 	}
 
 	if len(data) > 0 {
@@ -42,21 +43,32 @@ func newLookup(action lib.Action, data json.RawMessage) (lib.OutputConverter, er
 		return nil, fmt.Errorf("❌ [type %s | action %s] please specify an IP or a CIDR as search target", typeLookup, action)
 	}
 
+	tmp.OutputFormat = strings.ToLower(strings.TrimSpace(tmp.OutputFormat))
+	switch tmp.OutputFormat {
+	case "":
+		tmp.OutputFormat = "text"
+	case "text", "json":
+	default:
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid outputFormat: %s", typeLookup, action, tmp.OutputFormat)
+	}
+
 	return &lookup{
-		Type:        typeLookup,
-		Action:      action,
-		Description: descLookup,
-		Search:      tmp.Search,
-		SearchList:  tmp.SearchList,
+		Type:         typeLookup,
+		Action:       action,
+		Description:  descLookup,
+		Search:       tmp.Search,
+		SearchList:   tmp.SearchList,
+		OutputFormat: tmp.OutputFormat,
 	}, nil
 }
 
 type lookup struct {
-	Type        string
-	Action      lib.Action
-	Description string
-	Search      string
-	SearchList  []string
+	Type         string
+	Action       lib.Action
+	Description  string
+	Search       string
+	SearchList   []string
+	OutputFormat string
 }
 
 func (l *lookup) GetType() string {
@@ -71,25 +83,51 @@ func (l *lookup) GetDescription() string {
 	return l.Description
 }
 
-func (l *lookup) Output(container lib.Container) error {
-	switch strings.Contains(l.Search, "/") {
-	case true: // CIDR
-		if _, err := netip.ParsePrefix(l.Search); err != nil {
-			return errors.New("invalid IP or CIDR")
-		}
+func (l *lookup) GetArgs() []lib.Arg {
+	return []lib.Arg{
+		{Name: "search", Type: lib.ArgTypeString, Description: "The IP or CIDR to be searched", Required: true},
+		{Name: "searchList", Type: lib.ArgTypeStringList, Description: "The lists to search from"},
+		{Name: "outputFormat", Type: lib.ArgTypeString, Description: "The format of the search result", Default: "text", Enum: []string{"text", "json"}},
+	}
+}
 
-	case false: // IP
-		if _, err := netip.ParseAddr(l.Search); err != nil {
-			return errors.New("invalid IP or CIDR")
-		}
+// WritesStdout implements lib.StdoutWriter.
+func (l *lookup) WritesStdout() bool {
+	return true
+}
+
+func (l *lookup) Output(_ context.Context, container lib.Container) error {
+	if _, _, err := lib.ParsePrefix(l.Search); err != nil {
+		return errors.New("invalid IP or CIDR")
 	}
 
 	lists, found, _ := container.Lookup(l.Search, l.SearchList...)
+	slices.Sort(lists)
+	for idx := range lists {
+		lists[idx] = strings.ToLower(lists[idx])
+	}
+
+	if l.OutputFormat == "json" {
+		result, err := json.Marshal(struct {
+			Search string   `json:"search"`
+			Found  bool     `json:"found"`
+			Lists  []string `json:"lists"`
+		}{
+			Search: l.Search,
+			Found:  found,
+			Lists:  append([]string{}, lists...),
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(lib.Stdout(), string(result))
+		return nil
+	}
+
 	if found {
-		slices.Sort(lists)
-		fmt.Println(strings.ToLower(strings.Join(lists, ",")))
+		fmt.Fprintln(lib.Stdout(), strings.Join(lists, ","))
 	} else {
-		fmt.Println("false")
+		fmt.Fprintln(lib.Stdout(), "false")
 	}
 
 	return nil
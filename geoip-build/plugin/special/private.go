@@ -1,6 +1,7 @@
 package special
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/Loyalsoldier/geoip/lib"
@@ -83,7 +84,13 @@ func (p *private) GetDescription() string {
 	return p.Description
 }
 
-func (p *private) Input(container lib.Container) (lib.Container, error) {
+func (p *private) GetArgs() []lib.Arg {
+	return []lib.Arg{
+		lib.ArgOnlyIPType,
+	}
+}
+
+func (p *private) Input(_ context.Context, container lib.Container) (lib.Container, error) {
 	entry, found := container.GetEntry(entryNamePrivate)
 	if !found {
 		entry = lib.NewEntry(entryNamePrivate)
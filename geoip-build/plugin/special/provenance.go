@@ -0,0 +1,150 @@
+package special
+
+import (
+	"context"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/Loyalsoldier/geoip/lib"
+)
+
+const (
+	typeProvenance = "provenance"
+	descProvenance = "Output which input added or removed each CIDR of each list in CSV or JSON format"
+)
+
+const (
+	provenanceFormatCSV  = "csv"
+	provenanceFormatJSON = "json"
+)
+
+var defaultProvenanceOutputDir = filepath.Join("./", "output", "provenance")
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeProvenance, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newProvenance(action, data)
+	})
+	lib.RegisterOutputConverter(typeProvenance, &provenance{
+		Description: descProvenance,
+	})
+}
+
+func newProvenance(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp struct {
+		OutputName string   `json:"outputName"`
+		OutputDir  string   `json:"outputDir"`
+		Format     string   `json:"format"`
+		Want       []string `json:"wantedList"`
+		Exclude    []string `json:"excludedList"`
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	tmp.Format = strings.ToLower(strings.TrimSpace(tmp.Format))
+	switch tmp.Format {
+	case "":
+		tmp.Format = provenanceFormatCSV
+	case provenanceFormatCSV, provenanceFormatJSON:
+	default:
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid format %q, available options: %s, %s", typeProvenance, action, tmp.Format, provenanceFormatCSV, provenanceFormatJSON)
+	}
+
+	if tmp.OutputName == "" {
+		tmp.OutputName = "provenance." + tmp.Format
+	}
+
+	if tmp.OutputDir == "" {
+		tmp.OutputDir = defaultProvenanceOutputDir
+	}
+
+	wantList, err := lib.NewListFilter(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid wantedList: %v", typeProvenance, action, err)
+	}
+
+	excludeList, err := lib.NewListFilter(tmp.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid excludedList: %v", typeProvenance, action, err)
+	}
+
+	return &provenance{
+		Type:        typeProvenance,
+		Action:      action,
+		Description: descProvenance,
+		OutputName:  tmp.OutputName,
+		OutputDir:   tmp.OutputDir,
+		Format:      tmp.Format,
+		Want:        wantList,
+		Exclude:     excludeList,
+	}, nil
+}
+
+type provenance struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	OutputName  string
+	OutputDir   string
+	Format      string
+	Want        *lib.ListFilter
+	Exclude     *lib.ListFilter
+}
+
+func (p *provenance) GetType() string {
+	return p.Type
+}
+
+func (p *provenance) GetAction() lib.Action {
+	return p.Action
+}
+
+func (p *provenance) GetDescription() string {
+	return p.Description
+}
+
+func (p *provenance) GetArgs() []lib.Arg {
+	return []lib.Arg{
+		lib.ArgOutputName.WithDefault("provenance.csv"),
+		lib.ArgOutputDir.WithDefault(defaultProvenanceOutputDir),
+		{Name: "format", Type: lib.ArgTypeString, Description: "The format of the output file", Default: provenanceFormatCSV, Enum: []string{provenanceFormatCSV, provenanceFormatJSON}},
+		lib.ArgWantedList,
+		lib.ArgExcludedList,
+	}
+}
+
+// UseProvenance implements lib.ProvenanceUser.
+func (p *provenance) UseProvenance() bool {
+	return true
+}
+
+func (p *provenance) Output(ctx context.Context, container lib.Container) error {
+	records, found := lib.GetProvenance(container)
+	if !found {
+		return errors.New("provenance is not tracked")
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch p.Format {
+	case provenanceFormatJSON:
+		err = records.WriteJSON(&buf, p.Want, p.Exclude)
+	default:
+		err = records.WriteCSV(&buf, p.Want, p.Exclude)
+	}
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return lib.WriteFile(p.Type, filepath.Join(p.OutputDir, p.OutputName), buf.Bytes())
+}
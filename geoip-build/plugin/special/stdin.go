@@ -1,6 +1,7 @@
 package special
 
 import (
+	"context"
 	"bufio"
 	"encoding/json"
 	"fmt"
@@ -69,11 +70,27 @@ func (s *stdin) GetDescription() string {
 	return s.Description
 }
 
-func (s *stdin) Input(container lib.Container) (lib.Container, error) {
+func (s *stdin) GetArgs() []lib.Arg {
+	return []lib.Arg{
+		{Name: "name", Type: lib.ArgTypeString, Description: "The name of the list", Required: true},
+		lib.ArgOnlyIPType,
+	}
+}
+
+// IsVolatile implements lib.VolatileInput.
+func (s *stdin) IsVolatile() bool {
+	return true
+}
+
+func (s *stdin) Input(ctx context.Context, container lib.Container) (lib.Container, error) {
 	entry := lib.NewEntry(s.Name)
 
 	scanner := bufio.NewScanner(os.Stdin)
 	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" {
 			continue
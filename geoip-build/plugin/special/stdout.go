@@ -1,12 +1,12 @@
 package special
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
-	"os"
 	"slices"
-	"strings"
 
 	"github.com/Loyalsoldier/geoip/lib"
 )
@@ -38,12 +38,22 @@ func newStdout(action lib.Action, data json.RawMessage) (lib.OutputConverter, er
 		}
 	}
 
+	wantList, err := lib.NewListFilter(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid wantedList: %v", typeStdout, action, err)
+	}
+
+	excludeList, err := lib.NewListFilter(tmp.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid excludedList: %v", typeStdout, action, err)
+	}
+
 	return &stdout{
 		Type:        typeStdout,
 		Action:      action,
 		Description: descStdout,
-		Want:        tmp.Want,
-		Exclude:     tmp.Exclude,
+		Want:        wantList,
+		Exclude:     excludeList,
 		OnlyIPType:  tmp.OnlyIPType,
 	}, nil
 }
@@ -52,8 +62,8 @@ type stdout struct {
 	Type        string
 	Action      lib.Action
 	Description string
-	Want        []string
-	Exclude     []string
+	Want        *lib.ListFilter
+	Exclude     *lib.ListFilter
 	OnlyIPType  lib.IPType
 }
 
@@ -69,8 +79,25 @@ func (s *stdout) GetDescription() string {
 	return s.Description
 }
 
-func (s *stdout) Output(container lib.Container) error {
+func (s *stdout) GetArgs() []lib.Arg {
+	return []lib.Arg{
+		lib.ArgWantedList,
+		lib.ArgExcludedList,
+		lib.ArgOnlyIPType,
+	}
+}
+
+// WritesStdout implements lib.StdoutWriter.
+func (s *stdout) WritesStdout() bool {
+	return true
+}
+
+func (s *stdout) Output(ctx context.Context, container lib.Container) error {
 	for _, name := range s.filterAndSortList(container) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		entry, found := container.GetEntry(name)
 		if !found {
 			continue
@@ -82,7 +109,7 @@ func (s *stdout) Output(container lib.Container) error {
 		}
 
 		for _, cidr := range cidrList {
-			io.WriteString(os.Stdout, cidr+"\n")
+			io.WriteString(lib.Stdout(), cidr+"\n")
 		}
 	}
 
@@ -90,21 +117,8 @@ func (s *stdout) Output(container lib.Container) error {
 }
 
 func (s *stdout) filterAndSortList(container lib.Container) []string {
-	excludeMap := make(map[string]bool)
-	for _, exclude := range s.Exclude {
-		if exclude = strings.ToUpper(strings.TrimSpace(exclude)); exclude != "" {
-			excludeMap[exclude] = true
-		}
-	}
-
-	wantList := make([]string, 0, len(s.Want))
-	for _, want := range s.Want {
-		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeMap[want] {
-			wantList = append(wantList, want)
-		}
-	}
-
-	if len(wantList) > 0 {
+	if !s.Want.IsEmpty() {
+		wantList := s.Want.Expand(container, s.Exclude)
 		// Sort the list
 		slices.Sort(wantList)
 		return wantList
@@ -113,7 +127,7 @@ func (s *stdout) filterAndSortList(container lib.Container) []string {
 	list := make([]string, 0, 300)
 	for entry := range container.Loop() {
 		name := entry.GetName()
-		if excludeMap[name] {
+		if s.Exclude.Match(name) {
 			continue
 		}
 		list = append(list, name)
@@ -1,6 +1,7 @@
 package special
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/Loyalsoldier/geoip/lib"
@@ -51,7 +52,11 @@ func (t *test) GetDescription() string {
 	return t.Description
 }
 
-func (t *test) Input(container lib.Container) (lib.Container, error) {
+func (t *test) GetArgs() []lib.Arg {
+	return []lib.Arg{}
+}
+
+func (t *test) Input(_ context.Context, container lib.Container) (lib.Container, error) {
 	entry := lib.NewEntry(entryNameTest)
 	for _, cidr := range testCIDRs {
 		if err := entry.AddPrefix(cidr); err != nil {
@@ -1,12 +1,11 @@
 package v2ray
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"net"
-	"net/http"
-	"os"
+	"net/netip"
 	"strings"
 
 	"github.com/Loyalsoldier/geoip/lib"
@@ -45,11 +44,9 @@ func newGeoIPDatIn(action lib.Action, data json.RawMessage) (lib.InputConverter,
 	}
 
 	// Filter want list
-	wantList := make(map[string]bool)
-	for _, want := range tmp.Want {
-		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" {
-			wantList[want] = true
-		}
+	wantList, err := lib.NewListFilter(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid wantedList: %v", typeGeoIPdatIn, action, err)
 	}
 
 	return &geoIPDatIn{
@@ -67,7 +64,7 @@ type geoIPDatIn struct {
 	Action      lib.Action
 	Description string
 	URI         string
-	Want        map[string]bool
+	Want        *lib.ListFilter
 	OnlyIPType  lib.IPType
 }
 
@@ -83,15 +80,23 @@ func (g *geoIPDatIn) GetDescription() string {
 	return g.Description
 }
 
-func (g *geoIPDatIn) Input(container lib.Container) (lib.Container, error) {
+func (g *geoIPDatIn) GetArgs() []lib.Arg {
+	return []lib.Arg{
+		lib.ArgURI.WithRequired(),
+		lib.ArgWantedList,
+		lib.ArgOnlyIPType,
+	}
+}
+
+func (g *geoIPDatIn) Input(ctx context.Context, container lib.Container) (lib.Container, error) {
 	entries := make(map[string]*lib.Entry)
 	var err error
 
 	switch {
 	case strings.HasPrefix(strings.ToLower(g.URI), "http://"), strings.HasPrefix(strings.ToLower(g.URI), "https://"):
-		err = g.walkRemoteFile(g.URI, entries)
+		err = g.walkRemoteFile(ctx, g.URI, entries)
 	default:
-		err = g.walkLocalFile(g.URI, entries)
+		err = g.walkLocalFile(ctx, g.URI, entries)
 	}
 
 	if err != nil {
@@ -128,8 +133,8 @@ func (g *geoIPDatIn) Input(container lib.Container) (lib.Container, error) {
 	return container, nil
 }
 
-func (g *geoIPDatIn) walkLocalFile(path string, entries map[string]*lib.Entry) error {
-	file, err := os.Open(path)
+func (g *geoIPDatIn) walkLocalFile(ctx context.Context, path string, entries map[string]*lib.Entry) error {
+	file, err := lib.OpenURI(ctx, path)
 	if err != nil {
 		return err
 	}
@@ -142,18 +147,14 @@ func (g *geoIPDatIn) walkLocalFile(path string, entries map[string]*lib.Entry) e
 	return nil
 }
 
-func (g *geoIPDatIn) walkRemoteFile(url string, entries map[string]*lib.Entry) error {
-	resp, err := http.Get(url)
+func (g *geoIPDatIn) walkRemoteFile(ctx context.Context, url string, entries map[string]*lib.Entry) error {
+	body, err := lib.GetRemoteURLReader(ctx, url)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("❌ [type %s | action %s] failed to get remote file %s, http status code %d", g.Type, g.Action, url, resp.StatusCode)
-	}
+	defer body.Close()
 
-	if err := g.generateEntries(resp.Body, entries); err != nil {
+	if err := g.generateEntries(body, entries); err != nil {
 		return err
 	}
 
@@ -174,7 +175,7 @@ func (g *geoIPDatIn) generateEntries(reader io.Reader, entries map[string]*lib.E
 	for _, geoip := range geoipList.Entry {
 		name := strings.ToUpper(strings.TrimSpace(geoip.CountryCode))
 
-		if len(g.Want) > 0 && !g.Want[name] {
+		if !g.Want.Wants(name) {
 			continue
 		}
 
@@ -184,8 +185,12 @@ func (g *geoIPDatIn) generateEntries(reader io.Reader, entries map[string]*lib.E
 		}
 
 		for _, v2rayCIDR := range geoip.Cidr {
-			ipStr := net.IP(v2rayCIDR.GetIp()).String() + "/" + fmt.Sprint(v2rayCIDR.GetPrefix())
-			if err := entry.AddPrefix(ipStr); err != nil {
+			// IPv4-mapped IPv6 CIDRs have 16-byte IPs and IPv6 prefix lengths
+			ip, ok := netip.AddrFromSlice(v2rayCIDR.GetIp())
+			if !ok {
+				return lib.ErrInvalidIP
+			}
+			if err := entry.AddPrefix(netip.PrefixFrom(ip, int(v2rayCIDR.GetPrefix()))); err != nil {
 				return err
 			}
 		}
@@ -1,17 +1,17 @@
 package v2ray
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/netip"
-	"os"
 	"path/filepath"
 	"slices"
-	"sort"
-	"strings"
 
 	"github.com/Loyalsoldier/geoip/lib"
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -20,6 +20,9 @@ const (
 	descGeoIPdatOut = "Convert data to V2Ray GeoIP dat format"
 )
 
+// geoIPListEntryField is the number of the entry field of GeoIPList in geoip.proto.
+const geoIPListEntryField protowire.Number = 1
+
 var (
 	defaultOutputName = "geoip.dat"
 	defaultOutputDir  = filepath.Join("./", "output", "dat")
@@ -42,6 +45,9 @@ func newGeoIPDat(action lib.Action, data json.RawMessage) (lib.OutputConverter,
 		Exclude        []string   `json:"excludedList"`
 		OneFilePerList bool       `json:"oneFilePerList"`
 		OnlyIPType     lib.IPType `json:"onlyIPType"`
+		NameCase       string     `json:"nameCase"`
+		NamePrefix     string     `json:"namePrefix"`
+		NameSuffix     string     `json:"nameSuffix"`
 	}
 
 	if len(data) > 0 {
@@ -58,16 +64,32 @@ func newGeoIPDat(action lib.Action, data json.RawMessage) (lib.OutputConverter,
 		tmp.OutputDir = defaultOutputDir
 	}
 
+	wantList, err := lib.NewListFilter(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid wantedList: %v", typeGeoIPdatOut, action, err)
+	}
+
+	excludeList, err := lib.NewListFilter(tmp.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid excludedList: %v", typeGeoIPdatOut, action, err)
+	}
+
+	naming, err := lib.NewListNaming(tmp.NameCase, tmp.NamePrefix, tmp.NameSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v", typeGeoIPdatOut, action, err)
+	}
+
 	return &geoIPDatOut{
 		Type:           typeGeoIPdatOut,
 		Action:         action,
 		Description:    descGeoIPdatOut,
 		OutputName:     tmp.OutputName,
 		OutputDir:      tmp.OutputDir,
-		Want:           tmp.Want,
-		Exclude:        tmp.Exclude,
+		Want:           wantList,
+		Exclude:        excludeList,
 		OneFilePerList: tmp.OneFilePerList,
 		OnlyIPType:     tmp.OnlyIPType,
+		Naming:         naming,
 	}, nil
 }
 
@@ -77,10 +99,13 @@ type geoIPDatOut struct {
 	Description    string
 	OutputName     string
 	OutputDir      string
-	Want           []string
-	Exclude        []string
+	Want           *lib.ListFilter
+	Exclude        *lib.ListFilter
 	OneFilePerList bool
 	OnlyIPType     lib.IPType
+	Naming         *lib.ListNaming
+
+	written []string
 }
 
 func (g *geoIPDatOut) GetType() string {
@@ -95,49 +120,52 @@ func (g *geoIPDatOut) GetDescription() string {
 	return g.Description
 }
 
-func (g *geoIPDatOut) Output(container lib.Container) error {
-	geoIPList := new(GeoIPList)
-	geoIPList.Entry = make([]*GeoIP, 0, 300)
-	updated := false
+// WritesIPType implements lib.IPTypeWriter.
+func (g *geoIPDatOut) WritesIPType() lib.IPType {
+	return g.OnlyIPType
+}
+
+func (g *geoIPDatOut) GetArgs() []lib.Arg {
+	return []lib.Arg{
+		lib.ArgOutputName.WithDefault(defaultOutputName),
+		lib.ArgOutputDir.WithDefault(defaultOutputDir),
+		lib.ArgWantedList,
+		lib.ArgExcludedList,
+		{Name: "oneFilePerList", Type: lib.ArgTypeBool, Description: "Write each list into a separate dat file"},
+		lib.ArgOnlyIPType,
+		lib.ArgNameCase,
+		lib.ArgNamePrefix,
+		lib.ArgNameSuffix,
+	}
+}
+
+func (g *geoIPDatOut) Output(ctx context.Context, container lib.Container) error {
+	entries := make([]*lib.Entry, 0, 300)
 
 	for _, name := range g.filterAndSortList(container) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		entry, found := container.GetEntry(name)
 		if !found {
-			log.Printf("❌ entry %s not found\n", name)
+			slog.Warn(fmt.Sprintf("❌ entry %s not found", name), "type", g.Type, "list", name)
 			continue
 		}
 
-		geoIP, err := g.generateGeoIP(entry)
-		if err != nil {
-			return err
-		}
-		geoIPList.Entry = append(geoIPList.Entry, geoIP)
-		updated = true
-
 		if g.OneFilePerList {
-			geoIPBytes, err := proto.Marshal(geoIPList)
-			if err != nil {
-				return err
-			}
-
-			filename := strings.ToLower(entry.GetName()) + ".dat"
-			if err := g.writeFile(filename, geoIPBytes); err != nil {
+			filename := g.Naming.FileName(entry.GetName(), ".dat")
+			if err := g.writeFile(ctx, filename, []*lib.Entry{entry}); err != nil {
 				return err
 			}
-
-			geoIPList.Entry = nil
+			continue
 		}
+		entries = append(entries, entry)
 	}
 
-	if !g.OneFilePerList && updated {
-		// Sort to make reproducible builds
-		g.sort(geoIPList)
-
-		geoIPBytes, err := proto.Marshal(geoIPList)
-		if err != nil {
-			return err
-		}
-		if err := g.writeFile(g.OutputName, geoIPBytes); err != nil {
+	// Entries are sorted by list name to make reproducible builds
+	if !g.OneFilePerList && len(entries) > 0 {
+		if err := g.writeFile(ctx, g.OutputName, entries); err != nil {
 			return err
 		}
 	}
@@ -146,21 +174,8 @@ func (g *geoIPDatOut) Output(container lib.Container) error {
 }
 
 func (g *geoIPDatOut) filterAndSortList(container lib.Container) []string {
-	excludeMap := make(map[string]bool)
-	for _, exclude := range g.Exclude {
-		if exclude = strings.ToUpper(strings.TrimSpace(exclude)); exclude != "" {
-			excludeMap[exclude] = true
-		}
-	}
-
-	wantList := make([]string, 0, len(g.Want))
-	for _, want := range g.Want {
-		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeMap[want] {
-			wantList = append(wantList, want)
-		}
-	}
-
-	if len(wantList) > 0 {
+	if !g.Want.IsEmpty() {
+		wantList := g.Want.Expand(container, g.Exclude)
 		// Sort the list
 		slices.Sort(wantList)
 		return wantList
@@ -169,7 +184,7 @@ func (g *geoIPDatOut) filterAndSortList(container lib.Container) []string {
 	list := make([]string, 0, 300)
 	for entry := range container.Loop() {
 		name := entry.GetName()
-		if excludeMap[name] {
+		if g.Exclude.Match(name) {
 			continue
 		}
 		list = append(list, name)
@@ -214,23 +229,70 @@ func (g *geoIPDatOut) generateGeoIP(entry *lib.Entry) (*GeoIP, error) {
 	return nil, fmt.Errorf("❌ [type %s | action %s] entry %s has no CIDR", g.Type, g.Action, entry.GetName())
 }
 
-// Sort by country code to make reproducible builds
-func (g *geoIPDatOut) sort(list *GeoIPList) {
-	sort.SliceStable(list.Entry, func(i, j int) bool {
-		return list.Entry[i].CountryCode < list.Entry[j].CountryCode
-	})
-}
-
-func (g *geoIPDatOut) writeFile(filename string, geoIPBytes []byte) error {
-	if err := os.MkdirAll(g.OutputDir, 0755); err != nil {
-		return err
+// writeFile writes the entries into the dat file as a GeoIPList message.
+// The GeoIP message of each entry is generated and written one by one as
+// the repeated entry field, so that the memory used stays flat regardless
+// of the number of entries. The file is left untouched if ctx is done
+// before all entries are written.
+func (g *geoIPDatOut) writeFile(ctx context.Context, filename string, entries []*lib.Entry) error {
+	lists := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		lists = append(lists, entry.GetName())
 	}
 
-	if err := os.WriteFile(filepath.Join(g.OutputDir, filename), geoIPBytes, 0644); err != nil {
+	path := filepath.Join(g.OutputDir, filename)
+	if err := lib.WriteFileFrom(g.Type, path, func(w io.Writer) error {
+		var header, message []byte
+		for _, entry := range entries {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			geoIP, err := g.generateGeoIP(entry)
+			if err != nil {
+				return err
+			}
+			message, err = proto.MarshalOptions{Deterministic: true}.MarshalAppend(message[:0], geoIP)
+			if err != nil {
+				return err
+			}
+			header = protowire.AppendTag(header[:0], geoIPListEntryField, protowire.BytesType)
+			header = protowire.AppendVarint(header, uint64(len(message)))
+			if _, err := w.Write(header); err != nil {
+				return err
+			}
+			if _, err := w.Write(message); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, lists...); err != nil {
 		return err
 	}
+	g.written = append(g.written, path)
+
+	return nil
+}
+
+// Verify re-reads the dat files written by geoIPDatOut
+// and checks them against the container.
+func (g *geoIPDatOut) Verify(ctx context.Context, container lib.Container) error {
+	for _, path := range g.written {
+		in := &geoIPDatIn{
+			Type:   typeGeoIPdatIn,
+			Action: lib.ActionAdd,
+			URI:    path,
+		}
+
+		reread, err := in.Input(ctx, lib.NewContainer())
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := lib.VerifyContainer(reread, container); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
 
-	log.Printf("✅ [%s] %s --> %s", g.Type, filename, g.OutputDir)
+		slog.Info(fmt.Sprintf("✅ [%s] %s verified", g.Type, path), "type", g.Type, "path", path)
+	}
 
 	return nil
 }
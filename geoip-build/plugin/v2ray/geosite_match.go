@@ -0,0 +1,172 @@
+package v2ray
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Types of Domain in router.proto of v2ray-core, besides domainTypeFull.
+const (
+	domainTypePlain      = 0
+	domainTypeRegex      = 1
+	domainTypeRootDomain = 2
+)
+
+// GeoSiteMatcher answers which categories of a V2Ray GeoSite dat file a
+// domain is in, with the same semantics of full, domain, keyword and regexp
+// rules as V2Ray. It is immutable once loaded, and safe for concurrent use.
+type GeoSiteMatcher struct {
+	lists    []string
+	full     map[string][]int // indexes of the lists of each full rule
+	domain   map[string][]int // indexes of the lists of each domain rule
+	keywords []geoSiteKeyword
+	regexps  []geoSiteRegexp
+}
+
+type geoSiteKeyword struct {
+	keyword string
+	list    int
+}
+
+type geoSiteRegexp struct {
+	re   *regexp.Regexp
+	list int
+}
+
+// NewGeoSiteMatcher returns the matcher of the categories in the GeoSite
+// dat data. The attributes of rules are ignored.
+func NewGeoSiteMatcher(data []byte) (*GeoSiteMatcher, error) {
+	m := &GeoSiteMatcher{
+		full:   make(map[string][]int),
+		domain: make(map[string][]int),
+	}
+
+	type rule struct {
+		domainType uint64
+		value      string
+	}
+	categories := make(map[string][]rule)
+	err := consumeBytesFields(data, func(num protowire.Number, site []byte) error {
+		if num != geoSiteListEntryField {
+			return nil
+		}
+
+		var name string
+		var rules []rule
+		err := consumeBytesFields(site, func(num protowire.Number, value []byte) error {
+			switch num {
+			case geoSiteCountryCodeField:
+				name = strings.ToLower(strings.TrimSpace(string(value)))
+			case geoSiteDomainField:
+				domainType, domain, err := parseGeoSiteDomain(value)
+				if err != nil {
+					return err
+				}
+				rules = append(rules, rule{domainType: domainType, value: domain})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if name != "" {
+			categories[name] = append(categories[name], rules...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(categories) == 0 {
+		return nil, fmt.Errorf("no category is found")
+	}
+
+	// Lists are indexed in the order of their names, so that the indexes of
+	// the matched ones sort the same way as the names
+	m.lists = make([]string, 0, len(categories))
+	for name := range categories {
+		m.lists = append(m.lists, name)
+	}
+	slices.Sort(m.lists)
+	for idx, name := range m.lists {
+		for _, rule := range categories[name] {
+			value := strings.TrimSuffix(rule.value, ".")
+			switch rule.domainType {
+			case domainTypeFull:
+				value = strings.ToLower(value)
+				m.full[value] = appendListIndex(m.full[value], idx)
+			case domainTypeRootDomain:
+				value = strings.ToLower(value)
+				m.domain[value] = appendListIndex(m.domain[value], idx)
+			case domainTypePlain:
+				m.keywords = append(m.keywords, geoSiteKeyword{keyword: strings.ToLower(rule.value), list: idx})
+			case domainTypeRegex:
+				re, err := regexp.Compile(rule.value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid regexp rule %q of category %s: %v", rule.value, name, err)
+				}
+				m.regexps = append(m.regexps, geoSiteRegexp{re: re, list: idx})
+			default:
+				return nil, fmt.Errorf("unknown domain type %d of category %s", rule.domainType, name)
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// appendListIndex appends idx to indexes unless it is already the last one,
+// as rules are added list by list.
+func appendListIndex(indexes []int, idx int) []int {
+	if n := len(indexes); n > 0 && indexes[n-1] == idx {
+		return indexes
+	}
+	return append(indexes, idx)
+}
+
+// Match returns the names of the categories containing the domain in lower
+// case, sorted by name. A domain rule "example.com" matches the domain
+// "example.com" and all of its subdomains.
+func (m *GeoSiteMatcher) Match(domain string) []string {
+	names := make([]string, 0, 4)
+	domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+	if domain == "" {
+		return names
+	}
+
+	hits := slices.Clone(m.full[domain])
+	for suffix := domain; ; {
+		hits = append(hits, m.domain[suffix]...)
+		dot := strings.IndexByte(suffix, '.')
+		if dot < 0 {
+			break
+		}
+		suffix = suffix[dot+1:]
+	}
+	for _, rule := range m.keywords {
+		if strings.Contains(domain, rule.keyword) {
+			hits = append(hits, rule.list)
+		}
+	}
+	for _, rule := range m.regexps {
+		if rule.re.MatchString(domain) {
+			hits = append(hits, rule.list)
+		}
+	}
+
+	slices.Sort(hits)
+	for _, idx := range slices.Compact(hits) {
+		names = append(names, m.lists[idx])
+	}
+	return names
+}
+
+// Lists returns the names of all categories in lower case, sorted by name.
+func (m *GeoSiteMatcher) Lists() []string {
+	return slices.Clone(m.lists)
+}
@@ -0,0 +1,543 @@
+package v2ray
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Loyalsoldier/geoip/lib"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	typeGeoSiteResolve = "v2rayGeoSiteResolve"
+	descGeoSiteResolve = "Resolve the full domains of V2Ray GeoSite dat categories to IPs"
+)
+
+// Fields of GeoSiteList, GeoSite and Domain in router.proto of v2ray-core.
+const (
+	geoSiteListEntryField   protowire.Number = 1
+	geoSiteCountryCodeField protowire.Number = 1
+	geoSiteDomainField      protowire.Number = 2
+	domainTypeField         protowire.Number = 1
+	domainValueField        protowire.Number = 2
+
+	domainTypeFull = 3
+)
+
+const (
+	defaultResolveConcurrency = 16
+	defaultResolveTimeout     = 5 * time.Second
+	defaultResolveCacheTTL    = 24 * time.Hour
+)
+
+func init() {
+	lib.RegisterInputConfigCreator(typeGeoSiteResolve, func(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+		return newGeoSiteResolve(action, data)
+	})
+	lib.RegisterInputConverter(typeGeoSiteResolve, &geoSiteResolve{
+		Description: descGeoSiteResolve,
+	})
+}
+
+func newGeoSiteResolve(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+	var tmp struct {
+		URI         string     `json:"uri"`
+		Want        []string   `json:"wantedList"`
+		Name        string     `json:"name"`
+		Resolvers   []string   `json:"resolvers"`
+		Concurrency int        `json:"concurrency"`
+		Timeout     string     `json:"timeout"`
+		CacheFile   string     `json:"cacheFile"`
+		CacheTTL    string     `json:"cacheTTL"`
+		OnlyIPType  lib.IPType `json:"onlyIPType"`
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.URI == "" {
+		return nil, fmt.Errorf("❌ [type %s | action %s] uri must be specified in config", typeGeoSiteResolve, action)
+	}
+	if len(tmp.Want) == 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] wantedList must be specified in config", typeGeoSiteResolve, action)
+	}
+
+	// Filter want list
+	wantList, err := lib.NewListFilter(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid wantedList: %v", typeGeoSiteResolve, action, err)
+	}
+
+	servers := make([]string, 0, len(tmp.Resolvers))
+	for _, resolver := range tmp.Resolvers {
+		server, err := resolverAddress(resolver)
+		if err != nil {
+			return nil, fmt.Errorf("❌ [type %s | action %s] invalid resolvers: %v", typeGeoSiteResolve, action, err)
+		}
+		servers = append(servers, server)
+	}
+
+	switch {
+	case tmp.Concurrency == 0:
+		tmp.Concurrency = defaultResolveConcurrency
+	case tmp.Concurrency < 0:
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid concurrency %d, must be positive", typeGeoSiteResolve, action, tmp.Concurrency)
+	}
+
+	timeout, err := parsePositiveDuration(tmp.Timeout, defaultResolveTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid timeout: %v", typeGeoSiteResolve, action, err)
+	}
+	cacheTTL, err := parsePositiveDuration(tmp.CacheTTL, defaultResolveCacheTTL)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid cacheTTL: %v", typeGeoSiteResolve, action, err)
+	}
+
+	return &geoSiteResolve{
+		Type:        typeGeoSiteResolve,
+		Action:      action,
+		Description: descGeoSiteResolve,
+		URI:         tmp.URI,
+		Want:        wantList,
+		Name:        strings.ToUpper(strings.TrimSpace(tmp.Name)),
+		Resolvers:   servers,
+		Concurrency: tmp.Concurrency,
+		Timeout:     timeout,
+		CacheFile:   strings.TrimSpace(tmp.CacheFile),
+		CacheTTL:    cacheTTL,
+		OnlyIPType:  tmp.OnlyIPType,
+	}, nil
+}
+
+// geoSiteResolve resolves the "full:" domains of the wanted categories of
+// a GeoSite dat file to IPs, for IP-level blocking of services defined by
+// domains. Other types of domains cannot be resolved and are ignored.
+//
+// Each domain is resolved by all resolvers and the addresses are merged,
+// as DNS-based load balancing answers differently by resolver.
+type geoSiteResolve struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	URI         string
+	Want        *lib.ListFilter
+	Name        string
+	Resolvers   []string
+	Concurrency int
+	Timeout     time.Duration
+	CacheFile   string
+	CacheTTL    time.Duration
+	OnlyIPType  lib.IPType
+}
+
+func (g *geoSiteResolve) GetType() string {
+	return g.Type
+}
+
+func (g *geoSiteResolve) GetAction() lib.Action {
+	return g.Action
+}
+
+func (g *geoSiteResolve) GetDescription() string {
+	return g.Description
+}
+
+func (g *geoSiteResolve) GetArgs() []lib.Arg {
+	return []lib.Arg{
+		{Name: "uri", Type: lib.ArgTypeString, Description: "Local file path or remote HTTP(S) URL of the GeoSite dat file", Required: true},
+		{Name: "wantedList", Type: lib.ArgTypeStringList, Description: "The GeoSite categories to be resolved. Supports glob patterns like \"category-*\" and regular expressions enclosed in slashes like \"/^(google|youtube)$/\"", Required: true},
+		{Name: "name", Type: lib.ArgTypeString, Description: "The list to add all resolved IPs to, defaults to a list of the same name for each category"},
+		{Name: "resolvers", Type: lib.ArgTypeStringList, Description: "DNS servers to resolve domains by, like \"8.8.8.8\" or \"[2001:4860:4860::8888]:53\", defaults to the system resolver"},
+		{Name: "concurrency", Type: lib.ArgTypeInt, Description: "Number of domains to resolve concurrently", Default: fmt.Sprint(defaultResolveConcurrency)},
+		{Name: "timeout", Type: lib.ArgTypeString, Description: "Timeout of each DNS query", Default: defaultResolveTimeout.String()},
+		{Name: "cacheFile", Type: lib.ArgTypeString, Description: "Path to the JSON file caching the resolved IPs between builds"},
+		{Name: "cacheTTL", Type: lib.ArgTypeString, Description: "How long the cached IPs of a domain are used before it is resolved again", Default: "24h"},
+		lib.ArgOnlyIPType,
+	}
+}
+
+// IsVolatile implements lib.VolatileInput, as DNS answers change
+// independently of the GeoSite dat file.
+func (g *geoSiteResolve) IsVolatile() bool {
+	return true
+}
+
+func (g *geoSiteResolve) Input(ctx context.Context, container lib.Container) (lib.Container, error) {
+	file, err := lib.OpenURI(ctx, g.URI)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := g.readFullDomains(data)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid GeoSite dat %s: %w", g.Type, g.Action, g.URI, err)
+	}
+	if len(categories) == 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] no full domain is found in the wanted categories", g.Type, g.Action)
+	}
+
+	domains := make([]string, 0, 1024)
+	for _, list := range categories {
+		domains = append(domains, list...)
+	}
+	slices.Sort(domains)
+	domains = slices.Compact(domains)
+
+	cache := g.loadCache()
+	addrs, err := g.resolve(ctx, domains, cache)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.saveCache(cache); err != nil {
+		slog.Warn(fmt.Sprintf("⚠️ [%s] failed to save cache file %s: %v", g.Type, g.CacheFile, err), "type", g.Type, "path", g.CacheFile, "error", err)
+	}
+
+	entries := make(map[string]*lib.Entry, len(categories))
+	for category, list := range categories {
+		name := category
+		if g.Name != "" {
+			name = g.Name
+		}
+		for _, domain := range list {
+			for _, addr := range addrs[domain] {
+				entry, found := entries[name]
+				if !found {
+					entry = lib.NewEntry(name)
+					entries[name] = entry
+				}
+				if err := entry.AddPrefix(addr); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] no entry is generated", g.Type, g.Action)
+	}
+
+	var ignoreIPType lib.IgnoreIPOption
+	switch g.OnlyIPType {
+	case lib.IPv4:
+		ignoreIPType = lib.IgnoreIPv6
+	case lib.IPv6:
+		ignoreIPType = lib.IgnoreIPv4
+	}
+
+	for _, entry := range entries {
+		switch g.Action {
+		case lib.ActionAdd:
+			if err := container.Add(entry, ignoreIPType); err != nil {
+				return nil, err
+			}
+		case lib.ActionRemove:
+			if err := container.Remove(entry, lib.CaseRemovePrefix, ignoreIPType); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, lib.ErrUnknownAction
+		}
+	}
+
+	return container, nil
+}
+
+// readFullDomains returns the full domains of each wanted category in the
+// GeoSite dat data, decoded field by field as geoip does not generate the
+// code of router.proto.
+func (g *geoSiteResolve) readFullDomains(data []byte) (map[string][]string, error) {
+	categories := make(map[string][]string)
+	err := consumeBytesFields(data, func(num protowire.Number, site []byte) error {
+		if num != geoSiteListEntryField {
+			return nil
+		}
+
+		var name string
+		var domains []string
+		err := consumeBytesFields(site, func(num protowire.Number, value []byte) error {
+			switch num {
+			case geoSiteCountryCodeField:
+				name = strings.ToUpper(strings.TrimSpace(string(value)))
+			case geoSiteDomainField:
+				domainType, domain, err := parseGeoSiteDomain(value)
+				if err != nil {
+					return err
+				}
+				if domainType == domainTypeFull {
+					domains = append(domains, strings.ToLower(strings.TrimSuffix(domain, ".")))
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if name != "" && len(domains) > 0 && g.Want.Wants(name) {
+			categories[name] = append(categories[name], domains...)
+		}
+		return nil
+	})
+	return categories, err
+}
+
+func parseGeoSiteDomain(data []byte) (uint64, string, error) {
+	var domainType uint64
+	var value string
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return 0, "", protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch {
+		case num == domainTypeField && typ == protowire.VarintType:
+			domainType, n = protowire.ConsumeVarint(data)
+		case num == domainValueField && typ == protowire.BytesType:
+			var b []byte
+			b, n = protowire.ConsumeBytes(data)
+			value = string(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return 0, "", protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+	return domainType, value, nil
+}
+
+// consumeBytesFields calls fn with the number and value of each field of
+// the length-delimited type in the protobuf message data, skipping others.
+func consumeBytesFields(data []byte, fn func(num protowire.Number, value []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if typ != protowire.BytesType {
+			if n = protowire.ConsumeFieldValue(num, typ, data); n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+
+		value, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if err := fn(num, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolve returns the addresses of each domain resolved by all resolvers,
+// using and updating the unexpired addresses in cache.
+func (g *geoSiteResolve) resolve(ctx context.Context, domains []string, cache map[string]*resolveCacheEntry) (map[string][]netip.Addr, error) {
+	network := "ip"
+	switch g.OnlyIPType {
+	case lib.IPv4:
+		network = "ip4"
+	case lib.IPv6:
+		network = "ip6"
+	}
+
+	resolvers := make([]*net.Resolver, 0, len(g.Resolvers))
+	for _, server := range g.Resolvers {
+		resolvers = append(resolvers, newDNSServerResolver(server, g.Timeout))
+	}
+	if len(resolvers) == 0 {
+		resolvers = append(resolvers, net.DefaultResolver)
+	}
+
+	var mu sync.Mutex
+	addrs := make(map[string][]netip.Addr, len(domains))
+	now := time.Now()
+	pending := make(chan string)
+	failed := 0
+
+	var wg sync.WaitGroup
+	for i := 0; i < min(g.Concurrency, len(domains)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for domain := range pending {
+				var resolved []netip.Addr
+				var errs []error
+				for _, resolver := range resolvers {
+					queryCtx, cancel := context.WithTimeout(ctx, g.Timeout)
+					answers, err := resolver.LookupNetIP(queryCtx, network, domain)
+					cancel()
+					if err != nil {
+						errs = append(errs, err)
+						continue
+					}
+					resolved = append(resolved, answers...)
+				}
+				resolved = validResolvedAddrs(resolved)
+
+				mu.Lock()
+				if len(resolved) > 0 {
+					addrs[domain] = resolved
+					cache[domain] = &resolveCacheEntry{Addrs: resolved, Resolved: now}
+				} else {
+					failed++
+					slog.Debug(fmt.Sprintf("[%s] failed to resolve %s: %v", g.Type, domain, errors.Join(errs...)), "type", g.Type, "domain", domain)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, domain := range domains {
+		mu.Lock()
+		entry, cached := cache[domain]
+		if cached = cached && now.Sub(entry.Resolved) < g.CacheTTL; cached {
+			addrs[domain] = entry.Addrs
+		}
+		mu.Unlock()
+		if cached {
+			continue
+		}
+		select {
+		case pending <- domain:
+		case <-ctx.Done():
+			close(pending)
+			wg.Wait()
+			return nil, ctx.Err()
+		}
+	}
+	close(pending)
+	wg.Wait()
+
+	if failed > 0 {
+		slog.Warn(fmt.Sprintf("⚠️ [%s] %d of %d domains failed to resolve", g.Type, failed, len(domains)), "type", g.Type, "failed", failed, "domains", len(domains))
+	}
+	return addrs, nil
+}
+
+// validResolvedAddrs returns the unique addresses of addrs, without the
+// unspecified and loopback ones that blocking resolvers answer with.
+func validResolvedAddrs(addrs []netip.Addr) []netip.Addr {
+	valid := make([]netip.Addr, 0, len(addrs))
+	for _, addr := range addrs {
+		addr = addr.Unmap()
+		if addr.IsUnspecified() || addr.IsLoopback() {
+			continue
+		}
+		valid = append(valid, addr)
+	}
+	slices.SortFunc(valid, netip.Addr.Compare)
+	return slices.Compact(valid)
+}
+
+// newDNSServerResolver returns the resolver querying the DNS server at
+// address.
+func newDNSServerResolver(address string, timeout time.Duration) *net.Resolver {
+	dialer := &net.Dialer{Timeout: timeout}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, address)
+		},
+	}
+}
+
+// resolverAddress returns the address of the DNS server resolver with the
+// default port 53 if omitted.
+func resolverAddress(resolver string) (string, error) {
+	resolver = strings.TrimSpace(resolver)
+	if addr, err := netip.ParseAddr(resolver); err == nil {
+		return net.JoinHostPort(addr.String(), "53"), nil
+	}
+	if _, err := netip.ParseAddrPort(resolver); err == nil {
+		return resolver, nil
+	}
+	return "", fmt.Errorf("%q is not an IP or IP:port", resolver)
+}
+
+func parsePositiveDuration(s string, defaultValue time.Duration) (time.Duration, error) {
+	if s = strings.TrimSpace(s); s == "" {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s must be positive", s)
+	}
+	return d, nil
+}
+
+type resolveCacheEntry struct {
+	Addrs    []netip.Addr `json:"addrs"`
+	Resolved time.Time    `json:"resolved"`
+}
+
+// loadCache returns the cached addresses of the domains in the cache file,
+// which is ignored if it is missing or invalid.
+func (g *geoSiteResolve) loadCache() map[string]*resolveCacheEntry {
+	cache := make(map[string]*resolveCacheEntry)
+	if g.CacheFile == "" {
+		return cache
+	}
+
+	data, err := os.ReadFile(g.CacheFile)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return cache
+	case err == nil:
+		err = json.Unmarshal(data, &cache)
+	}
+	if err != nil {
+		slog.Warn(fmt.Sprintf("⚠️ [%s] invalid cache file %s, ignored", g.Type, g.CacheFile), "type", g.Type, "path", g.CacheFile, "error", err)
+		return make(map[string]*resolveCacheEntry)
+	}
+	return cache
+}
+
+// saveCache writes the unexpired addresses in cache to the cache file.
+func (g *geoSiteResolve) saveCache(cache map[string]*resolveCacheEntry) error {
+	if g.CacheFile == "" || lib.IsDryRun() {
+		return nil
+	}
+	for domain, entry := range cache {
+		if time.Since(entry.Resolved) >= g.CacheTTL {
+			delete(cache, domain)
+		}
+	}
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(g.CacheFile, data, 0644)
+}
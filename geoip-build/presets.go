@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Loyalsoldier/geoip/lib"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(presetsCmd)
+}
+
+var presetsCmd = &cobra.Command{
+	Use:   "presets",
+	Short: "List all presets available in wantedList and excludedList as \"" + lib.PresetPrefix + "<name>\"",
+	Run: func(cmd *cobra.Command, args []string) {
+		if isJSONOutput(cmd) {
+			printJSON(lib.Presets())
+			return
+		}
+
+		fmt.Println("All available presets:")
+		for _, preset := range lib.Presets() {
+			fmt.Printf("  - %s%s (%s)\n", lib.PresetPrefix, preset.Name, preset.Description)
+			fmt.Printf("      %s\n", strings.Join(preset.Lists, ", "))
+		}
+	},
+}
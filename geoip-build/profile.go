@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	runtimepprof "runtime/pprof"
+)
+
+// stopProfiling stops the CPU profiling and writes the heap profile
+// started by startProfiling, if any.
+var stopProfiling = func() {}
+
+// startProfiling starts writing the CPU profile to cpuFile, and arranges
+// the heap profile to be written to memFile when the command exits.
+// Empty file names disable the corresponding profile.
+func startProfiling(cpuFile, memFile string) error {
+	var cpu *os.File
+	if cpuFile != "" {
+		f, err := os.Create(cpuFile)
+		if err != nil {
+			return fmt.Errorf("failed to create CPU profile: %w", err)
+		}
+		if err := runtimepprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to start CPU profile: %w", err)
+		}
+		cpu = f
+	}
+
+	stopProfiling = func() {
+		stopProfiling = func() {}
+
+		if cpu != nil {
+			runtimepprof.StopCPUProfile()
+			cpu.Close()
+		}
+
+		if memFile != "" {
+			if err := writeHeapProfile(memFile); err != nil {
+				slog.Error("❌ failed to write memory profile: "+err.Error(), "file", memFile)
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeHeapProfile(file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Get up-to-date statistics of the live heap
+	runtime.GC()
+	return runtimepprof.WriteHeapProfile(f)
+}
+
+// handlePprof registers the pprof HTTP handlers under /debug/pprof/ on mux.
+func handlePprof(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/Loyalsoldier/geoip/lib"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(publishCmd)
+	publishCmd.PersistentFlags().StringP("dir", "d", "./output", "Directory of the built artifacts to publish")
+	publishCmd.MarkPersistentFlagDirname("dir")
+	publishCmd.PersistentFlags().Bool("dry-run", false, "Print what would be published without publishing anything")
+
+	publishCmd.AddCommand(publishS3Cmd)
+	publishS3Cmd.Flags().String("endpoint", "https://s3.amazonaws.com", "Base URL of the S3 compatible API, e.g. \"https://<account id>.r2.cloudflarestorage.com\" or \"https://storage.googleapis.com\"")
+	publishS3Cmd.Flags().String("region", "us-east-1", "Region of the bucket, e.g. \"auto\" for Cloudflare R2 and Google Cloud Storage")
+	publishS3Cmd.Flags().StringP("bucket", "b", "", "Name of the bucket")
+	publishS3Cmd.Flags().StringP("prefix", "p", "", "Prefix prepended to the key of each object, e.g. \"geoip/\"")
+	publishS3Cmd.Flags().String("cache-control", "", "Cache-Control header of uploaded objects, e.g. \"public, max-age=3600\"")
+	publishS3Cmd.MarkFlagRequired("bucket")
+
+	publishCmd.AddCommand(publishGitHubCmd)
+	publishGitHubCmd.Flags().StringP("repo", "r", os.Getenv("GITHUB_REPOSITORY"), "Repository in the form of owner/name, defaults to the GITHUB_REPOSITORY environment variable")
+	publishGitHubCmd.Flags().StringP("tag", "t", "{datetime}", "Tag of the release, in which \"{date}\", \"{datetime}\" and \"{epoch}\" are replaced with the build time")
+	publishGitHubCmd.Flags().String("name", "", "Name of the release with the same placeholders as tag, defaults to the tag")
+	publishGitHubCmd.Flags().String("notes", "", "Release notes")
+	publishGitHubCmd.Flags().String("checksums", "SHA256SUMS", "Name of the checksum asset generated from all uploaded files unless a file of the same name exists, empty to disable")
+	publishGitHubCmd.Flags().String("api-url", "https://api.github.com", "Base URL of the GitHub REST API")
+}
+
+var publishCmd = &cobra.Command{
+	Use:   "publish",
+	Short: "Publish the built artifacts",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := rootCmd.PersistentPreRunE(cmd, args); err != nil {
+			return err
+		}
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			lib.SetDryRun(true)
+		}
+		return nil
+	},
+}
+
+var publishS3Cmd = &cobra.Command{
+	Use:   "s3",
+	Short: "Upload all files in the directory of artifacts to an S3 compatible bucket, e.g. AWS S3, Cloudflare R2 or Google Cloud Storage",
+	Long: `Upload all files in the directory of artifacts to an S3 compatible bucket, e.g. AWS S3, Cloudflare R2 or Google Cloud Storage.
+
+Credentials are read from the environment variables AWS_ACCESS_KEY_ID,
+AWS_SECRET_ACCESS_KEY and optionally AWS_SESSION_TOKEN. Files with the same
+SHA256 checksum as the uploaded objects are skipped.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, _ := cmd.Flags().GetString("dir")
+		endpoint, _ := cmd.Flags().GetString("endpoint")
+		region, _ := cmd.Flags().GetString("region")
+		bucket, _ := cmd.Flags().GetString("bucket")
+		prefix, _ := cmd.Flags().GetString("prefix")
+		cacheControl, _ := cmd.Flags().GetString("cache-control")
+
+		uploader, err := lib.NewS3Uploader(lib.S3Config{
+			Endpoint:     endpoint,
+			Region:       region,
+			Bucket:       bucket,
+			Prefix:       prefix,
+			CacheControl: cacheControl,
+
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		})
+		if err != nil {
+			fatal(lib.NewPublishError("s3", err))
+		}
+
+		uploaded, err := uploader.UploadDir(dir)
+		if err != nil {
+			fatal(lib.NewPublishError("s3", err))
+		}
+		log.Printf("✅ %d files uploaded to bucket %s", uploaded, bucket)
+	},
+}
+
+var publishGitHubCmd = &cobra.Command{
+	Use:   "github",
+	Short: "Create or update a GitHub release and upload all files in the directory of artifacts as its assets",
+	Long: `Create or update a GitHub release and upload all files in the directory of artifacts as its assets.
+
+The token is read from the environment variable GITHUB_TOKEN. Existing assets
+of the same names are replaced, and those with the same SHA256 checksum are
+kept untouched. Build time in tag and name is the --build-epoch flag or the
+SOURCE_DATE_EPOCH environment variable if set, or the current time.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, _ := cmd.Flags().GetString("dir")
+		repo, _ := cmd.Flags().GetString("repo")
+		tag, _ := cmd.Flags().GetString("tag")
+		name, _ := cmd.Flags().GetString("name")
+		notes, _ := cmd.Flags().GetString("notes")
+		checksums, _ := cmd.Flags().GetString("checksums")
+		apiURL, _ := cmd.Flags().GetString("api-url")
+
+		publisher, err := lib.NewGitHubPublisher(lib.GitHubReleaseConfig{
+			APIURL:    apiURL,
+			Repo:      repo,
+			Token:     os.Getenv("GITHUB_TOKEN"),
+			Tag:       tag,
+			Name:      name,
+			Body:      notes,
+			Checksums: checksums,
+		})
+		if err != nil {
+			fatal(lib.NewPublishError("github", err))
+		}
+
+		releaseURL, uploaded, err := publisher.PublishDir(dir)
+		if err != nil {
+			fatal(lib.NewPublishError("github", err))
+		}
+		log.Printf("✅ %d files uploaded to release %s %s", uploaded, publisher.Tag(), releaseURL)
+	},
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Loyalsoldier/geoip/lib"
+	"github.com/Loyalsoldier/geoip/plugin/v2ray"
+)
+
+// queryAPI answers which lists of the last successful build of the daemon
+// an IP, CIDR or domain is in, so that other services can look them up
+// without the built files.
+type queryAPI struct {
+	// geositeURI is the GeoSite dat file the domains are looked up in,
+	// reloaded after each build.
+	geositeURI string
+
+	mu        sync.RWMutex
+	container lib.Container
+	geosite   *v2ray.GeoSiteMatcher
+}
+
+// lookupResult is the result of a lookup, in the same format as the lookup
+// command in JSON output format.
+type lookupResult struct {
+	Search string   `json:"search"`
+	Found  bool     `json:"found"`
+	Lists  []string `json:"lists"`
+}
+
+func newQueryAPI(geositeURI string) *queryAPI {
+	return &queryAPI{geositeURI: strings.TrimSpace(geositeURI)}
+}
+
+func (q *queryAPI) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /lookup/ip/{ip...}", q.handleIP)
+	mux.HandleFunc("GET /lookup/domain/{domain}", q.handleDomain)
+}
+
+// refresh replaces the lists IPs are looked up in with the ones generated
+// by the inputs of instance, and reloads the GeoSite dat file. The data of
+// the last build is kept if the dat file fails to load.
+func (q *queryAPI) refresh(ctx context.Context, instance *lib.Instance) error {
+	container := instance.Container()
+
+	var geosite *v2ray.GeoSiteMatcher
+	var err error
+	if q.geositeURI != "" {
+		geosite, err = q.loadGeoSite(ctx)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if container != nil {
+		q.container = container
+	}
+	if geosite != nil {
+		q.geosite = geosite
+	}
+	return err
+}
+
+func (q *queryAPI) loadGeoSite(ctx context.Context) (*v2ray.GeoSiteMatcher, error) {
+	f, err := lib.OpenURI(ctx, q.geositeURI)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	geosite, err := v2ray.NewGeoSiteMatcher(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GeoSite dat file %s: %w", q.geositeURI, err)
+	}
+	return geosite, nil
+}
+
+func (q *queryAPI) handleIP(w http.ResponseWriter, r *http.Request) {
+	search := strings.ToLower(strings.TrimSpace(r.PathValue("ip")))
+	if !isValidIPOrCIDR(search) {
+		writeQueryError(w, http.StatusBadRequest, fmt.Sprintf("invalid IP or CIDR %q", search))
+		return
+	}
+
+	q.mu.RLock()
+	container := q.container
+	q.mu.RUnlock()
+	if container == nil {
+		writeQueryError(w, http.StatusServiceUnavailable, "no build has succeeded yet")
+		return
+	}
+
+	lists, found, err := container.Lookup(search, r.URL.Query()["list"]...)
+	if err != nil {
+		writeQueryError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for idx := range lists {
+		lists[idx] = strings.ToLower(lists[idx])
+	}
+	slices.Sort(lists)
+	writeQueryResult(w, &lookupResult{Search: search, Found: found, Lists: append([]string{}, lists...)})
+}
+
+func (q *queryAPI) handleDomain(w http.ResponseWriter, r *http.Request) {
+	search := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(r.PathValue("domain")), "."))
+	if search == "" || strings.ContainsAny(search, " /") {
+		writeQueryError(w, http.StatusBadRequest, fmt.Sprintf("invalid domain %q", search))
+		return
+	}
+	if q.geositeURI == "" {
+		writeQueryError(w, http.StatusNotFound, "domain lookups require the GeoSite dat file set by the \"lookup-geosite\" flag")
+		return
+	}
+
+	q.mu.RLock()
+	geosite := q.geosite
+	q.mu.RUnlock()
+	if geosite == nil {
+		writeQueryError(w, http.StatusServiceUnavailable, "the GeoSite dat file has not been loaded yet")
+		return
+	}
+
+	lists := geosite.Match(search)
+	if want := r.URL.Query()["list"]; len(want) > 0 {
+		lists = slices.DeleteFunc(lists, func(list string) bool {
+			return !slices.ContainsFunc(want, func(w string) bool { return strings.EqualFold(strings.TrimSpace(w), list) })
+		})
+	}
+	writeQueryResult(w, &lookupResult{Search: search, Found: len(lists) > 0, Lists: lists})
+}
+
+func writeQueryResult(w http.ResponseWriter, result *lookupResult) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func writeQueryError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{
+		Error: message,
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Loyalsoldier/geoip/selftest"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(selftestCmd)
+	selftestCmd.Flags().String("update", "", "Path to the testdata directory of the selftest package in the source tree, to write the golden files to instead of comparing with them")
+	selftestCmd.MarkFlagDirname("update")
+}
+
+var selftestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "Convert fixture lists with every input and output converter and compare the results with the golden files, to catch format regressions before publishing",
+	Run: func(cmd *cobra.Command, args []string) {
+		if update, _ := cmd.Flags().GetString("update"); update != "" {
+			if err := selftest.Update(cmd.Context(), update); err != nil {
+				fatal(err)
+			}
+			fmt.Println("Golden files updated in", update)
+			return
+		}
+
+		dir, err := os.MkdirTemp("", "geoip-selftest-")
+		if err != nil {
+			fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		results, err := selftest.Run(cmd.Context(), dir)
+		if err != nil {
+			fatal(err)
+		}
+
+		failed := 0
+		for _, result := range results {
+			if !result.OK {
+				failed++
+			}
+		}
+
+		if isJSONOutput(cmd) {
+			printJSON(results)
+		} else {
+			for _, result := range results {
+				if result.OK {
+					fmt.Printf("✅ %s\n", result.Name)
+				} else {
+					fmt.Printf("❌ %s: %s\n", result.Name, result.Error)
+				}
+			}
+			fmt.Printf("%d of %d cases passed\n", len(results)-failed, len(results))
+		}
+
+		if failed > 0 {
+			os.RemoveAll(dir)
+			fatalf("%d of %d selftest cases failed", failed, len(results))
+		}
+	},
+}
@@ -0,0 +1,442 @@
+// Package selftest is a regression suite of the converters, which converts
+// small fixture lists with every output converter and compares the files
+// written with the golden files of the last release, and reads the golden
+// files back with every input converter, so that changes of the formats
+// are caught before publishing.
+package selftest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Loyalsoldier/geoip/lib"
+)
+
+// epoch is the build timestamp embedded in the golden files.
+const epoch = 1704067200 // 2024-01-01T00:00:00Z
+
+// mmdbMetadataMarker starts the metadata section of MaxMind mmdb files, of
+// which the description and the build info of the builder are not compared.
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+//go:embed testdata
+var testdata embed.FS
+
+// outputs are the output converters of which the files are compared with
+// the golden files, in the directories of their types.
+var outputs = []string{
+	"text",
+	"clashRuleSet",
+	"clashRuleSetClassical",
+	"surgeRuleSet",
+	"v2rayGeoIPDat",
+	"maxmindMMDB",
+	"nftables",
+	"ipset",
+}
+
+// outputArgs are the args of the output converters besides outputDir, with
+// which their files do not depend on the directory they are written to.
+var outputArgs = map[string]map[string]any{
+	"nftables": {"includeDir": "/etc/nftables.d"},
+}
+
+// inputs are the input converters reading the golden files of the output
+// converters of the same types back.
+var inputs = []string{
+	"text",
+	"clashRuleSet",
+	"clashRuleSetClassical",
+	"surgeRuleSet",
+	"v2rayGeoIPDat",
+	"maxmindMMDB",
+}
+
+// stdoutOutputs are the output converters writing to stdout with their
+// args, of which the output is compared with the golden file stdoutFile in
+// the directories of their types.
+var stdoutOutputs = []struct {
+	typ  string
+	args map[string]any
+}{
+	{typ: "stdout"},
+	{typ: "lookup", args: map[string]any{"search": "1.0.1.1", "outputFormat": "json"}},
+}
+
+const stdoutFile = "stdout.txt"
+
+// Result is the result of a case of the suite.
+type Result struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type testCase struct {
+	name string
+	run  func(ctx context.Context, dir string, want map[string][]netip.Prefix) error
+}
+
+// Run runs the suite in the temporary directory dir and returns the results
+// of all cases.
+func Run(ctx context.Context, dir string) ([]*Result, error) {
+	if err := os.CopyFS(dir, testdata); err != nil {
+		return nil, err
+	}
+	dir = filepath.Join(dir, "testdata")
+	lib.SetBuildEpoch(epoch)
+	lib.SetMappedIPv4(lib.MappedIPv4AsIPv4)
+
+	want, err := readFixture(filepath.Join(dir, "fixture", "text"))
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*Result, 0, len(cases()))
+	for _, c := range cases() {
+		result := &Result{Name: c.name, OK: true}
+		if err := c.run(ctx, dir, want); err != nil {
+			result.OK, result.Error = false, err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Update writes the golden files of all output converters to the golden
+// directory of the testdata directory dir of the source tree.
+func Update(ctx context.Context, dir string) error {
+	lib.SetBuildEpoch(epoch)
+	lib.SetMappedIPv4(lib.MappedIPv4AsIPv4)
+	for _, typ := range outputs {
+		golden := filepath.Join(dir, "golden", typ)
+		if err := os.RemoveAll(golden); err != nil {
+			return err
+		}
+		if err := convert(ctx, filepath.Join(dir, "fixture", "text"), typ, golden); err != nil {
+			return fmt.Errorf("%s: %w", typ, err)
+		}
+	}
+	for _, output := range stdoutOutputs {
+		golden := filepath.Join(dir, "golden", output.typ)
+		data, err := convertStdout(ctx, filepath.Join(dir, "fixture", "text"), output.typ, output.args)
+		if err != nil {
+			return fmt.Errorf("%s: %w", output.typ, err)
+		}
+		if err := os.MkdirAll(golden, 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(golden, stdoutFile), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cases() []testCase {
+	var cases []testCase
+	for _, typ := range outputs {
+		cases = append(cases, testCase{name: "output/" + typ, run: func(ctx context.Context, dir string, _ map[string][]netip.Prefix) error {
+			out := filepath.Join(dir, "out", typ)
+			if err := convert(ctx, filepath.Join(dir, "fixture", "text"), typ, out); err != nil {
+				return err
+			}
+			return compareDir(out, filepath.Join(dir, "golden", typ))
+		}})
+	}
+
+	for _, output := range stdoutOutputs {
+		cases = append(cases, testCase{name: "output/" + output.typ, run: func(ctx context.Context, dir string, _ map[string][]netip.Prefix) error {
+			got, err := convertStdout(ctx, filepath.Join(dir, "fixture", "text"), output.typ, output.args)
+			if err != nil {
+				return err
+			}
+			want, err := os.ReadFile(filepath.Join(dir, "golden", output.typ, stdoutFile))
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(got, want) {
+				return fmt.Errorf("output %q differs from golden file %q", got, want)
+			}
+			return nil
+		}})
+	}
+
+	// The golden files are read back by the input converters of the same
+	// formats, so that the input converters are tested independently
+	for _, typ := range inputs {
+		cases = append(cases, testCase{name: "input/" + typ, run: func(ctx context.Context, dir string, want map[string][]netip.Prefix) error {
+			golden := filepath.Join(dir, "golden", typ)
+			args := map[string]any{"inputDir": golden}
+			switch typ {
+			case "v2rayGeoIPDat":
+				args = map[string]any{"uri": filepath.Join(golden, "geoip.dat")}
+			case "maxmindMMDB":
+				args = map[string]any{"uri": filepath.Join(golden, "Country.mmdb")}
+			}
+			return compareInput(ctx, typ, args, want)
+		}})
+	}
+
+	cases = append(cases,
+		testCase{name: "input/json", run: func(ctx context.Context, dir string, want map[string][]netip.Prefix) error {
+			return compareInput(ctx, "json", map[string]any{
+				"inputDir": filepath.Join(dir, "fixture", "json"),
+				"jsonPath": []string{"prefixes"},
+			}, want)
+		}},
+		testCase{name: "input/maxmindGeoLite2CountryCSV", run: func(ctx context.Context, dir string, want map[string][]netip.Prefix) error {
+			csv := filepath.Join(dir, "fixture", "csv")
+			return compareInput(ctx, "maxmindGeoLite2CountryCSV", map[string]any{
+				"country": filepath.Join(csv, "GeoLite2-Country-Locations-en.csv"),
+				"ipv4":    filepath.Join(csv, "GeoLite2-Country-Blocks-IPv4.csv"),
+				"ipv6":    filepath.Join(csv, "GeoLite2-Country-Blocks-IPv6.csv"),
+			}, want)
+		}},
+		testCase{name: "input/maxmindGeoLite2ASNCSV", run: func(ctx context.Context, dir string, want map[string][]netip.Prefix) error {
+			csv := filepath.Join(dir, "fixture", "asn")
+			return compareInput(ctx, "maxmindGeoLite2ASNCSV", map[string]any{
+				"ipv4":       filepath.Join(csv, "GeoLite2-ASN-Blocks-IPv4.csv"),
+				"ipv6":       filepath.Join(csv, "GeoLite2-ASN-Blocks-IPv6.csv"),
+				"wantedList": map[string][]string{"cn": {"4134"}, "us": {"16509"}},
+			}, want)
+		}},
+		testCase{name: "input/maxmindGeoLite2CityCSV", run: func(ctx context.Context, dir string, want map[string][]netip.Prefix) error {
+			csv := filepath.Join(dir, "fixture", "city")
+			return compareInput(ctx, "maxmindGeoLite2CityCSV", map[string]any{
+				"city":        filepath.Join(csv, "GeoLite2-City-Locations-en.csv"),
+				"ipv4":        filepath.Join(csv, "GeoLite2-City-Blocks-IPv4.csv"),
+				"ipv6":        filepath.Join(csv, "GeoLite2-City-Blocks-IPv6.csv"),
+				"granularity": "country",
+			}, want)
+		}},
+		// The fixture lists with bogons added are the text fixture lists
+		// once the bogons are removed
+		testCase{name: "input/bogon", run: func(ctx context.Context, dir string, want map[string][]netip.Prefix) error {
+			return compareInputs(ctx, []any{
+				map[string]any{"type": "text", "action": "add", "args": map[string]any{"inputDir": filepath.Join(dir, "fixture", "bogon")}},
+				map[string]any{"type": "bogon", "action": "remove"},
+			}, want)
+		}},
+		// The full domains are resolved from the cache file only, so that no
+		// DNS query is sent
+		testCase{name: "input/v2rayGeoSiteResolve", run: func(ctx context.Context, dir string, _ map[string][]netip.Prefix) error {
+			geosite := filepath.Join(dir, "fixture", "geosite")
+			want, err := readFixture(filepath.Join(geosite, "want"))
+			if err != nil {
+				return err
+			}
+			return compareInput(ctx, "v2rayGeoSiteResolve", map[string]any{
+				"uri":        filepath.Join(geosite, "geosite.dat"),
+				"wantedList": []string{"cn", "us"},
+				"cacheFile":  filepath.Join(geosite, "cache.json"),
+				"cacheTTL":   "876000h",
+			}, want)
+		}},
+		// The edge cases of IPv6 and prefix lengths are normalized the same
+		// way by all converters, of which the text input is tested
+		testCase{name: "normalize/text", run: func(ctx context.Context, dir string, _ map[string][]netip.Prefix) error {
+			want, err := readFixture(filepath.Join(dir, "fixture", "normalize", "want"))
+			if err != nil {
+				return err
+			}
+			return compareInput(ctx, "text", map[string]any{"inputDir": filepath.Join(dir, "fixture", "normalize", "in")}, want)
+		}},
+	)
+	return cases
+}
+
+// convert converts the text fixture lists in dir with the output converter
+// typ to the directory out.
+func convert(ctx context.Context, dir, typ, out string) error {
+	args := map[string]any{"outputDir": out}
+	maps.Copy(args, outputArgs[typ])
+	config := map[string]any{
+		"input":  []any{map[string]any{"type": "text", "action": "add", "args": map[string]any{"inputDir": dir}}},
+		"output": []any{map[string]any{"type": typ, "action": "output", "args": args}},
+	}
+	instance, err := newInstance(config)
+	if err != nil {
+		return err
+	}
+	return instance.Run(ctx)
+}
+
+// convertStdout converts the text fixture lists in dir with the output
+// converter typ of args writing to stdout, and returns what it writes.
+func convertStdout(ctx context.Context, dir, typ string, args map[string]any) ([]byte, error) {
+	config := map[string]any{
+		"input":  []any{map[string]any{"type": "text", "action": "add", "args": map[string]any{"inputDir": dir}}},
+		"output": []any{map[string]any{"type": typ, "action": "output", "args": args}},
+	}
+	instance, err := newInstance(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	lib.SetStdout(&buf)
+	defer lib.SetStdout(nil)
+	if err := instance.Run(ctx); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compareInput reads the lists with the input converter typ of args and
+// compares them with want.
+func compareInput(ctx context.Context, typ string, args map[string]any, want map[string][]netip.Prefix) error {
+	return compareInputs(ctx, []any{map[string]any{"type": typ, "action": "add", "args": args}}, want)
+}
+
+// compareInputs reads the lists with the input converters of inputs in
+// order and compares them with want.
+func compareInputs(ctx context.Context, inputs []any, want map[string][]netip.Prefix) error {
+	config := map[string]any{
+		"input": inputs,
+	}
+	instance, err := newInstance(config)
+	if err != nil {
+		return err
+	}
+	if _, err := instance.RunInput(ctx); err != nil {
+		return err
+	}
+	lists, err := instance.ListPrefixes()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(want)) {
+		got, found := lists[name]
+		if !found {
+			return fmt.Errorf("list %s not found", name)
+		}
+		if !slices.Equal(got, want[name]) {
+			return fmt.Errorf("list %s: got %v, want %v", name, got, want[name])
+		}
+	}
+	for name := range lists {
+		if _, found := want[name]; !found {
+			return fmt.Errorf("unexpected list %s", name)
+		}
+	}
+	return nil
+}
+
+func newInstance(config map[string]any) (*lib.Instance, error) {
+	content, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	instance, err := lib.NewInstance()
+	if err != nil {
+		return nil, err
+	}
+	if err := instance.InitFromBytes(content); err != nil {
+		return nil, err
+	}
+	return instance, nil
+}
+
+// compareDir compares the files in dir with the golden files in golden.
+func compareDir(dir, golden string) error {
+	files, err := listFiles(dir)
+	if err != nil {
+		return err
+	}
+	goldenFiles, err := listFiles(golden)
+	if err != nil {
+		return err
+	}
+	if !slices.Equal(files, goldenFiles) {
+		return fmt.Errorf("files %v differ from golden files %v", files, goldenFiles)
+	}
+
+	for _, file := range files {
+		got, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			return err
+		}
+		want, err := os.ReadFile(filepath.Join(golden, file))
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(file, ".mmdb") {
+			got, want = mmdbData(got), mmdbData(want)
+		}
+		if !bytes.Equal(got, want) {
+			return fmt.Errorf("%s differs from golden file", file)
+		}
+	}
+	return nil
+}
+
+// mmdbData returns the search tree and data section of the mmdb file data.
+func mmdbData(data []byte) []byte {
+	if idx := bytes.LastIndex(data, mmdbMetadataMarker); idx >= 0 {
+		return data[:idx]
+	}
+	return data
+}
+
+// listFiles returns the sorted paths of the files in dir relative to dir.
+func listFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	slices.Sort(files)
+	return files, err
+}
+
+// readFixture parses the text fixture lists in dir, written in the canonical
+// form of merged CIDRs sorted with IPv4 first, so that the lists of all
+// input converters are compared with them exactly.
+func readFixture(dir string) (map[string][]netip.Prefix, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	lists := make(map[string][]netip.Prefix, len(entries))
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		name := strings.ToUpper(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			prefix, err := netip.ParsePrefix(line)
+			if err != nil {
+				return nil, fmt.Errorf("fixture %s: %w", entry.Name(), err)
+			}
+			lists[name] = append(lists[name], prefix)
+		}
+	}
+	return lists, nil
+}
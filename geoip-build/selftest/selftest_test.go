@@ -0,0 +1,31 @@
+package selftest_test
+
+import (
+	"context"
+	"testing"
+
+	_ "github.com/Loyalsoldier/geoip/plugin/firewall"
+	_ "github.com/Loyalsoldier/geoip/plugin/maxmind"
+	_ "github.com/Loyalsoldier/geoip/plugin/plaintext"
+	_ "github.com/Loyalsoldier/geoip/plugin/special"
+	_ "github.com/Loyalsoldier/geoip/plugin/v2ray"
+	"github.com/Loyalsoldier/geoip/selftest"
+)
+
+func TestRun(t *testing.T) {
+	results, err := selftest.Run(context.Background(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) == 0 {
+		t.Fatal("no case is run")
+	}
+
+	for _, result := range results {
+		t.Run(result.Name, func(t *testing.T) {
+			if !result.OK {
+				t.Error(result.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/Loyalsoldier/geoip/lib"
+	"github.com/robfig/cron/v3"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringP("config", "c", "config.json", "URI of the JSON, YAML or TOML format config file, support both local file path and remote HTTP(S) URL")
+	serveCmd.MarkFlagFilename("config", "json", "yaml", "yml", "toml")
+	serveCmd.Flags().StringP("schedule", "s", "0 4 * * *", "Cron expression of the schedule to rebuild, e.g. \"0 4 * * *\" or \"@every 6h\"")
+	serveCmd.Flags().StringP("listen", "l", "127.0.0.1:8080", "Address to listen on for the build status endpoint \"/status\" and the lookup API")
+	serveCmd.Flags().StringP("dir", "d", "", "Directory of the built artifacts to serve over HTTP, with a JSON index at \"/index.json\"")
+	serveCmd.Flags().Bool("run-on-start", true, "Run a build immediately on start")
+	serveCmd.Flags().Bool("lookup-api", false, "Expose the JSON endpoints \"/lookup/ip/{ip}\" and \"/lookup/domain/{domain}\" answering which lists of the last successful build an IP, CIDR or domain is in")
+	serveCmd.Flags().String("lookup-geosite", "", "URI of the V2Ray GeoSite dat file domains are looked up in by the lookup API, reloaded after each build, support both local file path and remote HTTP(S) URL")
+	serveCmd.Flags().Bool("pprof", false, "Expose the runtime profiling data of the daemon under \"/debug/pprof/\" for analysis with \"go tool pprof\"")
+	serveCmd.Flags().String("attributions", "", "Path to the file of the licenses and attributions declared by the inputs in config file of each build, e.g. \"./output/ATTRIBUTIONS\"")
+	serveCmd.Flags().String("manifest", "", "Path to the JSON manifest of all written outputs and the versions of remote sources of each build, e.g. \"./output/version.json\"")
+	serveCmd.Flags().String("checksums", "", "Path to the sha256sum compatible checksum file of all written outputs of each build, e.g. \"./output/SHA256SUMS\"")
+	serveCmd.Flags().Bool("checksum-files", false, "Write a \".sha256\" checksum file next to each written output of each build")
+	serveCmd.Flags().String("sign", "", "Sign every written output of each build with a detached signature by the tool, available options: \"minisign\", \"gpg\"")
+	serveCmd.Flags().String("sign-key", "", "Path to the secret key file for minisign, or the key ID for gpg, passphrase of which is read from the "+lib.SignPassphraseEnv+" environment variable")
+	serveCmd.Flags().StringArray("notify-webhook", []string{}, "URL to POST the JSON report of each build to when it completes, can be used multiple times")
+	serveCmd.Flags().String("notify-telegram-chat", "", "ID of the Telegram chat to send the report of each build to when it completes, token of the bot is read from the "+lib.TelegramBotTokenEnv+" environment variable")
+	serveCmd.Flags().String("notify-on", lib.NotifyAlways, "When to send notifications, available options: \"always\", \"success\", \"failure\"")
+	serveCmd.Flags().String("metrics-file", "", "Path to the Prometheus textfile of the metrics of the last build, e.g. for the textfile collector of node_exporter")
+	serveCmd.Flags().String("metrics-push", "", "URL of the Prometheus Pushgateway to push the metrics of each build to, e.g. \"http://localhost:9091\"")
+	serveCmd.Flags().String("metrics-job", "geoip", "Job label of the metrics pushed to the Pushgateway")
+	serveCmd.Flags().Int("max-failures", 0, "Number of failed inputs not marked as optional to be skipped before a build fails")
+	serveCmd.Flags().IntP("jobs", "j", runtime.NumCPU(), "Number of inputs to parse concurrently in each build, 1 to parse them one by one")
+	serveCmd.Flags().Int("output-jobs", runtime.NumCPU(), "Number of outputs to write concurrently in each build, 1 to write them one by one")
+	serveCmd.Flags().String("max-memory", "", "Memory each build should fit in, e.g. \"512MB\", lists are spilled to a temporary file and inputs and outputs run one by one")
+	serveCmd.Flags().String("incremental", "", "Path to the state file of incremental builds, outputs whose config and inputs are unchanged since the last build are skipped")
+	serveCmd.Flags().String("parse-cache", "", "Directory to cache the parsed inputs in, keyed by the content hash of their sources, so that unchanged sources are not parsed again")
+	serveCmd.MarkFlagDirname("dir")
+}
+
+var serveCmd = &cobra.Command{
+	Use:     "serve",
+	Aliases: []string{"daemon"},
+	Short:   "Run as a daemon that periodically converts geoip data by using config file and exposes the last build status",
+	Run: func(cmd *cobra.Command, args []string) {
+		configFile, _ := cmd.Flags().GetString("config")
+		spec, _ := cmd.Flags().GetString("schedule")
+		listen, _ := cmd.Flags().GetString("listen")
+		runOnStart, _ := cmd.Flags().GetBool("run-on-start")
+		dir, _ := cmd.Flags().GetString("dir")
+
+		schedule, err := cron.ParseStandard(spec)
+		if err != nil {
+			fatal("invalid argument schedule: ", err)
+		}
+
+		maxFailures, _ := cmd.Flags().GetInt("max-failures")
+		jobs, _ := cmd.Flags().GetInt("jobs")
+		outputJobs, _ := cmd.Flags().GetInt("output-jobs")
+		maxMemory, err := maxMemoryFlag(cmd)
+		if err != nil {
+			fatal(err)
+		}
+		var parseCache *lib.ParseCache
+		if cacheDir, _ := cmd.Flags().GetString("parse-cache"); cacheDir != "" {
+			if parseCache, err = lib.NewParseCache(cacheDir); err != nil {
+				fatal(err)
+			}
+		}
+		var incremental *lib.Incremental
+		if stateFile, _ := cmd.Flags().GetString("incremental"); stateFile != "" {
+			if incremental, err = lib.NewIncremental(stateFile); err != nil {
+				fatal(err)
+			}
+		}
+		attributions, _ := cmd.Flags().GetString("attributions")
+		manifest, _ := cmd.Flags().GetString("manifest")
+		checksums, _ := cmd.Flags().GetString("checksums")
+		checksumFiles, _ := cmd.Flags().GetBool("checksum-files")
+
+		signer, err := newSigner(cmd)
+		if err != nil {
+			fatal(err)
+		}
+
+		notifier, err := newNotifier(cmd)
+		if err != nil {
+			fatal(err)
+		}
+
+		metrics, err := newMetricsExporter(cmd)
+		if err != nil {
+			fatal(err)
+		}
+
+		d := &daemon{
+			configFile:    configFile,
+			maxFailures:   maxFailures,
+			jobs:          jobs,
+			outputJobs:    outputJobs,
+			maxMemory:     maxMemory,
+			parseCache:    parseCache,
+			incremental:   incremental,
+			attributions:  attributions,
+			manifest:      manifest,
+			checksums:     checksums,
+			checksumFiles: checksumFiles,
+			signer:        signer,
+			notifier:      notifier,
+			metrics:       metrics,
+		}
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/status", d.handleStatus)
+		if enablePprof, _ := cmd.Flags().GetBool("pprof"); enablePprof {
+			handlePprof(mux)
+		}
+		if lookupAPI, _ := cmd.Flags().GetBool("lookup-api"); lookupAPI {
+			geosite, _ := cmd.Flags().GetString("lookup-geosite")
+			d.query = newQueryAPI(geosite)
+			d.query.register(mux)
+		}
+		if dir != "" {
+			d.server = newArtifactServer(dir)
+			mux.HandleFunc("/index.json", d.server.handleIndex)
+			mux.Handle("/", d.server)
+		}
+		go func() {
+			log.Println("Listen on:", listen)
+			if err := http.ListenAndServe(listen, mux); err != nil {
+				fatal(err)
+			}
+		}()
+
+		// A running build is canceled on SIGINT or SIGTERM, leaving the
+		// artifacts of the last build untouched, and the daemon exits
+		ctx := cmd.Context()
+		if runOnStart {
+			d.build(ctx)
+		}
+
+		for ctx.Err() == nil {
+			next := schedule.Next(time.Now())
+			d.setNextRun(next)
+			log.Println("Next build at:", next.Format(time.RFC3339))
+			select {
+			case <-time.After(time.Until(next)):
+				d.build(ctx)
+			case <-ctx.Done():
+			}
+		}
+		log.Println("Daemon stopped:", context.Cause(ctx))
+	},
+}
+
+// buildStatus is the status of a build run by the daemon.
+type buildStatus struct {
+	Config     string               `json:"config"`
+	StartedAt  time.Time            `json:"startedAt"`
+	FinishedAt time.Time            `json:"finishedAt"`
+	Duration   string               `json:"duration"`
+	Success    bool                 `json:"success"`
+	Error      string               `json:"error,omitempty"`
+	Changed    bool                 `json:"changed"`
+	Artifacts  []*buildArtifact     `json:"artifacts"`
+	Failures   []*lib.SourceFailure `json:"failures"`
+}
+
+type buildArtifact struct {
+	Type      string `json:"type"`
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`
+	Lists     int    `json:"lists"`
+	Unchanged bool   `json:"unchanged"`
+}
+
+type daemon struct {
+	configFile    string
+	maxFailures   int
+	jobs          int
+	outputJobs    int
+	maxMemory     int64
+	parseCache    *lib.ParseCache
+	incremental   *lib.Incremental
+	attributions  string
+	manifest      string
+	checksums     string
+	checksumFiles bool
+	signer        *lib.Signer
+	notifier      *lib.Notifier
+	metrics       *lib.MetricsExporter
+	server        *artifactServer
+	query         *queryAPI
+
+	mu      sync.RWMutex
+	last    *buildStatus
+	nextRun time.Time
+}
+
+func (d *daemon) build(ctx context.Context) {
+	status := &buildStatus{
+		Config:    d.configFile,
+		StartedAt: time.Now(),
+		Artifacts: []*buildArtifact{},
+	}
+
+	instance, changed, err := d.convert(ctx)
+	var failures []*lib.SourceFailure
+	if instance != nil {
+		failures = instance.Failures()
+	}
+	status.Failures = failures
+	if err != nil {
+		slog.Error("❌ build failed: "+err.Error(), "config", d.configFile)
+		status.Error = err.Error()
+	} else {
+		status.Success = true
+		status.Changed = changed
+		for _, artifact := range lib.Artifacts() {
+			status.Artifacts = append(status.Artifacts, &buildArtifact{
+				Type:      artifact.Type,
+				Path:      artifact.Path,
+				Size:      artifact.Size,
+				Lists:     len(artifact.Lists),
+				Unchanged: artifact.Unchanged,
+			})
+		}
+	}
+
+	if d.query != nil && err == nil {
+		if err := d.query.refresh(ctx, instance); err != nil {
+			slog.Error("❌ failed to refresh lookup API: "+err.Error(), "geosite", d.query.geositeURI)
+		}
+	}
+
+	if d.server != nil {
+		if err := d.server.refresh(); err != nil {
+			slog.Error("❌ failed to refresh served artifacts: "+err.Error(), "dir", d.server.dir)
+		}
+	}
+
+	status.FinishedAt = time.Now()
+	status.Duration = status.FinishedAt.Sub(status.StartedAt).Round(time.Millisecond).String()
+
+	d.mu.Lock()
+	d.last = status
+	d.mu.Unlock()
+
+	if err == nil && !changed {
+		slog.Info("⏭️ no artifact is changed since the last build, the manifest, checksums, signatures, notifications and metrics are skipped", "config", d.configFile)
+		return
+	}
+
+	var summary *lib.Summary
+	if err == nil {
+		summary, _ = instance.Summary()
+	}
+	if err := d.notifier.Notify(lib.NewBuildReport(d.configFile, status.StartedAt, summary, err, failures)); err != nil {
+		slog.Error("❌ failed to send notifications: "+err.Error(), "config", d.configFile)
+	}
+	if err := d.metrics.Export(instance, status.StartedAt, err); err != nil {
+		slog.Error("❌ failed to export metrics: "+err.Error(), "config", d.configFile)
+	}
+}
+
+// convert runs a build and returns the instance run, which is nil if it failed
+// to be initialized, and whether any file written by its output converters is
+// changed since the last build. The attributions, manifest, checksums and
+// signatures are only written if changed, as the manifest embeds the build
+// time.
+func (d *daemon) convert(ctx context.Context) (*lib.Instance, bool, error) {
+	instance, err := lib.NewInstance()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := instance.Init(d.configFile); err != nil {
+		return nil, false, err
+	}
+	instance.SetMaxFailures(d.maxFailures)
+	instance.SetConcurrency(d.jobs)
+	instance.SetOutputConcurrency(d.outputJobs)
+	instance.SetMaxMemory(d.maxMemory)
+	instance.SetParseCache(d.parseCache)
+	instance.SetIncremental(d.incremental)
+
+	if err := instance.Run(ctx); err != nil {
+		return instance, true, err
+	}
+
+	changed := false
+	for _, artifact := range lib.Artifacts() {
+		changed = changed || !artifact.Unchanged
+	}
+	if !changed {
+		return instance, false, nil
+	}
+
+	if d.attributions != "" {
+		if err := instance.WriteAttributions(d.attributions); err != nil {
+			return instance, true, err
+		}
+	}
+
+	if d.manifest != "" {
+		if err := instance.WriteManifest(d.manifest); err != nil {
+			return instance, true, err
+		}
+	}
+
+	if err := lib.WriteChecksums(d.checksums, d.checksumFiles); err != nil {
+		return instance, true, err
+	}
+
+	if d.signer != nil {
+		return instance, true, d.signer.SignArtifacts()
+	}
+
+	return instance, true, nil
+}
+
+func (d *daemon) setNextRun(next time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.nextRun = next
+}
+
+func (d *daemon) handleStatus(w http.ResponseWriter, r *http.Request) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	resp := struct {
+		LastBuild *buildStatus `json:"lastBuild"`
+		NextRun   time.Time    `json:"nextRun"`
+	}{
+		LastBuild: d.last,
+		NextRun:   d.nextRun,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/Loyalsoldier/geoip/lib"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+	statsCmd.PersistentFlags().StringP("config", "c", "config.json", "URI of the JSON, YAML or TOML format config file, support both local file path and remote HTTP(S) URL")
+	statsCmd.MarkPersistentFlagFilename("config", "json", "yaml", "yml", "toml")
+}
+
+var statsCmd = &cobra.Command{
+	Use:     "stats",
+	Aliases: []string{"stat"},
+	Short:   "Show the number of IPv4 & IPv6 CIDRs of each list generated by the inputs of config file",
+	Run: func(cmd *cobra.Command, args []string) {
+		configFile, _ := cmd.Flags().GetString("config")
+		log.Println("Use config:", configFile)
+
+		instance, err := lib.NewInstance()
+		if err != nil {
+			fatal(err)
+		}
+
+		if err := instance.Init(configFile); err != nil {
+			fatal(err)
+		}
+
+		container, err := instance.RunInput(cmd.Context())
+		if err != nil {
+			fatal(err)
+		}
+
+		stats, err := lib.GetStats(container)
+		if err != nil {
+			fatal(err)
+		}
+
+		if isJSONOutput(cmd) {
+			printJSON(stats)
+			return
+		}
+
+		lib.PrintStats(os.Stdout, stats, nil)
+	},
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Loyalsoldier/geoip/lib"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(versionCmd)
+}
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version, commit and date of the build of geoip",
+	Run: func(cmd *cobra.Command, args []string) {
+		info := lib.GetBuildInfo()
+		if isJSONOutput(cmd) {
+			printJSON(info)
+			return
+		}
+
+		fmt.Println("Version:   ", info.Version)
+		if info.Commit != "" {
+			commit := info.Commit
+			if info.Modified {
+				commit += " (modified)"
+			}
+			fmt.Println("Commit:    ", commit)
+		}
+		if info.Date != "" {
+			fmt.Println("Date:      ", info.Date)
+		}
+		fmt.Println("Go version:", info.GoVersion)
+	},
+}
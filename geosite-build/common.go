@@ -1,17 +1,16 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"go/build"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
 )
 
-type fileName string
-
-type attribute string
-
 // GetDataDir returns the path to the "data" directory used to generate lists.
 // Usage order:
 // 1. The datapath that user set when running the program
@@ -19,13 +18,13 @@ type attribute string
 // 3. The path to the data directory of project `v2fly/domain-list-community` in GOPATH mode
 func GetDataDir() string {
 	if *dataPath != "" { // Use dataPath option if set by user
-		fmt.Printf("Use domain list files in '%s' directory.\n", *dataPath)
+		slog.Info(fmt.Sprintf("Use domain list files in '%s' directory.", *dataPath), "dir", *dataPath)
 		return *dataPath
 	}
 
 	defaultDataDir := filepath.Join("./", "data")
 	if _, err := os.Stat(defaultDataDir); !os.IsNotExist(err) { // Use "./data" directory if exists
-		fmt.Printf("Use domain list files in '%s' directory.\n", defaultDataDir)
+		slog.Info(fmt.Sprintf("Use domain list files in '%s' directory.", defaultDataDir), "dir", defaultDataDir)
 		return defaultDataDir
 	}
 
@@ -98,16 +97,80 @@ func GetGOPATH() string {
 	return GOPATH
 }
 
-// isEmpty checks if the rule that has been trimmed out spaces is empty
-func isEmpty(s string) bool {
-	return len(strings.TrimSpace(s)) == 0
+// writeOutputFile writes data to the file in the output path,
+// or only prints what would be written in dry-run mode.
+func writeOutputFile(filename string, data []byte) error {
+	_, err := writeOutputStream(filename, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+	return err
 }
 
-// removeComment removes comments in the rule
-func removeComment(line string) string {
-	idx := strings.Index(line, "#")
-	if idx == -1 {
-		return line
+// writeOutputStream is like writeOutputFile, but the content of the file is
+// written incrementally by write, so that it is never held in memory as a
+// whole. It returns the size of the content.
+func writeOutputStream(filename string, write func(w io.Writer) error) (int64, error) {
+	counter := new(countingWriter)
+	if *dryRun {
+		if err := write(counter); err != nil {
+			return 0, err
+		}
+		slog.Info(fmt.Sprintf("%s would be generated in '%s' (dry run, %d bytes).", filename, *outputPath, counter.n), "file", filename, "dir", *outputPath, "bytes", counter.n, "dryRun", true)
+		return counter.n, nil
+	}
+
+	if err := writeFileAtomic(filepath.Join(*outputPath, filename), func(w io.Writer) error {
+		return write(io.MultiWriter(w, counter))
+	}); err != nil {
+		return 0, err
+	}
+	slog.Info(fmt.Sprintf("%s has been generated successfully in '%s'.", filename, *outputPath), "file", filename, "dir", *outputPath, "bytes", counter.n)
+
+	return counter.n, nil
+}
+
+// writeFileAtomic writes the content written by write to a temporary file in
+// the directory of path, creating the directory if necessary, and renames it
+// to path once it is synced to disk, so that a crashed or failed run never
+// leaves path truncated. The temporary file is removed on failure.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
 	}
-	return strings.TrimSpace(line[:idx])
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	buf := bufio.NewWriter(tmp)
+	if err := write(buf); err != nil {
+		return err
+	}
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
 }
@@ -1,6 +1,7 @@
 module github.com/Loyalsoldier/domain-list-custom
 
-go 1.21
+go 1.22
+
 toolchain go1.22.5
 
 require (
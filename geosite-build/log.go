@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// setupLogger sets the default logger writing to stderr with the minimum level
+// ("debug", "info", "warn" or "error") and format ("text" or "json").
+func setupLogger(level, format string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level: %s", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: l}
+	switch strings.ToLower(format) {
+	case "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, opts)))
+	default:
+		return fmt.Errorf("invalid log format: %s", format)
+	}
+
+	return nil
+}
+
+// fatal logs the error at error level and exits.
+func fatal(err error) {
+	slog.Error("Failed: " + err.Error())
+	os.Exit(1)
+}
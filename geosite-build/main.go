@@ -1,12 +1,16 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/Loyalsoldier/domain-list-custom/pkg/geosite"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -15,54 +19,68 @@ var (
 	datName      = flag.String("datname", "geosite.dat", "Name of the generated dat file")
 	outputPath   = flag.String("outputpath", "./publish", "Output path to the generated files")
 	exportLists  = flag.String("exportlists", "", "Lists to be exported in plaintext format, separated by ',' comma")
+	exportAttrs  = flag.Bool("exportattrs", false, "Also export the rules with each attribute present in each list of exportlists in plaintext format, named like 'google@cn.txt'")
 	excludeAttrs = flag.String("excludeattrs", "cn@!cn@ads,geolocation-cn@!cn@ads,geolocation-!cn@cn@ads", "Exclude rules with certain attributes in certain lists, seperated by ',' comma, support multiple attributes in one list. Example: geolocation-!cn@cn@ads,geolocation-cn@!cn")
 	toGFWList    = flag.String("togfwlist", "geolocation-!cn", "List to be exported in GFWList format")
+	exportDat    = flag.String("exportdat", "", "Path to an existing dat file to be exported to files in the format of data directory into outputpath, skipping generation")
+	mergeDats    = flag.String("mergedats", "", "Paths to existing dat files to be merged into datname in outputpath, separated by ',' comma, skipping generation")
+	mergePolicy  = flag.String("mergepolicy", geosite.MergePolicyUnion, "Policy for lists existing in more than one dat file to be merged, available options: union, prefer-first, error")
+	dryRun       = flag.Bool("dryrun", false, "Process all lists and print what would be generated without writing any file")
+	verify       = flag.Bool("verify", false, "Re-read the generated dat file and check it against the lists in memory")
+	logLevel     = flag.String("loglevel", "info", "Minimum level of logs, available options: debug, info, warn, error")
+	logFormat    = flag.String("logformat", "text", "Format of logs, available options: text, json")
+	provenance   = flag.String("provenance", "", "Name of the CSV file generated in outputpath recording the data file and line every rule of every list comes from")
+	graph        = flag.String("graph", "", "Name of the file generated in outputpath describing how lists include each other, in JSON format if it ends with '.json' or Graphviz DOT format otherwise")
 )
 
 func main() {
 	flag.Parse()
 
-	dir := GetDataDir()
-	listInfoMap := make(ListInfoMap)
+	if err := setupLogger(*logLevel, *logFormat); err != nil {
+		fatal(err)
+	}
+
+	if *dryRun && *verify {
+		fatal(errors.New("dryrun cannot be used with verify"))
+	}
+
+	if *exportDat != "" {
+		if err := geosite.ExportDat(*exportDat, *outputPath); err != nil {
+			fatal(err)
+		}
+		return
+	}
 
-	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+	if *mergeDats != "" {
+		var paths []string
+		for _, path := range strings.Split(*mergeDats, ",") {
+			if path = strings.TrimSpace(path); path != "" {
+				paths = append(paths, path)
+			}
+		}
+		geositeList, err := geosite.MergeDats(paths, strings.ToLower(strings.TrimSpace(*mergePolicy)))
 		if err != nil {
-			return err
+			fatal(err)
 		}
-		if info.IsDir() {
-			return nil
+		protoBytes, err := proto.MarshalOptions{Deterministic: true}.Marshal(geositeList)
+		if err != nil {
+			fatal(err)
 		}
-		if err := listInfoMap.Marshal(path); err != nil {
+		if err := writeFileAtomic(filepath.Join(*outputPath, *datName), func(w io.Writer) error {
+			_, err := w.Write(protoBytes)
 			return err
+		}); err != nil {
+			fatal(err)
 		}
-		return nil
-	}); err != nil {
-		fmt.Println("Failed:", err)
-		os.Exit(1)
+		slog.Info(fmt.Sprintf("%s has been merged successfully in '%s'.", *datName, *outputPath), "file", *datName, "dir", *outputPath, "bytes", len(protoBytes))
+		return
 	}
 
-	if err := listInfoMap.FlattenAndGenUniqueDomainList(); err != nil {
-		fmt.Println("Failed:", err)
-		os.Exit(1)
-	}
-
-	// Process and split *excludeRules
-	excludeAttrsInFile := make(map[fileName]map[attribute]bool)
-	if *excludeAttrs != "" {
-		exFilenameAttrSlice := strings.Split(*excludeAttrs, ",")
-		for _, exFilenameAttr := range exFilenameAttrSlice {
-			exFilenameAttr = strings.TrimSpace(exFilenameAttr)
-			exFilenameAttrMap := strings.Split(exFilenameAttr, "@")
-			filename := fileName(strings.ToUpper(strings.TrimSpace(exFilenameAttrMap[0])))
-			excludeAttrsInFile[filename] = make(map[attribute]bool)
-			for _, attr := range exFilenameAttrMap[1:] {
-				attr = strings.TrimSpace(attr)
-				if len(attr) > 0 {
-					excludeAttrsInFile[filename][attribute(attr)] = true
-				}
-			}
-		}
+	listInfoMap, err := geosite.LoadDir(GetDataDir())
+	if err != nil {
+		fatal(err)
 	}
+	excludeAttrsInFile := geosite.ParseExcludeAttrs(*excludeAttrs)
 
 	// Process and split *exportLists
 	var exportListsSlice []string
@@ -77,37 +95,72 @@ func main() {
 	}
 
 	// Generate dlc.dat
+	var datSize int64
 	if geositeList := listInfoMap.ToProto(excludeAttrsInFile); geositeList != nil {
-		protoBytes, err := proto.Marshal(geositeList)
+		size, err := writeOutputStream(*datName, func(w io.Writer) error {
+			return geosite.WriteProto(w, geositeList)
+		})
+		if err != nil {
+			fatal(err)
+		}
+		datSize = size
+
+		if *verify {
+			if err := geosite.VerifyDat(filepath.Join(*outputPath, *datName), listInfoMap); err != nil {
+				fatal(err)
+			}
+			slog.Info(fmt.Sprintf("%s has been verified successfully.", *datName), "file", *datName)
+		}
+	}
+
+	// Generate provenance of rules
+	if *provenance != "" {
+		provenanceBytes, err := listInfoMap.ToProvenanceCSV()
 		if err != nil {
-			fmt.Println("Failed:", err)
-			os.Exit(1)
+			fatal(err)
 		}
-		if err := os.MkdirAll(*outputPath, 0755); err != nil {
-			fmt.Println("Failed:", err)
-			os.Exit(1)
+		if err := writeOutputFile(*provenance, provenanceBytes); err != nil {
+			fatal(err)
 		}
-		if err := os.WriteFile(filepath.Join(*outputPath, *datName), protoBytes, 0644); err != nil {
-			fmt.Println("Failed:", err)
-			os.Exit(1)
-		} else {
-			fmt.Printf("%s has been generated successfully in '%s'.\n", *datName, *outputPath)
+	}
+
+	// Generate inclusion graph of lists
+	if *graph != "" {
+		listGraph := listInfoMap.ToGraph(excludeAttrsInFile)
+		if _, err := writeOutputStream(*graph, func(w io.Writer) error {
+			if strings.EqualFold(filepath.Ext(*graph), ".json") {
+				return listGraph.WriteJSON(w)
+			}
+			return listGraph.WriteDOT(w)
+		}); err != nil {
+			fatal(err)
 		}
 	}
 
+	// Print summary of the generated lists
+	fmt.Println()
+	listInfoMap.PrintStats(os.Stdout)
+	fmt.Printf("\n%s: %d bytes\n", *datName, datSize)
+
 	// Generate plaintext list files
 	if filePlainTextBytesMap, err := listInfoMap.ToPlainText(exportListsSlice); err == nil {
 		for filename, plaintextBytes := range filePlainTextBytesMap {
 			filename += ".txt"
-			if err := os.WriteFile(filepath.Join(*outputPath, filename), plaintextBytes, 0644); err != nil {
-				fmt.Println("Failed:", err)
-				os.Exit(1)
-			} else {
-				fmt.Printf("%s has been generated successfully in '%s'.\n", filename, *outputPath)
+			if err := writeOutputFile(filename, plaintextBytes); err != nil {
+				fatal(err)
 			}
 		}
 	} else {
-		fmt.Println("Failed:", err)
-		os.Exit(1)
+		fatal(err)
+	}
+
+	// Generate plaintext list files of attributes
+	if *exportAttrs {
+		for filename, plaintextBytes := range listInfoMap.ToAttributePlainText(exportListsSlice) {
+			filename += ".txt"
+			if err := writeOutputFile(filename, plaintextBytes); err != nil {
+				fatal(err)
+			}
+		}
 	}
 }
@@ -0,0 +1,40 @@
+package geosite
+
+import (
+	"sort"
+	"strings"
+)
+
+// FileName is the name of a list, i.e. the upper-cased name of its file in
+// the data directory.
+type FileName string
+
+// Attribute is an attribute of rules, e.g. "@cn", or attributes joined
+// together, e.g. "@cn@ads".
+type Attribute string
+
+// isEmpty checks if the rule that has been trimmed out spaces is empty
+func isEmpty(s string) bool {
+	return len(strings.TrimSpace(s)) == 0
+}
+
+// removeComment removes comments in the rule
+func removeComment(line string) string {
+	idx := strings.Index(line, "#")
+	if idx == -1 {
+		return line
+	}
+	return strings.TrimSpace(line[:idx])
+}
+
+// sortedKeys returns the keys of the map in sorted order.
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i] < keys[j]
+	})
+	return keys
+}
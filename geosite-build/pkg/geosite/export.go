@@ -0,0 +1,76 @@
+package geosite
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+	"google.golang.org/protobuf/proto"
+)
+
+// ExportDat converts every list of an existing geosite dat file back to
+// a file in the format of the data directory, so that upstream artifacts
+// can be audited or migrated into a data directory.
+func ExportDat(path, dir string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var geositeList router.GeoSiteList
+	if err := proto.Unmarshal(data, &geositeList); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for _, geosite := range geositeList.Entry {
+		filename := strings.ToLower(strings.TrimSpace(geosite.CountryCode))
+		if filename == "" {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, filename), toDataFormat(geosite), 0644); err != nil {
+			return err
+		}
+		slog.Info(fmt.Sprintf("%s has been exported successfully in '%s'.", filename, dir), "file", filename, "dir", dir)
+	}
+
+	return nil
+}
+
+// toDataFormat converts router.GeoSite to the format of files in data directory.
+func toDataFormat(geosite *router.GeoSite) []byte {
+	dataBytes := make([]byte, 0, 1024*512)
+
+	for _, rule := range geosite.Domain {
+		ruleVal := strings.TrimSpace(rule.GetValue())
+		if len(ruleVal) == 0 {
+			continue
+		}
+
+		var ruleString string
+		switch rule.Type {
+		case router.Domain_Full:
+			ruleString = "full:" + ruleVal
+		case router.Domain_RootDomain:
+			ruleString = ruleVal
+		case router.Domain_Plain:
+			ruleString = "keyword:" + ruleVal
+		case router.Domain_Regex:
+			ruleString = "regexp:" + ruleVal
+		}
+
+		for _, attr := range rule.Attribute {
+			ruleString += " @" + attr.GetKey()
+		}
+		// Output format is: type:domain.tld @attr1 @attr2
+		dataBytes = append(dataBytes, []byte(ruleString+"\n")...)
+	}
+
+	return dataBytes
+}
@@ -0,0 +1,119 @@
+package geosite
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Graph is how the lists in data directory are composed of each other by
+// the "include" syntax, along with the attributes excluded from them.
+type Graph struct {
+	Lists      []*GraphList      `json:"lists"`
+	Inclusions []*GraphInclusion `json:"inclusions"`
+}
+
+// GraphList is a list of Graph.
+type GraphList struct {
+	Name string `json:"name"`
+	// Rules is the number of rules generated by ToProto, including those of
+	// the included lists.
+	Rules              int      `json:"rules"`
+	ExcludedAttributes []string `json:"excludedAttributes,omitempty"`
+}
+
+// GraphInclusion is the inclusion of list To in list From, with only the
+// rules having any of Attributes if there are.
+type GraphInclusion struct {
+	From       string   `json:"from"`
+	To         string   `json:"to"`
+	Attributes []string `json:"attributes,omitempty"`
+}
+
+// ToGraph returns the graph of the lists, sorted by name. The numbers of
+// rules are those generated by ToProto with excludeAttrs.
+func (lm *ListInfoMap) ToGraph(excludeAttrs map[FileName]map[Attribute]bool) *Graph {
+	graph := &Graph{
+		Lists:      make([]*GraphList, 0, len(*lm)),
+		Inclusions: make([]*GraphInclusion, 0),
+	}
+
+	for _, name := range sortedKeys(*lm) {
+		listinfo := (*lm)[name]
+		list := &GraphList{Name: strings.ToLower(string(name))}
+		if listinfo.GeoSite != nil {
+			list.Rules = len(listinfo.GeoSite.Domain)
+		}
+		for _, attr := range sortedKeys(excludeAttrs[name]) {
+			list.ExcludedAttributes = append(list.ExcludedAttributes, string(attr))
+		}
+		graph.Lists = append(graph.Lists, list)
+
+		for _, filename := range sortedKeys(listinfo.InclusionAttributeMap) {
+			inclusion := &GraphInclusion{
+				From: list.Name,
+				To:   strings.ToLower(string(filename)),
+			}
+			all := false
+			for _, attr := range listinfo.InclusionAttributeMap[filename] {
+				// "@" is the placeholder of the inclusion of all rules
+				if attr == "@" {
+					all = true
+					continue
+				}
+				inclusion.Attributes = append(inclusion.Attributes, strings.TrimPrefix(string(attr), "@"))
+			}
+			if all {
+				inclusion.Attributes = nil
+			} else {
+				sort.Strings(inclusion.Attributes)
+			}
+			graph.Inclusions = append(graph.Inclusions, inclusion)
+		}
+	}
+
+	return graph
+}
+
+// WriteJSON writes the graph to w in indented JSON format.
+func (g *Graph) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(g)
+}
+
+// WriteDOT writes the graph to w in Graphviz DOT format, with an edge from
+// each list to every list it includes, labeled with the attributes of the
+// inclusion if any.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph geosite {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box];\n")
+	for _, list := range g.Lists {
+		label := fmt.Sprintf("%s\\n%d rules", list.Name, list.Rules)
+		if len(list.ExcludedAttributes) > 0 {
+			label += "\\nexcludes " + strings.Join(list.ExcludedAttributes, " ")
+		}
+		fmt.Fprintf(&b, "  %s [label=%s];\n", dotQuote(list.Name), dotQuote(label))
+	}
+	for _, inclusion := range g.Inclusions {
+		fmt.Fprintf(&b, "  %s -> %s", dotQuote(inclusion.From), dotQuote(inclusion.To))
+		if len(inclusion.Attributes) > 0 {
+			fmt.Fprintf(&b, " [label=%s]", dotQuote("@"+strings.Join(inclusion.Attributes, " @")))
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dotQuote quotes s as a DOT ID, keeping the escape sequences of labels
+// like "\n" written in s.
+func dotQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
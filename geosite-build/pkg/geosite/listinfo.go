@@ -1,4 +1,4 @@
-package main
+package geosite
 
 import (
 	"bufio"
@@ -16,30 +16,30 @@ import (
 // It includes all types of rules of the file, as well as servel types of
 // sturctures of same items for convenience in later process.
 type ListInfo struct {
-	Name                    fileName
+	Name                    FileName
 	HasInclusion            bool
-	InclusionAttributeMap   map[fileName][]attribute
+	InclusionAttributeMap   map[FileName][]Attribute
 	FullTypeList            []*router.Domain
 	KeywordTypeList         []*router.Domain
 	RegexpTypeList          []*router.Domain
 	AttributeRuleUniqueList []*router.Domain
 	DomainTypeList          []*router.Domain
 	DomainTypeUniqueList    []*router.Domain
-	AttributeRuleListMap    map[attribute][]*router.Domain
+	AttributeRuleListMap    map[Attribute][]*router.Domain
 	GeoSite                 *router.GeoSite
 }
 
 // NewListInfo return a ListInfo
 func NewListInfo() *ListInfo {
 	return &ListInfo{
-		InclusionAttributeMap:   make(map[fileName][]attribute),
+		InclusionAttributeMap:   make(map[FileName][]Attribute),
 		FullTypeList:            make([]*router.Domain, 0, 10),
 		KeywordTypeList:         make([]*router.Domain, 0, 10),
 		RegexpTypeList:          make([]*router.Domain, 0, 10),
 		AttributeRuleUniqueList: make([]*router.Domain, 0, 10),
 		DomainTypeList:          make([]*router.Domain, 0, 10),
 		DomainTypeUniqueList:    make([]*router.Domain, 0, 10),
-		AttributeRuleListMap:    make(map[attribute][]*router.Domain),
+		AttributeRuleListMap:    make(map[Attribute][]*router.Domain),
 	}
 }
 
@@ -47,8 +47,10 @@ func NewListInfo() *ListInfo {
 // and generates a ListInfo of each file.
 func (l *ListInfo) ProcessList(file *os.File) error {
 	scanner := bufio.NewScanner(file)
+	lineNum := 0
 	// Parse a file line by line to generate ListInfo
 	for scanner.Scan() {
+		lineNum++
 		line := scanner.Text()
 		if isEmpty(line) {
 			continue
@@ -64,6 +66,7 @@ func (l *ListInfo) ProcessList(file *os.File) error {
 		if parsedRule == nil {
 			continue
 		}
+		recordOrigin(parsedRule, file.Name(), lineNum)
 		l.classifyRule(parsedRule)
 	}
 	if err := scanner.Err(); err != nil {
@@ -115,18 +118,18 @@ func (l *ListInfo) parseInclusion(inclusion string) {
 	inclusionVal := strings.TrimPrefix(strings.TrimSpace(inclusion), "include:")
 	l.HasInclusion = true
 	inclusionValSlice := strings.Split(inclusionVal, "@")
-	filename := fileName(strings.ToUpper(strings.TrimSpace(inclusionValSlice[0])))
+	filename := FileName(strings.ToUpper(strings.TrimSpace(inclusionValSlice[0])))
 	switch len(inclusionValSlice) {
 	case 1: // Inclusion without attribute
 		// Use '@' as the placeholder attribute for 'include:filename'
-		l.InclusionAttributeMap[filename] = append(l.InclusionAttributeMap[filename], attribute("@"))
+		l.InclusionAttributeMap[filename] = append(l.InclusionAttributeMap[filename], Attribute("@"))
 	default: // Inclusion with attribute(s)
 		// support new inclusion syntax, eg: `include:google @cn @gfw`
 		for _, attr := range inclusionValSlice[1:] {
 			attr = strings.ToLower(strings.TrimSpace(attr))
 			if attr != "" {
 				// Added in this format: '@cn'
-				l.InclusionAttributeMap[filename] = append(l.InclusionAttributeMap[filename], attribute("@"+attr))
+				l.InclusionAttributeMap[filename] = append(l.InclusionAttributeMap[filename], Attribute("@"+attr))
 			}
 		}
 	}
@@ -175,9 +178,9 @@ func (l *ListInfo) parseAttribute(attr string) (*router.Domain_Attribute, error)
 func (l *ListInfo) classifyRule(rule *router.Domain) {
 	if len(rule.Attribute) > 0 {
 		l.AttributeRuleUniqueList = append(l.AttributeRuleUniqueList, rule)
-		var attrsString attribute
+		var attrsString Attribute
 		for _, attr := range rule.Attribute {
-			attrsString += attribute("@" + attr.GetKey()) // attrsString will be "@cn@ads" if there are more than one attributes
+			attrsString += Attribute("@" + attr.GetKey()) // attrsString will be "@cn@ads" if there are more than one attributes
 		}
 		l.AttributeRuleListMap[attrsString] = append(l.AttributeRuleListMap[attrsString], rule)
 	} else {
@@ -201,7 +204,9 @@ func (l *ListInfo) classifyRule(rule *router.Domain) {
 // to remove duplications of them.
 func (l *ListInfo) Flatten(lm *ListInfoMap) error {
 	if l.HasInclusion {
-		for filename, attrs := range l.InclusionAttributeMap {
+		// Iterate in sorted order to make the generated rules deterministic
+		for _, filename := range sortedKeys(l.InclusionAttributeMap) {
+			attrs := l.InclusionAttributeMap[filename]
 			for _, attrWanted := range attrs {
 				includedList := (*lm)[filename]
 				switch string(attrWanted) {
@@ -211,12 +216,13 @@ func (l *ListInfo) Flatten(lm *ListInfoMap) error {
 					l.KeywordTypeList = append(l.KeywordTypeList, includedList.KeywordTypeList...)
 					l.RegexpTypeList = append(l.RegexpTypeList, includedList.RegexpTypeList...)
 					l.AttributeRuleUniqueList = append(l.AttributeRuleUniqueList, includedList.AttributeRuleUniqueList...)
-					for attr, domainList := range includedList.AttributeRuleListMap {
-						l.AttributeRuleListMap[attr] = append(l.AttributeRuleListMap[attr], domainList...)
+					for _, attr := range sortedKeys(includedList.AttributeRuleListMap) {
+						l.AttributeRuleListMap[attr] = append(l.AttributeRuleListMap[attr], includedList.AttributeRuleListMap[attr]...)
 					}
 
 				default:
-					for attr, domainList := range includedList.AttributeRuleListMap {
+					for _, attr := range sortedKeys(includedList.AttributeRuleListMap) {
+						domainList := includedList.AttributeRuleListMap[attr]
 						// If there are more than one attribute attached to the rule,
 						// the attribute key of AttributeRuleListMap in ListInfo
 						// will be like: "@cn@ads".
@@ -235,7 +241,7 @@ func (l *ListInfo) Flatten(lm *ListInfoMap) error {
 		}
 	}
 
-	sort.Slice(l.DomainTypeList, func(i, j int) bool {
+	sort.SliceStable(l.DomainTypeList, func(i, j int) bool {
 		return len(strings.Split(l.DomainTypeList[i].GetValue(), ".")) < len(strings.Split(l.DomainTypeList[j].GetValue(), "."))
 	})
 
@@ -256,7 +262,7 @@ func (l *ListInfo) Flatten(lm *ListInfoMap) error {
 // ToGeoSite converts every ListInfo into a router.GeoSite structure.
 // It also excludes rules with certain attributes in certain files that
 // user specified in command line when runing the program.
-func (l *ListInfo) ToGeoSite(excludeAttrs map[fileName]map[attribute]bool) {
+func (l *ListInfo) ToGeoSite(excludeAttrs map[FileName]map[Attribute]bool) {
 	geosite := new(router.GeoSite)
 	geosite.CountryCode = string(l.Name)
 	geosite.Domain = append(geosite.Domain, l.FullTypeList...)
@@ -274,7 +280,7 @@ func (l *ListInfo) ToGeoSite(excludeAttrs map[fileName]map[attribute]bool) {
 		for _, domain := range l.AttributeRuleUniqueList {
 			ifKeep := true
 			for _, attr := range domain.GetAttribute() {
-				if excludeAttrsMap[attribute(attr.GetKey())] {
+				if excludeAttrsMap[Attribute(attr.GetKey())] {
 					ifKeep = false
 					break
 				}
@@ -294,35 +300,58 @@ func (l *ListInfo) ToPlainText() []byte {
 	plaintextBytes := make([]byte, 0, 1024*512)
 
 	for _, rule := range l.GeoSite.Domain {
-		ruleVal := strings.TrimSpace(rule.GetValue())
-		if len(ruleVal) == 0 {
-			continue
+		if ruleString := formatRule(rule); ruleString != "" {
+			plaintextBytes = append(plaintextBytes, []byte(ruleString+"\n")...)
 		}
+	}
 
-		var ruleString string
-		switch rule.Type {
-		case router.Domain_Full:
-			ruleString = "full:" + ruleVal
-		case router.Domain_RootDomain:
-			ruleString = "domain:" + ruleVal
-		case router.Domain_Plain:
-			ruleString = "keyword:" + ruleVal
-		case router.Domain_Regex:
-			ruleString = "regexp:" + ruleVal
-		}
+	return plaintextBytes
+}
 
-		if len(rule.Attribute) > 0 {
-			ruleString += ":"
-			for _, attr := range rule.Attribute {
-				ruleString += "@" + attr.GetKey() + ","
-			}
-			ruleString = strings.TrimRight(ruleString, ",")
+// ToAttributePlainText returns the rules having each attribute present in
+// router.GeoSite in plaintext format, keyed by the attribute, e.g. "cn".
+func (l *ListInfo) ToAttributePlainText() map[string][]byte {
+	attrPlainTextBytesMap := make(map[string][]byte)
+	for _, rule := range l.GeoSite.Domain {
+		ruleString := formatRule(rule)
+		if ruleString == "" {
+			continue
+		}
+		for _, attr := range rule.Attribute {
+			attrPlainTextBytesMap[attr.GetKey()] = append(attrPlainTextBytesMap[attr.GetKey()], ruleString+"\n"...)
 		}
-		// Output format is: type:domain.tld:@attr1,@attr2
-		plaintextBytes = append(plaintextBytes, []byte(ruleString+"\n")...)
 	}
+	return attrPlainTextBytesMap
+}
 
-	return plaintextBytes
+// formatRule returns the rule in the format of "type:domain.tld:@attr1,@attr2",
+// or an empty string if the value of the rule is empty.
+func formatRule(rule *router.Domain) string {
+	ruleVal := strings.TrimSpace(rule.GetValue())
+	if len(ruleVal) == 0 {
+		return ""
+	}
+
+	var ruleString string
+	switch rule.Type {
+	case router.Domain_Full:
+		ruleString = "full:" + ruleVal
+	case router.Domain_RootDomain:
+		ruleString = "domain:" + ruleVal
+	case router.Domain_Plain:
+		ruleString = "keyword:" + ruleVal
+	case router.Domain_Regex:
+		ruleString = "regexp:" + ruleVal
+	}
+
+	if len(rule.Attribute) > 0 {
+		ruleString += ":"
+		for _, attr := range rule.Attribute {
+			ruleString += "@" + attr.GetKey() + ","
+		}
+		ruleString = strings.TrimRight(ruleString, ",")
+	}
+	return ruleString
 }
 
 // ToGFWList converts router.GeoSite to GFWList format.
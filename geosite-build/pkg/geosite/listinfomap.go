@@ -0,0 +1,212 @@
+package geosite
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// ListInfoMap is the map of files in data directory and ListInfo
+type ListInfoMap map[FileName]*ListInfo
+
+// Marshal processes a file in data directory and generates ListInfo for it.
+func (lm *ListInfoMap) Marshal(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	list := NewListInfo()
+	listName := FileName(strings.ToUpper(filepath.Base(path)))
+	list.Name = listName
+	if err := list.ProcessList(file); err != nil {
+		return err
+	}
+
+	(*lm)[listName] = list
+	return nil
+}
+
+// FlattenAndGenUniqueDomainList flattens the included lists and
+// generates a domain trie for each file in data directory to
+// make the items of domain type list unique.
+func (lm *ListInfoMap) FlattenAndGenUniqueDomainList() error {
+	inclusionLevel := make([]map[FileName]bool, 0, 20)
+	okayList := make(map[FileName]bool)
+	inclusionLevelAllLength, loopTimes := 0, 0
+
+	for inclusionLevelAllLength < len(*lm) {
+		inclusionMap := make(map[FileName]bool)
+
+		if loopTimes == 0 {
+			for _, listinfo := range *lm {
+				if listinfo.HasInclusion {
+					continue
+				}
+				inclusionMap[listinfo.Name] = true
+			}
+		} else {
+			for _, listinfo := range *lm {
+				if !listinfo.HasInclusion || okayList[listinfo.Name] {
+					continue
+				}
+
+				var passTimes int
+				for filename := range listinfo.InclusionAttributeMap {
+					if !okayList[filename] {
+						break
+					}
+					passTimes++
+				}
+				if passTimes == len(listinfo.InclusionAttributeMap) {
+					inclusionMap[listinfo.Name] = true
+				}
+			}
+		}
+
+		for filename := range inclusionMap {
+			okayList[filename] = true
+		}
+
+		inclusionLevel = append(inclusionLevel, inclusionMap)
+		inclusionLevelAllLength += len(inclusionMap)
+		loopTimes++
+	}
+
+	for idx, inclusionMap := range inclusionLevel {
+		slog.Debug(fmt.Sprintf("Level %d: %v", idx+1, inclusionMap), "level", idx+1)
+
+		for inclusionFilename := range inclusionMap {
+			if err := (*lm)[inclusionFilename].Flatten(lm); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ToProto generates a router.GeoSite for each file in data directory
+// and returns a router.GeoSiteList
+func (lm *ListInfoMap) ToProto(excludeAttrs map[FileName]map[Attribute]bool) *router.GeoSiteList {
+	protoList := new(router.GeoSiteList)
+	for _, name := range sortedKeys(*lm) {
+		listinfo := (*lm)[name]
+		listinfo.ToGeoSite(excludeAttrs)
+		protoList.Entry = append(protoList.Entry, listinfo.GeoSite)
+	}
+	return protoList
+}
+
+// geoSiteListEntryField is the number of the entry field of router.GeoSiteList.
+const geoSiteListEntryField protowire.Number = 1
+
+// WriteProto writes the router.GeoSiteList to w in protobuf format. The
+// router.GeoSite of each list is marshaled and written one by one as the
+// repeated entry field, so that the whole dat is never marshaled in memory.
+func WriteProto(w io.Writer, list *router.GeoSiteList) error {
+	var header, message []byte
+	for _, geosite := range list.Entry {
+		var err error
+		message, err = proto.MarshalOptions{Deterministic: true}.MarshalAppend(message[:0], geosite)
+		if err != nil {
+			return err
+		}
+		header = protowire.AppendTag(header[:0], geoSiteListEntryField, protowire.BytesType)
+		header = protowire.AppendVarint(header, uint64(len(message)))
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		if _, err := w.Write(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ToPlainText returns a map of exported lists that user wants
+// and the contents of them in byte format.
+func (lm *ListInfoMap) ToPlainText(exportListsMap []string) (map[string][]byte, error) {
+	filePlainTextBytesMap := make(map[string][]byte)
+	for _, filename := range exportListsMap {
+		if listinfo := (*lm)[FileName(strings.ToUpper(filename))]; listinfo != nil {
+			plaintextBytes := listinfo.ToPlainText()
+			filePlainTextBytesMap[filename] = plaintextBytes
+		} else {
+			slog.Warn("Notice: "+filename+": no such exported list in the directory, skipped.", "list", filename)
+		}
+	}
+	return filePlainTextBytesMap, nil
+}
+
+// ToAttributePlainText returns a map of the rules having each attribute
+// present in the exported lists that user wants, named like "google@cn",
+// and the contents of them in byte format.
+func (lm *ListInfoMap) ToAttributePlainText(exportListsMap []string) map[string][]byte {
+	filePlainTextBytesMap := make(map[string][]byte)
+	for _, filename := range exportListsMap {
+		if listinfo := (*lm)[FileName(strings.ToUpper(filename))]; listinfo != nil {
+			for attr, plaintextBytes := range listinfo.ToAttributePlainText() {
+				filePlainTextBytesMap[filename+"@"+attr] = plaintextBytes
+			}
+		}
+	}
+	return filePlainTextBytesMap
+}
+
+// ToGFWList returns the content of the list to be generated into GFWList format
+// that user wants in bytes format.
+func (lm *ListInfoMap) ToGFWList(togfwlist string) ([]byte, error) {
+	if togfwlist != "" {
+		if listinfo := (*lm)[FileName(strings.ToUpper(togfwlist))]; listinfo != nil {
+			return listinfo.ToGFWList(), nil
+		}
+		return nil, errors.New("no such list: " + togfwlist)
+	}
+	return nil, nil
+}
+
+// PrintStats prints the number of rules by type of each list
+// that has been converted to router.GeoSite structure.
+func (lm *ListInfoMap) PrintStats(w io.Writer) {
+	names := make([]string, 0, len(*lm))
+	for name := range *lm {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LIST\tFULL\tDOMAIN\tKEYWORD\tREGEXP\tTOTAL\t")
+	for _, name := range names {
+		listinfo := (*lm)[FileName(name)]
+		if listinfo.GeoSite == nil {
+			continue
+		}
+
+		counts := make(map[router.Domain_Type]int)
+		for _, rule := range listinfo.GeoSite.Domain {
+			counts[rule.Type]++
+		}
+
+		mark := ""
+		if len(listinfo.GeoSite.Domain) == 0 {
+			mark = "empty"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%s\n", name,
+			counts[router.Domain_Full], counts[router.Domain_RootDomain],
+			counts[router.Domain_Plain], counts[router.Domain_Regex],
+			len(listinfo.GeoSite.Domain), mark)
+	}
+	tw.Flush()
+}
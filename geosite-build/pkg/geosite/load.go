@@ -0,0 +1,64 @@
+package geosite
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LoadDir parses every list file in the data directory dir, and flattens
+// the inclusions of all lists, so that the returned lists are ready to be
+// converted by ToProto, ToPlainText and ToGFWList.
+func LoadDir(dir string) (ListInfoMap, error) {
+	listInfoMap := make(ListInfoMap)
+
+	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		start := time.Now()
+		if err := listInfoMap.Marshal(path); err != nil {
+			return err
+		}
+		slog.Debug("Parsed "+path, "path", path, "bytes", info.Size(), "duration", time.Since(start))
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := listInfoMap.FlattenAndGenUniqueDomainList(); err != nil {
+		return nil, err
+	}
+
+	return listInfoMap, nil
+}
+
+// ParseExcludeAttrs parses the rules with certain attributes to be excluded
+// from certain lists by ToProto, separated by ',' comma, with multiple
+// attributes in one list, e.g. "geolocation-!cn@cn@ads,geolocation-cn@!cn".
+func ParseExcludeAttrs(s string) map[FileName]map[Attribute]bool {
+	excludeAttrsInFile := make(map[FileName]map[Attribute]bool)
+	if s == "" {
+		return excludeAttrsInFile
+	}
+
+	for _, exFilenameAttr := range strings.Split(s, ",") {
+		exFilenameAttr = strings.TrimSpace(exFilenameAttr)
+		exFilenameAttrMap := strings.Split(exFilenameAttr, "@")
+		filename := FileName(strings.ToUpper(strings.TrimSpace(exFilenameAttrMap[0])))
+		excludeAttrsInFile[filename] = make(map[Attribute]bool)
+		for _, attr := range exFilenameAttrMap[1:] {
+			attr = strings.TrimSpace(attr)
+			if len(attr) > 0 {
+				excludeAttrsInFile[filename][Attribute(attr)] = true
+			}
+		}
+	}
+
+	return excludeAttrsInFile
+}
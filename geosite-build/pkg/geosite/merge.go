@@ -0,0 +1,97 @@
+package geosite
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+	"google.golang.org/protobuf/proto"
+)
+
+// Policies of MergeDats for lists existing in more than one dat file.
+const (
+	MergePolicyUnion       = "union"
+	MergePolicyPreferFirst = "prefer-first"
+	MergePolicyError       = "error"
+)
+
+// MergeDats merges multiple geosite dat files into one router.GeoSiteList.
+// The policy decides what to do with lists existing in more than one file:
+// "union" merges the rules of them, "prefer-first" keeps the list of the
+// first file only, and "error" fails the merge.
+func MergeDats(paths []string, policy string) (*router.GeoSiteList, error) {
+	switch policy {
+	case MergePolicyUnion, MergePolicyPreferFirst, MergePolicyError:
+	default:
+		return nil, fmt.Errorf("invalid merge policy: %s", policy)
+	}
+
+	geositeMap := make(map[string]*router.GeoSite)
+	ruleKeysMap := make(map[string]map[string]bool)
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var geositeList router.GeoSiteList
+		if err := proto.Unmarshal(data, &geositeList); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		for _, geosite := range geositeList.Entry {
+			name := strings.ToUpper(strings.TrimSpace(geosite.CountryCode))
+			merged, found := geositeMap[name]
+			if found {
+				switch policy {
+				case MergePolicyPreferFirst:
+					slog.Warn(fmt.Sprintf("Notice: %s: list %s is skipped as it already exists.", path, name), "path", path, "list", name)
+					continue
+				case MergePolicyError:
+					return nil, fmt.Errorf("%s: list %s already exists", path, name)
+				}
+			} else {
+				merged = &router.GeoSite{CountryCode: name}
+				geositeMap[name] = merged
+				ruleKeysMap[name] = make(map[string]bool)
+			}
+
+			// Skip duplicated rules in lists existing in more than one file
+			for _, rule := range geosite.Domain {
+				key := ruleKey(rule)
+				if ruleKeysMap[name][key] {
+					continue
+				}
+				ruleKeysMap[name][key] = true
+				merged.Domain = append(merged.Domain, rule)
+			}
+		}
+	}
+
+	protoList := new(router.GeoSiteList)
+	for _, geosite := range geositeMap {
+		protoList.Entry = append(protoList.Entry, geosite)
+	}
+	sort.Slice(protoList.Entry, func(i, j int) bool {
+		return protoList.Entry[i].CountryCode < protoList.Entry[j].CountryCode
+	})
+
+	return protoList, nil
+}
+
+// ruleKey returns the string that identifies a rule with its type, value and attributes.
+func ruleKey(rule *router.Domain) string {
+	var b strings.Builder
+	b.WriteString(rule.Type.String())
+	b.WriteString(":")
+	b.WriteString(rule.GetValue())
+	for _, attr := range rule.Attribute {
+		b.WriteString("@")
+		b.WriteString(attr.GetKey())
+	}
+	return b.String()
+}
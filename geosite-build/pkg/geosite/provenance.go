@@ -0,0 +1,49 @@
+package geosite
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// ruleOrigin is where a rule is defined in data directory.
+type ruleOrigin struct {
+	Path string
+	Line int
+}
+
+// ruleOrigins maps every parsed rule to where it is defined. Rules included
+// by other lists are shared with them, so they keep their origins.
+var ruleOrigins = make(map[*router.Domain]ruleOrigin)
+
+func recordOrigin(rule *router.Domain, path string, line int) {
+	ruleOrigins[rule] = ruleOrigin{Path: path, Line: line}
+}
+
+// ToProvenanceCSV returns the rules of every list generated by ToProto,
+// along with the data file and line they come from, in CSV format.
+func (lm *ListInfoMap) ToProvenanceCSV() ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"list", "rule", "file", "line"})
+
+	for _, name := range sortedKeys(*lm) {
+		listinfo := (*lm)[name]
+		if listinfo.GeoSite == nil {
+			continue
+		}
+		for _, rule := range listinfo.GeoSite.Domain {
+			ruleString := formatRule(rule)
+			if ruleString == "" {
+				continue
+			}
+			origin := ruleOrigins[rule]
+			w.Write([]string{string(name), ruleString, origin.Path, strconv.Itoa(origin.Line)})
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
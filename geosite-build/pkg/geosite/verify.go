@@ -0,0 +1,53 @@
+package geosite
+
+import (
+	"fmt"
+	"os"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+	"google.golang.org/protobuf/proto"
+)
+
+// verifySampleSize is the maximum number of rules of each list
+// to be checked when verifying the generated dat file.
+const verifySampleSize = 100
+
+// VerifyDat re-reads the generated dat file and checks it against the lists
+// in memory. Every list must exist with the same number of rules, and a sample
+// of its rules must round-trip unchanged.
+func VerifyDat(path string, lm ListInfoMap) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var geositeList router.GeoSiteList
+	if err := proto.Unmarshal(data, &geositeList); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if len(geositeList.Entry) != len(lm) {
+		return fmt.Errorf("%s: expected %d lists, got %d", path, len(lm), len(geositeList.Entry))
+	}
+
+	for _, geosite := range geositeList.Entry {
+		listinfo := lm[FileName(geosite.CountryCode)]
+		if listinfo == nil || listinfo.GeoSite == nil {
+			return fmt.Errorf("%s: list %s not found in build", path, geosite.CountryCode)
+		}
+
+		want := listinfo.GeoSite.Domain
+		if len(geosite.Domain) != len(want) {
+			return fmt.Errorf("%s: list %s: expected %d rules, got %d", path, geosite.CountryCode, len(want), len(geosite.Domain))
+		}
+
+		step := max(1, len(want)/verifySampleSize)
+		for idx := 0; idx < len(want); idx += step {
+			if !proto.Equal(geosite.Domain[idx], want[idx]) {
+				return fmt.Errorf("%s: list %s: rule %d mismatched", path, geosite.CountryCode, idx)
+			}
+		}
+	}
+
+	return nil
+}
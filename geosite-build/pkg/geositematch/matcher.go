@@ -0,0 +1,238 @@
+// Package geositematch answers which lists of a geosite.dat file a domain is
+// in, with the same semantics of full, domain, keyword and regexp rules and
+// of attribute selectors as V2Ray, so that DNS servers and proxies written
+// in Go can route with the same data the build produces.
+package geositematch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+	"google.golang.org/protobuf/proto"
+)
+
+// Matcher matches domains against the lists of a geosite.dat file. It is
+// immutable once loaded, and safe for concurrent use.
+type Matcher struct {
+	lists    []string
+	full     map[string][]int // indexes of the lists of each full rule
+	domain   map[string][]int // indexes of the lists of each domain rule
+	keywords []keywordRule
+	regexps  []regexpRule
+}
+
+type keywordRule struct {
+	keyword string
+	list    int
+}
+
+type regexpRule struct {
+	re   *regexp.Regexp
+	list int
+}
+
+// selector selects the rules of a list having all of the attributes.
+type selector struct {
+	name  string
+	list  string
+	attrs []string
+}
+
+// parseSelector parses a selector in the format of "list" or
+// "list@attr1@attr2", e.g. "google@cn".
+func parseSelector(s string) (*selector, error) {
+	parts := strings.Split(strings.TrimSpace(s), "@")
+	sel := &selector{list: strings.ToUpper(strings.TrimSpace(parts[0]))}
+	if sel.list == "" {
+		return nil, fmt.Errorf("invalid selector %q: empty list name", s)
+	}
+	for _, attr := range parts[1:] {
+		attr = strings.ToLower(strings.TrimSpace(attr))
+		if attr == "" {
+			return nil, fmt.Errorf("invalid selector %q: empty attribute", s)
+		}
+		sel.attrs = append(sel.attrs, attr)
+	}
+	sel.name = strings.Join(append([]string{sel.list}, sel.attrs...), "@")
+	return sel, nil
+}
+
+func (s *selector) selects(rule *router.Domain) bool {
+	for _, attr := range s.attrs {
+		if !slices.ContainsFunc(rule.Attribute, func(a *router.Domain_Attribute) bool {
+			return a.GetKey() == attr && a.GetBoolValue()
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+// Load loads the geosite.dat file at path. See LoadDat for selectors.
+func Load(path string, selectors ...string) (*Matcher, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return LoadDat(data, selectors...)
+}
+
+// LoadDat loads the content of a geosite.dat file. Only the lists selected
+// by selectors are loaded if any is given, each of which is either the name
+// of a list, e.g. "google", or the name of a list with attributes, e.g.
+// "google@cn", to select only the rules having all of the attributes. All
+// lists are loaded without attribute filtering otherwise.
+func LoadDat(data []byte, selectors ...string) (*Matcher, error) {
+	var geositeList router.GeoSiteList
+	if err := proto.Unmarshal(data, &geositeList); err != nil {
+		return nil, err
+	}
+
+	geosites := make(map[string]*router.GeoSite, len(geositeList.Entry))
+	for _, geosite := range geositeList.Entry {
+		name := strings.ToUpper(strings.TrimSpace(geosite.CountryCode))
+		if name == "" {
+			continue
+		}
+		if existing, found := geosites[name]; found {
+			existing.Domain = append(existing.Domain, geosite.Domain...)
+			continue
+		}
+		geosites[name] = geosite
+	}
+
+	var sels []*selector
+	if len(selectors) == 0 {
+		for name := range geosites {
+			sels = append(sels, &selector{name: name, list: name})
+		}
+	}
+	for _, s := range selectors {
+		sel, err := parseSelector(s)
+		if err != nil {
+			return nil, err
+		}
+		if _, found := geosites[sel.list]; !found {
+			return nil, fmt.Errorf("list %s not found", sel.list)
+		}
+		sels = append(sels, sel)
+	}
+	slices.SortFunc(sels, func(a, b *selector) int {
+		return strings.Compare(a.name, b.name)
+	})
+	sels = slices.CompactFunc(sels, func(a, b *selector) bool {
+		return a.name == b.name
+	})
+
+	m := &Matcher{
+		lists:  make([]string, 0, len(sels)),
+		full:   make(map[string][]int),
+		domain: make(map[string][]int),
+	}
+	for idx, sel := range sels {
+		m.lists = append(m.lists, sel.name)
+		for _, rule := range geosites[sel.list].Domain {
+			if !sel.selects(rule) {
+				continue
+			}
+			if err := m.add(idx, rule); err != nil {
+				return nil, fmt.Errorf("list %s: %w", sel.name, err)
+			}
+		}
+	}
+
+	return m, nil
+}
+
+func (m *Matcher) add(idx int, rule *router.Domain) error {
+	switch rule.Type {
+	case router.Domain_Full:
+		m.full[rule.Value] = appendIndex(m.full[rule.Value], idx)
+	case router.Domain_RootDomain:
+		m.domain[rule.Value] = appendIndex(m.domain[rule.Value], idx)
+	case router.Domain_Plain:
+		m.keywords = append(m.keywords, keywordRule{keyword: rule.Value, list: idx})
+	case router.Domain_Regex:
+		re, err := regexp.Compile(rule.Value)
+		if err != nil {
+			return err
+		}
+		m.regexps = append(m.regexps, regexpRule{re: re, list: idx})
+	default:
+		return errors.New("unknown domain type: " + rule.Type.String())
+	}
+	return nil
+}
+
+// appendIndex appends idx to indexes unless it is already the last one, as
+// rules are added list by list.
+func appendIndex(indexes []int, idx int) []int {
+	if n := len(indexes); n > 0 && indexes[n-1] == idx {
+		return indexes
+	}
+	return append(indexes, idx)
+}
+
+// Match returns the names of the lists containing the domain, sorted by
+// name, or nil if none does. A domain rule "example.com" matches the domain
+// "example.com" and all of its subdomains.
+func (m *Matcher) Match(domain string) []string {
+	domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+	if domain == "" {
+		return nil
+	}
+
+	var hits []int
+	hits = append(hits, m.full[domain]...)
+	for suffix := domain; ; {
+		hits = append(hits, m.domain[suffix]...)
+		dot := strings.IndexByte(suffix, '.')
+		if dot < 0 {
+			break
+		}
+		suffix = suffix[dot+1:]
+	}
+	for _, rule := range m.keywords {
+		if strings.Contains(domain, rule.keyword) {
+			hits = append(hits, rule.list)
+		}
+	}
+	for _, rule := range m.regexps {
+		if rule.re.MatchString(domain) {
+			hits = append(hits, rule.list)
+		}
+	}
+	if len(hits) == 0 {
+		return nil
+	}
+
+	// Lists are sorted by name, so are their indexes
+	slices.Sort(hits)
+	hits = slices.Compact(hits)
+	names := make([]string, len(hits))
+	for i, idx := range hits {
+		names[i] = m.lists[idx]
+	}
+	return names
+}
+
+// Contains reports whether the list, or the selector in the format of
+// "list@attr", contains the domain.
+func (m *Matcher) Contains(list, domain string) bool {
+	sel, err := parseSelector(list)
+	if err != nil {
+		return false
+	}
+	_, found := slices.BinarySearch(m.Match(domain), sel.name)
+	return found
+}
+
+// Lists returns the names of all loaded lists or selectors, sorted by name.
+func (m *Matcher) Lists() []string {
+	return slices.Clone(m.lists)
+}